@@ -0,0 +1,260 @@
+package aggregator
+
+import (
+    "os"
+    "log"
+    "sync"
+    "time"
+    "path/filepath"
+    "encoding/gob"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+)
+
+const (
+    // ModeCount is ModeCount
+    ModeCount string = "count"
+    // ModeRate is ModeRate
+    ModeRate string = "rate"
+    // ModeAbsence is ModeAbsence
+    ModeAbsence string = "absence"
+)
+
+const (
+    windowInfoSuffix string = ".window"
+)
+
+type window struct {
+    Hits []int64
+    LastMatch int64
+    Absent bool
+    Triggered bool
+}
+
+type windowInfo struct {
+    FileID string
+    Windows map[string]*window
+}
+
+// Aggregator is Aggregator
+type Aggregator struct {
+    callers string
+    windowInfo *windowInfo
+    dirty bool
+    mutex *sync.Mutex
+}
+
+func (a *Aggregator) getWindow(key string) (*window) {
+    w, ok := a.windowInfo.Windows[key]
+    if !ok {
+        w = &window{
+            Hits: make([]int64, 0),
+            LastMatch: 0,
+            Absent: false,
+            Triggered: false,
+        }
+        a.windowInfo.Windows[key] = w
+    }
+    return w
+}
+
+func (a *Aggregator) pruneHits(w *window, windowSec int64, now int64) {
+    i := 0
+    for ; i < len(w.Hits); i++ {
+        if w.Hits[i] > now - windowSec {
+            break
+        }
+    }
+    if i > 0 {
+        w.Hits = w.Hits[i:]
+    }
+}
+
+// Match is record a match and report whether it should be notified
+// in absence mode it reports whether the pattern has recovered from absence
+func (a *Aggregator) Match(key string, aggregation *configurator.Aggregation, now time.Time) (bool) {
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+    if aggregation == nil {
+        return true
+    }
+    w := a.getWindow(key)
+    a.dirty = true
+    switch aggregation.Mode {
+    case ModeCount:
+        w.Hits = append(w.Hits, now.Unix())
+        a.pruneHits(w, aggregation.Window, now.Unix())
+        if int64(len(w.Hits)) < aggregation.Count {
+            return false
+        }
+        w.Hits = w.Hits[:0]
+        return true
+    case ModeRate:
+        if aggregation.Window <= 0 {
+            log.Printf("invalid window of rate aggregation (%v, %v)", key, aggregation.Window)
+            return true
+        }
+        w.Hits = append(w.Hits, now.Unix())
+        a.pruneHits(w, aggregation.Window, now.Unix())
+        rate := float64(len(w.Hits)) / float64(aggregation.Window)
+        if rate <= aggregation.Rate {
+            return false
+        }
+        w.Hits = w.Hits[:0]
+        return true
+    case ModeAbsence:
+        return a.seen(w, now)
+    default:
+        log.Printf("unexpected aggregation mode (%v, %v)", key, aggregation.Mode)
+        return true
+    }
+}
+
+func (a *Aggregator) seen(w *window, now time.Time) (bool) {
+    recovered := w.Absent
+    w.LastMatch = now.Unix()
+    w.Absent = false
+    a.dirty = true
+    return recovered
+}
+
+// Seen is record an activity and report whether it has recovered from absence
+func (a *Aggregator) Seen(key string, now time.Time) (bool) {
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+    return a.seen(a.getWindow(key), now)
+}
+
+// Absent is report whether activity has just become absent for duration seconds
+func (a *Aggregator) Absent(key string, duration int64, now time.Time) (bool) {
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+    w := a.getWindow(key)
+    if w.LastMatch == 0 {
+        // start counting from first check
+        w.LastMatch = now.Unix()
+        a.dirty = true
+        return false
+    }
+    if w.Absent || now.Unix() - w.LastMatch < duration {
+        return false
+    }
+    w.Absent = true
+    a.dirty = true
+    return true
+}
+
+// Count is record a hit and report count of hits within window seconds
+func (a *Aggregator) Count(key string, windowSec int64, now time.Time) (int64) {
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+    w := a.getWindow(key)
+    w.Hits = append(w.Hits, now.Unix())
+    a.pruneHits(w, windowSec, now.Unix())
+    a.dirty = true
+    return int64(len(w.Hits))
+}
+
+// Trigger is record that pattern has been notified
+func (a *Aggregator) Trigger(key string) {
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+    w := a.getWindow(key)
+    if w.Triggered {
+        return
+    }
+    w.Triggered = true
+    a.dirty = true
+}
+
+// Resolve is report whether notified pattern is resolved
+func (a *Aggregator) Resolve(key string) (bool) {
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+    w := a.getWindow(key)
+    if !w.Triggered {
+        return false
+    }
+    w.Triggered = false
+    a.dirty = true
+    return true
+}
+
+// Load is load window info
+func (a *Aggregator) Load(savePrefix string, fileID string) (error) {
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+    a.windowInfo = &windowInfo{
+        FileID: fileID,
+        Windows: make(map[string]*window),
+    }
+    infoFilePath := filepath.Join(savePrefix, a.callers, fileID + windowInfoSuffix)
+    _, err := os.Stat(infoFilePath)
+    if err != nil {
+        return nil
+    }
+    file, err := os.Open(infoFilePath)
+    if err != nil {
+        return errors.Wrapf(err, "can not read window info (%v)", infoFilePath)
+    }
+    defer file.Close()
+    dec := gob.NewDecoder(file)
+    newWindowInfo := new(windowInfo)
+    err = dec.Decode(newWindowInfo)
+    if err != nil {
+        os.Remove(infoFilePath)
+        return errors.Wrapf(err, "can not decode window info (%v)", infoFilePath)
+    }
+    if newWindowInfo.Windows == nil {
+        newWindowInfo.Windows = make(map[string]*window)
+    }
+    a.windowInfo = newWindowInfo
+    return nil
+}
+
+// Save is save window info
+func (a *Aggregator) Save(savePrefix string) (error) {
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+    if a.windowInfo == nil || !a.dirty {
+        return nil
+    }
+    infoFileDir := filepath.Join(savePrefix, a.callers)
+    _, err := os.Stat(infoFileDir)
+    if err != nil {
+       err := os.MkdirAll(infoFileDir, 0755)
+       if err != nil {
+           return errors.Wrapf(err, "can not create directory (%v)", infoFileDir)
+       }
+    }
+    infoFilePath := filepath.Join(infoFileDir, a.windowInfo.FileID + windowInfoSuffix)
+    file, err := os.Create(infoFilePath)
+    if err != nil {
+        return errors.Wrapf(err, "can not create window info (%v)", infoFilePath)
+    }
+    defer file.Close()
+    enc := gob.NewEncoder(file)
+    err = enc.Encode(a.windowInfo)
+    if err != nil {
+        return errors.Wrapf(err, "can not encode window info (%v)", infoFilePath)
+    }
+    a.dirty = false
+    return nil
+}
+
+// Loaded is loaded
+func (a *Aggregator) Loaded() (bool) {
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+    return a.windowInfo != nil
+}
+
+// NewAggregator is create new aggregator
+func NewAggregator(callers string) (*Aggregator) {
+    return &Aggregator {
+        callers: callers,
+        windowInfo: nil,
+        dirty: false,
+        mutex: new(sync.Mutex),
+    }
+}
@@ -0,0 +1,169 @@
+package aggregator
+
+import (
+    "time"
+    "testing"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+)
+
+func newTestAggregator() (*Aggregator) {
+    aggregator := NewAggregator("test")
+    aggregator.windowInfo = &windowInfo{
+        FileID: "file",
+        Windows: make(map[string]*window),
+    }
+    return aggregator
+}
+
+func TestMatch(t *testing.T) {
+    start := time.Unix(1767225600, 0)
+    tests := []struct {
+        name string
+        aggregation *configurator.Aggregation
+        offsets []int64
+        expected []bool
+    }{
+        {
+            "no aggregation",
+            nil,
+            []int64{ 0, 0 },
+            []bool{ true, true },
+        },
+        {
+            "count",
+            &configurator.Aggregation{ Mode: ModeCount, Count: 3, Window: 10 },
+            []int64{ 0, 1, 2, 3, 4, 5 },
+            []bool{ false, false, true, false, false, true },
+        },
+        {
+            "count out of window",
+            &configurator.Aggregation{ Mode: ModeCount, Count: 3, Window: 10 },
+            []int64{ 0, 5, 10, 16, 17 },
+            []bool{ false, false, false, false, true },
+        },
+        {
+            "rate",
+            &configurator.Aggregation{ Mode: ModeRate, Rate: 0.2, Window: 10 },
+            []int64{ 0, 1, 2, 3, 20 },
+            []bool{ false, false, true, false, false },
+        },
+        {
+            "rate out of window",
+            &configurator.Aggregation{ Mode: ModeRate, Rate: 0.2, Window: 10 },
+            []int64{ 0, 5, 10, 15, 20 },
+            []bool{ false, false, false, false, false },
+        },
+        {
+            "absence",
+            &configurator.Aggregation{ Mode: ModeAbsence, Duration: 10 },
+            []int64{ 0, 1 },
+            []bool{ false, false },
+        },
+        {
+            "unexpected mode",
+            &configurator.Aggregation{ Mode: "unknown" },
+            []int64{ 0 },
+            []bool{ true },
+        },
+    }
+    for _, test := range tests {
+        aggregator := newTestAggregator()
+        for i, offset := range test.offsets {
+            matched := aggregator.Match("key", test.aggregation, start.Add(time.Duration(offset) * time.Second))
+            if matched != test.expected[i] {
+                t.Errorf("%v: unexpected match (%v, %v, %v)", test.name, i, matched, test.expected[i])
+            }
+        }
+    }
+}
+
+func TestAbsence(t *testing.T) {
+    start := time.Unix(1767225600, 0)
+    aggregation := &configurator.Aggregation{ Mode: ModeAbsence, Duration: 10 }
+    tests := []struct {
+        name string
+        offset int64
+        match bool
+        expected bool
+    }{
+        // first check starts counting
+        { "first check", 0, false, false },
+        { "within duration", 9, false, false },
+        { "absent", 10, false, true },
+        { "already absent", 20, false, false },
+        { "recovered", 21, true, true },
+        { "matched again", 22, true, false },
+        { "within duration after recovery", 31, false, false },
+        { "absent again", 32, false, true },
+    }
+    aggregator := newTestAggregator()
+    for _, test := range tests {
+        now := start.Add(time.Duration(test.offset) * time.Second)
+        var result bool
+        if test.match {
+            result = aggregator.Match("key", aggregation, now)
+        } else {
+            result = aggregator.Absent("key", aggregation.Duration, now)
+        }
+        if result != test.expected {
+            t.Errorf("%v: unexpected result (%v, %v)", test.name, result, test.expected)
+        }
+    }
+}
+
+func TestTriggerAndResolve(t *testing.T) {
+    aggregator := newTestAggregator()
+    if aggregator.Resolve("key") {
+        t.Errorf("pattern that is not notified is resolved")
+    }
+    aggregator.Trigger("key")
+    aggregator.Trigger("key")
+    if !aggregator.Resolve("key") {
+        t.Errorf("notified pattern is not resolved")
+    }
+    if aggregator.Resolve("key") {
+        t.Errorf("pattern is resolved twice")
+    }
+}
+
+func TestSaveAndLoad(t *testing.T) {
+    savePrefix := t.TempDir()
+    start := time.Unix(1767225600, 0)
+    aggregation := &configurator.Aggregation{ Mode: ModeCount, Count: 3, Window: 10 }
+    aggregator := NewAggregator("test")
+    err := aggregator.Load(savePrefix, "file")
+    if err != nil {
+        t.Fatalf("can not load: %v", err)
+    }
+    aggregator.Match("count", aggregation, start)
+    aggregator.Match("count", aggregation, start.Add(time.Second))
+    aggregator.Absent("absence", 10, start)
+    aggregator.Absent("absence", 10, start.Add(10 * time.Second))
+    aggregator.Trigger("trigger")
+    err = aggregator.Save(savePrefix)
+    if err != nil {
+        t.Fatalf("can not save: %v", err)
+    }
+    loaded := NewAggregator("test")
+    err = loaded.Load(savePrefix, "file")
+    if err != nil {
+        t.Fatalf("can not load: %v", err)
+    }
+    if !loaded.Match("count", aggregation, start.Add(2 * time.Second)) {
+        t.Errorf("hits are not restored")
+    }
+    if !loaded.Seen("absence", start.Add(11 * time.Second)) {
+        t.Errorf("absence is not restored")
+    }
+    if !loaded.Resolve("trigger") {
+        t.Errorf("trigger is not restored")
+    }
+    other := NewAggregator("test")
+    err = other.Load(savePrefix, "other")
+    if err != nil {
+        t.Fatalf("can not load: %v", err)
+    }
+    if len(other.windowInfo.Windows) != 0 {
+        t.Errorf("windows of other file are loaded (%v)", len(other.windowInfo.Windows))
+    }
+}
@@ -1,4 +1,17 @@
 #!/bin/bash
 go build -buildmode=plugin matcher.go
+cd replayer
+./build.sh
+cd ..
 cd notifier_plugins/mailsender
 ./build.sh
+cd ../webhook
+./build.sh
+cd ../chat
+./build.sh
+cd ../incident
+./build.sh
+cd ../exec
+./build.sh
+cd ../syslog
+./build.sh
@@ -1,14 +1,61 @@
 package configurator
 
+// Retry is Retry
+// failed notification is retried with exponential backoff from interval seconds up to max_interval seconds
+// and it is moved to dead letter directory after max_attempts attempts
+type Retry struct {
+    MaxAttempts int64 `json:"max_attempts" yaml:"max_attempts" toml:"max_attempts"`
+    Interval int64 `json:"interval" yaml:"interval" toml:"interval"`
+    MaxInterval int64 `json:"max_interval" yaml:"max_interval" toml:"max_interval"`
+}
+
 // Notifier is Notifier
 type Notifier struct {
     Name string `json:"name" yaml:"name" toml:"name"`
     Config string `json:"config" yaml:"config" toml:"config"`
+    Retry *Retry `json:"retry" yaml:"retry" toml:"retry"`
+}
+
+// Aggregation is Aggregation
+// mode is one of "count", "rate" and "absence"
+//   count: notify when count matches occur within window seconds
+//   rate: notify when matches per second within window seconds exceed rate
+//   absence: notify when pattern has not matched for duration seconds
+//            and notify again when pattern matches after that
+type Aggregation struct {
+    Mode string `json:"mode" yaml:"mode" toml:"mode"`
+    Count int64 `json:"count" yaml:"count" toml:"count"`
+    Window int64 `json:"window" yaml:"window" toml:"window"`
+    Rate float64 `json:"rate" yaml:"rate" toml:"rate"`
+    Duration int64 `json:"duration" yaml:"duration" toml:"duration"`
 }
 
 // MsgMatcher is MsgMatcher
+// severity is one of "critical", "error", "warning" and "info"
+// recovery_pattern resolves notified pattern when it matches in the same file
 type MsgMatcher struct {
     Pattern string `json:"pattern" yaml:"pattern" toml:"pattern"`
+    Severity string `json:"severity" yaml:"severity" toml:"severity"`
+    RecoveryPattern string `json:"recovery_pattern" yaml:"recovery_pattern" toml:"recovery_pattern"`
+    Aggregation *Aggregation `json:"aggregation" yaml:"aggregation" toml:"aggregation"`
+}
+
+// Grouping is Grouping
+// matched lines are collected into a batch that is notified after interval seconds
+// or when count lines are collected, and the label is silenced for cooldown seconds
+// after a batch is notified. identical lines are deduplicated (digits are masked with normalize)
+type Grouping struct {
+    Interval int64 `json:"interval" yaml:"interval" toml:"interval"`
+    Count int64 `json:"count" yaml:"count" toml:"count"`
+    Normalize bool `json:"normalize" yaml:"normalize" toml:"normalize"`
+    Cooldown int64 `json:"cooldown" yaml:"cooldown" toml:"cooldown"`
+}
+
+// Heartbeat is Heartbeat
+// notify when the file has not been written for duration seconds
+// and notify again when the file is written after that
+type Heartbeat struct {
+    Duration int64 `json:"duration" yaml:"duration" toml:"duration"`
 }
 
 // PathMatcher is Matcher
@@ -16,15 +63,53 @@ type PathMatcher struct {
     Pattern string `json:"pattern" yaml:"pattern" toml:"pattern"`
     SkipNotify bool `json:"skip_notify" yaml:"skip_notify" toml:"skip_notify"`
     Label string `json:"label" yaml:"label" toml:"label"`
+    Severity string `json:"severity" yaml:"severity" toml:"severity"`
+    Grouping *Grouping `json:"grouping" yaml:"grouping" toml:"grouping"`
+    Heartbeat *Heartbeat `json:"heartbeat" yaml:"heartbeat" toml:"heartbeat"`
     MsgMatchers []*MsgMatcher `json:"msg_matchers" yaml:"msg_matchers" toml:"msg_matchers"`
     Notifiers []*Notifier `json:"notifiers" yaml:"notifiers" toml:"notifiers"`
 }
 
+// Schedule is Schedule
+// days are "mon" to "sun" (every day when empty), start and end are "HH:MM" in time_zone
+// and end before start means the schedule continues over midnight
+type Schedule struct {
+    TimeZone string `json:"time_zone" yaml:"time_zone" toml:"time_zone"`
+    Days []string `json:"days" yaml:"days" toml:"days"`
+    Start string `json:"start" yaml:"start" toml:"start"`
+    End string `json:"end" yaml:"end" toml:"end"`
+}
+
+// Escalation is Escalation
+// notifiers also receive notifications while the route fires count times within window seconds
+type Escalation struct {
+    Count int64 `json:"count" yaml:"count" toml:"count"`
+    Window int64 `json:"window" yaml:"window" toml:"window"`
+    Notifiers []*Notifier `json:"notifiers" yaml:"notifiers" toml:"notifiers"`
+}
+
+// Route is Route
+// routes are evaluated in order and the first matched route is used unless continue is set,
+// notifiers of path matcher are used when no route is matched.
+// empty labels matches every label, outside_schedule matches outside of schedule (nights, weekends)
+type Route struct {
+    Name string `json:"name" yaml:"name" toml:"name"`
+    Labels []string `json:"labels" yaml:"labels" toml:"labels"`
+    MinSeverity string `json:"min_severity" yaml:"min_severity" toml:"min_severity"`
+    Schedule *Schedule `json:"schedule" yaml:"schedule" toml:"schedule"`
+    OutsideSchedule bool `json:"outside_schedule" yaml:"outside_schedule" toml:"outside_schedule"`
+    Continue bool `json:"continue" yaml:"continue" toml:"continue"`
+    Notifiers []*Notifier `json:"notifiers" yaml:"notifiers" toml:"notifiers"`
+    Escalation *Escalation `json:"escalation" yaml:"escalation" toml:"escalation"`
+}
+
 // Config is Config
 type Config struct {
     SavePrefix string `json:"save_prefix" yaml:"save_prefix" toml:"save_prefix"`
     AutoReload int64 `json:"auto_reload" yaml:"auto_reload" toml:"auto_reload"`
+    CheckInterval int64 `json:"check_interval" yaml:"check_interval" toml:"check_interval"`
     NotifierPluginPath string  `json:"notifier_plugin_path" yaml:"notifier_plugin_path" toml:"notifier_plugin_path"`
     SkipNotify bool `json:"skip_notify" yaml:"skip_notify" toml:"skip_notify"`
     PathMatchers []*PathMatcher `json:"path_matchers" yaml:"path_matchers" toml:"path_matchers"`
+    Routes []*Route `json:"routes" yaml:"routes" toml:"routes"`
 }
@@ -4,14 +4,21 @@ import (
     "os"
     "log"
     "io"
-    "regexp"
+    "fmt"
     "bufio"
-    "path"
+    "bytes"
+    "sync"
+    "time"
     "path/filepath"
     "encoding/gob"
     "github.com/pkg/errors"
     "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/aggregator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/grouper"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifiercache"
     "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifyqueue"
+    "github.com/potix/log_monitor/actor_plugins/matcher/rulemanager"
 )
 
 type fileInfo struct {
@@ -23,12 +30,19 @@ type fileInfo struct {
 // FileChecker is FileChecker
 type FileChecker struct {
     callers string
-    config *configurator.Config
+    host string
+    ruleSet *rulemanager.RuleSet
+    ruleSetMutex *sync.Mutex
     fileInfo *fileInfo
+    aggregator *aggregator.Aggregator
+    grouper *grouper.Grouper
+    notifierCache *notifiercache.NotifierCache
+    notifyQueue *notifyqueue.NotifyQueue
+    now func() (time.Time)
 }
 
 func (f * FileChecker)loadFileInfo(fileID string) (error) {
-    infoFilePath := filepath.Join(f.config.SavePrefix, f.callers, fileID)
+    infoFilePath := filepath.Join(f.ruleSet.Config.SavePrefix, f.callers, fileID)
     _, err := os.Stat(infoFilePath)
     if err != nil {
         return nil
@@ -50,7 +64,7 @@ func (f * FileChecker)loadFileInfo(fileID string) (error) {
 }
 
 func (f *FileChecker)saveFileInfo(fileID string) (error) {
-    infoFileDir := filepath.Join(f.config.SavePrefix, f.callers)
+    infoFileDir := filepath.Join(f.ruleSet.Config.SavePrefix, f.callers)
     _, err := os.Stat(infoFileDir)
     if err != nil {
        err := os.MkdirAll(infoFileDir, 0755)
@@ -72,32 +86,221 @@ func (f *FileChecker)saveFileInfo(fileID string) (error) {
     return nil
 }
 
-func (f *FileChecker)callNotify(data []byte, fileID string, fileName string, pathMatcher *configurator.PathMatcher) (error) {
-    notifierPlugins := make([]notifierplugger.NotifierPlugin, 0, len(pathMatcher.Notifiers))
-    for _, notifier := range pathMatcher.Notifiers {
-        pluginFilePath, pluginNewFunc, ok := notifierplugger.GetNotifierPlugin(notifier.Name)
-        if !ok {
-            return errors.Errorf("not found notifier plugin (%v)", notifier.Name)
+func (f *FileChecker)escalate(route *rulemanager.Route, event *notifierplugger.Event) (bool) {
+    escalation := route.Route.Escalation
+    key := "escalation/" + route.Key + "/" + event.Label + "/" + event.Pattern
+    if event.Action == notifierplugger.EventResolve {
+        // resolve is also sent to escalation notifiers if it has been escalated
+        return f.aggregator.Resolve(key)
+    }
+    if f.aggregator.Count(key, escalation.Window, f.now()) < escalation.Count {
+        return false
+    }
+    f.aggregator.Trigger(key)
+    return true
+}
+
+func (f *FileChecker)routeNotifiers(event *notifierplugger.Event, pathMatcher *configurator.PathMatcher) ([]*configurator.Notifier) {
+    f.ruleSetMutex.Lock()
+    ruleSet := f.ruleSet
+    f.ruleSetMutex.Unlock()
+    routes := ruleSet.GetRoutes(event.Label, event.Severity, f.now())
+    if len(routes) == 0 {
+        return pathMatcher.Notifiers
+    }
+    notifiers := make([]*configurator.Notifier, 0)
+    for _, route := range routes {
+        notifiers = append(notifiers, route.Route.Notifiers...)
+        if route.Route.Escalation == nil || !f.escalate(route, event) {
+            continue
+        }
+        log.Printf("escalated (%v, %v, %v)", route.Key, event.Label, event.Pattern)
+        notifiers = append(notifiers, route.Route.Escalation.Notifiers...)
+    }
+    return notifiers
+}
+
+func (f *FileChecker)callNotify(event *notifierplugger.Event, pathMatcher *configurator.PathMatcher) {
+    f.notifyQueue.Enqueue(event, f.routeNotifiers(event, pathMatcher))
+}
+
+// notifyBatch is notify grouped matches, patterns are carried so that resolve of each pattern finds the batch
+func (f *FileChecker)notifyBatch(summary []byte, severity string, patterns []string, fileID string, fileName string, pathMatcher *configurator.PathMatcher) {
+    pattern := ""
+    if len(patterns) == 1 {
+        pattern = patterns[0]
+    }
+    event := &notifierplugger.Event{
+        Action: notifierplugger.EventTrigger,
+        Msg: summary,
+        FileID: fileID,
+        FileName: fileName,
+        Label: pathMatcher.Label,
+        Severity: severity,
+        Pattern: pattern,
+        Patterns: patterns,
+        Host: f.host,
+    }
+    f.callNotify(event, pathMatcher)
+    log.Printf("queued batch (%v)", pathMatcher.Label)
+}
+
+func (f *FileChecker)aggregationKey(pathMatcher *configurator.PathMatcher, matcher *configurator.MsgMatcher) (string) {
+    return pathMatcher.Label + "/" + matcher.Pattern
+}
+
+func (f *FileChecker)notify(action string, msg []byte, severity string, pattern string, fileID string, fileName string, pathMatcher *configurator.PathMatcher) {
+    if f.ruleSet.Config.SkipNotify || pathMatcher.SkipNotify {
+        return
+    }
+    event := &notifierplugger.Event{
+        Action: action,
+        Msg: msg,
+        FileID: fileID,
+        FileName: fileName,
+        Label: pathMatcher.Label,
+        Severity: severity,
+        Pattern: pattern,
+        Patterns: nil,
+        Host: f.host,
+    }
+    f.callNotify(event, pathMatcher)
+    log.Printf("queued %v (%v, %v, %v)", action, pathMatcher.Label, fileName, pattern)
+}
+
+func (f *FileChecker)checkAbsence(fileID string, fileName string, rule *rulemanager.Rule) {
+    now := f.now()
+    for _, msgRule := range rule.MsgRules {
+        matcher := msgRule.MsgMatcher
+        if matcher.Aggregation == nil || matcher.Aggregation.Mode != aggregator.ModeAbsence {
+            continue
+        }
+        if !f.aggregator.Absent(f.aggregationKey(rule.PathMatcher, matcher), matcher.Aggregation.Duration, now) {
+            continue
         }
-        configPath := path.Join(filepath.Dir(pluginFilePath), notifier.Config)
-        plugin, err := pluginNewFunc(f.callers, configPath)
+        msg := fmt.Sprintf("pattern has not matched for %v seconds (%v)\n", matcher.Aggregation.Duration, matcher.Pattern)
+        f.notify(notifierplugger.EventTrigger, []byte(msg), msgRule.Severity, matcher.Pattern, fileID, fileName, rule.PathMatcher)
+    }
+}
+
+func (f *FileChecker)checkHeartbeat(written bool, fileID string, fileName string, rule *rulemanager.Rule) {
+    pathMatcher := rule.PathMatcher
+    if pathMatcher.Heartbeat == nil {
+        return
+    }
+    now := f.now()
+    key := pathMatcher.Label
+    if written {
+        if !f.aggregator.Seen(key, now) {
+            return
+        }
+        msg := fmt.Sprintf("file has been written again (%v)\n", fileName)
+        f.notify(notifierplugger.EventResolve, []byte(msg), rule.Severity, "", fileID, fileName, pathMatcher)
+        return
+    }
+    if !f.aggregator.Absent(key, pathMatcher.Heartbeat.Duration, now) {
+        return
+    }
+    msg := fmt.Sprintf("file has not been written for %v seconds (%v)\n", pathMatcher.Heartbeat.Duration, fileName)
+    f.notify(notifierplugger.EventTrigger, []byte(msg), rule.Severity, "", fileID, fileName, pathMatcher)
+}
+
+func (f *FileChecker)prepare(fileID string, fileName string, ruleSet *rulemanager.RuleSet) {
+    f.ruleSetMutex.Lock()
+    f.ruleSet = ruleSet
+    f.ruleSetMutex.Unlock()
+    f.notifierCache.Sync(ruleSet)
+    f.notifyQueue.Sync(ruleSet)
+    if !f.notifyQueue.Loaded() {
+        err := f.notifyQueue.Load(ruleSet.Config.SavePrefix, fileID)
         if err != nil {
-            return errors.Wrapf(err, "can not create plugin (%v, %v)",  notifier.Name, configPath )
+            log.Printf("can not load notify queue (%v, %v): %v", fileName, fileID, err)
         }
-        notifierPlugins = append(notifierPlugins, plugin)
     }
-    for _, notifierPlugin := range notifierPlugins {
-        notifierPlugin.Notify(data, fileID, fileName, pathMatcher.Label)
+    if !f.aggregator.Loaded() {
+        err := f.aggregator.Load(ruleSet.Config.SavePrefix, fileID)
+        if err != nil {
+            log.Printf("can not load window info (%v, %v): %v", fileName, fileID, err)
+        }
     }
-    return nil
+}
+
+func (f *FileChecker)complete(written bool, fileID string, fileName string, ruleSet *rulemanager.RuleSet, rule *rulemanager.Rule) {
+    f.checkAbsence(fileID, fileName, rule)
+    f.checkHeartbeat(written, fileID, fileName, rule)
+    saveErr := f.aggregator.Save(ruleSet.Config.SavePrefix)
+    if saveErr != nil {
+        log.Printf("can not save window info: %v", saveErr)
+    }
+    f.notifierCache.Flush()
 }
 
 // Check is check
-func (f *FileChecker)Check(fileID string, trackLinkFile string, fileName string, pathMatcher *configurator.PathMatcher) (error) {
+func (f *FileChecker)Check(fileID string, trackLinkFile string, fileName string, ruleSet *rulemanager.RuleSet, rule *rulemanager.Rule) (error) {
+    f.prepare(fileID, fileName, ruleSet)
+    written, err := f.checkLines(fileID, trackLinkFile, fileName, rule)
+    f.complete(written, fileID, fileName, ruleSet, rule)
+    return err
+}
+
+// CheckData is check lines of data instead of reading file, it is used when logs are not local files
+// data should end at line boundary, absence and heartbeat are checked even if data is empty
+func (f *FileChecker)CheckData(fileID string, fileName string, data []byte, ruleSet *rulemanager.RuleSet, rule *rulemanager.Rule) {
+    f.prepare(fileID, fileName, ruleSet)
+    for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+        if len(line) == 0 {
+            continue
+        }
+        if line[len(line) - 1] != '\n' {
+            line = append(line[:len(line):len(line)], '\n')
+        }
+        f.checkLine(line, fileID, fileName, rule)
+    }
+    f.complete(len(data) > 0, fileID, fileName, ruleSet, rule)
+}
+
+// checkLine is check line that has trailing newline
+func (f *FileChecker)checkLine(data []byte, fileID string, fileName string, rule *rulemanager.Rule) {
+    pathMatcher := rule.PathMatcher
+    trimData := data[:len(data) -1]
+    for _, msgRule := range rule.MsgRules {
+        matcher := msgRule.MsgMatcher
+        key := f.aggregationKey(pathMatcher, matcher)
+        if msgRule.RecoveryRegexp != nil && msgRule.RecoveryRegexp.Match(trimData) && f.aggregator.Resolve(key) {
+            msg := fmt.Sprintf("pattern has been resolved (%v)\n", matcher.Pattern)
+            f.notify(notifierplugger.EventResolve, []byte(msg + string(data)), msgRule.Severity, matcher.Pattern, fileID, fileName, pathMatcher)
+            continue
+        }
+        if !msgRule.Regexp.Match(trimData) {
+            continue
+        }
+        if !f.aggregator.Match(key, matcher.Aggregation, f.now()) {
+            continue
+        }
+        if matcher.Aggregation != nil && matcher.Aggregation.Mode == aggregator.ModeAbsence {
+            msg := fmt.Sprintf("pattern has matched again (%v)\n", matcher.Pattern)
+            f.notify(notifierplugger.EventResolve, []byte(msg + string(data)), msgRule.Severity, matcher.Pattern, fileID, fileName, pathMatcher)
+            continue
+        }
+        if f.ruleSet.Config.SkipNotify || pathMatcher.SkipNotify {
+            continue
+        }
+        if msgRule.RecoveryRegexp != nil {
+            f.aggregator.Trigger(key)
+        }
+        if pathMatcher.Grouping != nil {
+            f.grouper.Add(data, msgRule.Severity, matcher.Pattern, fileID, fileName, pathMatcher)
+            continue
+        }
+        f.notify(notifierplugger.EventTrigger, data, msgRule.Severity, matcher.Pattern, fileID, fileName, pathMatcher)
+    }
+}
+
+func (f *FileChecker)checkLines(fileID string, trackLinkFile string, fileName string, rule *rulemanager.Rule) (bool, error) {
     if f.fileInfo == nil {
         err := f.loadFileInfo(fileID)
         if err != nil {
-            return errors.Wrapf(err, "can not load file info (%v, %v)", fileName, fileID)
+            return false, errors.Wrapf(err, "can not load file info (%v, %v)", fileName, fileID)
         }
         if f.fileInfo == nil {
             f.fileInfo = &fileInfo{
@@ -113,20 +316,20 @@ func (f *FileChecker)Check(fileID string, trackLinkFile string, fileName string,
     }
     fi, err := os.Stat(trackLinkFile)
     if err != nil {
-        return errors.Wrapf(err, "not found trackLinkFile (%v)", trackLinkFile)
+        return false, errors.Wrapf(err, "not found trackLinkFile (%v)", trackLinkFile)
     }
     if fi.Size() <= f.fileInfo.Pos {
-        return nil
+        return false, nil
     }
     oldPos := f.fileInfo.Pos
     file, err := os.Open(trackLinkFile)
     if err != nil {
-        return errors.Wrapf(err, "can not open trackLinkFile (%v)", trackLinkFile)
+        return false, errors.Wrapf(err, "can not open trackLinkFile (%v)", trackLinkFile)
     }
     defer file.Close()
     _, err = file.Seek(f.fileInfo.Pos, 0)
     if err != nil {
-        return errors.Wrapf(err, "can not seek trackLinkFile (%v)", trackLinkFile)
+        return false, errors.Wrapf(err, "can not seek trackLinkFile (%v)", trackLinkFile)
     }
     reader := bufio.NewReader(file)
     for {
@@ -137,42 +340,50 @@ func (f *FileChecker)Check(fileID string, trackLinkFile string, fileName string,
             }
             break
         }
-        trimData := data[:len(data) -1]
-        for _, matcher := range pathMatcher.MsgMatchers {
-            matched, err := regexp.Match(matcher.Pattern, trimData)
-            if err != nil {
-                log.Printf("can not macth message (%v, %v): %v", matcher.Pattern, string(data), err)
-            }
-            if !matched {
-                continue
-            }
-            if f.config.SkipNotify || pathMatcher.SkipNotify {
-                continue
-            }
-            err = f.callNotify(data, fileID, fileName, pathMatcher)
-            if err != nil {
-                log.Printf("can not notify (%v, %v): %v", matcher.Pattern, string(data), err)
-            } else {
-                log.Printf("notified (%v)", matcher.Pattern)
-            }
-        }
+        f.checkLine(data, fileID, fileName, rule)
         f.fileInfo.Pos += int64(len(data))
     }
     if oldPos == f.fileInfo.Pos {
-        return nil
+        return false, nil
     }
     err = f.saveFileInfo(f.fileInfo.FileID)
     if err != nil {
         log.Printf("can not save file info: %v", err)
     }
-    return nil
+    return true, nil
+}
+
+// Start is start
+func (f *FileChecker)Start() {
+    f.notifyQueue.Start()
+    f.grouper.Start()
+}
+
+// Stop is stop
+func (f *FileChecker)Stop() {
+    // batches flushed at stop are queued before the queue stops
+    f.grouper.Stop()
+    f.notifyQueue.Stop()
 }
 
 // NewFileChecker is create new file reader
-func NewFileChecker(callers string, config *configurator.Config) (*FileChecker) {
-    return &FileChecker {
+func NewFileChecker(callers string, notifierCache *notifiercache.NotifierCache) (*FileChecker) {
+    return NewHostFileChecker(callers, "", notifierCache)
+}
+
+// NewHostFileChecker is create new file checker of logs of other host, host is set to events
+func NewHostFileChecker(callers string, host string, notifierCache *notifiercache.NotifierCache) (*FileChecker) {
+    fileChecker := &FileChecker {
         callers: callers,
-        config: config,
+        host: host,
+        ruleSet: nil,
+        ruleSetMutex: new(sync.Mutex),
         fileInfo: nil,
+        aggregator: aggregator.NewAggregator(callers),
+        notifierCache: notifierCache,
+        notifyQueue: notifyqueue.NewNotifyQueue(callers, notifierCache),
+        now: time.Now,
     }
+    fileChecker.grouper = grouper.NewGrouper(callers, fileChecker.notifyBatch)
+    return fileChecker
 }
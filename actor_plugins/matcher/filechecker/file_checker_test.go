@@ -0,0 +1,228 @@
+package filechecker
+
+import (
+    "time"
+    "regexp"
+    "strings"
+    "testing"
+    "path/filepath"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifiercache"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifyqueue"
+    "github.com/potix/log_monitor/actor_plugins/matcher/rulemanager"
+)
+
+const (
+    testFileID string = "file1"
+)
+
+type clock struct {
+    now time.Time
+}
+
+func (c *clock) get() (time.Time) {
+    return c.now
+}
+
+func (c *clock) advance(seconds int64) {
+    c.now = c.now.Add(time.Duration(seconds) * time.Second)
+}
+
+func newTestRuleSet(t *testing.T, pathMatcher *configurator.PathMatcher, routes ...*rulemanager.Route) (*rulemanager.RuleSet, *rulemanager.Rule) {
+    msgRules := make([]*rulemanager.MsgRule, 0, len(pathMatcher.MsgMatchers))
+    for _, msgMatcher := range pathMatcher.MsgMatchers {
+        var recoveryRegexp *regexp.Regexp
+        if msgMatcher.RecoveryPattern != "" {
+            recoveryRegexp = regexp.MustCompile(msgMatcher.RecoveryPattern)
+        }
+        severity := msgMatcher.Severity
+        if severity == "" {
+            severity = notifierplugger.SeverityError
+        }
+        msgRules = append(msgRules, &rulemanager.MsgRule{
+            MsgMatcher: msgMatcher,
+            Regexp: regexp.MustCompile(msgMatcher.Pattern),
+            RecoveryRegexp: recoveryRegexp,
+            Severity: severity,
+        })
+    }
+    rule := &rulemanager.Rule{
+        PathMatcher: pathMatcher,
+        Regexp: regexp.MustCompile(pathMatcher.Pattern),
+        MsgRules: msgRules,
+        Severity: notifierplugger.SeverityError,
+    }
+    ruleSet := &rulemanager.RuleSet{
+        Config: &configurator.Config{
+            SavePrefix: t.TempDir(),
+        },
+        Rules: []*rulemanager.Rule{ rule },
+        Routes: routes,
+    }
+    return ruleSet, rule
+}
+
+func newTestFileChecker(c *clock) (*FileChecker) {
+    fileChecker := NewFileChecker("test", notifiercache.NewNotifierCache("test"))
+    fileChecker.now = c.get
+    return fileChecker
+}
+
+// queued is get queued notifications, the queue is not started so they are kept on disk
+func queued(t *testing.T, ruleSet *rulemanager.RuleSet) ([]*notifyqueue.Item) {
+    items, err := notifyqueue.LoadItems(filepath.Join(ruleSet.Config.SavePrefix, "test", "queue", testFileID))
+    if err != nil {
+        t.Fatalf("can not load queued notifications: %v", err)
+    }
+    return items
+}
+
+func actions(items []*notifyqueue.Item) (string) {
+    result := make([]string, 0, len(items))
+    for _, item := range items {
+        result = append(result, item.NotifierName + ":" + item.Event.Action)
+    }
+    return strings.Join(result, ",")
+}
+
+func TestHeartbeat(t *testing.T) {
+    c := &clock{ now: time.Unix(1767225600, 0) }
+    ruleSet, rule := newTestRuleSet(t, &configurator.PathMatcher{
+        Pattern: "app",
+        Label: "app",
+        Heartbeat: &configurator.Heartbeat{ Duration: 60 },
+        Notifiers: []*configurator.Notifier{ &configurator.Notifier{ Name: "test" } },
+    })
+    fileChecker := newTestFileChecker(c)
+    tests := []struct {
+        name string
+        advance int64
+        data string
+        expected string
+    }{
+        { "first check", 0, "", "" },
+        { "within duration", 59, "", "" },
+        { "not written", 1, "", "test:trigger" },
+        { "still not written", 60, "", "test:trigger" },
+        { "written again", 1, "line\n", "test:trigger,test:resolve" },
+        { "written", 1, "line\n", "test:trigger,test:resolve" },
+        { "not written again", 60, "", "test:trigger,test:resolve,test:trigger" },
+    }
+    for _, test := range tests {
+        c.advance(test.advance)
+        fileChecker.CheckData(testFileID, "app.log", []byte(test.data), ruleSet, rule)
+        items := queued(t, ruleSet)
+        if actions(items) != test.expected {
+            t.Fatalf("%v: unexpected notifications (%v, %v)", test.name, actions(items), test.expected)
+        }
+    }
+    items := queued(t, ruleSet)
+    if msg := string(items[0].Event.Msg); msg != "file has not been written for 60 seconds (app.log)\n" {
+        t.Errorf("unexpected trigger message (%q)", msg)
+    }
+    if msg := string(items[1].Event.Msg); msg != "file has been written again (app.log)\n" {
+        t.Errorf("unexpected resolve message (%q)", msg)
+    }
+}
+
+func TestRecovery(t *testing.T) {
+    c := &clock{ now: time.Unix(1767225600, 0) }
+    ruleSet, rule := newTestRuleSet(t, &configurator.PathMatcher{
+        Pattern: "app",
+        Label: "app",
+        MsgMatchers: []*configurator.MsgMatcher{
+            &configurator.MsgMatcher{ Pattern: "down", RecoveryPattern: "up" },
+            &configurator.MsgMatcher{
+                Pattern: "heartbeat",
+                Aggregation: &configurator.Aggregation{ Mode: "absence", Duration: 60 },
+            },
+        },
+        Notifiers: []*configurator.Notifier{ &configurator.Notifier{ Name: "test" } },
+    })
+    fileChecker := newTestFileChecker(c)
+    tests := []struct {
+        name string
+        advance int64
+        data string
+        expected string
+    }{
+        { "recovery before trigger", 0, "service up\n", "" },
+        { "trigger", 0, "service down\n", "test:trigger" },
+        { "recovery", 1, "service up\n", "test:trigger,test:resolve" },
+        { "recovery after resolve", 1, "service up\n", "test:trigger,test:resolve" },
+        { "absence starts", 0, "", "test:trigger,test:resolve" },
+        { "absent", 60, "", "test:trigger,test:resolve,test:trigger" },
+        { "matched again", 1, "heartbeat\n", "test:trigger,test:resolve,test:trigger,test:resolve" },
+    }
+    for _, test := range tests {
+        c.advance(test.advance)
+        fileChecker.CheckData(testFileID, "app.log", []byte(test.data), ruleSet, rule)
+        items := queued(t, ruleSet)
+        if actions(items) != test.expected {
+            t.Fatalf("%v: unexpected notifications (%v, %v)", test.name, actions(items), test.expected)
+        }
+    }
+    items := queued(t, ruleSet)
+    if msg := string(items[1].Event.Msg); msg != "pattern has been resolved (down)\nservice up\n" {
+        t.Errorf("unexpected resolve message (%q)", msg)
+    }
+    if msg := string(items[3].Event.Msg); msg != "pattern has matched again (heartbeat)\nheartbeat\n" {
+        t.Errorf("unexpected resolve message (%q)", msg)
+    }
+}
+
+func TestRouteAndEscalation(t *testing.T) {
+    c := &clock{ now: time.Unix(1767225600, 0) }
+    oncall := &rulemanager.Route{
+        Route: &configurator.Route{
+            Name: "oncall",
+            MinSeverity: notifierplugger.SeverityError,
+            Notifiers: []*configurator.Notifier{ &configurator.Notifier{ Name: "oncall" } },
+            Escalation: &configurator.Escalation{
+                Count: 3,
+                Window: 60,
+                Notifiers: []*configurator.Notifier{ &configurator.Notifier{ Name: "manager" } },
+            },
+        },
+        Key: "oncall",
+        Labels: map[string]bool{},
+        MinSeverity: notifierplugger.SeverityError,
+        Schedule: nil,
+    }
+    ruleSet, rule := newTestRuleSet(t, &configurator.PathMatcher{
+        Pattern: "app",
+        Label: "app",
+        MsgMatchers: []*configurator.MsgMatcher{
+            &configurator.MsgMatcher{ Pattern: "ERROR", RecoveryPattern: "OK", Severity: notifierplugger.SeverityError },
+            &configurator.MsgMatcher{ Pattern: "WARN", Severity: notifierplugger.SeverityWarning },
+        },
+        Notifiers: []*configurator.Notifier{ &configurator.Notifier{ Name: "default" } },
+    }, oncall)
+    fileChecker := newTestFileChecker(c)
+    tests := []struct {
+        name string
+        advance int64
+        data string
+        expected string
+    }{
+        { "below min severity uses path matcher notifiers", 0, "WARN\n", "default:trigger" },
+        { "first", 0, "ERROR\n", "oncall:trigger" },
+        { "second", 10, "ERROR\n", "oncall:trigger" },
+        { "escalated at count", 10, "ERROR\n", "oncall:trigger,manager:trigger" },
+        { "still escalated", 10, "ERROR\n", "oncall:trigger,manager:trigger" },
+        { "resolve is sent to escalation notifiers", 10, "OK\n", "oncall:resolve,manager:resolve" },
+        { "out of window", 100, "ERROR\n", "oncall:trigger" },
+        { "resolve is not escalated", 10, "OK\n", "oncall:resolve" },
+    }
+    seen := 0
+    for _, test := range tests {
+        c.advance(test.advance)
+        fileChecker.CheckData(testFileID, "app.log", []byte(test.data), ruleSet, rule)
+        items := queued(t, ruleSet)
+        if got := actions(items[seen:]); got != test.expected {
+            t.Fatalf("%v: unexpected notifications (%v, %v)", test.name, got, test.expected)
+        }
+        seen = len(items)
+    }
+}
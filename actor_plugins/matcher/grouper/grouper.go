@@ -0,0 +1,247 @@
+package grouper
+
+import (
+    "fmt"
+    "sync"
+    "time"
+    "bytes"
+    "regexp"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+)
+
+const (
+    defaultInterval int64 = 60
+)
+
+var digitsRegexp = regexp.MustCompile("[0-9]+")
+
+// FlushFunc is FlushFunc
+// patterns is matched patterns of batch in order of first match
+type FlushFunc func(summary []byte, severity string, patterns []string, fileID string, fileName string, pathMatcher *configurator.PathMatcher)
+
+type entry struct {
+    msg []byte
+    count int64
+}
+
+type batch struct {
+    fileID string
+    fileName string
+    pathMatcher *configurator.PathMatcher
+    severity string
+    patterns []string
+    entries []*entry
+    index map[string]*entry
+    total int64
+    created time.Time
+}
+
+// pending is flushed batch, it is notified after mutex is unlocked so that slow notification does not block Add
+type pending struct {
+    summary []byte
+    batch *batch
+}
+
+// Grouper is Grouper
+type Grouper struct {
+    callers string
+    flushFunc FlushFunc
+    batches map[string]*batch
+    cooldowns map[string]time.Time
+    suppressed map[string]int64
+    mutex *sync.Mutex
+    finish chan bool
+}
+
+func (g *Grouper) dedupKey(msg []byte, grouping *configurator.Grouping) (string) {
+    trimMsg := bytes.TrimRight(msg, "\r\n")
+    if grouping.Normalize {
+        return string(digitsRegexp.ReplaceAll(trimMsg, []byte("#")))
+    }
+    return string(trimMsg)
+}
+
+func containsPattern(patterns []string, pattern string) (bool) {
+    for _, p := range patterns {
+        if p == pattern {
+            return true
+        }
+    }
+    return false
+}
+
+func (g *Grouper) summary(label string, b *batch) ([]byte) {
+    buffer := new(bytes.Buffer)
+    fmt.Fprintf(buffer, "%v: %v matches (%v unique) in %v\n", label, b.total, len(b.entries), b.fileName)
+    suppressed := g.suppressed[label]
+    if suppressed > 0 {
+        fmt.Fprintf(buffer, "%v matches suppressed by cooldown\n", suppressed)
+        delete(g.suppressed, label)
+    }
+    for _, e := range b.entries {
+        if e.count > 1 {
+            fmt.Fprintf(buffer, "[x%v] ", e.count)
+        }
+        buffer.Write(bytes.TrimRight(e.msg, "\r\n"))
+        buffer.WriteString("\n")
+    }
+    return buffer.Bytes()
+}
+
+// take is remove batch of label, caller must hold mutex
+func (g *Grouper) take(label string, now time.Time) (*pending) {
+    b, ok := g.batches[label]
+    if !ok {
+        return nil
+    }
+    delete(g.batches, label)
+    if b.pathMatcher.Grouping.Cooldown > 0 {
+        g.cooldowns[label] = now.Add(time.Duration(b.pathMatcher.Grouping.Cooldown) * time.Second)
+    }
+    return &pending{
+        summary: g.summary(label, b),
+        batch: b,
+    }
+}
+
+func (g *Grouper) notify(pendings []*pending) {
+    for _, p := range pendings {
+        g.flushFunc(p.summary, p.batch.severity, p.batch.patterns, p.batch.fileID, p.batch.fileName, p.batch.pathMatcher)
+    }
+}
+
+// Add is add matched line to batch
+func (g *Grouper) Add(msg []byte, severity string, pattern string, fileID string, fileName string, pathMatcher *configurator.PathMatcher) {
+    p := g.add(msg, severity, pattern, fileID, fileName, pathMatcher, time.Now())
+    if p != nil {
+        g.notify([]*pending{ p })
+    }
+}
+
+func (g *Grouper) add(msg []byte, severity string, pattern string, fileID string, fileName string, pathMatcher *configurator.PathMatcher, now time.Time) (*pending) {
+    g.mutex.Lock()
+    defer g.mutex.Unlock()
+    label := pathMatcher.Label
+    until, ok := g.cooldowns[label]
+    if ok {
+        if now.Before(until) {
+            g.suppressed[label]++
+            return nil
+        }
+        delete(g.cooldowns, label)
+    }
+    b, ok := g.batches[label]
+    if !ok {
+        b = &batch{
+            fileID: fileID,
+            fileName: fileName,
+            pathMatcher: pathMatcher,
+            severity: severity,
+            patterns: make([]string, 0, 1),
+            entries: make([]*entry, 0),
+            index: make(map[string]*entry),
+            total: 0,
+            created: now,
+        }
+        g.batches[label] = b
+    }
+    if notifierplugger.SeverityRank(severity) > notifierplugger.SeverityRank(b.severity) {
+        b.severity = severity
+    }
+    if !containsPattern(b.patterns, pattern) {
+        b.patterns = append(b.patterns, pattern)
+    }
+    key := g.dedupKey(msg, pathMatcher.Grouping)
+    e, ok := b.index[key]
+    if ok {
+        e.count++
+    } else {
+        e = &entry{
+            msg: append([]byte(nil), msg...),
+            count: 1,
+        }
+        b.entries = append(b.entries, e)
+        b.index[key] = e
+    }
+    b.total++
+    if pathMatcher.Grouping.Count > 0 && b.total >= pathMatcher.Grouping.Count {
+        return g.take(label, now)
+    }
+    return nil
+}
+
+func (g *Grouper) flushExpired(now time.Time) {
+    g.notify(g.takeExpired(now))
+}
+
+func (g *Grouper) takeExpired(now time.Time) ([]*pending) {
+    g.mutex.Lock()
+    defer g.mutex.Unlock()
+    pendings := make([]*pending, 0)
+    for label, b := range g.batches {
+        interval := b.pathMatcher.Grouping.Interval
+        if interval <= 0 {
+            if b.pathMatcher.Grouping.Count > 0 {
+                continue
+            }
+            interval = defaultInterval
+        }
+        if now.Sub(b.created) < time.Duration(interval) * time.Second {
+            continue
+        }
+        pendings = append(pendings, g.take(label, now))
+    }
+    return pendings
+}
+
+// Flush is flush all batches
+func (g *Grouper) Flush() {
+    g.notify(g.takeAll())
+}
+
+func (g *Grouper) takeAll() ([]*pending) {
+    g.mutex.Lock()
+    defer g.mutex.Unlock()
+    now := time.Now()
+    pendings := make([]*pending, 0, len(g.batches))
+    for label := range g.batches {
+        pendings = append(pendings, g.take(label, now))
+    }
+    return pendings
+}
+
+func (g *Grouper) flushLoop() {
+    for {
+        select {
+        case <-time.After(time.Second):
+            g.flushExpired(time.Now())
+        case <-g.finish:
+            return
+        }
+    }
+}
+
+// Start is start
+func (g *Grouper) Start() {
+    g.finish = make(chan bool)
+    go g.flushLoop()
+}
+
+// Stop is stop
+func (g *Grouper) Stop() {
+    close(g.finish)
+    g.Flush()
+}
+
+// NewGrouper is create new grouper
+func NewGrouper(callers string, flushFunc FlushFunc) (*Grouper) {
+    return &Grouper{
+        callers: callers,
+        flushFunc: flushFunc,
+        batches: make(map[string]*batch),
+        cooldowns: make(map[string]time.Time),
+        suppressed: make(map[string]int64),
+        mutex: new(sync.Mutex),
+    }
+}
@@ -0,0 +1,154 @@
+package grouper
+
+import (
+    "time"
+    "strings"
+    "testing"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+)
+
+type flushed struct {
+    summary string
+    severity string
+    patterns []string
+    label string
+}
+
+type recorder struct {
+    flushes []*flushed
+}
+
+func (r *recorder) flush(summary []byte, severity string, patterns []string, fileID string, fileName string, pathMatcher *configurator.PathMatcher) {
+    r.flushes = append(r.flushes, &flushed{
+        summary: string(summary),
+        severity: severity,
+        patterns: patterns,
+        label: pathMatcher.Label,
+    })
+}
+
+func newTestGrouper() (*Grouper, *recorder) {
+    r := &recorder{ flushes: make([]*flushed, 0) }
+    return NewGrouper("test", r.flush), r
+}
+
+func newPathMatcher(label string, grouping *configurator.Grouping) (*configurator.PathMatcher) {
+    return &configurator.PathMatcher{
+        Label: label,
+        Grouping: grouping,
+    }
+}
+
+func TestDedupKey(t *testing.T) {
+    grouper, _ := newTestGrouper()
+    tests := []struct {
+        msg string
+        normalize bool
+        expected string
+    }{
+        { "error 123 at 10:20\n", false, "error 123 at 10:20" },
+        { "error 123 at 10:20\r\n", true, "error # at #:#" },
+        { "no digits\n", true, "no digits" },
+    }
+    for _, test := range tests {
+        key := grouper.dedupKey([]byte(test.msg), &configurator.Grouping{ Normalize: test.normalize })
+        if key != test.expected {
+            t.Errorf("unexpected dedup key (%q, %q, %q)", test.msg, key, test.expected)
+        }
+    }
+}
+
+func TestBatchesPerLabel(t *testing.T) {
+    grouper, r := newTestGrouper()
+    now := time.Unix(1767225600, 0)
+    grouping := &configurator.Grouping{ Interval: 10, Normalize: true }
+    web := newPathMatcher("web", grouping)
+    db := newPathMatcher("db", grouping)
+    grouper.add([]byte("timeout 1\n"), "warning", "timeout", "f1", "web.log", web, now)
+    grouper.add([]byte("timeout 2\n"), "critical", "timeout", "f1", "web.log", web, now)
+    grouper.add([]byte("refused\n"), "error", "refused", "f1", "web.log", web, now)
+    grouper.add([]byte("deadlock\n"), "error", "deadlock", "f2", "db.log", db, now.Add(5 * time.Second))
+    grouper.flushExpired(now.Add(9 * time.Second))
+    if len(r.flushes) != 0 {
+        t.Fatalf("batch is flushed before interval (%v)", len(r.flushes))
+    }
+    grouper.flushExpired(now.Add(10 * time.Second))
+    if len(r.flushes) != 1 {
+        t.Fatalf("unexpected flushes (%v)", len(r.flushes))
+    }
+    f := r.flushes[0]
+    expected := "web: 3 matches (2 unique) in web.log\n[x2] timeout 1\nrefused\n"
+    if f.label != "web" || f.summary != expected {
+        t.Errorf("unexpected summary (%v, %q)", f.label, f.summary)
+    }
+    if f.severity != "critical" || strings.Join(f.patterns, ",") != "timeout,refused" {
+        t.Errorf("unexpected severity or patterns (%v, %v)", f.severity, f.patterns)
+    }
+    grouper.flushExpired(now.Add(15 * time.Second))
+    if len(r.flushes) != 2 || r.flushes[1].label != "db" {
+        t.Errorf("batch of other label is not flushed separately (%v)", len(r.flushes))
+    }
+}
+
+func TestFlushByCount(t *testing.T) {
+    grouper, r := newTestGrouper()
+    now := time.Unix(1767225600, 0)
+    pathMatcher := newPathMatcher("web", &configurator.Grouping{ Count: 2 })
+    if p := grouper.add([]byte("a\n"), "error", "a", "f1", "web.log", pathMatcher, now); p != nil {
+        t.Errorf("batch is taken before count")
+    }
+    // batch with count is not flushed by default interval
+    grouper.flushExpired(now.Add(time.Hour))
+    p := grouper.add([]byte("b\n"), "error", "a", "f1", "web.log", pathMatcher, now.Add(time.Hour))
+    if p == nil {
+        t.Fatalf("batch is not taken at count")
+    }
+    grouper.notify([]*pending{ p })
+    if len(r.flushes) != 1 || r.flushes[0].summary != "web: 2 matches (2 unique) in web.log\na\nb\n" {
+        t.Errorf("unexpected flushes (%v)", r.flushes)
+    }
+}
+
+func TestCooldown(t *testing.T) {
+    grouper, r := newTestGrouper()
+    pathMatcher := newPathMatcher("web", &configurator.Grouping{ Count: 1, Cooldown: 60 })
+    grouper.Add([]byte("first\n"), "error", "a", "f1", "web.log", pathMatcher)
+    if len(r.flushes) != 1 {
+        t.Fatalf("unexpected flushes (%v)", len(r.flushes))
+    }
+    until := grouper.cooldowns["web"]
+    if p := grouper.add([]byte("second\n"), "error", "a", "f1", "web.log", pathMatcher, until.Add(-time.Second)); p != nil {
+        t.Errorf("batch is taken in cooldown")
+    }
+    grouper.add([]byte("third\n"), "error", "a", "f1", "web.log", pathMatcher, until.Add(-time.Second))
+    p := grouper.add([]byte("fourth\n"), "error", "a", "f1", "web.log", pathMatcher, until)
+    if p == nil {
+        t.Fatalf("batch is not taken after cooldown")
+    }
+    expected := "web: 1 matches (1 unique) in web.log\n2 matches suppressed by cooldown\nfourth\n"
+    if string(p.summary) != expected {
+        t.Errorf("unexpected summary (%q)", p.summary)
+    }
+}
+
+func TestNotifyOutsideMutex(t *testing.T) {
+    done := make(chan bool)
+    var grouper *Grouper
+    other := newPathMatcher("other", &configurator.Grouping{ Interval: 60 })
+    grouper = NewGrouper("test", func(summary []byte, severity string, patterns []string, fileID string, fileName string, pathMatcher *configurator.PathMatcher) {
+        // flush func that adds again deadlocks if it is called with mutex held
+        grouper.Add([]byte("again\n"), "error", "a", "f1", "other.log", other)
+        close(done)
+    })
+    go grouper.Add([]byte("line\n"), "error", "a", "f1", "web.log", newPathMatcher("web", &configurator.Grouping{ Count: 1 }))
+    select {
+    case <-done:
+    case <-time.After(5 * time.Second):
+        t.Fatalf("flush func is called with mutex held")
+    }
+    grouper.mutex.Lock()
+    defer grouper.mutex.Unlock()
+    if _, ok := grouper.batches["other"]; !ok {
+        t.Errorf("line added by flush func is lost")
+    }
+}
@@ -12,6 +12,7 @@ import (
     "github.com/potix/log_monitor/actor_plugins/matcher/filechecker"
     "github.com/potix/log_monitor/actor_plugins/matcher/rulemanager"
     "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifiercache"
 )
 
 type targetInfo struct {
@@ -44,34 +45,44 @@ type fileCheckInfo struct {
     eventCh chan bool
 }
 
+const (
+    defaultCheckInterval int64 = 60
+)
+
 // Matcher is matcher
 type Matcher struct {
     callers string
     configurator *configurator.Configurator
     ruleManager *rulemanager.RuleManager
     fileChecker *filechecker.FileChecker
+    notifierCache *notifiercache.NotifierCache
     targetInfo *targetInfo
     fileCheckInfo *fileCheckInfo
 }
 
 func (m *Matcher) fileCheckLoop() {
     for {
+        checkInterval := defaultCheckInterval
+        if m.ruleManager.GetRuleSet().Config.CheckInterval > 0 {
+            checkInterval = m.ruleManager.GetRuleSet().Config.CheckInterval
+        }
         select {
         case _, ok := <-m.fileCheckInfo.eventCh:
             if !ok {
                return
             }
-        case <-time.After(time.Duration(60) * time.Second):
+        case <-time.After(time.Duration(checkInterval) * time.Second):
         }
         fileID := m.targetInfo.getFileID()
         fileName := m.targetInfo.getFileName()
         trackLinkFilePath := m.targetInfo.getTrackLinkFilePath()
-	pathMatchers := m.ruleManager.GetRule(fileName)
-        if pathMatchers == nil {
+        ruleSet := m.ruleManager.GetRuleSet()
+	rule := ruleSet.GetRule(fileName)
+        if rule == nil {
             log.Printf("not found rule for target (%v)", fileName)
             continue
         }
-        err := m.fileChecker.Check(fileID, trackLinkFilePath, fileName, pathMatchers)
+        err := m.fileChecker.Check(fileID, trackLinkFilePath, fileName, ruleSet, rule)
         if err != nil {
 	    log.Printf("can not check file (%v, %v, %v): %v", fileID, trackLinkFilePath, fileName, err)
         }
@@ -79,11 +90,16 @@ func (m *Matcher) fileCheckLoop() {
 }
 
 func (m *Matcher) initialize(fileName string, fileID string, trackLinkFilePath string) {
-    pathMatchers := m.ruleManager.GetRule(fileName)
-    if pathMatchers == nil {
+    rule := m.ruleManager.GetRuleSet().GetRule(fileName)
+    if rule == nil {
         log.Printf("not found rule for target (%v)", fileName)
         return
     }
+    err := m.ruleManager.Start()
+    if err != nil {
+        log.Printf("can not start rule manager (%v): %v", fileName, err)
+        return
+    }
     m.targetInfo = &targetInfo{
         fileNameMutex: new(sync.Mutex),
         fileName: fileName,
@@ -93,13 +109,15 @@ func (m *Matcher) initialize(fileName string, fileID string, trackLinkFilePath s
     m.fileCheckInfo = &fileCheckInfo{
         eventCh: make(chan bool),
     }
-    m.ruleManager.Start()
+    m.fileChecker.Start()
     go m.fileCheckLoop()
 }
 
 func (m *Matcher) finalize(fileName string, fileID string, trackLinkFilePath string) {
     close(m.fileCheckInfo.eventCh)
+    m.fileChecker.Stop()
     m.ruleManager.Stop()
+    m.notifierCache.Clear()
 }
 
 // FoundFile is add file
@@ -154,14 +172,16 @@ func NewMatcher(callers string, configFile string) (actorplugger.ActorPlugin, er
     }
     log.Printf("config = %v", config)
     newCallers := callers + ".matcher"
-    ruleManager, err := rulemanager.NewRuleManager(config, configurator)
+    notifierCache := notifiercache.NewNotifierCache(newCallers)
+    ruleManager, err := rulemanager.GetRuleManager(configFile, configurator)
     if (err != nil) {
-        return nil, errors.Wrapf(err, "can not create rule manager")
+        return nil, errors.Wrapf(err, "can not get rule manager")
     }
     return &Matcher {
         callers: newCallers,
         configurator: configurator,
-        fileChecker: filechecker.NewFileChecker(newCallers, config),
+        fileChecker: filechecker.NewFileChecker(newCallers, notifierCache),
+        notifierCache: notifierCache,
         ruleManager: ruleManager,
         targetInfo: nil,
         fileCheckInfo: nil,
@@ -0,0 +1,2 @@
+#!/bin/bash
+go build -buildmode=plugin chat.go
@@ -0,0 +1,450 @@
+package main
+
+import (
+    "os"
+    "fmt"
+    "log"
+    "sync"
+    "time"
+    "bytes"
+    "regexp"
+    "strings"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/templater"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifier_plugins/chat/utility"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifier_plugins/chat/configurator"
+)
+
+const (
+        defaultTimeout int64 = 10
+        defaultMinInterval int64 = 1
+        defaultMaxAttachments int64 = 20
+        defaultMaxQueue int64 = 1000
+        defaultColor string = "#439FE0"
+        drainTimeout time.Duration = 10 * time.Second
+        maxRetryInterval time.Duration = 5 * time.Minute
+)
+
+var defaultSeverities = []*configurator.Severity{
+        &configurator.Severity{
+                Name: "critical",
+                Pattern: "(?i)(emerg|alert|crit|fatal|panic)",
+                Color: "danger",
+        },
+        &configurator.Severity{
+                Name: "error",
+                Pattern: "(?i)err",
+                Color: "danger",
+        },
+        &configurator.Severity{
+                Name: "warning",
+                Pattern: "(?i)warn",
+                Color: "warning",
+        },
+}
+
+type severity struct {
+        name string
+        regexp *regexp.Regexp
+        color string
+}
+
+// pending is message waiting for sending, sealed message is failed message
+// that is retried as it is, new attachments are not merged into it
+type pending struct {
+        channel string
+        attachments []*utility.Attachment
+        dropped int64
+        sealed bool
+}
+
+// Chat is Chat
+type Chat struct {
+        callers string
+        config *configurator.Config
+        webhookClient *utility.WebhookClient
+        hostname string
+        titleTemplate *templater.Template
+        textTemplate *templater.Template
+        severities []*severity
+        channels map[string]string
+        minInterval time.Duration
+        maxAttachments int64
+        maxQueue int64
+        queue []*pending
+        queueMutex *sync.Mutex
+        stopped bool
+        lastError error
+        retryInterval time.Duration
+        nextSend time.Time
+        finish chan bool
+        finished chan bool
+}
+
+func (c *Chat) escape(text string) (string) {
+        r := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "```", "'''")
+        return r.Replace(text)
+}
+
+func (c *Chat) getSeverity(msg []byte, severityName string) (string, string) {
+        if severityName != "" {
+                for _, s := range c.severities {
+                        if s.name == severityName {
+                                return s.name, s.color
+                        }
+                }
+                return severityName, defaultColor
+        }
+        for _, s := range c.severities {
+                if s.regexp.Match(msg) {
+                        return s.name, s.color
+                }
+        }
+        return "info", defaultColor
+}
+
+func (c *Chat) getChannel(label string) (string) {
+        channel, ok := c.channels[label]
+        if ok {
+                return channel
+        }
+        return c.config.Channel
+}
+
+func (c *Chat) enqueue(channel string, attachment *utility.Attachment) (error) {
+        c.queueMutex.Lock()
+        defer c.queueMutex.Unlock()
+        if c.stopped {
+                return errors.Errorf("chat is stopped (%v)", channel)
+        }
+        if c.lastError != nil {
+                // notify queue retries it while webhook is failing
+                return errors.Wrapf(c.lastError, "chat webhook is failing, retry later (%v)", channel)
+        }
+        var p *pending
+        for _, q := range c.queue {
+                if q.channel == channel && !q.sealed {
+                        p = q
+                        break
+                }
+        }
+        if p == nil {
+                p = &pending{
+                        channel: channel,
+                        attachments: make([]*utility.Attachment, 0),
+                        dropped: 0,
+                        sealed: false,
+                }
+                c.queue = append(c.queue, p)
+        }
+        p.attachments = append(p.attachments, attachment)
+        if int64(len(p.attachments)) > c.maxQueue {
+                p.attachments = p.attachments[1:]
+                p.dropped++
+        }
+        return nil
+}
+
+func (c *Chat) dequeue() (*pending) {
+        c.queueMutex.Lock()
+        defer c.queueMutex.Unlock()
+        if len(c.queue) == 0 {
+                return nil
+        }
+        p := c.queue[0]
+        if int64(len(p.attachments)) <= c.maxAttachments {
+                c.queue = c.queue[1:]
+                return p
+        }
+        // merge up to max attachments into one message
+        merged := &pending{
+                channel: p.channel,
+                attachments: p.attachments[:c.maxAttachments],
+                dropped: p.dropped,
+                sealed: false,
+        }
+        p.attachments = p.attachments[c.maxAttachments:]
+        p.dropped = 0
+        // move to tail for fairness between channels
+        c.queue = append(c.queue[1:], p)
+        return merged
+}
+
+// requeue is put failed message back to head, it is sealed so that it keeps its attachments
+func (c *Chat) requeue(p *pending) {
+        c.queueMutex.Lock()
+        defer c.queueMutex.Unlock()
+        p.sealed = true
+        c.queue = append([]*pending{p}, c.queue...)
+}
+
+func (c *Chat) setLastError(err error) {
+        c.queueMutex.Lock()
+        defer c.queueMutex.Unlock()
+        c.lastError = err
+}
+
+func (c *Chat) send(p *pending) (time.Duration, error) {
+        payload := &utility.Payload{
+                Channel: p.channel,
+                Username: c.config.Username,
+                IconEmoji: c.config.IconEmoji,
+                IconURL: c.config.IconURL,
+                Attachments: p.attachments,
+        }
+        if len(p.attachments) > 1 {
+                payload.Text = fmt.Sprintf("%v messages", len(p.attachments))
+        }
+        if p.dropped > 0 {
+                payload.Text += fmt.Sprintf(" (%v messages dropped)", p.dropped)
+        }
+        return c.webhookClient.Post(payload)
+}
+
+func (c *Chat) sendNext() (bool) {
+        if time.Now().Before(c.nextSend) {
+                return true
+        }
+        p := c.dequeue()
+        if p == nil {
+                return false
+        }
+        retryAfter, err := c.send(p)
+        if err != nil {
+                c.requeue(p)
+                if retryAfter > 0 {
+                        c.nextSend = time.Now().Add(retryAfter)
+                        log.Printf("can not send chat message, retry later (%v): %v", p.channel, err)
+                        return true
+                }
+                // failed message is kept and retried with backoff, new messages are refused meanwhile
+                c.setLastError(err)
+                if c.retryInterval < c.minInterval {
+                        c.retryInterval = c.minInterval
+                } else {
+                        c.retryInterval *= 2
+                }
+                if c.retryInterval > maxRetryInterval {
+                        c.retryInterval = maxRetryInterval
+                }
+                c.nextSend = time.Now().Add(c.retryInterval)
+                log.Printf("can not send chat message, retry after %v (%v, %v attachments): %v", c.retryInterval, p.channel, len(p.attachments), err)
+                return true
+        }
+        c.setLastError(nil)
+        c.retryInterval = 0
+        c.nextSend = time.Now().Add(c.minInterval)
+        return true
+}
+
+// drain is send queued messages at stop until deadline, rate limited messages are dropped after deadline
+func (c *Chat) drain(deadline time.Time) {
+        for c.sendNext() {
+                wait := c.nextSend.Sub(time.Now())
+                if time.Now().Add(wait).After(deadline) {
+                        break
+                }
+                time.Sleep(wait)
+        }
+        c.queueMutex.Lock()
+        defer c.queueMutex.Unlock()
+        dropped := 0
+        for _, p := range c.queue {
+                dropped += len(p.attachments)
+        }
+        if dropped > 0 {
+                log.Printf("chat messages are dropped at stop (%v messages)", dropped)
+        }
+}
+
+func (c *Chat) sendLoop() {
+        defer close(c.finished)
+        for {
+                select {
+                case <-c.finish:
+                        c.drain(time.Now().Add(drainTimeout))
+                        return
+                case <-time.After(c.minInterval):
+                        c.sendNext()
+                }
+        }
+}
+
+// Start is start
+func (c *Chat) Start() (error) {
+        c.finish = make(chan bool)
+        c.finished = make(chan bool)
+        go c.sendLoop()
+        return nil
+}
+
+// Stop is stop
+func (c *Chat) Stop() {
+        c.queueMutex.Lock()
+        c.stopped = true
+        c.queueMutex.Unlock()
+        close(c.finish)
+        <-c.finished
+}
+
+// Flush is flush
+func (c *Chat) Flush() {
+}
+
+// Notify is notify
+func (c *Chat) Notify(msg []byte, fileID string, fileName string, label string) (error) {
+        return c.NotifyEvent(&notifierplugger.Event{
+                Action: notifierplugger.EventTrigger,
+                Msg: msg,
+                FileID: fileID,
+                FileName: fileName,
+                Label: label,
+                Severity: "",
+                Pattern: "",
+        })
+}
+
+// NotifyEvent is notify event, message is queued and sent in background
+// it returns error while webhook is failing so that notify queue retries the event
+func (c *Chat) NotifyEvent(event *notifierplugger.Event) (error) {
+        trimMsg := string(bytes.TrimRight(event.Msg, "\r\n"))
+        severityName, color := c.getSeverity(event.Msg, event.Severity)
+        if event.Action == notifierplugger.EventResolve {
+                color = "good"
+        }
+        params := templater.NewParams(event)
+        params.Severity = severityName
+        // logs of other host are reported with their host
+        host := c.hostname
+        if event.Host != "" {
+                host = event.Host
+        }
+        title := event.Label
+        if c.titleTemplate != nil {
+                newTitle, err := c.titleTemplate.Execute(params)
+                if err != nil {
+                        return errors.Wrapf(err, "can not create title (%v)", event.Label)
+                }
+                title = newTitle
+        }
+        text := "```\n" + c.escape(trimMsg) + "\n```"
+        if c.textTemplate != nil {
+                newText, err := c.textTemplate.Execute(params)
+                if err != nil {
+                        return errors.Wrapf(err, "can not create text (%v)", event.Label)
+                }
+                text = c.escape(newText)
+        }
+        attachment := &utility.Attachment{
+                Fallback: fmt.Sprintf("[%v] %v: %v", event.Label, event.FileName, trimMsg),
+                Color: color,
+                Title: title,
+                Text: text,
+                Fields: []*utility.Field{
+                        &utility.Field{ Title: "Label", Value: c.escape(event.Label), Short: true },
+                        &utility.Field{ Title: "Severity", Value: severityName, Short: true },
+                        &utility.Field{ Title: "File", Value: c.escape(event.FileName), Short: true },
+                        &utility.Field{ Title: "Host", Value: c.escape(host), Short: true },
+                },
+                MrkdwnIn: []string{"text"},
+                Ts: params.Time.Unix(),
+        }
+        return c.enqueue(c.getChannel(event.Label), attachment)
+}
+
+// NewChat is create new chat notifier
+func NewChat(callers string, configFile string) (notifierplugger.NotifierPlugin, error) {
+    log.Printf("configFile = %v", configFile)
+    hostname, err := os.Hostname()
+    if err != nil {
+        return nil, errors.Wrap(err, "can not get hostname")
+    }
+    configurator, err := configurator.NewConfigurator(configFile)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not create configurator (%v)", configFile)
+    }
+    config, err := configurator.Load()
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not load config (%v)", configFile)
+    }
+    if config.WebhookURL == "" {
+        return nil, errors.Errorf("no webhook url (%v)", configFile)
+    }
+    // config is not logged because webhook url is a secret
+    log.Printf("channel = %v", config.Channel)
+    configSeverities := config.Severities
+    if len(configSeverities) == 0 {
+        configSeverities = defaultSeverities
+    }
+    severities := make([]*severity, 0, len(configSeverities))
+    for _, s := range configSeverities {
+        re, err := regexp.Compile(s.Pattern)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not compile severity pattern (%v)", s.Pattern)
+        }
+        severities = append(severities, &severity{
+            name: s.Name,
+            regexp: re,
+            color: s.Color,
+        })
+    }
+    var titleTemplate *templater.Template
+    if config.TitleTemplate != "" {
+        titleTemplate, err = templater.New("title_template", config.TitleTemplate, nil)
+        if err != nil {
+            return nil, errors.Wrapf(err, "invalid title template (%v)", configFile)
+        }
+    }
+    var textTemplate *templater.Template
+    if config.TextTemplate != "" {
+        textTemplate, err = templater.New("text_template", config.TextTemplate, nil)
+        if err != nil {
+            return nil, errors.Wrapf(err, "invalid text template (%v)", configFile)
+        }
+    }
+    channels := make(map[string]string)
+    for _, channel := range config.Channels {
+        channels[channel.Label] = channel.Channel
+    }
+    timeout := defaultTimeout
+    if config.Timeout > 0 {
+        timeout = config.Timeout
+    }
+    minInterval := defaultMinInterval
+    if config.MinInterval > 0 {
+        minInterval = config.MinInterval
+    }
+    maxAttachments := defaultMaxAttachments
+    if config.MaxAttachments > 0 {
+        maxAttachments = config.MaxAttachments
+    }
+    maxQueue := defaultMaxQueue
+    if config.MaxQueue > 0 {
+        maxQueue = config.MaxQueue
+    }
+    newCallers := callers + ".chat"
+    return &Chat {
+        callers: newCallers,
+        config: config,
+        webhookClient: utility.NewWebhookClient(config.WebhookURL, time.Duration(timeout) * time.Second),
+        hostname: hostname,
+        titleTemplate: titleTemplate,
+        textTemplate: textTemplate,
+        severities: severities,
+        channels: channels,
+        minInterval: time.Duration(minInterval) * time.Second,
+        maxAttachments: maxAttachments,
+        maxQueue: maxQueue,
+        queue: make([]*pending, 0),
+        queueMutex: new(sync.Mutex),
+        stopped: false,
+        lastError: nil,
+        retryInterval: 0,
+    }, nil
+}
+
+// GetNotifierPluginInfo is GetNotifierPluginInfo
+func GetNotifierPluginInfo() (string, notifierplugger.NotifierPluginNewFunc) {
+    return "chat", NewChat
+}
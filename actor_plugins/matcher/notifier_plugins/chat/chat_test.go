@@ -0,0 +1,244 @@
+package main
+
+import (
+    "sync"
+    "time"
+    "testing"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "encoding/json"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifier_plugins/chat/utility"
+)
+
+type response struct {
+    status int
+    retryAfter string
+}
+
+type stubServer struct {
+    *httptest.Server
+    mutex *sync.Mutex
+    payloads []*utility.Payload
+    responses []*response
+}
+
+// newStubServer is create webhook stub that replies responses in order and 200 after them
+func newStubServer(responses ...*response) (*stubServer) {
+    s := &stubServer{
+        mutex: new(sync.Mutex),
+        payloads: make([]*utility.Payload, 0),
+        responses: responses,
+    }
+    s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        payload := new(utility.Payload)
+        json.NewDecoder(r.Body).Decode(payload)
+        s.mutex.Lock()
+        defer s.mutex.Unlock()
+        s.payloads = append(s.payloads, payload)
+        if len(s.responses) == 0 {
+            w.WriteHeader(http.StatusOK)
+            return
+        }
+        res := s.responses[0]
+        s.responses = s.responses[1:]
+        if res.retryAfter != "" {
+            w.Header().Set("Retry-After", res.retryAfter)
+        }
+        w.WriteHeader(res.status)
+    }))
+    return s
+}
+
+func (s *stubServer) received() ([]*utility.Payload) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    return append([]*utility.Payload(nil), s.payloads...)
+}
+
+func newTestChat(t *testing.T, url string, config string) (*Chat) {
+    configFile := filepath.Join(t.TempDir(), "chat.toml")
+    err := ioutil.WriteFile(configFile, []byte("webhook_url = \"" + url + "\"\nchannel = \"#alerts\"\n" + config), 0644)
+    if err != nil {
+        t.Fatalf("can not write config: %v", err)
+    }
+    notifier, err := NewChat("test", configFile)
+    if err != nil {
+        t.Fatalf("can not create chat: %v", err)
+    }
+    return notifier.(*Chat)
+}
+
+func testEvent(label string, msg string) (*notifierplugger.Event) {
+    return &notifierplugger.Event{
+        Action: notifierplugger.EventTrigger,
+        Msg: []byte(msg + "\n"),
+        FileID: "id1",
+        FileName: "/var/log/app.log",
+        Label: label,
+        Severity: "error",
+        Pattern: "ERROR",
+        Host: "web1",
+    }
+}
+
+func notify(t *testing.T, chat *Chat, label string, msgs ...string) {
+    for _, msg := range msgs {
+        err := chat.NotifyEvent(testEvent(label, msg))
+        if err != nil {
+            t.Fatalf("can not notify (%v): %v", msg, err)
+        }
+    }
+}
+
+// sendNow is send next message ignoring interval
+func sendNow(chat *Chat) (bool) {
+    chat.nextSend = time.Time{}
+    return chat.sendNext()
+}
+
+func fallbacks(payload *utility.Payload) ([]string) {
+    result := make([]string, 0, len(payload.Attachments))
+    for _, attachment := range payload.Attachments {
+        result = append(result, attachment.Fallback)
+    }
+    return result
+}
+
+func checkPayload(t *testing.T, payload *utility.Payload, channel string, text string, msgs ...string) {
+    if payload.Channel != channel || payload.Text != text {
+        t.Errorf("unexpected payload (%v, %q)", payload.Channel, payload.Text)
+    }
+    got := fallbacks(payload)
+    if len(got) != len(msgs) {
+        t.Errorf("unexpected attachments (%v, %v)", got, msgs)
+        return
+    }
+    for i, msg := range msgs {
+        if got[i] != "[app] /var/log/app.log: " + msg && got[i] != "[db] /var/log/app.log: " + msg {
+            t.Errorf("unexpected attachment (%v, %v)", got[i], msg)
+        }
+    }
+}
+
+func TestMergeAttachments(t *testing.T) {
+    server := newStubServer()
+    defer server.Close()
+    chat := newTestChat(t, server.URL, "max_attachments = 2\n[[ channels ]]\n  label = \"db\"\n  channel = \"#db\"\n")
+    notify(t, chat, "app", "a1", "a2", "a3")
+    notify(t, chat, "db", "d1")
+    for i := 0; i < 3; i++ {
+        if !sendNow(chat) {
+            t.Fatalf("queue is empty (%v)", i)
+        }
+    }
+    if sendNow(chat) {
+        t.Errorf("queue is not empty")
+    }
+    payloads := server.received()
+    if len(payloads) != 3 {
+        t.Fatalf("unexpected payloads (%v)", len(payloads))
+    }
+    checkPayload(t, payloads[0], "#alerts", "2 messages", "a1", "a2")
+    // channel of remaining attachments is moved to tail
+    checkPayload(t, payloads[1], "#db", "", "d1")
+    checkPayload(t, payloads[2], "#alerts", "", "a3")
+}
+
+func TestMaxQueueDropsOldest(t *testing.T) {
+    server := newStubServer()
+    defer server.Close()
+    chat := newTestChat(t, server.URL, "max_queue = 2\n")
+    notify(t, chat, "app", "a1", "a2", "a3")
+    sendNow(chat)
+    payloads := server.received()
+    if len(payloads) != 1 {
+        t.Fatalf("unexpected payloads (%v)", len(payloads))
+    }
+    checkPayload(t, payloads[0], "#alerts", "2 messages (1 messages dropped)", "a2", "a3")
+}
+
+func TestRateLimited(t *testing.T) {
+    server := newStubServer(&response{ status: http.StatusTooManyRequests, retryAfter: "7" })
+    defer server.Close()
+    chat := newTestChat(t, server.URL, "")
+    notify(t, chat, "app", "a1")
+    before := time.Now()
+    sendNow(chat)
+    if wait := chat.nextSend.Sub(before); wait < 7 * time.Second || wait > 8 * time.Second {
+        t.Errorf("retry after is not honored (%v)", wait)
+    }
+    if !chat.sendNext() {
+        t.Errorf("message is lost while rate limited")
+    }
+    if len(server.received()) != 1 {
+        t.Errorf("message is sent before retry after")
+    }
+    // rate limit is not failure, new message is queued after requeued message
+    notify(t, chat, "app", "a2")
+    sendNow(chat)
+    sendNow(chat)
+    payloads := server.received()
+    if len(payloads) != 3 {
+        t.Fatalf("unexpected payloads (%v)", len(payloads))
+    }
+    checkPayload(t, payloads[1], "#alerts", "", "a1")
+    checkPayload(t, payloads[2], "#alerts", "", "a2")
+}
+
+func TestFailedMessageIsKept(t *testing.T) {
+    server := newStubServer(&response{ status: http.StatusInternalServerError }, &response{ status: http.StatusBadGateway })
+    defer server.Close()
+    chat := newTestChat(t, server.URL, "")
+    notify(t, chat, "app", "a1", "a2")
+    sendNow(chat)
+    if chat.retryInterval != time.Second {
+        t.Errorf("unexpected retry interval (%v)", chat.retryInterval)
+    }
+    // new message is refused so that notify queue retries it
+    err := chat.NotifyEvent(testEvent("app", "a3"))
+    if err == nil {
+        t.Errorf("message is accepted while webhook is failing")
+    }
+    sendNow(chat)
+    if chat.retryInterval != 2 * time.Second {
+        t.Errorf("retry interval is not backed off (%v)", chat.retryInterval)
+    }
+    sendNow(chat)
+    if chat.lastError != nil || chat.retryInterval != 0 {
+        t.Errorf("failure is not cleared (%v, %v)", chat.lastError, chat.retryInterval)
+    }
+    notify(t, chat, "app", "a3")
+    sendNow(chat)
+    payloads := server.received()
+    if len(payloads) != 4 {
+        t.Fatalf("unexpected payloads (%v)", len(payloads))
+    }
+    for i := 0; i < 3; i++ {
+        checkPayload(t, payloads[i], "#alerts", "2 messages", "a1", "a2")
+    }
+    checkPayload(t, payloads[3], "#alerts", "", "a3")
+}
+
+func TestDrainOnStop(t *testing.T) {
+    server := newStubServer()
+    defer server.Close()
+    chat := newTestChat(t, server.URL, "min_interval = 60\n")
+    err := chat.Start()
+    if err != nil {
+        t.Fatalf("can not start: %v", err)
+    }
+    notify(t, chat, "app", "a1", "a2")
+    chat.Stop()
+    payloads := server.received()
+    if len(payloads) != 1 {
+        t.Fatalf("queue is not drained at stop (%v)", len(payloads))
+    }
+    checkPayload(t, payloads[0], "#alerts", "2 messages", "a1", "a2")
+    err = chat.NotifyEvent(testEvent("app", "a3"))
+    if err == nil {
+        t.Errorf("message is accepted after stop")
+    }
+}
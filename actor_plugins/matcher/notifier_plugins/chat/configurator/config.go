@@ -0,0 +1,33 @@
+package configurator
+
+// Severity is Severity
+// color is "good", "warning", "danger" or hex color code
+type Severity struct {
+        Name    string `json:"name"    yaml:"name"    toml:"name"`
+        Pattern string `json:"pattern" yaml:"pattern" toml:"pattern"`
+        Color   string `json:"color"   yaml:"color"   toml:"color"`
+}
+
+// Channel is channel override for label
+type Channel struct {
+        Label   string `json:"label"   yaml:"label"   toml:"label"`
+        Channel string `json:"channel" yaml:"channel" toml:"channel"`
+}
+
+// Config is Config
+// title_template and text_template are text/template of templater, text is escaped after execution
+type Config struct {
+        WebhookURL     string      `json:"webhook_url"     yaml:"webhook_url"     toml:"webhook_url"`
+        Channel        string      `json:"channel"         yaml:"channel"         toml:"channel"`
+        Username       string      `json:"username"        yaml:"username"        toml:"username"`
+        IconEmoji      string      `json:"icon_emoji"      yaml:"icon_emoji"      toml:"icon_emoji"`
+        IconURL        string      `json:"icon_url"        yaml:"icon_url"        toml:"icon_url"`
+        TitleTemplate  string      `json:"title_template"  yaml:"title_template"  toml:"title_template"`
+        TextTemplate   string      `json:"text_template"   yaml:"text_template"   toml:"text_template"`
+        Timeout        int64       `json:"timeout"         yaml:"timeout"         toml:"timeout"`
+        MinInterval    int64       `json:"min_interval"    yaml:"min_interval"    toml:"min_interval"`
+        MaxAttachments int64       `json:"max_attachments" yaml:"max_attachments" toml:"max_attachments"`
+        MaxQueue       int64       `json:"max_queue"       yaml:"max_queue"       toml:"max_queue"`
+        Severities     []*Severity `json:"severities"      yaml:"severities"      toml:"severities"`
+        Channels       []*Channel  `json:"channels"        yaml:"channels"        toml:"channels"`
+}
@@ -0,0 +1,88 @@
+package utility
+
+import (
+	"github.com/pkg/errors"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Field is attachment field
+type Field struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// Attachment is Slack/Mattermost compatible attachment
+type Attachment struct {
+	Fallback   string   `json:"fallback"`
+	Color      string   `json:"color,omitempty"`
+	Title      string   `json:"title,omitempty"`
+	Text       string   `json:"text"`
+	Fields     []*Field `json:"fields,omitempty"`
+	MrkdwnIn   []string `json:"mrkdwn_in,omitempty"`
+	Ts         int64    `json:"ts,omitempty"`
+}
+
+// Payload is Slack/Mattermost compatible incoming webhook payload
+type Payload struct {
+	Channel     string        `json:"channel,omitempty"`
+	Username    string        `json:"username,omitempty"`
+	IconEmoji   string        `json:"icon_emoji,omitempty"`
+	IconURL     string        `json:"icon_url,omitempty"`
+	Text        string        `json:"text,omitempty"`
+	Attachments []*Attachment `json:"attachments"`
+}
+
+// WebhookClient is incoming webhook client
+type WebhookClient struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// Post is post payload, retry after duration is returned when it is rate limited
+func (w *WebhookClient) Post(payload *Payload) (time.Duration, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, errors.Wrap(err, "can not marshal payload")
+	}
+	response, err := w.client.Post(w.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// url.Error has webhook url that is a secret
+		urlErr, ok := err.(*url.Error)
+		if ok {
+			return 0, errors.Wrapf(urlErr.Err, "can not post payload (%v)", urlErr.Op)
+		}
+		return 0, errors.Wrap(err, "can not post payload")
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode == http.StatusTooManyRequests {
+		retryAfter := time.Second
+		seconds, err := strconv.ParseInt(response.Header.Get("Retry-After"), 10, 64)
+		if err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return retryAfter, errors.Errorf("rate limited (retry after = %v)", retryAfter)
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return 0, errors.Errorf("unexpected status (status = %v)", response.Status)
+	}
+	return 0, nil
+}
+
+// NewWebhookClient is create incoming webhook client
+func NewWebhookClient(webhookURL string, timeout time.Duration) (*WebhookClient) {
+	return &WebhookClient{
+		webhookURL: webhookURL,
+		client:     &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
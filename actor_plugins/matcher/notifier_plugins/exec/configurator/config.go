@@ -0,0 +1,16 @@
+package configurator
+
+// Config is Config
+// command is executed with matched line on stdin, stdin_template (text/template of templater) formats it
+// command runs in background, so failed command is only logged and it is not retried by notify queue
+type Config struct {
+        Command        []string          `json:"command"         yaml:"command"         toml:"command"`
+        WorkDir        string            `json:"work_dir"        yaml:"work_dir"        toml:"work_dir"`
+        User           string            `json:"user"            yaml:"user"            toml:"user"`
+        Env            map[string]string `json:"env"             yaml:"env"             toml:"env"`
+        StdinTemplate  string            `json:"stdin_template"  yaml:"stdin_template"  toml:"stdin_template"`
+        Timeout        int64             `json:"timeout"         yaml:"timeout"         toml:"timeout"`
+        MaxConcurrency int64             `json:"max_concurrency" yaml:"max_concurrency" toml:"max_concurrency"`
+        MaxPending     int64             `json:"max_pending"     yaml:"max_pending"     toml:"max_pending"`
+        MaxOutput      int64             `json:"max_output"      yaml:"max_output"      toml:"max_output"`
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+    "os"
+    "log"
+    "sync"
+    "time"
+    "bytes"
+    "context"
+    "os/exec"
+    "os/user"
+    "strconv"
+    "syscall"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/templater"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifier_plugins/exec/configurator"
+)
+
+const (
+        defaultTimeout int64 = 60
+        defaultMaxConcurrency int64 = 1
+        defaultMaxPending int64 = 100
+        defaultMaxOutput int64 = 4096
+        waitDelay time.Duration = 5 * time.Second
+)
+
+// Exec is Exec
+type Exec struct {
+        callers string
+        config *configurator.Config
+        hostname string
+        credential *syscall.Credential
+        stdinTemplate *templater.Template
+        timeout time.Duration
+        maxPending int64
+        maxOutput int64
+        semaphore chan bool
+        pending int64
+        pendingMutex *sync.Mutex
+        stopped bool
+        waitGroup *sync.WaitGroup
+}
+
+func (e *Exec) environ(event *notifierplugger.Event) ([]string) {
+        // logs of other host are reported with their host
+        hostname := e.hostname
+        if event.Host != "" {
+            hostname = event.Host
+        }
+        env := os.Environ()
+        for key, value := range e.config.Env {
+            env = append(env, key + "=" + value)
+        }
+        env = append(env,
+            "LABEL=" + event.Label,
+            "FILEID=" + event.FileID,
+            "FILENAME=" + event.FileName,
+            "HOSTNAME=" + hostname,
+            "EVENT_ACTION=" + event.Action,
+            "SEVERITY=" + event.Severity,
+            "PATTERN=" + event.Pattern)
+        return env
+}
+
+func (e *Exec) truncate(output []byte) (string) {
+        if int64(len(output)) <= e.maxOutput {
+            return string(output)
+        }
+        return string(output[:e.maxOutput]) + "...(truncated)"
+}
+
+func (e *Exec) stdin(event *notifierplugger.Event) ([]byte, error) {
+        if e.stdinTemplate == nil {
+            return event.Msg, nil
+        }
+        stdin, err := e.stdinTemplate.Execute(templater.NewParams(event))
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not create stdin (%v, %v)", e.config.Command[0], event.Label)
+        }
+        return []byte(stdin), nil
+}
+
+// run is run command and log result, error is returned for failed command
+func (e *Exec) run(event *notifierplugger.Event, stdin []byte) (error) {
+        ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+        defer cancel()
+        cmd := exec.CommandContext(ctx, e.config.Command[0], e.config.Command[1:]...)
+        cmd.Dir = e.config.WorkDir
+        cmd.Env = e.environ(event)
+        cmd.Stdin = bytes.NewReader(stdin)
+        output := new(bytes.Buffer)
+        cmd.Stdout = output
+        cmd.Stderr = output
+        // command runs in own process group so that grandchildren are killed at timeout
+        cmd.SysProcAttr = &syscall.SysProcAttr{
+            Setpgid: true,
+            Credential: e.credential,
+        }
+        cmd.Cancel = func() (error) {
+            return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+        }
+        // grandchild that keeps output open does not block Run after it is killed
+        cmd.WaitDelay = waitDelay
+        startTime := time.Now()
+        err := cmd.Run()
+        elapsed := time.Since(startTime)
+        exitCode := 0
+        if err != nil {
+            exitCode = -1
+            exitErr, ok := err.(*exec.ExitError)
+            if ok {
+                status, ok := exitErr.Sys().(syscall.WaitStatus)
+                if ok {
+                    exitCode = status.ExitStatus()
+                }
+            }
+            if ctx.Err() == context.DeadlineExceeded {
+                err = errors.Errorf("timeout (%v)", e.timeout)
+            }
+            log.Printf("command failed (%v, %v, exit code = %v, elapsed = %v): %v: %v",
+                e.config.Command[0], event.Label, exitCode, elapsed, err, e.truncate(output.Bytes()))
+            return err
+        }
+        log.Printf("command succeeded (%v, %v, exit code = %v, elapsed = %v): %v",
+            e.config.Command[0], event.Label, exitCode, elapsed, e.truncate(output.Bytes()))
+        return nil
+}
+
+func (e *Exec) enqueue(event *notifierplugger.Event) (error) {
+        stdin, err := e.stdin(event)
+        if err != nil {
+            return err
+        }
+        e.pendingMutex.Lock()
+        if e.stopped {
+            e.pendingMutex.Unlock()
+            return errors.Errorf("exec is stopped (%v, %v)", e.config.Command[0], event.Label)
+        }
+        if e.pending >= e.maxPending {
+            e.pendingMutex.Unlock()
+            return errors.Errorf("too many pending commands (%v, %v)", e.config.Command[0], event.Label)
+        }
+        e.pending++
+        // added under the lock so that stop waits for every accepted command
+        e.waitGroup.Add(1)
+        e.pendingMutex.Unlock()
+        go func() {
+            defer e.waitGroup.Done()
+            e.semaphore <- true
+            defer func() {
+                <-e.semaphore
+                e.pendingMutex.Lock()
+                e.pending--
+                e.pendingMutex.Unlock()
+            }()
+            e.run(event, stdin)
+        }()
+        return nil
+}
+
+// Start is start
+func (e *Exec) Start() (error) {
+        return nil
+}
+
+// Stop is stop
+func (e *Exec) Stop() {
+        e.pendingMutex.Lock()
+        e.stopped = true
+        e.pendingMutex.Unlock()
+        e.waitGroup.Wait()
+}
+
+// Flush is flush
+func (e *Exec) Flush() {
+}
+
+// Notify is notify
+func (e *Exec) Notify(msg []byte, fileID string, fileName string, label string) (error) {
+        return e.enqueue(&notifierplugger.Event{
+            Action: notifierplugger.EventTrigger,
+            Msg: msg,
+            FileID: fileID,
+            FileName: fileName,
+            Label: label,
+            Severity: "",
+            Pattern: "",
+        })
+}
+
+// NotifyEvent is notify event, command runs in background
+// error is returned only when command can not be queued, failed command is logged and not retried by notify queue
+func (e *Exec) NotifyEvent(event *notifierplugger.Event) (error) {
+        return e.enqueue(event)
+}
+
+func lookupCredential(userName string) (*syscall.Credential, error) {
+    u, err := user.Lookup(userName)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not lookup user (%v)", userName)
+    }
+    uid, err := strconv.ParseUint(u.Uid, 10, 32)
+    if err != nil {
+        return nil, errors.Wrapf(err, "invalid uid (%v)", u.Uid)
+    }
+    gid, err := strconv.ParseUint(u.Gid, 10, 32)
+    if err != nil {
+        return nil, errors.Wrapf(err, "invalid gid (%v)", u.Gid)
+    }
+    return &syscall.Credential{
+        Uid: uint32(uid),
+        Gid: uint32(gid),
+    }, nil
+}
+
+// NewExec is create new exec notifier
+func NewExec(callers string, configFile string) (notifierplugger.NotifierPlugin, error) {
+    log.Printf("configFile = %v", configFile)
+    hostname, err := os.Hostname()
+    if err != nil {
+        return nil, errors.Wrap(err, "can not get hostname")
+    }
+    configurator, err := configurator.NewConfigurator(configFile)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not create configurator (%v)", configFile)
+    }
+    config, err := configurator.Load()
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not load config (%v)", configFile)
+    }
+    log.Printf("config = %+v", config)
+    if len(config.Command) == 0 {
+        return nil, errors.Errorf("no command (%v)", configFile)
+    }
+    var credential *syscall.Credential
+    if config.User != "" {
+        credential, err = lookupCredential(config.User)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not get credential (%v)", configFile)
+        }
+    }
+    var stdinTemplate *templater.Template
+    if config.StdinTemplate != "" {
+        stdinTemplate, err = templater.New("stdin_template", config.StdinTemplate, nil)
+        if err != nil {
+            return nil, errors.Wrapf(err, "invalid stdin template (%v)", configFile)
+        }
+    }
+    timeout := defaultTimeout
+    if config.Timeout > 0 {
+        timeout = config.Timeout
+    }
+    maxConcurrency := defaultMaxConcurrency
+    if config.MaxConcurrency > 0 {
+        maxConcurrency = config.MaxConcurrency
+    }
+    maxPending := defaultMaxPending
+    if config.MaxPending > 0 {
+        maxPending = config.MaxPending
+    }
+    maxOutput := defaultMaxOutput
+    if config.MaxOutput > 0 {
+        maxOutput = config.MaxOutput
+    }
+    newCallers := callers + ".exec"
+    return &Exec {
+        callers: newCallers,
+        config: config,
+        hostname: hostname,
+        credential: credential,
+        stdinTemplate: stdinTemplate,
+        timeout: time.Duration(timeout) * time.Second,
+        maxPending: maxPending,
+        maxOutput: maxOutput,
+        semaphore: make(chan bool, maxConcurrency),
+        pending: 0,
+        pendingMutex: new(sync.Mutex),
+        stopped: false,
+        waitGroup: new(sync.WaitGroup),
+    }, nil
+}
+
+// GetNotifierPluginInfo is GetNotifierPluginInfo
+func GetNotifierPluginInfo() (string, notifierplugger.NotifierPluginNewFunc) {
+    return "exec", NewExec
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+    "time"
+    "strings"
+    "strconv"
+    "syscall"
+    "testing"
+    "io/ioutil"
+    "path/filepath"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+)
+
+func newTestExec(t *testing.T, config string) (*Exec) {
+    configFile := filepath.Join(t.TempDir(), "exec.toml")
+    err := ioutil.WriteFile(configFile, []byte(config), 0644)
+    if err != nil {
+        t.Fatalf("can not write config: %v", err)
+    }
+    notifier, err := NewExec("test", configFile)
+    if err != nil {
+        t.Fatalf("can not create exec: %v", err)
+    }
+    return notifier.(*Exec)
+}
+
+func shellConfig(script string, extra string) (string) {
+    return "command = [\"sh\", \"-c\", " + strconv.Quote(script) + "]\n" + extra
+}
+
+func testEvent() (*notifierplugger.Event) {
+    return &notifierplugger.Event{
+        Action: notifierplugger.EventTrigger,
+        Msg: []byte("ERROR disk full\n"),
+        FileID: "id1",
+        FileName: "/var/log/app.log",
+        Label: "app",
+        Severity: "error",
+        Pattern: "ERROR",
+        Host: "web1",
+    }
+}
+
+func readFile(t *testing.T, filePath string) (string) {
+    buf, err := ioutil.ReadFile(filePath)
+    if err != nil {
+        t.Fatalf("can not read file (%v): %v", filePath, err)
+    }
+    return string(buf)
+}
+
+// isAlive is report whether process is running, zombie that is not reaped is not running
+func isAlive(pid int) (bool) {
+    if syscall.Kill(pid, 0) != nil {
+        return false
+    }
+    stat, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+    if err != nil {
+        return true
+    }
+    fields := strings.Fields(string(stat))
+    return len(fields) < 3 || fields[2] != "Z"
+}
+
+func TestEnvironmentAndStdin(t *testing.T) {
+    out := filepath.Join(t.TempDir(), "out")
+    script := "echo \"$LABEL|$FILEID|$FILENAME|$HOSTNAME|$EVENT_ACTION|$SEVERITY|$PATTERN|$EXTRA\" > \"$OUT\"; cat >> \"$OUT\""
+    e := newTestExec(t, shellConfig(script, "stdin_template = \"{{.Label}}: {{trimSpace .Message}}\"\n[ env ]\n  OUT = \"" + out + "\"\n  EXTRA = \"x\"\n"))
+    err := e.run(testEvent(), mustStdin(t, e))
+    if err != nil {
+        t.Fatalf("command failed: %v", err)
+    }
+    expected := "app|id1|/var/log/app.log|web1|trigger|error|ERROR|x\napp: ERROR disk full"
+    if data := readFile(t, out); data != expected {
+        t.Errorf("unexpected output (%q, %q)", data, expected)
+    }
+}
+
+func mustStdin(t *testing.T, e *Exec) ([]byte) {
+    stdin, err := e.stdin(testEvent())
+    if err != nil {
+        t.Fatalf("can not create stdin: %v", err)
+    }
+    return stdin
+}
+
+func TestFailedCommand(t *testing.T) {
+    e := newTestExec(t, shellConfig("echo failed; exit 3", ""))
+    err := e.run(testEvent(), nil)
+    if err == nil {
+        t.Errorf("failed command is succeeded")
+    }
+}
+
+func TestTimeoutKillsProcessGroup(t *testing.T) {
+    pidFile := filepath.Join(t.TempDir(), "pid")
+    // grandchild keeps output open and outlives its parent without process group kill
+    e := newTestExec(t, shellConfig("sleep 30 & echo $! > " + pidFile + "; wait", ""))
+    e.timeout = 200 * time.Millisecond
+    start := time.Now()
+    err := e.run(testEvent(), nil)
+    if err == nil || !strings.Contains(err.Error(), "timeout") {
+        t.Errorf("unexpected error (%v)", err)
+    }
+    if elapsed := time.Since(start); elapsed > waitDelay {
+        t.Errorf("output wait is not bounded (%v)", elapsed)
+    }
+    pid, err := strconv.Atoi(strings.TrimSpace(readFile(t, pidFile)))
+    if err != nil {
+        t.Fatalf("can not parse pid: %v", err)
+    }
+    if isAlive(pid) {
+        syscall.Kill(pid, syscall.SIGKILL)
+        t.Errorf("grandchild is not killed (%v)", pid)
+    }
+}
+
+func TestOutputWaitIsBounded(t *testing.T) {
+    pidFile := filepath.Join(t.TempDir(), "pid")
+    // grandchild in other session is not killed, it keeps output open after command exits
+    e := newTestExec(t, shellConfig("setsid sleep 30 & echo $! > " + pidFile, ""))
+    start := time.Now()
+    e.run(testEvent(), nil)
+    elapsed := time.Since(start)
+    pid, err := strconv.Atoi(strings.TrimSpace(readFile(t, pidFile)))
+    if err == nil {
+        syscall.Kill(pid, syscall.SIGKILL)
+    }
+    if elapsed > waitDelay + 2 * time.Second {
+        t.Errorf("output wait is not bounded (%v)", elapsed)
+    }
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+    out := filepath.Join(t.TempDir(), "out")
+    script := "echo start >> \"$OUT\"; sleep 0.2; echo end >> \"$OUT\""
+    e := newTestExec(t, shellConfig(script, "max_concurrency = 1\n[ env ]\n  OUT = \"" + out + "\"\n"))
+    for i := 0; i < 3; i++ {
+        err := e.NotifyEvent(testEvent())
+        if err != nil {
+            t.Fatalf("can not notify: %v", err)
+        }
+    }
+    e.Stop()
+    expected := strings.Repeat("start\nend\n", 3)
+    if data := readFile(t, out); data != expected {
+        t.Errorf("commands run concurrently (%q)", data)
+    }
+    err := e.NotifyEvent(testEvent())
+    if err == nil {
+        t.Errorf("command is accepted after stop")
+    }
+}
+
+func TestMaxPending(t *testing.T) {
+    e := newTestExec(t, shellConfig("sleep 0.5", "max_pending = 1\n"))
+    defer e.Stop()
+    err := e.NotifyEvent(testEvent())
+    if err != nil {
+        t.Fatalf("can not notify: %v", err)
+    }
+    err = e.NotifyEvent(testEvent())
+    if err == nil {
+        t.Errorf("command over max pending is accepted")
+    }
+}
@@ -0,0 +1,15 @@
+package configurator
+
+// Config is Config
+// severity_map maps rule severity to events api severity
+// summary_template is text/template of templater
+// state_file is shared by incident notifiers of the same state_file, open incidents of all of them are saved
+type Config struct {
+        URL             string            `json:"url"              yaml:"url"              toml:"url"`
+        RoutingKey      string            `json:"routing_key"      yaml:"routing_key"      toml:"routing_key"`
+        Timeout         int64             `json:"timeout"          yaml:"timeout"          toml:"timeout"`
+        DefaultSeverity string            `json:"default_severity" yaml:"default_severity" toml:"default_severity"`
+        SeverityMap     map[string]string `json:"severity_map"     yaml:"severity_map"     toml:"severity_map"`
+        SummaryTemplate string            `json:"summary_template" yaml:"summary_template" toml:"summary_template"`
+        StateFile       string            `json:"state_file"       yaml:"state_file"       toml:"state_file"`
+}
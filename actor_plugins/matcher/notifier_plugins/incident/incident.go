@@ -0,0 +1,410 @@
+package main
+
+import (
+    "os"
+    "log"
+    "sync"
+    "time"
+    "bytes"
+    "regexp"
+    "path/filepath"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/gob"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/templater"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifier_plugins/incident/utility"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifier_plugins/incident/configurator"
+)
+
+const (
+        defaultURL string = "https://events.pagerduty.com/v2/enqueue"
+        defaultTimeout int64 = 10
+        defaultSeverity string = "error"
+        defaultSummaryTemplate string = "[{{.Label}}] {{.FileName}}: {{.Message}}"
+        maxSummaryLength int = 1024
+)
+
+var normalizeRegexp = regexp.MustCompile("[0-9]+")
+
+// open incidents are tracked by label, file name and pattern to resolve them later
+type incidentState struct {
+        Incidents map[string][]string
+}
+
+// stateStore is incident state of state file, incident notifiers of the same state file share it
+// so that a notifier does not overwrite incidents opened by others
+type stateStore struct {
+        stateFile string
+        state *incidentState
+        dirty bool
+        refs int
+        mutex *sync.Mutex
+}
+
+var stateStores = make(map[string]*stateStore)
+var stateStoresMutex = new(sync.Mutex)
+
+func newStateStore(stateFile string) (*stateStore) {
+        return &stateStore{
+            stateFile: stateFile,
+            state: &incidentState{
+                Incidents: make(map[string][]string),
+            },
+            dirty: false,
+            refs: 0,
+            mutex: new(sync.Mutex),
+        }
+}
+
+// acquireStateStore is get state store of state file, state is loaded at first time
+// state store without state file is not shared
+func acquireStateStore(stateFile string) (*stateStore) {
+        if stateFile == "" {
+            return newStateStore("")
+        }
+        stateFile = filepath.Clean(stateFile)
+        stateStoresMutex.Lock()
+        defer stateStoresMutex.Unlock()
+        store, ok := stateStores[stateFile]
+        if !ok {
+            store = newStateStore(stateFile)
+            err := store.load()
+            if err != nil {
+                log.Printf("can not load incident state: %v", err)
+            }
+            stateStores[stateFile] = store
+        }
+        store.refs++
+        return store
+}
+
+// releaseStateStore is save state and discard state store at last release
+func releaseStateStore(store *stateStore) {
+        err := store.save()
+        if err != nil {
+            log.Printf("can not save incident state: %v", err)
+        }
+        if store.stateFile == "" {
+            return
+        }
+        stateStoresMutex.Lock()
+        defer stateStoresMutex.Unlock()
+        store.refs--
+        if store.refs > 0 {
+            return
+        }
+        delete(stateStores, store.stateFile)
+}
+
+func (s *stateStore) add(key string, dedupKey string) {
+        s.mutex.Lock()
+        defer s.mutex.Unlock()
+        for _, k := range s.state.Incidents[key] {
+            if k == dedupKey {
+                return
+            }
+        }
+        s.state.Incidents[key] = append(s.state.Incidents[key], dedupKey)
+        s.dirty = true
+}
+
+func (s *stateStore) remove(key string) ([]string) {
+        s.mutex.Lock()
+        defer s.mutex.Unlock()
+        dedupKeys, ok := s.state.Incidents[key]
+        if !ok {
+            return nil
+        }
+        delete(s.state.Incidents, key)
+        s.dirty = true
+        return dedupKeys
+}
+
+func (s *stateStore) load() (error) {
+        _, err := os.Stat(s.stateFile)
+        if err != nil {
+            return nil
+        }
+        file, err := os.Open(s.stateFile)
+        if err != nil {
+            return errors.Wrapf(err, "can not read incident state (%v)", s.stateFile)
+        }
+        defer file.Close()
+        dec := gob.NewDecoder(file)
+        newState := new(incidentState)
+        err = dec.Decode(newState)
+        if err != nil {
+            return errors.Wrapf(err, "can not decode incident state (%v)", s.stateFile)
+        }
+        if newState.Incidents == nil {
+            newState.Incidents = make(map[string][]string)
+        }
+        s.mutex.Lock()
+        defer s.mutex.Unlock()
+        s.state = newState
+        return nil
+}
+
+func (s *stateStore) save() (error) {
+        if s.stateFile == "" {
+            return nil
+        }
+        s.mutex.Lock()
+        defer s.mutex.Unlock()
+        if !s.dirty {
+            return nil
+        }
+        stateDir := filepath.Dir(s.stateFile)
+        _, err := os.Stat(stateDir)
+        if err != nil {
+            err := os.MkdirAll(stateDir, 0755)
+            if err != nil {
+                return errors.Wrapf(err, "can not create directory (%v)", stateDir)
+            }
+        }
+        file, err := os.Create(s.stateFile)
+        if err != nil {
+            return errors.Wrapf(err, "can not create incident state (%v)", s.stateFile)
+        }
+        defer file.Close()
+        enc := gob.NewEncoder(file)
+        err = enc.Encode(s.state)
+        if err != nil {
+            return errors.Wrapf(err, "can not encode incident state (%v)", s.stateFile)
+        }
+        s.dirty = false
+        return nil
+}
+
+// Incident is Incident
+type Incident struct {
+        callers string
+        config *configurator.Config
+        eventsClient *utility.EventsClient
+        hostname string
+        summaryTemplate *templater.Template
+        store *stateStore
+        started bool
+        stopped bool
+        mutex *sync.Mutex
+}
+
+func (i *Incident) incidentKey(label string, fileName string, pattern string) (string) {
+        return label + "\x00" + fileName + "\x00" + pattern
+}
+
+// eventPatterns is patterns of event, grouped matches have several patterns
+func eventPatterns(event *notifierplugger.Event) ([]string) {
+        if len(event.Patterns) > 0 {
+            return event.Patterns
+        }
+        return []string{ event.Pattern }
+}
+
+func (i *Incident) dedupKey(label string, fileName string, msg string) (string) {
+        hash := sha256.New()
+        hash.Write([]byte(label))
+        hash.Write([]byte{0})
+        hash.Write([]byte(fileName))
+        hash.Write([]byte{0})
+        hash.Write([]byte(normalizeRegexp.ReplaceAllString(msg, "#")))
+        return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (i *Incident) severity(severity string) (string) {
+        mapped, ok := i.config.SeverityMap[severity]
+        if ok {
+            return mapped
+        }
+        if notifierplugger.SeverityRank(severity) > 0 {
+            return severity
+        }
+        if i.config.DefaultSeverity != "" {
+            return i.config.DefaultSeverity
+        }
+        return defaultSeverity
+}
+
+func (i *Incident) summary(event *notifierplugger.Event, msg string) (string) {
+        fallback := "[" + event.Label + "] " + event.FileName + ": " + msg
+        summary := i.summaryTemplate.ExecuteOr(templater.NewParams(event), fallback)
+        return templater.Truncate(maxSummaryLength, summary)
+}
+
+func (i *Incident) trigger(event *notifierplugger.Event) (error) {
+        msg := string(bytes.TrimRight(event.Msg, "\r\n"))
+        dedupKey := i.dedupKey(event.Label, event.FileName, msg)
+        // logs of other host are reported with their host
+        source := i.hostname
+        if event.Host != "" {
+            source = event.Host
+        }
+        payload := &utility.Payload{
+            Summary: i.summary(event, msg),
+            Source: source,
+            Severity: i.severity(event.Severity),
+            Timestamp: time.Now().Format(time.RFC3339),
+            Component: event.FileName,
+            Group: event.Label,
+            Class: event.Pattern,
+            CustomDetails: map[string]string{
+                "file_id": event.FileID,
+                "message": msg,
+            },
+        }
+        err := i.eventsClient.Send(&utility.Event{
+            RoutingKey: i.config.RoutingKey,
+            EventAction: utility.ActionTrigger,
+            DedupKey: dedupKey,
+            Payload: payload,
+        })
+        if err != nil {
+            return errors.Wrapf(err, "can not send trigger event (%v, %v)", event.Label, event.FileName)
+        }
+        for _, pattern := range eventPatterns(event) {
+            i.store.add(i.incidentKey(event.Label, event.FileName, pattern), dedupKey)
+        }
+        return nil
+}
+
+func (i *Incident) resolve(event *notifierplugger.Event) (error) {
+        key := i.incidentKey(event.Label, event.FileName, event.Pattern)
+        dedupKeys := i.store.remove(key)
+        for n, dedupKey := range dedupKeys {
+            err := i.eventsClient.Send(&utility.Event{
+                RoutingKey: i.config.RoutingKey,
+                EventAction: utility.ActionResolve,
+                DedupKey: dedupKey,
+            })
+            if err != nil {
+                // keep unresolved incidents for next resolve
+                for _, k := range dedupKeys[n:] {
+                    i.store.add(key, k)
+                }
+                return errors.Wrapf(err, "can not send resolve event (%v, %v, %v)", event.Label, event.FileName, dedupKey)
+            }
+        }
+        return nil
+}
+
+// Start is start
+func (i *Incident) Start() (error) {
+        i.mutex.Lock()
+        defer i.mutex.Unlock()
+        i.store = acquireStateStore(i.config.StateFile)
+        i.started = true
+        return nil
+}
+
+// Stop is stop
+func (i *Incident) Stop() {
+        i.mutex.Lock()
+        defer i.mutex.Unlock()
+        if i.stopped {
+            return
+        }
+        i.stopped = true
+        if i.started {
+            releaseStateStore(i.store)
+        }
+}
+
+// Flush is flush
+func (i *Incident) Flush() {
+        i.mutex.Lock()
+        started := i.started
+        i.mutex.Unlock()
+        if !started {
+            return
+        }
+        err := i.store.save()
+        if err != nil {
+            log.Printf("can not save incident state: %v", err)
+        }
+}
+
+// Notify is notify, it is treated as trigger
+func (i *Incident) Notify(msg []byte, fileID string, fileName string, label string) (error) {
+        return i.NotifyEvent(&notifierplugger.Event{
+            Action: notifierplugger.EventTrigger,
+            Msg: msg,
+            FileID: fileID,
+            FileName: fileName,
+            Label: label,
+            Severity: "",
+            Pattern: "",
+        })
+}
+
+// NotifyEvent is notify event
+func (i *Incident) NotifyEvent(event *notifierplugger.Event) (error) {
+        i.mutex.Lock()
+        started, stopped := i.started, i.stopped
+        i.mutex.Unlock()
+        if !started || stopped {
+            return errors.Errorf("incident is not started or stopped (%v, %v)", event.Label, event.FileName)
+        }
+        switch event.Action {
+        case notifierplugger.EventResolve:
+            return i.resolve(event)
+        default:
+            return i.trigger(event)
+        }
+}
+
+// NewIncident is create new incident notifier
+func NewIncident(callers string, configFile string) (notifierplugger.NotifierPlugin, error) {
+    log.Printf("configFile = %v", configFile)
+    hostname, err := os.Hostname()
+    if err != nil {
+        return nil, errors.Wrap(err, "can not get hostname")
+    }
+    configurator, err := configurator.NewConfigurator(configFile)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not create configurator (%v)", configFile)
+    }
+    config, err := configurator.Load()
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not load config (%v)", configFile)
+    }
+    if config.RoutingKey == "" {
+        return nil, errors.Errorf("no routing key (%v)", configFile)
+    }
+    url := defaultURL
+    if config.URL != "" {
+        url = config.URL
+    }
+    // config is not logged because routing key is a secret
+    log.Printf("url = %v", url)
+    timeout := defaultTimeout
+    if config.Timeout > 0 {
+        timeout = config.Timeout
+    }
+    summaryTemplateText := defaultSummaryTemplate
+    if config.SummaryTemplate != "" {
+        summaryTemplateText = config.SummaryTemplate
+    }
+    summaryTemplate, err := templater.New("summary_template", summaryTemplateText, nil)
+    if err != nil {
+        return nil, errors.Wrapf(err, "invalid summary template (%v)", configFile)
+    }
+    newCallers := callers + ".incident"
+    return &Incident {
+        callers: newCallers,
+        config: config,
+        eventsClient: utility.NewEventsClient(url, time.Duration(timeout) * time.Second),
+        hostname: hostname,
+        summaryTemplate: summaryTemplate,
+        store: nil,
+        started: false,
+        stopped: false,
+        mutex: new(sync.Mutex),
+    }, nil
+}
+
+// GetNotifierPluginInfo is GetNotifierPluginInfo
+func GetNotifierPluginInfo() (string, notifierplugger.NotifierPluginNewFunc) {
+    return "incident", NewIncident
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+    "sync"
+    "testing"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "io/ioutil"
+    "encoding/json"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifier_plugins/incident/utility"
+)
+
+type eventsStub struct {
+    *httptest.Server
+    mutex *sync.Mutex
+    events []*utility.Event
+    status int
+}
+
+func newEventsStub(status int) (*eventsStub) {
+    s := &eventsStub{
+        mutex: new(sync.Mutex),
+        events: make([]*utility.Event, 0),
+        status: status,
+    }
+    s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        event := new(utility.Event)
+        err := json.NewDecoder(r.Body).Decode(event)
+        if err != nil {
+            w.WriteHeader(http.StatusBadRequest)
+            return
+        }
+        s.mutex.Lock()
+        s.events = append(s.events, event)
+        s.mutex.Unlock()
+        w.WriteHeader(s.status)
+    }))
+    return s
+}
+
+func newTestIncident(t *testing.T, url string, stateFile string) (*Incident) {
+    configFile := filepath.Join(t.TempDir(), "incident.toml")
+    config := "url = \"" + url + "\"\nrouting_key = \"key\"\nstate_file = \"" + stateFile + "\"\n"
+    err := ioutil.WriteFile(configFile, []byte(config), 0644)
+    if err != nil {
+        t.Fatalf("can not write config: %v", err)
+    }
+    notifier, err := NewIncident("test", configFile)
+    if err != nil {
+        t.Fatalf("can not create incident: %v", err)
+    }
+    err = notifier.Start()
+    if err != nil {
+        t.Fatalf("can not start incident: %v", err)
+    }
+    return notifier.(*Incident)
+}
+
+func testEvent(action string, pattern string, patterns []string) (*notifierplugger.Event) {
+    return &notifierplugger.Event{
+        Action: action,
+        Msg: []byte("ERROR disk full\n"),
+        FileID: "id1",
+        FileName: "/var/log/app.log",
+        Label: "app",
+        Severity: "error",
+        Pattern: pattern,
+        Patterns: patterns,
+        Host: "",
+    }
+}
+
+func TestResolveGroupedTrigger(t *testing.T) {
+    stub := newEventsStub(http.StatusAccepted)
+    defer stub.Close()
+    incident := newTestIncident(t, stub.URL, "")
+    defer incident.Stop()
+    err := incident.NotifyEvent(testEvent(notifierplugger.EventTrigger, "", []string{ "ERROR", "FATAL" }))
+    if err != nil {
+        t.Fatalf("can not trigger: %v", err)
+    }
+    err = incident.NotifyEvent(testEvent(notifierplugger.EventResolve, "FATAL", nil))
+    if err != nil {
+        t.Fatalf("can not resolve: %v", err)
+    }
+    if len(stub.events) != 2 {
+        t.Fatalf("unexpected events (%v)", len(stub.events))
+    }
+    trigger, resolve := stub.events[0], stub.events[1]
+    if trigger.EventAction != utility.ActionTrigger || trigger.RoutingKey != "key" || trigger.Payload == nil {
+        t.Errorf("unexpected trigger (%+v)", trigger)
+    }
+    if resolve.EventAction != utility.ActionResolve || resolve.DedupKey != trigger.DedupKey {
+        t.Errorf("unexpected resolve (%+v, %v)", resolve, trigger.DedupKey)
+    }
+}
+
+func TestResolveWithoutTrigger(t *testing.T) {
+    stub := newEventsStub(http.StatusAccepted)
+    defer stub.Close()
+    incident := newTestIncident(t, stub.URL, "")
+    defer incident.Stop()
+    err := incident.NotifyEvent(testEvent(notifierplugger.EventTrigger, "ERROR", nil))
+    if err != nil {
+        t.Fatalf("can not trigger: %v", err)
+    }
+    err = incident.NotifyEvent(testEvent(notifierplugger.EventResolve, "WARN", nil))
+    if err != nil {
+        t.Fatalf("can not resolve: %v", err)
+    }
+    if len(stub.events) != 1 {
+        t.Errorf("unexpected events (%v)", len(stub.events))
+    }
+}
+
+func TestFailedEventIsNotRetried(t *testing.T) {
+    stub := newEventsStub(http.StatusInternalServerError)
+    defer stub.Close()
+    incident := newTestIncident(t, stub.URL, "")
+    defer incident.Stop()
+    err := incident.NotifyEvent(testEvent(notifierplugger.EventTrigger, "ERROR", nil))
+    if err == nil {
+        t.Fatalf("no error")
+    }
+    // notify queue retries failed notifications
+    if len(stub.events) != 1 {
+        t.Errorf("unexpected events (%v)", len(stub.events))
+    }
+    // failed trigger is not tracked
+    err = incident.NotifyEvent(testEvent(notifierplugger.EventResolve, "ERROR", nil))
+    if err != nil || len(stub.events) != 1 {
+        t.Errorf("unexpected resolve (%v, %v)", err, len(stub.events))
+    }
+}
+
+func TestIncidentStateIsPersisted(t *testing.T) {
+    stub := newEventsStub(http.StatusAccepted)
+    defer stub.Close()
+    stateFile := filepath.Join(t.TempDir(), "incident.state")
+    incident := newTestIncident(t, stub.URL, stateFile)
+    err := incident.NotifyEvent(testEvent(notifierplugger.EventTrigger, "ERROR", nil))
+    if err != nil {
+        t.Fatalf("can not trigger: %v", err)
+    }
+    incident.Stop()
+    restarted := newTestIncident(t, stub.URL, stateFile)
+    defer restarted.Stop()
+    err = restarted.NotifyEvent(testEvent(notifierplugger.EventResolve, "ERROR", nil))
+    if err != nil {
+        t.Fatalf("can not resolve: %v", err)
+    }
+    if len(stub.events) != 2 || stub.events[1].DedupKey != stub.events[0].DedupKey {
+        t.Errorf("incident is not resolved after restart (%v)", len(stub.events))
+    }
+}
+
+func TestIncidentStateIsSharedByNotifiers(t *testing.T) {
+    stub := newEventsStub(http.StatusAccepted)
+    defer stub.Close()
+    stateFile := filepath.Join(t.TempDir(), "incident.state")
+    first := newTestIncident(t, stub.URL, stateFile)
+    second := newTestIncident(t, stub.URL, stateFile)
+    firstEvent := testEvent(notifierplugger.EventTrigger, "ERROR", nil)
+    secondEvent := testEvent(notifierplugger.EventTrigger, "ERROR", nil)
+    secondEvent.FileName = "/var/log/other.log"
+    err := first.NotifyEvent(firstEvent)
+    if err != nil {
+        t.Fatalf("can not trigger: %v", err)
+    }
+    first.Flush()
+    err = second.NotifyEvent(secondEvent)
+    if err != nil {
+        t.Fatalf("can not trigger: %v", err)
+    }
+    // each save keeps incidents of the other notifier
+    second.Flush()
+    first.Stop()
+    second.Stop()
+    restarted := newTestIncident(t, stub.URL, stateFile)
+    defer restarted.Stop()
+    for _, event := range []*notifierplugger.Event{ firstEvent, secondEvent } {
+        event.Action = notifierplugger.EventResolve
+        err := restarted.NotifyEvent(event)
+        if err != nil {
+            t.Fatalf("can not resolve: %v", err)
+        }
+    }
+    if len(stub.events) != 4 {
+        t.Fatalf("incidents are not resolved after restart (%v)", len(stub.events))
+    }
+    if stub.events[2].DedupKey != stub.events[0].DedupKey || stub.events[3].DedupKey != stub.events[1].DedupKey {
+        t.Errorf("unexpected resolved incidents (%v, %v)", stub.events[2].DedupKey, stub.events[3].DedupKey)
+    }
+}
+
+func TestNotifyEventAfterStop(t *testing.T) {
+    stub := newEventsStub(http.StatusAccepted)
+    defer stub.Close()
+    incident := newTestIncident(t, stub.URL, "")
+    incident.Stop()
+    err := incident.NotifyEvent(testEvent(notifierplugger.EventTrigger, "ERROR", nil))
+    if err == nil {
+        t.Errorf("notification is accepted after stop")
+    }
+    if len(stub.events) != 0 {
+        t.Errorf("unexpected events (%v)", len(stub.events))
+    }
+}
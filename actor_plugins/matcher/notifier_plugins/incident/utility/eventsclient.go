@@ -0,0 +1,72 @@
+package utility
+
+import (
+	"github.com/pkg/errors"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	// ActionTrigger is trigger event action
+	ActionTrigger string = "trigger"
+	// ActionResolve is resolve event action
+	ActionResolve string = "resolve"
+)
+
+// Payload is events api payload
+type Payload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// Event is events api event
+type Event struct {
+	RoutingKey  string   `json:"routing_key"`
+	EventAction string   `json:"event_action"`
+	DedupKey    string   `json:"dedup_key"`
+	Payload     *Payload `json:"payload,omitempty"`
+}
+
+// EventsClient is events api client, failed event is retried by notify queue
+type EventsClient struct {
+	url    string
+	client *http.Client
+}
+
+// Send is send event once
+func (e *EventsClient) Send(event *Event) (error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "can not marshal event")
+	}
+	response, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "can not send event (url = %v)", e.url)
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	return errors.Errorf("unexpected status (url = %v, status = %v)", e.url, response.Status)
+}
+
+// NewEventsClient is create events api client
+func NewEventsClient(url string, timeout time.Duration) (*EventsClient) {
+	return &EventsClient{
+		url:    url,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
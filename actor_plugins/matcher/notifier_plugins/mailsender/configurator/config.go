@@ -1,14 +1,29 @@
 package configurator
 
 // Config is Config
+// password is loaded from password_env or password_file if they are set, it is oauth2 access token on XOAUTH2
+// auth and password are used only when username is set
+// subject_format, body_template and digest_subject_format are text/template of templater, legacy ${LABEL} style variables are still accepted
+// html_template is html/template file, relative path is resolved from directory of config file
+// digest_interval enables digest mode that sends one summary mail per interval, entries of failed digest are kept for next interval
 type Config struct {
-        HostPort      string `json:"hostPort"       yaml:"hostPort"       toml:"hostPort"`
-        Username      string `json:"username"       yaml:"username"       toml:"username"`
-        Password      string `json:"password"       yaml:"password"       toml:"password"`
-        AuthType      string `json:"authType"       yaml:"authType"       toml:"authType"`
-        UseTLS        bool   `json:"useTls"         yaml:"useTls"         toml:"useTls"`
-        UseStartTLS   bool   `json:"useStartTls"    yaml:"useStartTls"    toml:"useStartTls"`
-        From          string `json:"from"           yaml:"from"           toml:"from"`
-        To            string `json:"to"             yaml:"to"             toml:"to"`
-        SubjectFormat string `json:"subject_format" yaml:"subject_format" toml:"subject_format"`
+        HostPort            string `json:"hostPort"              yaml:"hostPort"              toml:"hostPort"`
+        Username            string `json:"username"              yaml:"username"              toml:"username"`
+        Password            string `json:"password"              yaml:"password"              toml:"password"`
+        PasswordEnv         string `json:"password_env"          yaml:"password_env"          toml:"password_env"`
+        PasswordFile        string `json:"password_file"         yaml:"password_file"         toml:"password_file"`
+        AuthType            string `json:"authType"              yaml:"authType"              toml:"authType"`
+        UseTLS              bool   `json:"useTls"                yaml:"useTls"                toml:"useTls"`
+        UseStartTLS         bool   `json:"useStartTls"           yaml:"useStartTls"           toml:"useStartTls"`
+        IdleTimeout         int64  `json:"idle_timeout"          yaml:"idle_timeout"          toml:"idle_timeout"`
+        From                string `json:"from"                  yaml:"from"                  toml:"from"`
+        To                  string `json:"to"                    yaml:"to"                    toml:"to"`
+        Cc                  string `json:"cc"                    yaml:"cc"                    toml:"cc"`
+        Bcc                 string `json:"bcc"                   yaml:"bcc"                   toml:"bcc"`
+        SubjectFormat       string `json:"subject_format"        yaml:"subject_format"        toml:"subject_format"`
+        BodyTemplate        string `json:"body_template"         yaml:"body_template"         toml:"body_template"`
+        HTMLTemplate        string `json:"html_template"         yaml:"html_template"         toml:"html_template"`
+        DigestInterval      int64  `json:"digest_interval"       yaml:"digest_interval"       toml:"digest_interval"`
+        DigestMaxEntries    int64  `json:"digest_max_entries"    yaml:"digest_max_entries"    toml:"digest_max_entries"`
+        DigestSubjectFormat string `json:"digest_subject_format" yaml:"digest_subject_format" toml:"digest_subject_format"`
 }
@@ -1,42 +1,244 @@
 package main
 
 import (
+    "os"
+    "fmt"
     "log"
+    "sort"
+    "sync"
+    "time"
+    "bytes"
     "strings"
+    "path/filepath"
     "github.com/pkg/errors"
     "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/templater"
     "github.com/potix/log_monitor/actor_plugins/matcher/notifier_plugins/mailsender/utility"
     "github.com/potix/log_monitor/actor_plugins/matcher/notifier_plugins/mailsender/configurator"
 )
 
 const (
-	defaultSubjectFormat string = "${LABEL} - ${FILENAME}"
+	defaultSubjectFormat string = "{{.Label}} - {{.FileName}}"
+	defaultDigestSubjectFormat string = "{{.Count}} matches - {{.Labels}}"
+	defaultDigestMaxEntries int64 = 1000
+	defaultIdleTimeout int64 = 60
 )
 
+// legacy variables of subject format are converted to template actions
+var legacyVariables = strings.NewReplacer(
+        "${LABEL}", "{{.Label}}",
+        "${FILEID}", "{{.FileID}}",
+        "${FILENAME}", "{{.FileName}}",
+        "${COUNT}", "{{.Count}}",
+        "${LABELS}", "{{.Labels}}",
+)
+
+type digestSubjectParams struct {
+        Count int64
+        Labels string
+        Hostname string
+}
+
+type templateParams struct {
+        Subject string
+        Hostname string
+        Entries []*templater.Params
+        Dropped int64
+}
+
 // MailSender is MailSender
 type MailSender struct {
         callers string
         config *configurator.Config
         smtpClient *utility.SMTPClient
+        subjectTemplate *templater.Template
+        bodyTemplate *templater.Template
+        htmlTemplate *templater.Template
+        digestSubjectTemplate *templater.Template
+        hostname string
+        digestMaxEntries int64
+        entries []*templater.Params
+        dropped int64
+        entriesMutex *sync.Mutex
+        stopped bool
+        finish chan bool
+        finished chan bool
+}
+
+func (m *MailSender) htmlBody(subject string, entries []*templater.Params, dropped int64) (string) {
+        if m.htmlTemplate == nil {
+            return ""
+        }
+        params := &templateParams{
+            Subject: subject,
+            Hostname: m.hostname,
+            Entries: entries,
+            Dropped: dropped,
+        }
+        body, err := m.htmlTemplate.Execute(params)
+        if err != nil {
+            // fallback to text only mail
+            log.Printf("can not execute html template (%v): %v", m.config.HTMLTemplate, err)
+            return ""
+        }
+        return body
+}
+
+func (m *MailSender) sendMail(subject string, textBody string, htmlBody string) (error) {
+        err := m.smtpClient.SendMail(subject, textBody, htmlBody)
+        if err != nil {
+            return errors.Wrapf(err, "can not send mail (%v, %v, %v, %v)", m.config.From, m.config.To, m.config.HostPort, subject)
+        }
+        return nil
+}
+
+func (m *MailSender) sendDigest() {
+        m.entriesMutex.Lock()
+        entries := m.entries
+        dropped := m.dropped
+        m.entries = make([]*templater.Params, 0)
+        m.dropped = 0
+        m.entriesMutex.Unlock()
+        if len(entries) == 0 {
+            return
+        }
+        labelSet := make(map[string]bool)
+        for _, e := range entries {
+            labelSet[e.Label] = true
+        }
+        labels := make([]string, 0, len(labelSet))
+        for label := range labelSet {
+            labels = append(labels, label)
+        }
+        sort.Strings(labels)
+        subjectParams := &digestSubjectParams{
+            Count: int64(len(entries)) + dropped,
+            Labels: strings.Join(labels, ", "),
+            Hostname: m.hostname,
+        }
+        subject := m.digestSubjectTemplate.ExecuteOr(subjectParams, fmt.Sprintf("%v matches", subjectParams.Count))
+        textBody := new(bytes.Buffer)
+        for _, e := range entries {
+            fmt.Fprintf(textBody, "%v [%v] %v: %v\n", e.Timestamp, e.Label, e.FileName, e.Message)
+        }
+        if dropped > 0 {
+            fmt.Fprintf(textBody, "(%v matches dropped)\n", dropped)
+        }
+        err := m.sendMail(subject, textBody.String(), m.htmlBody(subject, entries, dropped))
+        if err != nil {
+            log.Printf("can not send digest, entries are kept for next interval: %v", err)
+            m.restore(entries, dropped)
+        }
+}
+
+// restore is put entries of failed digest back in front of entries added while sending
+// entries over digest_max_entries are counted as dropped
+func (m *MailSender) restore(entries []*templater.Params, dropped int64) {
+        m.entriesMutex.Lock()
+        defer m.entriesMutex.Unlock()
+        restored := append(entries, m.entries...)
+        if int64(len(restored)) > m.digestMaxEntries {
+            dropped += int64(len(restored)) - m.digestMaxEntries
+            restored = restored[:m.digestMaxEntries]
+        }
+        m.entries = restored
+        m.dropped += dropped
+}
+
+func (m *MailSender) digestLoop() {
+        defer close(m.finished)
+        ticker := time.NewTicker(time.Duration(m.config.DigestInterval) * time.Second)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-m.finish:
+                m.sendDigest()
+                return
+            case <-ticker.C:
+                m.sendDigest()
+            }
+        }
+}
+
+// Start is start
+func (m *MailSender) Start() (error) {
+        if m.config.DigestInterval <= 0 {
+            return nil
+        }
+        m.finish = make(chan bool)
+        m.finished = make(chan bool)
+        go m.digestLoop()
+        return nil
+}
+
+// Stop is stop
+func (m *MailSender) Stop() {
+        m.entriesMutex.Lock()
+        m.stopped = true
+        m.entriesMutex.Unlock()
+        if m.config.DigestInterval > 0 {
+            close(m.finish)
+            <-m.finished
+        }
+        m.smtpClient.Close()
+}
+
+// Flush is flush
+func (m *MailSender) Flush() {
 }
 
 // Notify is notify
-func (m *MailSender) Notify(msg []byte, fileID string, fileName string, label string) {
-	format := defaultSubjectFormat
-	if m.config.SubjectFormat != "" {
-	    format = m.config.SubjectFormat
-	}
-        r := strings.NewReplacer("${LABEL}", label, "${FILEID}", fileID, "${FILENAME}", fileName)
-        subject := r.Replace(format)
-        err := m.smtpClient.SendMail(subject, string(msg))
+func (m *MailSender) Notify(msg []byte, fileID string, fileName string, label string) (error) {
+        return m.NotifyEvent(&notifierplugger.Event{
+            Action: notifierplugger.EventTrigger,
+            Msg: msg,
+            FileID: fileID,
+            FileName: fileName,
+            Label: label,
+            Severity: "",
+            Pattern: "",
+        })
+}
+
+// NotifyEvent is notify event
+func (m *MailSender) NotifyEvent(event *notifierplugger.Event) (error) {
+        e := templater.NewParams(event)
+        m.entriesMutex.Lock()
+        if m.stopped {
+            m.entriesMutex.Unlock()
+            return errors.Errorf("mail sender is stopped (%v)", e.Label)
+        }
+        if m.config.DigestInterval > 0 {
+            defer m.entriesMutex.Unlock()
+            if int64(len(m.entries)) >= m.digestMaxEntries {
+                m.dropped++
+                return nil
+            }
+            m.entries = append(m.entries, e)
+            return nil
+        }
+        m.entriesMutex.Unlock()
+        subject, err := m.subjectTemplate.Execute(e)
         if err != nil {
-            log.Printf("can not send mail (%v, %v, %v, %v): %v", m.config.From, m.config.To, m.config.HostPort, subject, err)
+            return errors.Wrapf(err, "can not create subject (%v)", e.Label)
         }
+        textBody := string(event.Msg)
+        if m.bodyTemplate != nil {
+            textBody, err = m.bodyTemplate.Execute(e)
+            if err != nil {
+                return errors.Wrapf(err, "can not create body (%v)", e.Label)
+            }
+        }
+        return m.sendMail(subject, textBody, m.htmlBody(subject, []*templater.Params{ e }, 0))
 }
 
 // NewMailSender is create new mail sender
 func NewMailSender(callers string, configFile string) (notifierplugger.NotifierPlugin, error) {
     log.Printf("configFile = %v", configFile)
+    hostname, err := os.Hostname()
+    if err != nil {
+        return nil, errors.Wrap(err, "can not get hostname")
+    }
     configurator, err := configurator.NewConfigurator(configFile)
     if err != nil {
         return nil, errors.Wrapf(err, "can not create configurator (%v)", configFile)
@@ -45,15 +247,89 @@ func NewMailSender(callers string, configFile string) (notifierplugger.NotifierP
     if err != nil {
         return nil, errors.Wrapf(err, "can not load config (%v)", configFile)
     }
-    log.Printf("config = %v", config)
+    // password is used only for auth that is enabled by username
+    password := ""
+    if config.Username != "" {
+        password, err = utility.LoadSecret(config.Password, config.PasswordEnv, config.PasswordFile)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not load password (%v)", configFile)
+        }
+    }
+    redactedConfig := *config
+    if redactedConfig.Password != "" {
+        redactedConfig.Password = utility.Redact(redactedConfig.Password, redactedConfig.Password)
+    }
+    log.Printf("config = %v", redactedConfig)
+    subjectFormat := defaultSubjectFormat
+    if config.SubjectFormat != "" {
+        subjectFormat = legacyVariables.Replace(config.SubjectFormat)
+    }
+    subjectTemplate, err := templater.New("subject_format", subjectFormat, nil)
+    if err != nil {
+        return nil, errors.Wrapf(err, "invalid subject format (%v)", configFile)
+    }
+    var bodyTemplate *templater.Template
+    if config.BodyTemplate != "" {
+        bodyTemplate, err = templater.New("body_template", config.BodyTemplate, nil)
+        if err != nil {
+            return nil, errors.Wrapf(err, "invalid body template (%v)", configFile)
+        }
+    }
+    var htmlTemplate *templater.Template
+    if config.HTMLTemplate != "" {
+        htmlTemplateFile := config.HTMLTemplate
+        if !filepath.IsAbs(htmlTemplateFile) {
+            htmlTemplateFile = filepath.Join(filepath.Dir(configFile), htmlTemplateFile)
+        }
+        htmlTemplate, err = templater.NewHTMLFromFile(htmlTemplateFile, &templateParams{
+            Subject: "sample",
+            Hostname: hostname,
+            Entries: []*templater.Params{ templater.SampleParams() },
+            Dropped: 1,
+        })
+        if err != nil {
+            return nil, errors.Wrapf(err, "invalid html template (%v)", configFile)
+        }
+    }
+    digestSubjectFormat := defaultDigestSubjectFormat
+    if config.DigestSubjectFormat != "" {
+        digestSubjectFormat = legacyVariables.Replace(config.DigestSubjectFormat)
+    }
+    digestSubjectTemplate, err := templater.New("digest_subject_format", digestSubjectFormat, &digestSubjectParams{
+        Count: 1,
+        Labels: "sample",
+        Hostname: hostname,
+    })
+    if err != nil {
+        return nil, errors.Wrapf(err, "invalid digest subject format (%v)", configFile)
+    }
+    digestMaxEntries := defaultDigestMaxEntries
+    if config.DigestMaxEntries > 0 {
+        digestMaxEntries = config.DigestMaxEntries
+    }
+    idleTimeout := defaultIdleTimeout
+    if config.IdleTimeout > 0 {
+        idleTimeout = config.IdleTimeout
+    }
     newCallers := callers + ".mailsender"
     smtpClient := utility.NewSMTPClient(config.HostPort, config.Username,
-        config.Password, utility.GetSMTPAuthType(config.AuthType),
-        config.UseTLS, config.UseStartTLS, config.From, config.To)
+        password, utility.GetSMTPAuthType(config.AuthType),
+        config.UseTLS, config.UseStartTLS, config.From, config.To, config.Cc, config.Bcc,
+        time.Duration(idleTimeout) * time.Second)
     return &MailSender {
         callers: newCallers,
         config: config,
         smtpClient: smtpClient,
+        subjectTemplate: subjectTemplate,
+        bodyTemplate: bodyTemplate,
+        htmlTemplate: htmlTemplate,
+        digestSubjectTemplate: digestSubjectTemplate,
+        hostname: hostname,
+        digestMaxEntries: digestMaxEntries,
+        entries: make([]*templater.Params, 0),
+        dropped: 0,
+        entriesMutex: new(sync.Mutex),
+        stopped: false,
     }, nil
 }
 
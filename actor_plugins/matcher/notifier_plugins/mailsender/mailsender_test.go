@@ -0,0 +1,149 @@
+package main
+
+import (
+    "net"
+    "strings"
+    "testing"
+    "io/ioutil"
+    "path/filepath"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/templater"
+)
+
+func writeFile(t *testing.T, fileName string, content string) {
+    err := ioutil.WriteFile(fileName, []byte(content), 0644)
+    if err != nil {
+        t.Fatalf("can not write file (%v): %v", fileName, err)
+    }
+}
+
+func TestHTMLTemplateIsRelativeToConfigFile(t *testing.T) {
+    configDir := t.TempDir()
+    writeFile(t, filepath.Join(configDir, "mail.html.tmpl"), "<p>{{.Subject}}</p>")
+    configFile := filepath.Join(configDir, "mailsender.toml")
+    writeFile(t, configFile, "hostPort = \"127.0.0.1:25\"\nfrom = \"a@example.com\"\nto = \"b@example.com\"\nhtml_template = \"mail.html.tmpl\"\n")
+    notifier, err := NewMailSender("test", configFile)
+    if err != nil {
+        t.Fatalf("can not create mail sender: %v", err)
+    }
+    mailSender := notifier.(*MailSender)
+    if mailSender.htmlTemplate == nil {
+        t.Fatalf("no html template")
+    }
+    if body := mailSender.htmlBody("subject", nil, 0); body != "<p>subject</p>" {
+        t.Errorf("unexpected html body (%v)", body)
+    }
+}
+
+func TestPasswordIsNotLoadedWithoutAuth(t *testing.T) {
+    configFile := filepath.Join(t.TempDir(), "mailsender.toml")
+    writeFile(t, configFile, "hostPort = \"127.0.0.1:25\"\nusername = \"\"\npassword_env = \"LOG_MONITOR_TEST_UNSET_PASSWORD\"\nfrom = \"a@example.com\"\nto = \"b@example.com\"\n")
+    _, err := NewMailSender("test", configFile)
+    if err != nil {
+        t.Fatalf("can not create mail sender without auth: %v", err)
+    }
+    writeFile(t, configFile, "hostPort = \"127.0.0.1:25\"\nusername = \"user\"\npassword_env = \"LOG_MONITOR_TEST_UNSET_PASSWORD\"\nfrom = \"a@example.com\"\nto = \"b@example.com\"\n")
+    _, err = NewMailSender("test", configFile)
+    if err == nil {
+        t.Errorf("unset password is accepted with auth")
+    }
+}
+
+func testEvent(label string, msg string) (*notifierplugger.Event) {
+    return &notifierplugger.Event{
+        Action: notifierplugger.EventTrigger,
+        Msg: []byte(msg + "\n"),
+        FileID: "id1",
+        FileName: "/var/log/app.log",
+        Label: label,
+        Severity: "",
+        Pattern: "",
+    }
+}
+
+// closedHostPort is get address that refuses connection
+func closedHostPort(t *testing.T) (string) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("can not listen: %v", err)
+    }
+    hostPort := listener.Addr().String()
+    listener.Close()
+    return hostPort
+}
+
+func messages(mailSender *MailSender) (string) {
+    mailSender.entriesMutex.Lock()
+    defer mailSender.entriesMutex.Unlock()
+    result := make([]string, 0, len(mailSender.entries))
+    for _, e := range mailSender.entries {
+        result = append(result, strings.TrimSpace(e.Message))
+    }
+    return strings.Join(result, ",")
+}
+
+func TestFailedDigestIsKept(t *testing.T) {
+    configFile := filepath.Join(t.TempDir(), "mailsender.toml")
+    writeFile(t, configFile, "hostPort = \"" + closedHostPort(t) + "\"\nfrom = \"a@example.com\"\nto = \"b@example.com\"\ndigest_interval = 3600\ndigest_max_entries = 3\n")
+    notifier, err := NewMailSender("test", configFile)
+    if err != nil {
+        t.Fatalf("can not create mail sender: %v", err)
+    }
+    mailSender := notifier.(*MailSender)
+    for _, msg := range []string{ "m1", "m2" } {
+        err := mailSender.NotifyEvent(testEvent("app", msg))
+        if err != nil {
+            t.Fatalf("can not notify: %v", err)
+        }
+    }
+    mailSender.sendDigest()
+    if got := messages(mailSender); got != "m1,m2" {
+        t.Fatalf("failed digest is dropped (%v)", got)
+    }
+    // entries added while sending follow failed entries and entries over max are dropped
+    mailSender.entriesMutex.Lock()
+    entries := mailSender.entries
+    mailSender.entries = make([]*templater.Params, 0)
+    mailSender.entriesMutex.Unlock()
+    for _, msg := range []string{ "m3", "m4" } {
+        mailSender.NotifyEvent(testEvent("app", msg))
+    }
+    mailSender.restore(entries, 1)
+    if got := messages(mailSender); got != "m1,m2,m3" || mailSender.dropped != 2 {
+        t.Errorf("unexpected entries (%v, %v)", got, mailSender.dropped)
+    }
+    mailSender.sendDigest()
+    if got := messages(mailSender); got != "m1,m2,m3" || mailSender.dropped != 2 {
+        t.Errorf("unexpected entries after second failure (%v, %v)", got, mailSender.dropped)
+    }
+}
+
+func TestDigestNotifyEventAfterStop(t *testing.T) {
+    configFile := filepath.Join(t.TempDir(), "mailsender.toml")
+    writeFile(t, configFile, "hostPort = \"127.0.0.1:25\"\nfrom = \"a@example.com\"\nto = \"b@example.com\"\ndigest_interval = 3600\n")
+    notifier, err := NewMailSender("test", configFile)
+    if err != nil {
+        t.Fatalf("can not create mail sender: %v", err)
+    }
+    mailSender := notifier.(*MailSender)
+    err = mailSender.Start()
+    if err != nil {
+        t.Fatalf("can not start mail sender: %v", err)
+    }
+    mailSender.Stop()
+    err = mailSender.NotifyEvent(&notifierplugger.Event{
+        Action: notifierplugger.EventTrigger,
+        Msg: []byte("ERROR disk full\n"),
+        FileID: "id1",
+        FileName: "/var/log/app.log",
+        Label: "app",
+        Severity: "",
+        Pattern: "",
+    })
+    if err == nil {
+        t.Errorf("notification is accepted after stop")
+    }
+    if entries := len(mailSender.entries); entries != 0 {
+        t.Errorf("unexpected digest entries (%v)", entries)
+    }
+}
@@ -0,0 +1,47 @@
+package utility
+
+import (
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const redacted string = "********"
+
+// LoadSecret is load secret from environment variable, file or value in this order
+func LoadSecret(value string, envName string, fileName string) (string, error) {
+	if envName != "" {
+		secret, ok := os.LookupEnv(envName)
+		if !ok {
+			return "", errors.Errorf("not found environment variable (%v)", envName)
+		}
+		return secret, nil
+	}
+	if fileName != "" {
+		fi, err := os.Stat(fileName)
+		if err != nil {
+			return "", errors.Wrapf(err, "not found secret file (%v)", fileName)
+		}
+		if fi.Mode().Perm() & 0077 != 0 {
+			return "", errors.Errorf("secret file must not be accessible by group or others (%v, %v)", fileName, fi.Mode().Perm())
+		}
+		buf, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return "", errors.Wrapf(err, "can not read secret file (%v)", fileName)
+		}
+		return strings.TrimRight(string(buf), "\r\n"), nil
+	}
+	return value, nil
+}
+
+// Redact is replace secrets in text
+func Redact(text string, secrets ...string) (string) {
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		text = strings.Replace(text, secret, redacted, -1)
+	}
+	return text
+}
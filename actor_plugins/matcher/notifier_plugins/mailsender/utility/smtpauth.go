@@ -0,0 +1,82 @@
+package utility
+
+import (
+	"github.com/pkg/errors"
+	"net/smtp"
+)
+
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+// LoginAuth is create auth of LOGIN mechanism, it requires tls except localhost like PlainAuth
+func LoginAuth(username string, password string, host string) (smtp.Auth) {
+	return &loginAuth{
+		username: username,
+		password: password,
+		host:     host,
+	}
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch string(fromServer) {
+	case "Username:", "User Name\x00":
+		return []byte(a.username), nil
+	case "Password:", "Password\x00":
+		return []byte(a.password), nil
+	default:
+		return nil, errors.Errorf("unexpected server challenge (%v)", string(fromServer))
+	}
+}
+
+type xoauth2Auth struct {
+	username string
+	token    string
+	host     string
+}
+
+// XOAUTH2Auth is create auth of XOAUTH2 mechanism with oauth2 access token
+func XOAUTH2Auth(username string, token string, host string) (smtp.Auth) {
+	return &xoauth2Auth{
+		username: username,
+		token:    token,
+		host:     host,
+	}
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "XOAUTH2", []byte("user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// server sends error detail as challenge, empty response finishes exchange
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+func isLocalhost(name string) (bool) {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
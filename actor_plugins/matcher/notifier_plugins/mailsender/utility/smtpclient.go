@@ -3,10 +3,20 @@ package utility
 import (
 	"github.com/pkg/errors"
 	"net"
+	"os"
+	"bytes"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net/mail"
 	"net/smtp"
+	"net/textproto"
 	"strings"
+	"sync"
+	"time"
 	"fmt"
 	"log"
 )
@@ -18,6 +28,10 @@ const (
 	SMTPAuthPLAIN   SMTPAuthType = "PLAIN"
 	// AMTPAuthCRAMMD5 is SMTPAuthUnkown
 	AMTPAuthCRAMMD5 SMTPAuthType = "CRAM-MD5"
+	// SMTPAuthLOGIN is SMTPAuthLOGIN
+	SMTPAuthLOGIN   SMTPAuthType = "LOGIN"
+	// SMTPAuthXOAUTH2 is SMTPAuthXOAUTH2
+	SMTPAuthXOAUTH2 SMTPAuthType = "XOAUTH2"
 )
 
 // SMTPAuthType is SMTPAuthType
@@ -34,6 +48,10 @@ func GetSMTPAuthType(authType string) (SMTPAuthType) {
 		return SMTPAuthPLAIN
 	case AMTPAuthCRAMMD5.String():
 		return AMTPAuthCRAMMD5
+	case SMTPAuthLOGIN.String():
+		return SMTPAuthLOGIN
+	case SMTPAuthXOAUTH2.String():
+		return SMTPAuthXOAUTH2
 	default:
 		return SMTPAuthUnkown
 	}
@@ -49,35 +67,149 @@ type SMTPClient struct {
 	useStartTLS bool
 	from        string
 	to          string
+	cc          string
+	bcc         string
+	idleTimeout time.Duration
+	client      *smtp.Client
+	lastUsed    time.Time
+	mutex       *sync.Mutex
 }
 
-// SendMail is send mail
-func (s *SMTPClient) SendMail(subject string, body string) (error) {
-	from := mail.Address{
-		Address: s.from,
+func parseAddressList(list string) ([]*mail.Address, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
 	}
-	toList, err := mail.ParseAddressList(s.to)
+	return mail.ParseAddressList(list)
+}
+
+func formatAddressList(addressList []*mail.Address) (string) {
+	formatted := make([]string, 0, len(addressList))
+	for _, address := range addressList {
+		formatted = append(formatted, address.String())
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func messageID(from *mail.Address) (string) {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	domain := from.Address[strings.LastIndex(from.Address, "@") + 1:]
+	if domain == "" {
+		domain, _ = os.Hostname()
+	}
+	return fmt.Sprintf("<%v.%v@%v>", time.Now().UnixNano(), hex.EncodeToString(buf), domain)
+}
+
+func writeQuotedPrintable(w *bytes.Buffer, body string) {
+	qw := quotedprintable.NewWriter(w)
+	qw.Write([]byte(body))
+	qw.Close()
+}
+
+func buildMessage(from *mail.Address, toList []*mail.Address, ccList []*mail.Address, subject string, textBody string, htmlBody string) ([]byte, error) {
+	message := new(bytes.Buffer)
+	fmt.Fprintf(message, "From: %s\r\n", from.String())
+	fmt.Fprintf(message, "To: %s\r\n", formatAddressList(toList))
+	if len(ccList) > 0 {
+		fmt.Fprintf(message, "Cc: %s\r\n", formatAddressList(ccList))
+	}
+	fmt.Fprintf(message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(message, "Message-ID: %s\r\n", messageID(from))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	if htmlBody == "" {
+		message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		message.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+		message.WriteString("\r\n")
+		writeQuotedPrintable(message, textBody)
+		return message.Bytes(), nil
+	}
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fmt.Fprintf(message, "Content-Type: multipart/alternative; boundary=%s\r\n", mw.Boundary())
+	message.WriteString("\r\n")
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{ "text/plain; charset=UTF-8", textBody },
+		{ "text/html; charset=UTF-8", htmlBody },
+	}
+	for _, part := range parts {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, errors.Wrap(err, "can not create mime part")
+		}
+		partBody := new(bytes.Buffer)
+		writeQuotedPrintable(partBody, part.content)
+		pw.Write(partBody.Bytes())
+	}
+	err := mw.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "can not close mime writer")
+	}
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// SendMail is send mail, html body is optional
+func (s *SMTPClient) SendMail(subject string, textBody string, htmlBody string) (error) {
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("can not parse mail address (from = %v)", s.from))
+	}
+	toList, err := parseAddressList(s.to)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("can not parse mail address list (to = %v)", s.to))
 	}
-	message := ""
-	message += fmt.Sprintf("From: %s\r\n", s.from)
-	message += fmt.Sprintf("To: %s\r\n", s.to)
-	message += fmt.Sprintf("Subject: %s\r\n", subject)
-	message += "\r\n" + body
+	ccList, err := parseAddressList(s.cc)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("can not parse mail address list (cc = %v)", s.cc))
+	}
+	bccList, err := parseAddressList(s.bcc)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("can not parse mail address list (bcc = %v)", s.bcc))
+	}
+	if len(toList) + len(ccList) + len(bccList) == 0 {
+		return errors.New("no recipients")
+	}
+	// bcc recipients are not written into header
+	message, err := buildMessage(from, toList, ccList, subject, textBody, htmlBody)
+	if err != nil {
+		return errors.Wrap(err, "can not build message")
+	}
 
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err = s.send(from, toList, ccList, bccList, message)
+	if err != nil {
+		return errors.New(Redact(err.Error(), s.password))
+	}
+	return nil
+}
+
+func (s *SMTPClient) connect() (*smtp.Client, error) {
 	host, _, _ := net.SplitHostPort(s.hostPort)
 
 	var auth smtp.Auth
 	if s.username != "" {
-		if s.authType == SMTPAuthPLAIN {
+		switch s.authType {
+		case SMTPAuthPLAIN:
 			auth = smtp.PlainAuth("", s.username, s.password, host)
-		} else if s.authType == AMTPAuthCRAMMD5 {
+		case AMTPAuthCRAMMD5:
 			auth = smtp.CRAMMD5Auth(s.username, s.password)
+		case SMTPAuthLOGIN:
+			auth = LoginAuth(s.username, s.password, host)
+		case SMTPAuthXOAUTH2:
+			auth = XOAUTH2Auth(s.username, s.password, host)
 		}
 	}
 
 	var conn net.Conn
+	var err error
 	if s.useTLS {
 		tlsContext := &tls.Config{
 			ServerName:         host,
@@ -85,19 +217,19 @@ func (s *SMTPClient) SendMail(subject string, body string) (error) {
 		}
 		conn, err = tls.Dial("tcp", s.hostPort, tlsContext)
 		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("can not connect mail host with tls (host port = %v, use tls = %v)", s.hostPort, s.useTLS))
+			return nil, errors.Wrap(err, fmt.Sprintf("can not connect mail host with tls (host port = %v, use tls = %v)", s.hostPort, s.useTLS))
 		}
 	} else {
 		conn, err = net.Dial("tcp", s.hostPort)
 		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("can not connect mail host (host port = %v)", s.hostPort))
+			return nil, errors.Wrap(err, fmt.Sprintf("can not connect mail host (host port = %v)", s.hostPort))
 		}
 	}
-	defer conn.Close()
 
 	client, err := smtp.NewClient(conn, host)
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("can not create smtp client (host port = %v)", s.hostPort))
+		conn.Close()
+		return nil, errors.Wrap(err, fmt.Sprintf("can not create smtp client (host port = %v)", s.hostPort))
 	}
 
 	if s.useStartTLS {
@@ -106,27 +238,64 @@ func (s *SMTPClient) SendMail(subject string, body string) (error) {
 			InsecureSkipVerify: false,
 		}
 		if err = client.StartTLS(tlsconfig); err != nil {
-			return errors.Wrap(err, fmt.Sprintf("can not start tls (host port = %v, use start tls = %v)", s.hostPort, s.useStartTLS))
+			client.Close()
+			return nil, errors.Wrap(err, fmt.Sprintf("can not start tls (host port = %v, use start tls = %v)", s.hostPort, s.useStartTLS))
 		}
 	}
 
 	if auth != nil {
 		if err = client.Auth(auth); err != nil {
-			return errors.Wrap(err, fmt.Sprintf("can not authentication (host port = %v authType = %v, username = %v password = %v)", s.hostPort, s.authType, s.username, s.password))
+			client.Close()
+			return nil, errors.Wrap(err, fmt.Sprintf("can not authentication (host port = %v, authType = %v, username = %v)", s.hostPort, s.authType, s.username))
+		}
+	}
+	return client, nil
+}
+
+// getClient is reuse connection if it is alive, otherwise connect
+func (s *SMTPClient) getClient() (*smtp.Client, error) {
+	if s.client != nil {
+		if time.Since(s.lastUsed) < s.idleTimeout && s.client.Reset() == nil {
+			return s.client, nil
 		}
+		s.close()
 	}
+	client, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	s.client = client
+	return client, nil
+}
 
-	if err = client.Mail(from.Address); err != nil {
-		return errors.Wrap(err, fmt.Sprintf("can not send MAIL command (from = %v)", from.Address))
+func (s *SMTPClient) send(from *mail.Address, toList []*mail.Address, ccList []*mail.Address, bccList []*mail.Address, message []byte) (error) {
+	client, err := s.getClient()
+	if err != nil {
+		return err
+	}
+	err = s.transaction(client, from, toList, ccList, bccList, message)
+	if err != nil {
+		// connection state is unknown after failure
+		s.close()
+		return err
 	}
+	s.lastUsed = time.Now()
+	return nil
+}
 
-	var emails []string
-	for _, to := range toList {
-		emails = append(emails, to.Address)
+func (s *SMTPClient) transaction(client *smtp.Client, from *mail.Address, toList []*mail.Address, ccList []*mail.Address, bccList []*mail.Address, message []byte) (error) {
+	if err := client.Mail(from.Address); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("can not send MAIL command (from = %v)", from.Address))
 	}
-	recept := strings.Join(emails, ",")
-	if err = client.Rcpt(recept); err != nil {
-		return errors.Wrap(err, fmt.Sprintf("can not send RCPT command (recept = %v)", recept))
+
+	recipients := make([]*mail.Address, 0, len(toList) + len(ccList) + len(bccList))
+	recipients = append(recipients, toList...)
+	recipients = append(recipients, ccList...)
+	recipients = append(recipients, bccList...)
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient.Address); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("can not send RCPT command (recipient = %v)", recipient.Address))
+		}
 	}
 
 	w, err := client.Data()
@@ -134,7 +303,7 @@ func (s *SMTPClient) SendMail(subject string, body string) (error) {
 		return errors.Wrap(err, "can not send DATA command")
 	}
 
-	_, err = w.Write([]byte(message))
+	_, err = w.Write(message)
 	if err != nil {
 		w.Close()
 		return errors.Wrap(err, "can not write message")
@@ -142,19 +311,33 @@ func (s *SMTPClient) SendMail(subject string, body string) (error) {
 
 	err = w.Close()
 	if err != nil {
-		log.Printf("can not close message writer (reason = %v)", err)
+		return errors.Wrap(err, "can not close message writer")
 	}
 
-	err = client.Quit()
+	return nil
+}
+
+func (s *SMTPClient) close() {
+	if s.client == nil {
+		return
+	}
+	err := s.client.Quit()
 	if err != nil {
-		log.Printf("can not send QUIT command (reason = %v)", err)
+		log.Printf("can not send QUIT command (reason = %v)", Redact(err.Error(), s.password))
+		s.client.Close()
 	}
+	s.client = nil
+}
 
-	return nil
+// Close is close reused connection
+func (s *SMTPClient) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.close()
 }
 
 // NewSMTPClient is create smtp client
-func NewSMTPClient(hostPort string, username string, password string, authtype SMTPAuthType, useTLS bool, useStartTLS bool, from string, to string) (n *SMTPClient) {
+func NewSMTPClient(hostPort string, username string, password string, authtype SMTPAuthType, useTLS bool, useStartTLS bool, from string, to string, cc string, bcc string, idleTimeout time.Duration) (n *SMTPClient) {
 	return &SMTPClient{
 		hostPort:    hostPort,
 		username:    username,
@@ -164,5 +347,10 @@ func NewSMTPClient(hostPort string, username string, password string, authtype S
 		useStartTLS: useStartTLS,
 		from:        from,
 		to:          to,
+		cc:          cc,
+		bcc:         bcc,
+		idleTimeout: idleTimeout,
+		client:      nil,
+		mutex:       new(sync.Mutex),
 	}
 }
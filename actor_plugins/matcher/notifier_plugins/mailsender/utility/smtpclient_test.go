@@ -0,0 +1,362 @@
+package utility
+
+import (
+	"mime"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"encoding/base64"
+	"net/mail"
+	"net/textproto"
+)
+
+type fakeSMTPServer struct {
+	listener    net.Listener
+	mutex       *sync.Mutex
+	connections int
+	commands    []string
+	messages    []string
+	username    string
+	password    string
+}
+
+// newFakeSMTPServer is create smtp server that accepts every command and records them
+func newFakeSMTPServer(t *testing.T) (*fakeSMTPServer) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can not listen: %v", err)
+	}
+	s := &fakeSMTPServer{
+		listener:    listener,
+		mutex:       new(sync.Mutex),
+		connections: 0,
+		commands:    make([]string, 0),
+		messages:    make([]string, 0),
+		username:    "",
+		password:    "",
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.connections++
+		s.mutex.Unlock()
+		go s.handle(textproto.NewConn(conn))
+	}
+}
+
+func (s *fakeSMTPServer) record(command string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.commands = append(s.commands, command)
+}
+
+// challenge is send base64 challenge and read decoded response
+func challenge(conn *textproto.Conn, text string) (string, error) {
+	conn.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(text)))
+	line, err := conn.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	response, err := base64.StdEncoding.DecodeString(line)
+	return string(response), err
+}
+
+// auth is run LOGIN or XOAUTH2 exchange, failure reply echoes received secret like careless servers do
+func (s *fakeSMTPServer) auth(conn *textproto.Conn, args []string) (error) {
+	var username, secret string
+	switch strings.ToUpper(args[0]) {
+	case "LOGIN":
+		var err error
+		username, err = challenge(conn, "Username:")
+		if err != nil {
+			return err
+		}
+		secret, err = challenge(conn, "Password:")
+		if err != nil {
+			return err
+		}
+	case "XOAUTH2":
+		if len(args) < 2 {
+			return conn.PrintfLine("501 no initial response")
+		}
+		initial, err := base64.StdEncoding.DecodeString(args[1])
+		if err != nil {
+			return conn.PrintfLine("501 invalid initial response")
+		}
+		fields := strings.Split(string(initial), "\x01")
+		if len(fields) != 4 || !strings.HasPrefix(fields[0], "user=") || !strings.HasPrefix(fields[1], "auth=Bearer ") {
+			return conn.PrintfLine("501 invalid initial response")
+		}
+		username = strings.TrimPrefix(fields[0], "user=")
+		secret = strings.TrimPrefix(fields[1], "auth=Bearer ")
+		if username != s.username || secret != s.password {
+			// error detail is sent as challenge and client finishes with empty response
+			_, err := challenge(conn, "{\"status\":\"401\"}")
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return conn.PrintfLine("504 unsupported mechanism")
+	}
+	if username != s.username || secret != s.password {
+		return conn.PrintfLine("535 authentication failed (%s, %s)", username, secret)
+	}
+	return conn.PrintfLine("235 accepted")
+}
+
+func (s *fakeSMTPServer) handle(conn *textproto.Conn) {
+	defer conn.Close()
+	conn.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		s.record(line)
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO":
+			conn.PrintfLine("250-localhost")
+			conn.PrintfLine("250-AUTH LOGIN XOAUTH2")
+			conn.PrintfLine("250 8BITMIME")
+		case "AUTH":
+			if s.auth(conn, strings.Fields(line)[1:]) != nil {
+				return
+			}
+		case "DATA":
+			conn.PrintfLine("354 go ahead")
+			lines, err := conn.ReadDotLines()
+			if err != nil {
+				return
+			}
+			s.mutex.Lock()
+			s.messages = append(s.messages, strings.Join(lines, "\r\n"))
+			s.mutex.Unlock()
+			conn.PrintfLine("250 queued")
+		case "QUIT":
+			conn.PrintfLine("221 bye")
+			return
+		default:
+			conn.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) received() (int, []string, []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.connections, append([]string(nil), s.commands...), append([]string(nil), s.messages...)
+}
+
+func (s *fakeSMTPServer) hostPort() (string) {
+	return s.listener.Addr().String()
+}
+
+func newTestSMTPClient(hostPort string, to string, cc string, bcc string) (*SMTPClient) {
+	return NewSMTPClient(hostPort, "", "", SMTPAuthUnkown, false, false, "Sender <from@example.com>", to, cc, bcc, time.Minute)
+}
+
+func filterCommands(commands []string, prefix string) ([]string) {
+	filtered := make([]string, 0, len(commands))
+	for _, command := range commands {
+		if strings.HasPrefix(command, prefix) {
+			filtered = append(filtered, command)
+		}
+	}
+	return filtered
+}
+
+func TestRecipients(t *testing.T) {
+	tests := []struct {
+		name     string
+		to       string
+		cc       string
+		bcc      string
+		expected []string
+	}{
+		{ "to only", "a@example.com", "", "", []string{ "RCPT TO:<a@example.com>" } },
+		{ "multiple to", "A <a@example.com>, b@example.com", "", "",
+			[]string{ "RCPT TO:<a@example.com>", "RCPT TO:<b@example.com>" } },
+		{ "cc and bcc", "a@example.com", "c@example.com", "d@example.com, e@example.com",
+			[]string{ "RCPT TO:<a@example.com>", "RCPT TO:<c@example.com>", "RCPT TO:<d@example.com>", "RCPT TO:<e@example.com>" } },
+		{ "bcc only", "", "", "d@example.com", []string{ "RCPT TO:<d@example.com>" } },
+	}
+	for _, test := range tests {
+		server := newFakeSMTPServer(t)
+		client := newTestSMTPClient(server.hostPort(), test.to, test.cc, test.bcc)
+		err := client.SendMail("subject", "body", "")
+		client.Close()
+		if err != nil {
+			t.Fatalf("%v: can not send mail: %v", test.name, err)
+		}
+		_, commands, messages := server.received()
+		rcpts := filterCommands(commands, "RCPT")
+		if strings.Join(rcpts, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("%v: unexpected recipients (%v, %v)", test.name, rcpts, test.expected)
+		}
+		if len(messages) != 1 {
+			t.Fatalf("%v: unexpected messages (%v)", test.name, len(messages))
+		}
+		if strings.Contains(messages[0], "<d@example.com>") || strings.Contains(messages[0], "Bcc:") {
+			t.Errorf("%v: bcc is written into message (%v)", test.name, messages[0])
+		}
+	}
+}
+
+func TestNoRecipients(t *testing.T) {
+	client := newTestSMTPClient("127.0.0.1:1", "", "", "")
+	err := client.SendMail("subject", "body", "")
+	if err == nil {
+		t.Errorf("mail without recipients is sent")
+	}
+}
+
+func TestMessageHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		htmlBody    string
+		contentType string
+	}{
+		{ "text only", "", "text/plain; charset=UTF-8" },
+		{ "with html", "<p>body</p>", "multipart/alternative; boundary=" },
+	}
+	for _, test := range tests {
+		server := newFakeSMTPServer(t)
+		client := newTestSMTPClient(server.hostPort(), "a@example.com", "c@example.com", "d@example.com")
+		err := client.SendMail("ディスク full", "body", test.htmlBody)
+		client.Close()
+		if err != nil {
+			t.Fatalf("%v: can not send mail: %v", test.name, err)
+		}
+		_, _, messages := server.received()
+		if len(messages) != 1 {
+			t.Fatalf("%v: unexpected messages (%v)", test.name, len(messages))
+		}
+		msg, err := mail.ReadMessage(strings.NewReader(messages[0] + "\r\n"))
+		if err != nil {
+			t.Fatalf("%v: can not parse message: %v", test.name, err)
+		}
+		header := msg.Header
+		if from := header.Get("From"); from != "\"Sender\" <from@example.com>" {
+			t.Errorf("%v: unexpected from (%v)", test.name, from)
+		}
+		if to, cc := header.Get("To"), header.Get("Cc"); to != "<a@example.com>" || cc != "<c@example.com>" {
+			t.Errorf("%v: unexpected to and cc (%v, %v)", test.name, to, cc)
+		}
+		if subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject")); err != nil || subject != "ディスク full" {
+			t.Errorf("%v: unexpected subject (%v, %v)", test.name, subject, err)
+		}
+		if header.Get("MIME-Version") != "1.0" {
+			t.Errorf("%v: no mime version", test.name)
+		}
+		if contentType := header.Get("Content-Type"); !strings.HasPrefix(contentType, test.contentType) {
+			t.Errorf("%v: unexpected content type (%v)", test.name, contentType)
+		}
+		if _, err := header.Date(); err != nil {
+			t.Errorf("%v: invalid date (%v)", test.name, err)
+		}
+		messageID := header.Get("Message-ID")
+		if !strings.HasPrefix(messageID, "<") || !strings.HasSuffix(messageID, "@example.com>") {
+			t.Errorf("%v: unexpected message id (%v)", test.name, messageID)
+		}
+		if _, ok := header["Bcc"]; ok {
+			t.Errorf("%v: bcc header is written", test.name)
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		authType SMTPAuthType
+		password string
+		success  bool
+	}{
+		{ "login", SMTPAuthLOGIN, "secret-password", true },
+		{ "login with wrong password", SMTPAuthLOGIN, "wrong-password", false },
+		{ "xoauth2", SMTPAuthXOAUTH2, "secret-password", true },
+		{ "xoauth2 with wrong token", SMTPAuthXOAUTH2, "wrong-password", false },
+	}
+	for _, test := range tests {
+		server := newFakeSMTPServer(t)
+		server.username = "user"
+		server.password = "secret-password"
+		client := NewSMTPClient(server.hostPort(), "user", test.password, test.authType, false, false, "from@example.com", "a@example.com", "", "", time.Minute)
+		err := client.SendMail("subject", "body", "")
+		client.Close()
+		_, commands, messages := server.received()
+		if !test.success {
+			if err == nil {
+				t.Fatalf("%v: wrong credential is accepted", test.name)
+			}
+			// server echoes password in its reply
+			if strings.Contains(err.Error(), test.password) || !strings.Contains(err.Error(), redacted) {
+				t.Errorf("%v: password is not redacted (%v)", test.name, err)
+			}
+			if len(messages) != 0 {
+				t.Errorf("%v: mail is sent without authentication", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: can not send mail: %v", test.name, err)
+		}
+		if auth := filterCommands(commands, "AUTH"); len(auth) != 1 || !strings.HasPrefix(auth[0], "AUTH " + test.authType.String()) {
+			t.Errorf("%v: unexpected auth command (%v)", test.name, auth)
+		}
+		if len(messages) != 1 {
+			t.Errorf("%v: unexpected messages (%v)", test.name, len(messages))
+		}
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	client := newTestSMTPClient(server.hostPort(), "a@example.com", "", "")
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		err := client.SendMail("subject", "body", "")
+		if err != nil {
+			t.Fatalf("can not send mail: %v", err)
+		}
+	}
+	connections, commands, _ := server.received()
+	if connections != 1 {
+		t.Errorf("connection is not reused (%v)", connections)
+	}
+	verbs := make([]string, 0, len(commands))
+	for _, command := range commands {
+		verb := strings.SplitN(command, " ", 2)[0]
+		if verb == "MAIL" || verb == "RSET" || verb == "EHLO" || verb == "QUIT" {
+			verbs = append(verbs, verb)
+		}
+	}
+	// reused connection is checked by RSET before next transaction
+	if got := strings.Join(verbs, ","); got != "EHLO,MAIL,RSET,MAIL" {
+		t.Errorf("unexpected commands (%v)", got)
+	}
+	// idle connection is closed and new one is opened
+	client.mutex.Lock()
+	client.lastUsed = time.Now().Add(-2 * time.Minute)
+	client.mutex.Unlock()
+	err := client.SendMail("subject", "body", "")
+	if err != nil {
+		t.Fatalf("can not send mail after idle timeout: %v", err)
+	}
+	connections, commands, _ = server.received()
+	if connections != 2 || len(filterCommands(commands, "QUIT")) != 1 {
+		t.Errorf("idle connection is not replaced (%v, %v)", connections, commands)
+	}
+}
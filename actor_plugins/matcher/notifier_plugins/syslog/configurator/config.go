@@ -0,0 +1,24 @@
+package configurator
+
+// Config is Config
+// network is "udp", "tcp" or "tls"
+// message_template is text/template of templater for MSG part
+// hostname is used for logs of local files, logs of other host are sent with their host
+type Config struct {
+        Network            string `json:"network"              yaml:"network"              toml:"network"`
+        Address            string `json:"address"              yaml:"address"              toml:"address"`
+        Facility           string `json:"facility"             yaml:"facility"             toml:"facility"`
+        Severity           string `json:"severity"             yaml:"severity"             toml:"severity"`
+        Hostname           string `json:"hostname"             yaml:"hostname"             toml:"hostname"`
+        MsgID              string `json:"msg_id"               yaml:"msg_id"               toml:"msg_id"`
+        SDID               string `json:"sd_id"                yaml:"sd_id"                toml:"sd_id"`
+        MessageTemplate    string `json:"message_template"     yaml:"message_template"     toml:"message_template"`
+        Timeout            int64  `json:"timeout"              yaml:"timeout"              toml:"timeout"`
+        ReconnectInterval  int64  `json:"reconnect_interval"   yaml:"reconnect_interval"   toml:"reconnect_interval"`
+        MaxMessageSize     int64  `json:"max_message_size"     yaml:"max_message_size"     toml:"max_message_size"`
+        CAFile             string `json:"ca_file"              yaml:"ca_file"              toml:"ca_file"`
+        CertFile           string `json:"cert_file"            yaml:"cert_file"            toml:"cert_file"`
+        KeyFile            string `json:"key_file"             yaml:"key_file"             toml:"key_file"`
+        ServerName         string `json:"server_name"          yaml:"server_name"          toml:"server_name"`
+        InsecureSkipVerify bool   `json:"insecure_skip_verify" yaml:"insecure_skip_verify" toml:"insecure_skip_verify"`
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+    "os"
+    "log"
+    "time"
+    "bytes"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/templater"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifier_plugins/syslog/utility"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifier_plugins/syslog/configurator"
+)
+
+const (
+        defaultNetwork string = "udp"
+        defaultFacility string = "user"
+        defaultSeverity string = "warning"
+        defaultSDID string = "logmonitor@32473"
+        defaultTimeout int64 = 10
+        defaultReconnectInterval int64 = 5
+        defaultUDPMessageSize int64 = 2048
+        defaultStreamMessageSize int64 = 8192
+        nilValue string = "-"
+)
+
+var facilities = map[string]int{
+        "kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+        "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14,
+        "local0": 16, "local1": 17, "local2": 18, "local3": 19,
+        "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var severities = map[string]int{
+        "emerg": 0, "alert": 1, "crit": 2, "critical": 2, "err": 3, "error": 3,
+        "warning": 4, "warn": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+// Syslog is Syslog
+type Syslog struct {
+        callers string
+        config *configurator.Config
+        syslogClient *utility.SyslogClient
+        messageTemplate *templater.Template
+        hostname string
+        procID string
+        msgID string
+        sdID string
+        facility int
+        severity int
+        maxMessageSize int64
+}
+
+// header fields are printable us-ascii without space (RFC5424 section 6)
+func (s *Syslog) headerField(value string, maxLength int) (string) {
+        field := strings.Map(func(r rune) rune {
+            if r < 33 || r > 126 {
+                return '_'
+            }
+            return r
+        }, value)
+        if field == "" {
+            return nilValue
+        }
+        if len(field) > maxLength {
+            field = field[:maxLength]
+        }
+        return field
+}
+
+func (s *Syslog) paramValue(value string) (string) {
+        r := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "]", "\\]")
+        return r.Replace(value)
+}
+
+func (s *Syslog) severityOf(severity string) (int) {
+        value, ok := severities[severity]
+        if ok {
+            return value
+        }
+        return s.severity
+}
+
+func (s *Syslog) message(event *notifierplugger.Event) ([]byte, error) {
+        if s.messageTemplate == nil {
+            return bytes.TrimRight(event.Msg, "\r\n"), nil
+        }
+        msg, err := s.messageTemplate.Execute(templater.NewParams(event))
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not create message (%v)", event.Label)
+        }
+        return []byte(strings.TrimRight(msg, "\r\n")), nil
+}
+
+func (s *Syslog) format(event *notifierplugger.Event) ([]byte, error) {
+        msg, err := s.message(event)
+        if err != nil {
+            return nil, err
+        }
+        // logs of other host are reported with their host
+        hostname := s.hostname
+        if event.Host != "" {
+            hostname = event.Host
+        }
+        buf := new(bytes.Buffer)
+        buf.WriteString("<")
+        buf.WriteString(strconv.Itoa(s.facility * 8 + s.severityOf(event.Severity)))
+        buf.WriteString(">1 ")
+        buf.WriteString(time.Now().Format("2006-01-02T15:04:05.000000Z07:00"))
+        buf.WriteString(" ")
+        buf.WriteString(s.headerField(hostname, 255))
+        buf.WriteString(" ")
+        buf.WriteString(s.headerField(event.Label, 48))
+        buf.WriteString(" ")
+        buf.WriteString(s.procID)
+        buf.WriteString(" ")
+        buf.WriteString(s.msgID)
+        buf.WriteString(" [")
+        buf.WriteString(s.sdID)
+        buf.WriteString(" fileName=\"")
+        buf.WriteString(s.paramValue(event.FileName))
+        buf.WriteString("\" fileID=\"")
+        buf.WriteString(s.paramValue(event.FileID))
+        buf.WriteString("\"")
+        if event.Action != notifierplugger.EventTrigger {
+            buf.WriteString(" action=\"")
+            buf.WriteString(s.paramValue(event.Action))
+            buf.WriteString("\"")
+        }
+        buf.WriteString("] ")
+        if utf8.Valid(msg) {
+            buf.WriteString("\xEF\xBB\xBF")
+        }
+        buf.Write(msg)
+        // truncated MSG must be valid utf8 after BOM
+        return []byte(templater.Truncate(int(s.maxMessageSize), buf.String())), nil
+}
+
+func (s *Syslog) send(event *notifierplugger.Event) (error) {
+        formatted, err := s.format(event)
+        if err != nil {
+            return err
+        }
+        err = s.syslogClient.Send(formatted)
+        if err != nil {
+            return errors.Wrapf(err, "can not send syslog message (%v, %v)", s.config.Address, event.Label)
+        }
+        return nil
+}
+
+// Start is start
+func (s *Syslog) Start() (error) {
+        return nil
+}
+
+// Stop is stop
+func (s *Syslog) Stop() {
+        s.syslogClient.Close()
+}
+
+// Flush is flush
+func (s *Syslog) Flush() {
+}
+
+// Notify is notify
+func (s *Syslog) Notify(msg []byte, fileID string, fileName string, label string) (error) {
+        return s.send(&notifierplugger.Event{
+            Action: notifierplugger.EventTrigger,
+            Msg: msg,
+            FileID: fileID,
+            FileName: fileName,
+            Label: label,
+            Severity: "",
+            Pattern: "",
+        })
+}
+
+// NotifyEvent is notify event
+func (s *Syslog) NotifyEvent(event *notifierplugger.Event) (error) {
+        return s.send(event)
+}
+
+// NewSyslog is create new syslog notifier
+func NewSyslog(callers string, configFile string) (notifierplugger.NotifierPlugin, error) {
+    log.Printf("configFile = %v", configFile)
+    configurator, err := configurator.NewConfigurator(configFile)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not create configurator (%v)", configFile)
+    }
+    config, err := configurator.Load()
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not load config (%v)", configFile)
+    }
+    log.Printf("config = %+v", config)
+    if config.Address == "" {
+        return nil, errors.Errorf("no address (%v)", configFile)
+    }
+    hostname := config.Hostname
+    if hostname == "" {
+        hostname, err = os.Hostname()
+        if err != nil {
+            return nil, errors.Wrap(err, "can not get hostname")
+        }
+    }
+    network := defaultNetwork
+    if config.Network != "" {
+        network = config.Network
+    }
+    facilityName := defaultFacility
+    if config.Facility != "" {
+        facilityName = config.Facility
+    }
+    facility, ok := facilities[facilityName]
+    if !ok {
+        return nil, errors.Errorf("unexpected facility (%v)", facilityName)
+    }
+    severityName := defaultSeverity
+    if config.Severity != "" {
+        severityName = config.Severity
+    }
+    severity, ok := severities[severityName]
+    if !ok {
+        return nil, errors.Errorf("unexpected severity (%v)", severityName)
+    }
+    sdID := defaultSDID
+    if config.SDID != "" {
+        sdID = config.SDID
+    }
+    timeout := defaultTimeout
+    if config.Timeout > 0 {
+        timeout = config.Timeout
+    }
+    reconnectInterval := defaultReconnectInterval
+    if config.ReconnectInterval > 0 {
+        reconnectInterval = config.ReconnectInterval
+    }
+    maxMessageSize := defaultStreamMessageSize
+    if network == "udp" {
+        maxMessageSize = defaultUDPMessageSize
+    }
+    if config.MaxMessageSize > 0 {
+        maxMessageSize = config.MaxMessageSize
+    }
+    var messageTemplate *templater.Template
+    if config.MessageTemplate != "" {
+        messageTemplate, err = templater.New("message_template", config.MessageTemplate, nil)
+        if err != nil {
+            return nil, errors.Wrapf(err, "invalid message template (%v)", configFile)
+        }
+    }
+    tlsConfig := &utility.TLSConfig{
+        CAFile: config.CAFile,
+        CertFile: config.CertFile,
+        KeyFile: config.KeyFile,
+        ServerName: config.ServerName,
+        InsecureSkipVerify: config.InsecureSkipVerify,
+    }
+    syslogClient, err := utility.NewSyslogClient(network, config.Address, time.Duration(timeout) * time.Second,
+        time.Duration(reconnectInterval) * time.Second, tlsConfig)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not create syslog client (%v)", configFile)
+    }
+    newCallers := callers + ".syslog"
+    s := &Syslog {
+        callers: newCallers,
+        config: config,
+        syslogClient: syslogClient,
+        messageTemplate: messageTemplate,
+        hostname: hostname,
+        procID: strconv.Itoa(os.Getpid()),
+        facility: facility,
+        severity: severity,
+        maxMessageSize: maxMessageSize,
+    }
+    s.msgID = s.headerField(config.MsgID, 32)
+    s.sdID = s.headerField(sdID, 32)
+    return s, nil
+}
+
+// GetNotifierPluginInfo is GetNotifierPluginInfo
+func GetNotifierPluginInfo() (string, notifierplugger.NotifierPluginNewFunc) {
+    return "syslog", NewSyslog
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+    "io"
+    "net"
+    "time"
+    "bufio"
+    "bytes"
+    "strconv"
+    "strings"
+    "testing"
+    "io/ioutil"
+    "path/filepath"
+    "unicode/utf8"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+)
+
+const bom string = "\xEF\xBB\xBF"
+
+func newTestSyslog(t *testing.T, config string) (*Syslog) {
+    configFile := filepath.Join(t.TempDir(), "syslog.toml")
+    err := ioutil.WriteFile(configFile, []byte(config), 0644)
+    if err != nil {
+        t.Fatalf("can not write config: %v", err)
+    }
+    notifier, err := NewSyslog("test", configFile)
+    if err != nil {
+        t.Fatalf("can not create syslog: %v", err)
+    }
+    return notifier.(*Syslog)
+}
+
+func testEvent(msg string) (*notifierplugger.Event) {
+    return &notifierplugger.Event{
+        Action: notifierplugger.EventTrigger,
+        Msg: []byte(msg),
+        FileID: "id1",
+        FileName: "/var/log/app.log",
+        Label: "app",
+        Severity: "error",
+        Pattern: "ERROR",
+        Host: "",
+    }
+}
+
+// readFramed is read a message framed by octet counting (RFC6587)
+func readFramed(reader *bufio.Reader) (string, error) {
+    lengthText, err := reader.ReadString(' ')
+    if err != nil {
+        return "", err
+    }
+    length, err := strconv.Atoi(strings.TrimSuffix(lengthText, " "))
+    if err != nil {
+        return "", err
+    }
+    msg := make([]byte, length)
+    _, err = io.ReadFull(reader, msg)
+    return string(msg), err
+}
+
+func TestSendUDP(t *testing.T) {
+    conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("can not listen: %v", err)
+    }
+    defer conn.Close()
+    syslog := newTestSyslog(t, "network = \"udp\"\naddress = \"" + conn.LocalAddr().String() + "\"\nfacility = \"local0\"\nhostname = \"host1\"\n")
+    defer syslog.Stop()
+    err = syslog.NotifyEvent(testEvent("ERROR disk full\n"))
+    if err != nil {
+        t.Fatalf("can not notify: %v", err)
+    }
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+    buffer := make([]byte, 65536)
+    n, _, err := conn.ReadFrom(buffer)
+    if err != nil {
+        t.Fatalf("can not read: %v", err)
+    }
+    msg := string(buffer[:n])
+    // local0.error is 16 * 8 + 3
+    if !strings.HasPrefix(msg, "<131>1 ") {
+        t.Errorf("unexpected header (%v)", msg)
+    }
+    if !strings.Contains(msg, " host1 app ") || !strings.HasSuffix(msg, "] " + bom + "ERROR disk full") {
+        t.Errorf("unexpected message (%v)", msg)
+    }
+}
+
+func TestSendTCPOctetCounting(t *testing.T) {
+    listen, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("can not listen: %v", err)
+    }
+    defer listen.Close()
+    syslog := newTestSyslog(t, "network = \"tcp\"\naddress = \"" + listen.Addr().String() + "\"\n")
+    defer syslog.Stop()
+    messages := []string{ "ERROR first\nwith newline\n", "ERROR second" }
+    go func() {
+        for _, message := range messages {
+            syslog.NotifyEvent(testEvent(message))
+        }
+    }()
+    conn, err := listen.Accept()
+    if err != nil {
+        t.Fatalf("can not accept: %v", err)
+    }
+    defer conn.Close()
+    conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+    reader := bufio.NewReader(conn)
+    for _, message := range messages {
+        msg, err := readFramed(reader)
+        if err != nil {
+            t.Fatalf("can not read framed message: %v", err)
+        }
+        expected := bom + strings.TrimRight(message, "\n")
+        if !strings.HasSuffix(msg, expected) {
+            t.Errorf("unexpected message (%q, %q)", msg, expected)
+        }
+    }
+}
+
+func TestTruncateKeepsValidUTF8(t *testing.T) {
+    syslog := newTestSyslog(t, "network = \"udp\"\naddress = \"127.0.0.1:9\"\n")
+    defer syslog.Stop()
+    full, err := syslog.format(testEvent(strings.Repeat("日本語", 100)))
+    if err != nil {
+        t.Fatalf("can not format: %v", err)
+    }
+    start := bytes.Index(full, []byte(bom))
+    if start < 0 {
+        t.Fatalf("no bom (%q)", full)
+    }
+    // cut after each byte of a character
+    for cut := 1; cut <= 3; cut++ {
+        syslog.maxMessageSize = int64(start + len(bom) + 3 * 10 + cut)
+        formatted, err := syslog.format(testEvent(strings.Repeat("日本語", 100)))
+        if err != nil {
+            t.Fatalf("can not format: %v", err)
+        }
+        if int64(len(formatted)) > syslog.maxMessageSize {
+            t.Errorf("message is too long (%v, %v)", len(formatted), syslog.maxMessageSize)
+        }
+        msg := formatted[start + len(bom):]
+        expected := 30
+        if cut == 3 {
+            expected = 33
+        }
+        if !utf8.Valid(msg) || len(msg) != expected {
+            t.Errorf("unexpected msg (%v, %q)", cut, msg)
+        }
+    }
+}
+
+func TestNotifyEventAfterStop(t *testing.T) {
+    conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("can not listen: %v", err)
+    }
+    defer conn.Close()
+    syslog := newTestSyslog(t, "network = \"udp\"\naddress = \"" + conn.LocalAddr().String() + "\"\n")
+    syslog.Stop()
+    err = syslog.NotifyEvent(testEvent("ERROR disk full\n"))
+    if err == nil {
+        t.Errorf("notification is accepted after stop")
+    }
+}
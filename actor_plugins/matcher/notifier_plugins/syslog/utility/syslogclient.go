@@ -0,0 +1,172 @@
+package utility
+
+import (
+	"github.com/pkg/errors"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TLSConfig is tls config of syslog client
+type TLSConfig struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// SyslogClient is syslog client with reconnect
+type SyslogClient struct {
+	network           string
+	address           string
+	timeout           time.Duration
+	reconnectInterval time.Duration
+	tlsConfig         *tls.Config
+	conn              net.Conn
+	lastDial          time.Time
+	closed            bool
+	mutex             *sync.Mutex
+}
+
+func (s *SyslogClient) dial() (error) {
+	if time.Since(s.lastDial) < s.reconnectInterval {
+		return errors.Errorf("reconnect is throttled (network = %v, address = %v)", s.network, s.address)
+	}
+	s.lastDial = time.Now()
+	dialer := &net.Dialer{
+		Timeout: s.timeout,
+	}
+	var conn net.Conn
+	var err error
+	switch s.network {
+	case "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+	default:
+		conn, err = dialer.Dial(s.network, s.address)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "can not connect (network = %v, address = %v)", s.network, s.address)
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *SyslogClient) close() {
+	if s.conn == nil {
+		return
+	}
+	s.conn.Close()
+	s.conn = nil
+}
+
+func (s *SyslogClient) frame(msg []byte) ([]byte) {
+	if s.network == "udp" {
+		return msg
+	}
+	// octet counting framing (RFC6587)
+	framed := make([]byte, 0, len(msg) + 8)
+	framed = strconv.AppendInt(framed, int64(len(msg)), 10)
+	framed = append(framed, ' ')
+	return append(framed, msg...)
+}
+
+func (s *SyslogClient) write(framed []byte) (error) {
+	if s.conn == nil {
+		err := s.dial()
+		if err != nil {
+			return err
+		}
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	_, err := s.conn.Write(framed)
+	if err != nil {
+		s.close()
+		return errors.Wrapf(err, "can not write message (network = %v, address = %v)", s.network, s.address)
+	}
+	return nil
+}
+
+// Send is send message, it reconnects once when connection is broken
+func (s *SyslogClient) Send(msg []byte) (error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return errors.Errorf("client is closed (network = %v, address = %v)", s.network, s.address)
+	}
+	framed := s.frame(msg)
+	connected := s.conn != nil
+	err := s.write(framed)
+	if err == nil || !connected {
+		return err
+	}
+	log.Printf("reconnect syslog: %v", err)
+	s.lastDial = time.Time{}
+	return s.write(framed)
+}
+
+// Close is close connection, messages are not sent after close
+func (s *SyslogClient) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	s.close()
+}
+
+func newTLSConfig(config *TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CAFile != "" {
+		ca, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can not read ca file (%v)", config.CAFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.Errorf("can not append ca certificate (%v)", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can not load key pair (%v, %v)", config.CertFile, config.KeyFile)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// NewSyslogClient is create syslog client
+func NewSyslogClient(network string, address string, timeout time.Duration, reconnectInterval time.Duration, config *TLSConfig) (*SyslogClient, error) {
+	switch network {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, errors.Errorf("unexpected network (%v)", network)
+	}
+	var tlsConfig *tls.Config
+	if network == "tls" {
+		newConfig, err := newTLSConfig(config)
+		if err != nil {
+			return nil, errors.Wrap(err, "can not create tls config")
+		}
+		tlsConfig = newConfig
+	}
+	return &SyslogClient{
+		network:           network,
+		address:           address,
+		timeout:           timeout,
+		reconnectInterval: reconnectInterval,
+		tlsConfig:         tlsConfig,
+		conn:              nil,
+		closed:            false,
+		mutex:             new(sync.Mutex),
+	}, nil
+}
@@ -0,0 +1,12 @@
+package configurator
+
+// Config is Config
+type Config struct {
+        URL              string            `json:"url"                yaml:"url"                toml:"url"`
+        Method           string            `json:"method"             yaml:"method"             toml:"method"`
+        Headers          map[string]string `json:"headers"            yaml:"headers"            toml:"headers"`
+        BodyTemplate     string            `json:"body_template"      yaml:"body_template"      toml:"body_template"`
+        Timeout          int64             `json:"timeout"            yaml:"timeout"            toml:"timeout"`
+        HMACSecret       string            `json:"hmac_secret"        yaml:"hmac_secret"        toml:"hmac_secret"`
+        HMACHeader       string            `json:"hmac_header"        yaml:"hmac_header"        toml:"hmac_header"`
+}
@@ -0,0 +1,68 @@
+package utility
+
+import (
+	"github.com/pkg/errors"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// HTTPClient is http client
+type HTTPClient struct {
+	url        string
+	method     string
+	headers    map[string]string
+	hmacSecret string
+	hmacHeader string
+	client     *http.Client
+}
+
+func (h *HTTPClient) sign(body []byte) (string) {
+	mac := hmac.New(sha256.New, []byte(h.hmacSecret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Post is send body once, failed notification is retried by notify queue
+func (h *HTTPClient) Post(body []byte) (error) {
+	request, err := http.NewRequest(h.method, h.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "can not create request (method = %v, url = %v)", h.method, h.url)
+	}
+	for key, value := range h.headers {
+		request.Header.Set(key, value)
+	}
+	if h.hmacSecret != "" {
+		request.Header.Set(h.hmacHeader, h.sign(body))
+	}
+	response, err := h.client.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "can not send request (method = %v, url = %v)", h.method, h.url)
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	return errors.Errorf("unexpected status (url = %v, status = %v)", h.url, response.Status)
+}
+
+// NewHTTPClient is create http client
+func NewHTTPClient(url string, method string, headers map[string]string, timeout time.Duration,
+	hmacSecret string, hmacHeader string) (*HTTPClient) {
+	return &HTTPClient{
+		url:        url,
+		method:     method,
+		headers:    headers,
+		hmacSecret: hmacSecret,
+		hmacHeader: hmacHeader,
+		client:     &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
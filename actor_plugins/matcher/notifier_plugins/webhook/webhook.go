@@ -0,0 +1,137 @@
+package main
+
+import (
+    "log"
+    "sync"
+    "time"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/templater"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifier_plugins/webhook/utility"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifier_plugins/webhook/configurator"
+)
+
+const (
+        defaultMethod string = "POST"
+        defaultTimeout int64 = 10
+        defaultHMACHeader string = "X-Signature"
+        defaultBodyTemplate string = `{"label":{{json .Label}},"fileId":{{json .FileID}},"fileName":{{json .FileName}},"hostname":{{json .Hostname}},"timestamp":{{json .Timestamp}},"action":{{json .Action}},"severity":{{json .Severity}},"message":{{json .Message}}}`
+)
+
+// Webhook is Webhook
+type Webhook struct {
+        callers string
+        config *configurator.Config
+        bodyTemplate *templater.Template
+        httpClient *utility.HTTPClient
+        stopped bool
+        mutex *sync.Mutex
+}
+
+// Start is start
+func (w *Webhook) Start() (error) {
+        return nil
+}
+
+// Stop is stop
+func (w *Webhook) Stop() {
+        w.mutex.Lock()
+        defer w.mutex.Unlock()
+        w.stopped = true
+}
+
+// Flush is flush
+func (w *Webhook) Flush() {
+}
+
+// Notify is notify
+func (w *Webhook) Notify(msg []byte, fileID string, fileName string, label string) (error) {
+        return w.NotifyEvent(&notifierplugger.Event{
+            Action: notifierplugger.EventTrigger,
+            Msg: msg,
+            FileID: fileID,
+            FileName: fileName,
+            Label: label,
+            Severity: "",
+            Pattern: "",
+        })
+}
+
+// NotifyEvent is notify event
+func (w *Webhook) NotifyEvent(event *notifierplugger.Event) (error) {
+        w.mutex.Lock()
+        stopped := w.stopped
+        w.mutex.Unlock()
+        if stopped {
+            return errors.Errorf("webhook is stopped (%v, %v)", w.config.URL, event.Label)
+        }
+        body, err := w.bodyTemplate.Execute(templater.NewParams(event))
+        if err != nil {
+            return errors.Wrapf(err, "can not execute body template (%v, %v)", w.config.URL, event.Label)
+        }
+        err = w.httpClient.Post([]byte(body))
+        if err != nil {
+            return errors.Wrapf(err, "can not post webhook (%v, %v)", w.config.URL, event.Label)
+        }
+        return nil
+}
+
+// NewWebhook is create new webhook
+func NewWebhook(callers string, configFile string) (notifierplugger.NotifierPlugin, error) {
+    log.Printf("configFile = %v", configFile)
+    configurator, err := configurator.NewConfigurator(configFile)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not create configurator (%v)", configFile)
+    }
+    config, err := configurator.Load()
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not load config (%v)", configFile)
+    }
+    if config.URL == "" {
+        return nil, errors.Errorf("no url (%v)", configFile)
+    }
+    // config is not logged because it has hmac secret
+    log.Printf("url = %v", config.URL)
+    bodyTemplateText := defaultBodyTemplate
+    if config.BodyTemplate != "" {
+        bodyTemplateText = config.BodyTemplate
+    }
+    bodyTemplate, err := templater.New("body_template", bodyTemplateText, nil)
+    if err != nil {
+        return nil, errors.Wrapf(err, "invalid body template (%v)", configFile)
+    }
+    method := defaultMethod
+    if config.Method != "" {
+        method = config.Method
+    }
+    timeout := defaultTimeout
+    if config.Timeout > 0 {
+        timeout = config.Timeout
+    }
+    hmacHeader := defaultHMACHeader
+    if config.HMACHeader != "" {
+        hmacHeader = config.HMACHeader
+    }
+    headers := map[string]string{
+        "Content-Type": "application/json",
+    }
+    for key, value := range config.Headers {
+        headers[key] = value
+    }
+    newCallers := callers + ".webhook"
+    httpClient := utility.NewHTTPClient(config.URL, method, headers,
+        time.Duration(timeout) * time.Second, config.HMACSecret, hmacHeader)
+    return &Webhook {
+        callers: newCallers,
+        config: config,
+        bodyTemplate: bodyTemplate,
+        httpClient: httpClient,
+        stopped: false,
+        mutex: new(sync.Mutex),
+    }, nil
+}
+
+// GetNotifierPluginInfo is GetNotifierPluginInfo
+func GetNotifierPluginInfo() (string, notifierplugger.NotifierPluginNewFunc) {
+    return "webhook", NewWebhook
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "sync"
+    "testing"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+)
+
+type recorded struct {
+    body []byte
+    header http.Header
+}
+
+type stubServer struct {
+    *httptest.Server
+    mutex *sync.Mutex
+    requests []*recorded
+    status int
+}
+
+func newStubServer(status int) (*stubServer) {
+    s := &stubServer{
+        mutex: new(sync.Mutex),
+        requests: make([]*recorded, 0),
+        status: status,
+    }
+    s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := ioutil.ReadAll(r.Body)
+        s.mutex.Lock()
+        s.requests = append(s.requests, &recorded{ body: body, header: r.Header })
+        s.mutex.Unlock()
+        w.WriteHeader(s.status)
+    }))
+    return s
+}
+
+func newTestWebhook(t *testing.T, config string) (*Webhook) {
+    configFile := filepath.Join(t.TempDir(), "webhook.toml")
+    err := ioutil.WriteFile(configFile, []byte(config), 0644)
+    if err != nil {
+        t.Fatalf("can not write config: %v", err)
+    }
+    notifier, err := NewWebhook("test", configFile)
+    if err != nil {
+        t.Fatalf("can not create webhook: %v", err)
+    }
+    return notifier.(*Webhook)
+}
+
+func testEvent() (*notifierplugger.Event) {
+    return &notifierplugger.Event{
+        Action: notifierplugger.EventTrigger,
+        Msg: []byte("ERROR disk full\n"),
+        FileID: "id1",
+        FileName: "/var/log/app.log",
+        Label: "app",
+        Severity: "error",
+        Pattern: "ERROR",
+        Host: "web1",
+    }
+}
+
+func TestNotifyEventSignsBody(t *testing.T) {
+    server := newStubServer(http.StatusOK)
+    defer server.Close()
+    webhook := newTestWebhook(t, "url = \"" + server.URL + "\"\nhmac_secret = \"secret\"\nhmac_header = \"X-Test-Signature\"\n")
+    err := webhook.NotifyEvent(testEvent())
+    if err != nil {
+        t.Fatalf("can not notify: %v", err)
+    }
+    if len(server.requests) != 1 {
+        t.Fatalf("unexpected requests (%v)", len(server.requests))
+    }
+    request := server.requests[0]
+    mac := hmac.New(sha256.New, []byte("secret"))
+    mac.Write(request.body)
+    expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+    if signature := request.header.Get("X-Test-Signature"); signature != expected {
+        t.Errorf("unexpected signature (%v, %v)", signature, expected)
+    }
+    if contentType := request.header.Get("Content-Type"); contentType != "application/json" {
+        t.Errorf("unexpected content type (%v)", contentType)
+    }
+}
+
+func TestNotifyEventWithoutSecretIsNotSigned(t *testing.T) {
+    server := newStubServer(http.StatusOK)
+    defer server.Close()
+    webhook := newTestWebhook(t, "url = \"" + server.URL + "\"\n")
+    err := webhook.NotifyEvent(testEvent())
+    if err != nil {
+        t.Fatalf("can not notify: %v", err)
+    }
+    if signature := server.requests[0].header.Get(defaultHMACHeader); signature != "" {
+        t.Errorf("unexpected signature (%v)", signature)
+    }
+}
+
+func TestNotifyEventDefaultTemplate(t *testing.T) {
+    server := newStubServer(http.StatusOK)
+    defer server.Close()
+    webhook := newTestWebhook(t, "url = \"" + server.URL + "\"\n")
+    err := webhook.NotifyEvent(testEvent())
+    if err != nil {
+        t.Fatalf("can not notify: %v", err)
+    }
+    body := make(map[string]string)
+    err = json.Unmarshal(server.requests[0].body, &body)
+    if err != nil {
+        t.Fatalf("body is not json (%s): %v", server.requests[0].body, err)
+    }
+    expected := map[string]string{
+        "label": "app",
+        "fileId": "id1",
+        "fileName": "/var/log/app.log",
+        "hostname": "web1",
+        "action": notifierplugger.EventTrigger,
+        "severity": "error",
+    }
+    for key, value := range expected {
+        if body[key] != value {
+            t.Errorf("unexpected %v (%v, %v)", key, body[key], value)
+        }
+    }
+}
+
+func TestNotifyEventCustomTemplate(t *testing.T) {
+    server := newStubServer(http.StatusOK)
+    defer server.Close()
+    webhook := newTestWebhook(t, "url = \"" + server.URL + "\"\nbody_template = '{\"text\":{{json (printf \"[%s] %s\" .Label .Pattern)}}}'\n")
+    err := webhook.NotifyEvent(testEvent())
+    if err != nil {
+        t.Fatalf("can not notify: %v", err)
+    }
+    if body := string(server.requests[0].body); body != `{"text":"[app] ERROR"}` {
+        t.Errorf("unexpected body (%v)", body)
+    }
+}
+
+func TestNotifyEventFailureIsNotRetried(t *testing.T) {
+    for _, status := range []int{ http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusBadRequest } {
+        server := newStubServer(status)
+        webhook := newTestWebhook(t, "url = \"" + server.URL + "\"\n")
+        err := webhook.NotifyEvent(testEvent())
+        server.Close()
+        if err == nil {
+            t.Errorf("no error (%v)", status)
+        }
+        // notify queue retries failed notifications
+        if len(server.requests) != 1 {
+            t.Errorf("unexpected requests (%v, %v)", status, len(server.requests))
+        }
+    }
+}
+
+func TestNotifyEventAfterStop(t *testing.T) {
+    server := newStubServer(http.StatusOK)
+    defer server.Close()
+    webhook := newTestWebhook(t, "url = \"" + server.URL + "\"\n")
+    webhook.Stop()
+    err := webhook.NotifyEvent(testEvent())
+    if err == nil {
+        t.Errorf("notification is accepted after stop")
+    }
+    if len(server.requests) != 0 {
+        t.Errorf("unexpected requests (%v)", len(server.requests))
+    }
+}
@@ -0,0 +1,172 @@
+package notifiercache
+
+import (
+    "log"
+    "sync"
+    "path"
+    "path/filepath"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/rulemanager"
+)
+
+type notifierEntry struct {
+    notifier *configurator.Notifier
+    plugin notifierplugger.NotifierPlugin
+    refs int64
+    retired bool
+}
+
+// NotifierCache is NotifierCache
+type NotifierCache struct {
+    callers string
+    notifiers map[*configurator.Notifier]*notifierEntry
+    // entries is notifiers of current rule set and retired notifiers still held
+    entries map[notifierplugger.NotifierPlugin]*notifierEntry
+    ruleSet *rulemanager.RuleSet
+    mutex *sync.Mutex
+}
+
+func (n *NotifierCache) stopNotifier(notifierPlugin notifierplugger.NotifierPlugin) {
+    notifierPlugin.Flush()
+    notifierPlugin.Stop()
+}
+
+func (n *NotifierCache) newNotifier(notifier *configurator.Notifier) (notifierplugger.NotifierPlugin, error) {
+    pluginFilePath, pluginNewFunc, ok := notifierplugger.GetNotifierPlugin(notifier.Name)
+    if !ok {
+        return nil, errors.Errorf("not found notifier plugin (%v)", notifier.Name)
+    }
+    configPath := path.Join(filepath.Dir(pluginFilePath), notifier.Config)
+    plugin, err := pluginNewFunc(n.callers, configPath)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not create plugin (%v, %v)",  notifier.Name, configPath)
+    }
+    err = plugin.Start()
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not start plugin (%v, %v)",  notifier.Name, configPath)
+    }
+    return plugin, nil
+}
+
+func (n *NotifierCache) get(notifier *configurator.Notifier) (*notifierEntry, error) {
+    entry, ok := n.notifiers[notifier]
+    if ok {
+        return entry, nil
+    }
+    notifierPlugin, err := n.newNotifier(notifier)
+    if err != nil {
+        return nil, err
+    }
+    entry = &notifierEntry{
+        notifier: notifier,
+        plugin: notifierPlugin,
+        refs: 0,
+        retired: false,
+    }
+    n.notifiers[notifier] = entry
+    n.entries[notifierPlugin] = entry
+    return entry, nil
+}
+
+// Get is get notifier, notifier is created at first time
+func (n *NotifierCache) Get(notifier *configurator.Notifier) (notifierplugger.NotifierPlugin, error) {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+    entry, err := n.get(notifier)
+    if err != nil {
+        return nil, err
+    }
+    return entry.plugin, nil
+}
+
+// Acquire is get notifier and hold it until release, held notifier is not stopped by reload
+func (n *NotifierCache) Acquire(notifier *configurator.Notifier) (notifierplugger.NotifierPlugin, error) {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+    entry, err := n.get(notifier)
+    if err != nil {
+        return nil, err
+    }
+    entry.refs++
+    return entry.plugin, nil
+}
+
+// Release is release notifier held by acquire, retired notifier is stopped at last release
+func (n *NotifierCache) Release(notifierPlugin notifierplugger.NotifierPlugin) {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+    entry, ok := n.entries[notifierPlugin]
+    if !ok || entry.refs == 0 {
+        return
+    }
+    entry.refs--
+    if !entry.retired || entry.refs > 0 {
+        return
+    }
+    n.stopNotifier(entry.plugin)
+    delete(n.entries, notifierPlugin)
+    log.Printf("discarded retired notifier (%v, %v)", entry.notifier.Name, entry.notifier.Config)
+}
+
+// Flush is flush all notifiers, notifiers are held while flushing so that slow flush does not block acquire
+func (n *NotifierCache) Flush() {
+    n.mutex.Lock()
+    notifierPlugins := make([]notifierplugger.NotifierPlugin, 0, len(n.notifiers))
+    for _, entry := range n.notifiers {
+        entry.refs++
+        notifierPlugins = append(notifierPlugins, entry.plugin)
+    }
+    n.mutex.Unlock()
+    for _, notifierPlugin := range notifierPlugins {
+        notifierPlugin.Flush()
+        n.Release(notifierPlugin)
+    }
+}
+
+// Sync is discard notifiers when rule set is reloaded
+func (n *NotifierCache) Sync(ruleSet *rulemanager.RuleSet) {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+    if n.ruleSet == ruleSet {
+        return
+    }
+    if n.ruleSet != nil {
+        n.clear()
+    }
+    n.ruleSet = ruleSet
+}
+
+// Clear is stop and discard all notifiers, held notifiers are stopped at release
+func (n *NotifierCache) Clear() {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+    n.clear()
+}
+
+func (n *NotifierCache) clear() {
+    for notifier, entry := range n.notifiers {
+        if entry.refs > 0 {
+            // notifier in delivery is stopped after the delivery
+            entry.retired = true
+            log.Printf("retired notifier (%v, %v, refs = %v)", notifier.Name, notifier.Config, entry.refs)
+            continue
+        }
+        n.stopNotifier(entry.plugin)
+        delete(n.entries, entry.plugin)
+        log.Printf("discarded notifier (%v, %v)", notifier.Name, notifier.Config)
+    }
+    n.notifiers = make(map[*configurator.Notifier]*notifierEntry)
+}
+
+// NewNotifierCache is create new notifier cache
+func NewNotifierCache(callers string) (*NotifierCache) {
+    return &NotifierCache {
+        callers: callers,
+        notifiers: make(map[*configurator.Notifier]*notifierEntry),
+        entries: make(map[notifierplugger.NotifierPlugin]*notifierEntry),
+        ruleSet: nil,
+        mutex: new(sync.Mutex),
+    }
+}
@@ -0,0 +1,147 @@
+package notifiercache
+
+import (
+    "sync"
+    "time"
+    "testing"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+)
+
+type testNotifier struct {
+    mutex *sync.Mutex
+    flushed int
+    stopped int
+    onFlush func()
+}
+
+func (t *testNotifier) Start() (error) {
+    return nil
+}
+
+func (t *testNotifier) Stop() {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+    t.stopped++
+}
+
+func (t *testNotifier) Flush() {
+    if t.onFlush != nil {
+        t.onFlush()
+    }
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+    t.flushed++
+}
+
+func (t *testNotifier) Notify(msg []byte, fileID string, fileName string, label string) (error) {
+    return nil
+}
+
+func (t *testNotifier) counts() (int, int) {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+    return t.flushed, t.stopped
+}
+
+// add is add notifier as if it has been created by get, plugins can not be registered in tests
+func add(notifierCache *NotifierCache, name string) (*configurator.Notifier, *testNotifier) {
+    notifier := &configurator.Notifier{ Name: name }
+    plugin := &testNotifier{ mutex: new(sync.Mutex) }
+    entry := &notifierEntry{
+        notifier: notifier,
+        plugin: plugin,
+        refs: 0,
+        retired: false,
+    }
+    notifierCache.notifiers[notifier] = entry
+    notifierCache.entries[plugin] = entry
+    return notifier, plugin
+}
+
+func TestClearStopsNotifiersNotHeld(t *testing.T) {
+    notifierCache := NewNotifierCache("test")
+    _, plugin := add(notifierCache, "a")
+    notifierCache.Clear()
+    if _, stopped := plugin.counts(); stopped != 1 {
+        t.Errorf("notifier is not stopped (%v)", stopped)
+    }
+    if len(notifierCache.notifiers) != 0 || len(notifierCache.entries) != 0 {
+        t.Errorf("notifier is not discarded (%v, %v)", len(notifierCache.notifiers), len(notifierCache.entries))
+    }
+}
+
+func TestRetiredNotifierIsStoppedAtLastRelease(t *testing.T) {
+    notifierCache := NewNotifierCache("test")
+    notifier, plugin := add(notifierCache, "a")
+    for i := 0; i < 2; i++ {
+        acquired, err := notifierCache.Acquire(notifier)
+        if err != nil || acquired != plugin {
+            t.Fatalf("can not acquire notifier (%v, %v)", acquired, err)
+        }
+    }
+    notifierCache.Clear()
+    if _, stopped := plugin.counts(); stopped != 0 {
+        t.Fatalf("held notifier is stopped")
+    }
+    if len(notifierCache.notifiers) != 0 || len(notifierCache.entries) != 1 {
+        t.Errorf("unexpected entries (%v, %v)", len(notifierCache.notifiers), len(notifierCache.entries))
+    }
+    notifierCache.Release(plugin)
+    if _, stopped := plugin.counts(); stopped != 0 {
+        t.Fatalf("retired notifier is stopped before last release")
+    }
+    notifierCache.Release(plugin)
+    flushed, stopped := plugin.counts()
+    if flushed != 1 || stopped != 1 {
+        t.Errorf("retired notifier is not flushed and stopped at last release (%v, %v)", flushed, stopped)
+    }
+    if len(notifierCache.entries) != 0 {
+        t.Errorf("retired notifier is not discarded (%v)", len(notifierCache.entries))
+    }
+    // extra release is ignored
+    notifierCache.Release(plugin)
+    if _, stopped := plugin.counts(); stopped != 1 {
+        t.Errorf("notifier is stopped twice (%v)", stopped)
+    }
+}
+
+func TestReleaseWithoutClearKeepsNotifier(t *testing.T) {
+    notifierCache := NewNotifierCache("test")
+    notifier, plugin := add(notifierCache, "a")
+    notifierCache.Acquire(notifier)
+    notifierCache.Release(plugin)
+    if _, stopped := plugin.counts(); stopped != 0 {
+        t.Errorf("notifier in use is stopped")
+    }
+    if got, err := notifierCache.Get(notifier); err != nil || got != plugin {
+        t.Errorf("notifier is not cached (%v, %v)", got, err)
+    }
+}
+
+func TestFlushOutsideMutex(t *testing.T) {
+    notifierCache := NewNotifierCache("test")
+    other, _ := add(notifierCache, "other")
+    _, plugin := add(notifierCache, "slow")
+    acquired := make(chan bool)
+    plugin.onFlush = func() {
+        // stop flushes again
+        plugin.onFlush = nil
+        // acquire during flush blocks if flush holds mutex
+        go func() {
+            notifierCache.Acquire(other)
+            close(acquired)
+        }()
+        select {
+        case <-acquired:
+        case <-time.After(5 * time.Second):
+            t.Errorf("acquire is blocked by flush")
+        }
+        // notifier retired during flush is stopped after flush
+        notifierCache.Clear()
+    }
+    notifierCache.Flush()
+    flushed, stopped := plugin.counts()
+    if flushed != 2 || stopped != 1 {
+        t.Errorf("notifier retired during flush is not stopped after flush (%v, %v)", flushed, stopped)
+    }
+}
@@ -11,8 +11,74 @@ import (
 )
 
 // NotifierPlugin is actor plugin
+// Start is called once after creation, Flush is called after each check of file
+// and Stop is called when the notifier is discarded
+// Notify returns error when the message is not delivered, it is retried by notify queue
 type NotifierPlugin interface {
-    Notify(msg []byte, fileID string, fileName string, label string)
+    Start() (error)
+    Stop()
+    Flush()
+    Notify(msg []byte, fileID string, fileName string, label string) (error)
+}
+
+const (
+   // EventTrigger is EventTrigger
+   EventTrigger string = "trigger"
+   // EventResolve is EventResolve
+   EventResolve string = "resolve"
+)
+
+const (
+   // SeverityCritical is SeverityCritical
+   SeverityCritical string = "critical"
+   // SeverityError is SeverityError
+   SeverityError string = "error"
+   // SeverityWarning is SeverityWarning
+   SeverityWarning string = "warning"
+   // SeverityInfo is SeverityInfo
+   SeverityInfo string = "info"
+)
+
+var severityRanks = map[string]int{
+    SeverityInfo: 1,
+    SeverityWarning: 2,
+    SeverityError: 3,
+    SeverityCritical: 4,
+}
+
+// SeverityRank is rank of severity, unknown severity is 0
+func SeverityRank(severity string) (int) {
+    return severityRanks[severity]
+}
+
+// Event is event of matched rule
+// host is set when logs of other host are matched, it is empty for local files
+// patterns is patterns of grouped matches, pattern is set when they are only one
+type Event struct {
+    Action string
+    Msg []byte
+    FileID string
+    FileName string
+    Label string
+    Severity string
+    Pattern string
+    Patterns []string
+    Host string
+}
+
+// EventNotifierPlugin is notifier plugin that receives events instead of Notify
+type EventNotifierPlugin interface {
+    NotifierPlugin
+    NotifyEvent(event *Event) (error)
+}
+
+// Dispatch is notify event to notifier plugin, plain notifier plugin receives Notify
+func Dispatch(notifierPlugin NotifierPlugin, event *Event) (error) {
+    eventNotifierPlugin, ok := notifierPlugin.(EventNotifierPlugin)
+    if ok {
+        return eventNotifierPlugin.NotifyEvent(event)
+    }
+    return notifierPlugin.Notify(event.Msg, event.FileID, event.FileName, event.Label)
 }
 
 const (
@@ -111,6 +177,9 @@ func LoadNotifierPlugins(pluginPath string) (error) {
 // GetNotifierPlugin is get actor plugin
 func GetNotifierPlugin(name string) (string, NotifierPluginNewFunc, bool) {
         info, ok := registeredNotifierPlugins[name]
+        if !ok {
+            return "", nil, false
+        }
         return info.notifierPluginFilePath, info.notifierPluginNewFunc, ok
 }
 
@@ -0,0 +1,433 @@
+package notifyqueue
+
+import (
+    "os"
+    "fmt"
+    "log"
+    "sort"
+    "sync"
+    "time"
+    "io/ioutil"
+    "path/filepath"
+    "encoding/json"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifiercache"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/rulemanager"
+)
+
+const (
+    defaultMaxAttempts int64 = 5
+    defaultRetryInterval int64 = 10
+    defaultMaxRetryInterval int64 = 600
+    deliveryInterval time.Duration = time.Second
+    itemSuffix string = ".json"
+    queueDirName string = "queue"
+    deadLetterDirName string = "deadletter"
+)
+
+// Item is queued notification for a notifier
+type Item struct {
+    ID string `json:"id"`
+    Label string `json:"label"`
+    NotifierName string `json:"notifierName"`
+    NotifierConfig string `json:"notifierConfig"`
+    Event *notifierplugger.Event `json:"event"`
+    Attempts int64 `json:"attempts"`
+    NextAttempt int64 `json:"nextAttempt"`
+    LastError string `json:"lastError"`
+    CreatedAt int64 `json:"createdAt"`
+}
+
+// NotifyQueue is persistent notification queue between file checker and notifiers
+type NotifyQueue struct {
+    callers string
+    notifierCache *notifiercache.NotifierCache
+    ruleSet *rulemanager.RuleSet
+    queueDir string
+    deadLetterDir string
+    items []*Item
+    seq int64
+    mutex *sync.Mutex
+    now func() (time.Time)
+    wakeup chan bool
+    finish chan bool
+    finished chan bool
+}
+
+// DeadLetterDir is directory of undeliverable notifications
+func DeadLetterDir(savePrefix string, callers string) (string) {
+    return filepath.Join(savePrefix, callers, deadLetterDirName)
+}
+
+// LoadItems is load items in directory ordered by id
+func LoadItems(dir string) ([]*Item, error) {
+    fileList, err := ioutil.ReadDir(dir)
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil, nil
+        }
+        return nil, errors.Wrapf(err, "can not read directory (%v)", dir)
+    }
+    items := make([]*Item, 0, len(fileList))
+    for _, file := range fileList {
+        if file.IsDir() || filepath.Ext(file.Name()) != itemSuffix {
+            continue
+        }
+        itemFilePath := filepath.Join(dir, file.Name())
+        buf, err := ioutil.ReadFile(itemFilePath)
+        if err != nil {
+            log.Printf("can not read item (%v): %v", itemFilePath, err)
+            continue
+        }
+        item := new(Item)
+        err = json.Unmarshal(buf, item)
+        if err != nil || item.Event == nil {
+            log.Printf("can not decode item (%v): %v", itemFilePath, err)
+            continue
+        }
+        items = append(items, item)
+    }
+    sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+    return items, nil
+}
+
+// SaveItem is save item into directory
+func SaveItem(dir string, item *Item) (error) {
+    _, err := os.Stat(dir)
+    if err != nil {
+       err := os.MkdirAll(dir, 0755)
+       if err != nil {
+           return errors.Wrapf(err, "can not create directory (%v)", dir)
+       }
+    }
+    buf, err := json.MarshalIndent(item, "", "  ")
+    if err != nil {
+        return errors.Wrapf(err, "can not encode item (%v)", item.ID)
+    }
+    itemFilePath := filepath.Join(dir, item.ID + itemSuffix)
+    tmpFilePath := itemFilePath + ".tmp"
+    err = ioutil.WriteFile(tmpFilePath, buf, 0600)
+    if err != nil {
+        return errors.Wrapf(err, "can not write item (%v)", tmpFilePath)
+    }
+    err = os.Rename(tmpFilePath, itemFilePath)
+    if err != nil {
+        os.Remove(tmpFilePath)
+        return errors.Wrapf(err, "can not rename item (%v)", itemFilePath)
+    }
+    return nil
+}
+
+// RemoveItem is remove item from directory
+func RemoveItem(dir string, item *Item) (error) {
+    itemFilePath := filepath.Join(dir, item.ID + itemSuffix)
+    err := os.Remove(itemFilePath)
+    if err != nil && !os.IsNotExist(err) {
+        return errors.Wrapf(err, "can not remove item (%v)", itemFilePath)
+    }
+    return nil
+}
+
+func findNotifier(notifiers []*configurator.Notifier, item *Item) (*configurator.Notifier) {
+    for _, notifier := range notifiers {
+        if notifier.Name == item.NotifierName && notifier.Config == item.NotifierConfig {
+            return notifier
+        }
+    }
+    return nil
+}
+
+// FindNotifier is find notifier of item in path matcher of label or routes
+func FindNotifier(ruleSet *rulemanager.RuleSet, item *Item) (*configurator.Notifier) {
+    for _, rule := range ruleSet.Rules {
+        if rule.PathMatcher.Label != item.Label {
+            continue
+        }
+        notifier := findNotifier(rule.PathMatcher.Notifiers, item)
+        if notifier != nil {
+            return notifier
+        }
+    }
+    for _, route := range ruleSet.Routes {
+        notifier := findNotifier(route.Route.Notifiers, item)
+        if notifier != nil {
+            return notifier
+        }
+        if route.Route.Escalation == nil {
+            continue
+        }
+        notifier = findNotifier(route.Route.Escalation.Notifiers, item)
+        if notifier != nil {
+            return notifier
+        }
+    }
+    return nil
+}
+
+func retryPolicy(retry *configurator.Retry) (int64, int64, int64) {
+    maxAttempts := defaultMaxAttempts
+    retryInterval := defaultRetryInterval
+    maxRetryInterval := defaultMaxRetryInterval
+    if retry == nil {
+        return maxAttempts, retryInterval, maxRetryInterval
+    }
+    if retry.MaxAttempts > 0 {
+        maxAttempts = retry.MaxAttempts
+    }
+    if retry.Interval > 0 {
+        retryInterval = retry.Interval
+    }
+    if retry.MaxInterval > 0 {
+        maxRetryInterval = retry.MaxInterval
+    }
+    return maxAttempts, retryInterval, maxRetryInterval
+}
+
+func (n *NotifyQueue) newID(fileID string) (string) {
+    n.seq++
+    return fmt.Sprintf("%v-%020d-%06d", fileID, n.now().UnixNano(), n.seq % 1000000)
+}
+
+func saveQueued(queueDir string, item *Item) {
+    if queueDir == "" {
+        return
+    }
+    err := SaveItem(queueDir, item)
+    if err != nil {
+        log.Printf("can not save queued notification (%v): %v", item.ID, err)
+    }
+}
+
+func (n *NotifyQueue) save(item *Item) {
+    saveQueued(n.queueDir, item)
+}
+
+// Enqueue is queue event for each notifier, items are saved outside of the mutex so that disk io does not block delivery
+func (n *NotifyQueue) Enqueue(event *notifierplugger.Event, notifiers []*configurator.Notifier) {
+    now := n.now().Unix()
+    n.mutex.Lock()
+    queueDir := n.queueDir
+    items := make([]*Item, 0, len(notifiers))
+    for _, notifier := range notifiers {
+        items = append(items, &Item{
+            ID: n.newID(event.FileID),
+            Label: event.Label,
+            NotifierName: notifier.Name,
+            NotifierConfig: notifier.Config,
+            Event: event,
+            Attempts: 0,
+            NextAttempt: now,
+            LastError: "",
+            CreatedAt: now,
+        })
+    }
+    n.mutex.Unlock()
+    for _, item := range items {
+        saveQueued(queueDir, item)
+    }
+    n.mutex.Lock()
+    if n.queueDir != queueDir {
+        // queue is loaded while saving, items are persisted into loaded directory
+        for _, item := range items {
+            n.save(item)
+        }
+    }
+    n.items = append(n.items, items...)
+    n.mutex.Unlock()
+    select {
+    case n.wakeup <- true:
+    default:
+    }
+}
+
+func (n *NotifyQueue) takeDueItems(now int64) ([]*Item) {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+    due := make([]*Item, 0)
+    remaining := make([]*Item, 0, len(n.items))
+    for _, item := range n.items {
+        if item.NextAttempt <= now {
+            due = append(due, item)
+        } else {
+            remaining = append(remaining, item)
+        }
+    }
+    n.items = remaining
+    return due
+}
+
+func (n *NotifyQueue) putBackItems(items []*Item) {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+    n.items = append(n.items, items...)
+}
+
+func (n *NotifyQueue) deliver(item *Item) (*configurator.Retry, error) {
+    n.mutex.Lock()
+    ruleSet := n.ruleSet
+    n.mutex.Unlock()
+    if ruleSet == nil {
+        return nil, errors.New("rule set is not synced")
+    }
+    notifier := FindNotifier(ruleSet, item)
+    if notifier == nil {
+        return nil, errors.Errorf("not found notifier (%v, %v, %v)", item.Label, item.NotifierName, item.NotifierConfig)
+    }
+    // notifier is held so that reload does not stop it during delivery
+    notifierPlugin, err := n.notifierCache.Acquire(notifier)
+    if err != nil {
+        return notifier.Retry, errors.Wrapf(err, "can not get notifier (%v, %v)", notifier.Name, notifier.Config)
+    }
+    defer n.notifierCache.Release(notifierPlugin)
+    return notifier.Retry, notifierplugger.Dispatch(notifierPlugin, item.Event)
+}
+
+func (n *NotifyQueue) deadLetter(item *Item) {
+    if n.deadLetterDir == "" {
+        log.Printf("drop undeliverable notification (%v)", item.ID)
+        return
+    }
+    err := SaveItem(n.deadLetterDir, item)
+    if err != nil {
+        log.Printf("can not save dead letter (%v): %v", item.ID, err)
+        return
+    }
+    if n.queueDir != "" {
+        err = RemoveItem(n.queueDir, item)
+        if err != nil {
+            log.Printf("can not remove queued notification (%v): %v", item.ID, err)
+        }
+    }
+}
+
+func (n *NotifyQueue) deliverDueItems() {
+    now := n.now()
+    items := n.takeDueItems(now.Unix())
+    for i, item := range items {
+        select {
+        case <-n.finish:
+            // undelivered items are delivered at next start
+            n.putBackItems(items[i:])
+            return
+        default:
+        }
+        retry, err := n.deliver(item)
+        item.Attempts++
+        if err == nil {
+            log.Printf("notified (%v, %v, %v, attempts = %v)", item.Label, item.NotifierName, item.Event.Action, item.Attempts)
+            if n.queueDir != "" {
+                err := RemoveItem(n.queueDir, item)
+                if err != nil {
+                    log.Printf("can not remove queued notification (%v): %v", item.ID, err)
+                }
+            }
+            continue
+        }
+        item.LastError = err.Error()
+        maxAttempts, retryInterval, maxRetryInterval := retryPolicy(retry)
+        if item.Attempts >= maxAttempts {
+            log.Printf("give up notification, move to dead letter (%v, %v, %v, attempts = %v): %v", item.Label, item.NotifierName, item.ID, item.Attempts, err)
+            n.deadLetter(item)
+            continue
+        }
+        interval := retryInterval
+        for j := int64(1); j < item.Attempts && interval < maxRetryInterval; j++ {
+            interval *= 2
+        }
+        if interval > maxRetryInterval {
+            interval = maxRetryInterval
+        }
+        item.NextAttempt = now.Unix() + interval
+        log.Printf("can not notify, retry after %v seconds (%v, %v, attempts = %v): %v", interval, item.Label, item.NotifierName, item.Attempts, err)
+        n.save(item)
+        n.putBackItems([]*Item{ item })
+    }
+}
+
+func (n *NotifyQueue) deliveryLoop() {
+    defer close(n.finished)
+    for {
+        select {
+        case <-n.finish:
+            return
+        case <-n.wakeup:
+        case <-time.After(deliveryInterval):
+        }
+        n.deliverDueItems()
+    }
+}
+
+// Load is load queued notifications of file
+func (n *NotifyQueue) Load(savePrefix string, fileID string) (error) {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+    n.queueDir = filepath.Join(savePrefix, n.callers, queueDirName, fileID)
+    n.deadLetterDir = DeadLetterDir(savePrefix, n.callers)
+    items, err := LoadItems(n.queueDir)
+    if err != nil {
+        return errors.Wrapf(err, "can not load queued notifications (%v)", n.queueDir)
+    }
+    // notifications queued before loading are persisted now
+    for _, item := range n.items {
+        n.save(item)
+    }
+    loaded := make(map[string]bool)
+    for _, item := range n.items {
+        loaded[item.ID] = true
+    }
+    for _, item := range items {
+        if loaded[item.ID] {
+            continue
+        }
+        n.items = append(n.items, item)
+    }
+    if len(items) > 0 {
+        log.Printf("loaded queued notifications (%v, %v)", n.queueDir, len(items))
+    }
+    return nil
+}
+
+// Loaded is loaded
+func (n *NotifyQueue) Loaded() (bool) {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+    return n.queueDir != ""
+}
+
+// Sync is update rule set used to find notifiers
+func (n *NotifyQueue) Sync(ruleSet *rulemanager.RuleSet) {
+    n.mutex.Lock()
+    defer n.mutex.Unlock()
+    n.ruleSet = ruleSet
+}
+
+// Start is start
+func (n *NotifyQueue) Start() {
+    n.finish = make(chan bool)
+    n.finished = make(chan bool)
+    go n.deliveryLoop()
+}
+
+// Stop is stop
+func (n *NotifyQueue) Stop() {
+    close(n.finish)
+    <-n.finished
+}
+
+// NewNotifyQueue is create new notify queue
+func NewNotifyQueue(callers string, notifierCache *notifiercache.NotifierCache) (*NotifyQueue) {
+    return &NotifyQueue {
+        callers: callers,
+        notifierCache: notifierCache,
+        ruleSet: nil,
+        queueDir: "",
+        deadLetterDir: "",
+        items: make([]*Item, 0),
+        seq: 0,
+        mutex: new(sync.Mutex),
+        now: time.Now,
+        wakeup: make(chan bool, 1),
+    }
+}
@@ -0,0 +1,194 @@
+package notifyqueue
+
+import (
+    "time"
+    "strings"
+    "testing"
+    "path/filepath"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifiercache"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/rulemanager"
+)
+
+const (
+    testFileID string = "file1"
+)
+
+type clock struct {
+    now time.Time
+}
+
+func (c *clock) get() (time.Time) {
+    return c.now
+}
+
+func (c *clock) advance(seconds int64) {
+    c.now = c.now.Add(time.Duration(seconds) * time.Second)
+}
+
+// newTestRuleSet is create rule set with notifiers whose plugins are not loaded, so every delivery fails
+func newTestRuleSet(notifiers ...*configurator.Notifier) (*rulemanager.RuleSet) {
+    return &rulemanager.RuleSet{
+        Config: &configurator.Config{},
+        Rules: []*rulemanager.Rule{
+            &rulemanager.Rule{
+                PathMatcher: &configurator.PathMatcher{
+                    Label: "app",
+                    Notifiers: notifiers,
+                },
+            },
+        },
+        Routes: nil,
+    }
+}
+
+func newTestNotifyQueue(t *testing.T, c *clock, savePrefix string, ruleSet *rulemanager.RuleSet) (*NotifyQueue) {
+    notifyQueue := NewNotifyQueue("test", notifiercache.NewNotifierCache("test"))
+    notifyQueue.now = c.get
+    err := notifyQueue.Load(savePrefix, testFileID)
+    if err != nil {
+        t.Fatalf("can not load queue: %v", err)
+    }
+    notifyQueue.Sync(ruleSet)
+    return notifyQueue
+}
+
+func testEvent() (*notifierplugger.Event) {
+    return &notifierplugger.Event{
+        Action: notifierplugger.EventTrigger,
+        Msg: []byte("ERROR disk full\n"),
+        FileID: testFileID,
+        FileName: "/var/log/app.log",
+        Label: "app",
+        Severity: notifierplugger.SeverityError,
+        Pattern: "ERROR",
+    }
+}
+
+func loadItems(t *testing.T, dir string) ([]*Item) {
+    items, err := LoadItems(dir)
+    if err != nil {
+        t.Fatalf("can not load items (%v): %v", dir, err)
+    }
+    return items
+}
+
+func TestRetryPolicy(t *testing.T) {
+    tests := []struct {
+        name string
+        retry *configurator.Retry
+        maxAttempts int64
+        interval int64
+        maxInterval int64
+    }{
+        { "default", nil, defaultMaxAttempts, defaultRetryInterval, defaultMaxRetryInterval },
+        { "partial", &configurator.Retry{ MaxAttempts: 3 }, 3, defaultRetryInterval, defaultMaxRetryInterval },
+        { "all", &configurator.Retry{ MaxAttempts: 2, Interval: 5, MaxInterval: 60 }, 2, 5, 60 },
+    }
+    for _, test := range tests {
+        maxAttempts, interval, maxInterval := retryPolicy(test.retry)
+        if maxAttempts != test.maxAttempts || interval != test.interval || maxInterval != test.maxInterval {
+            t.Errorf("%v: unexpected retry policy (%v, %v, %v)", test.name, maxAttempts, interval, maxInterval)
+        }
+    }
+}
+
+func TestBackoffAndDeadLetter(t *testing.T) {
+    c := &clock{ now: time.Unix(1767225600, 0) }
+    savePrefix := t.TempDir()
+    notifier := &configurator.Notifier{
+        Name: "missing",
+        Config: "missing.toml",
+        Retry: &configurator.Retry{ MaxAttempts: 4, Interval: 10, MaxInterval: 25 },
+    }
+    notifyQueue := newTestNotifyQueue(t, c, savePrefix, newTestRuleSet(notifier))
+    notifyQueue.Enqueue(testEvent(), []*configurator.Notifier{ notifier })
+    queueDir := filepath.Join(savePrefix, "test", queueDirName, testFileID)
+    deadLetterDir := DeadLetterDir(savePrefix, "test")
+    tests := []struct {
+        name string
+        advance int64
+        attempts int64
+        nextAttempt int64
+    }{
+        { "first attempt", 0, 1, 10 },
+        { "before interval", 9, 1, 1 },
+        { "second attempt", 1, 2, 20 },
+        { "third attempt is capped", 20, 3, 25 },
+        { "before capped interval", 24, 3, 1 },
+    }
+    for _, test := range tests {
+        c.advance(test.advance)
+        notifyQueue.deliverDueItems()
+        items := loadItems(t, queueDir)
+        if len(items) != 1 {
+            t.Fatalf("%v: unexpected queued items (%v)", test.name, len(items))
+        }
+        if items[0].Attempts != test.attempts || items[0].NextAttempt - c.now.Unix() != test.nextAttempt {
+            t.Errorf("%v: unexpected schedule (%v, %v)", test.name, items[0].Attempts, items[0].NextAttempt - c.now.Unix())
+        }
+        if !strings.Contains(items[0].LastError, "not found notifier plugin") {
+            t.Errorf("%v: unexpected last error (%v)", test.name, items[0].LastError)
+        }
+    }
+    c.advance(1)
+    notifyQueue.deliverDueItems()
+    if items := loadItems(t, queueDir); len(items) != 0 {
+        t.Errorf("undeliverable item is still queued (%v)", len(items))
+    }
+    deadLetters := loadItems(t, deadLetterDir)
+    if len(deadLetters) != 1 || deadLetters[0].Attempts != 4 {
+        t.Fatalf("undeliverable item is not moved to dead letter (%v)", len(deadLetters))
+    }
+    notifyQueue.mutex.Lock()
+    remaining := len(notifyQueue.items)
+    notifyQueue.mutex.Unlock()
+    if remaining != 0 {
+        t.Errorf("dead letter is still in queue (%v)", remaining)
+    }
+}
+
+func TestReloadAfterRestart(t *testing.T) {
+    c := &clock{ now: time.Unix(1767225600, 0) }
+    savePrefix := t.TempDir()
+    notifiers := []*configurator.Notifier{
+        &configurator.Notifier{ Name: "first", Config: "first.toml" },
+        &configurator.Notifier{ Name: "second", Config: "second.toml" },
+    }
+    ruleSet := newTestRuleSet(notifiers...)
+    // items queued before loading are persisted at load
+    notifyQueue := NewNotifyQueue("test", notifiercache.NewNotifierCache("test"))
+    notifyQueue.now = c.get
+    notifyQueue.Enqueue(testEvent(), notifiers[:1])
+    err := notifyQueue.Load(savePrefix, testFileID)
+    if err != nil {
+        t.Fatalf("can not load queue: %v", err)
+    }
+    notifyQueue.Sync(ruleSet)
+    notifyQueue.Enqueue(testEvent(), notifiers[1:])
+    notifyQueue.deliverDueItems()
+    restarted := newTestNotifyQueue(t, c, savePrefix, ruleSet)
+    restarted.mutex.Lock()
+    items := append([]*Item(nil), restarted.items...)
+    restarted.mutex.Unlock()
+    if len(items) != 2 {
+        t.Fatalf("queued items are not reloaded (%v)", len(items))
+    }
+    for i, item := range items {
+        if item.NotifierName != notifiers[i].Name || item.Attempts != 1 || item.NextAttempt != c.now.Unix() + defaultRetryInterval {
+            t.Errorf("unexpected reloaded item (%v, %v, %v)", item.NotifierName, item.Attempts, item.NextAttempt)
+        }
+        if string(item.Event.Msg) != "ERROR disk full\n" || item.Event.Label != "app" {
+            t.Errorf("unexpected reloaded event (%+v)", item.Event)
+        }
+    }
+    // reloaded item is retried on schedule
+    c.advance(defaultRetryInterval)
+    restarted.deliverDueItems()
+    for _, item := range loadItems(t, filepath.Join(savePrefix, "test", queueDirName, testFileID)) {
+        if item.Attempts != 2 {
+            t.Errorf("reloaded item is not retried (%v, %v)", item.NotifierName, item.Attempts)
+        }
+    }
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+    "os"
+    "io"
+    "fmt"
+    "log"
+    "flag"
+    "path"
+    "path/filepath"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifiercache"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifyqueue"
+    "github.com/potix/log_monitor/actor_plugins/matcher/rulemanager"
+)
+
+const (
+    callers string = "replayer"
+)
+
+func selected(item *notifyqueue.Item, label string, id string) (bool) {
+    return (label == "" || item.Label == label) && (id == "" || item.ID == id)
+}
+
+// replay is replay selected dead letters and return counts of replayed and failed, dry run only lists them
+func replay(out io.Writer, items []*notifyqueue.Item, ruleSet *rulemanager.RuleSet, notifierCache *notifiercache.NotifierCache,
+    deadLetterDir string, label string, id string, dryRun bool, keep bool) (int, int) {
+    replayed := 0
+    failed := 0
+    for _, item := range items {
+        if !selected(item, label, id) {
+            continue
+        }
+        if dryRun {
+            fmt.Fprintf(out, "%v\t%v\t%v\t%v\t%v\n", item.ID, item.Label, item.NotifierName, item.Attempts, item.LastError)
+            continue
+        }
+        notifier := notifyqueue.FindNotifier(ruleSet, item)
+        if notifier == nil {
+            log.Printf("not found notifier (%v, %v, %v, %v)", item.ID, item.Label, item.NotifierName, item.NotifierConfig)
+            failed++
+            continue
+        }
+        notifierPlugin, err := notifierCache.Get(notifier)
+        if err != nil {
+            log.Printf("can not get notifier (%v, %v): %v", item.ID, item.Label, err)
+            failed++
+            continue
+        }
+        item.Attempts++
+        err = notifierplugger.Dispatch(notifierPlugin, item.Event)
+        if err != nil {
+            log.Printf("can not replay notification (%v, %v, %v): %v", item.ID, item.Label, item.NotifierName, err)
+            item.LastError = err.Error()
+            err = notifyqueue.SaveItem(deadLetterDir, item)
+            if err != nil {
+                log.Printf("can not save dead letter (%v): %v", item.ID, err)
+            }
+            failed++
+            continue
+        }
+        log.Printf("replayed notification (%v, %v, %v)", item.ID, item.Label, item.NotifierName)
+        replayed++
+        if keep {
+            continue
+        }
+        err = notifyqueue.RemoveItem(deadLetterDir, item)
+        if err != nil {
+            log.Printf("can not remove dead letter (%v): %v", item.ID, err)
+        }
+    }
+    return replayed, failed
+}
+
+func main() {
+    var configFile string
+    var deadLetterDir string
+    var label string
+    var id string
+    var dryRun bool
+    var keep bool
+    flag.StringVar(&configFile, "config", "matcher.toml", "matcher config file")
+    flag.StringVar(&deadLetterDir, "dir", "", "dead letter directory (save_prefix/<callers>/deadletter)")
+    flag.StringVar(&label, "label", "", "replay only notifications of label")
+    flag.StringVar(&id, "id", "", "replay only notification of id")
+    flag.BoolVar(&dryRun, "dry-run", false, "list notifications without replaying")
+    flag.BoolVar(&keep, "keep", false, "keep notifications in dead letter directory after replaying")
+    flag.Parse()
+    if deadLetterDir == "" {
+        log.Fatalf("no dead letter directory")
+    }
+    configurator, err := configurator.NewConfigurator(configFile)
+    if err != nil {
+        log.Fatalf("can not create configurator (%v): %v", configFile, err)
+    }
+    config, err := configurator.Load()
+    if err != nil {
+        log.Fatalf("can not load config (%v): %v", configFile, err)
+    }
+    pluginPath := path.Join(filepath.Dir(configFile), config.NotifierPluginPath)
+    err = notifierplugger.LoadNotifierPlugins(pluginPath)
+    if err != nil {
+        log.Fatalf("can not load notifier plugins (%v): %v", pluginPath, err)
+    }
+    ruleManager, err := rulemanager.GetRuleManager(configFile, configurator)
+    if err != nil {
+        log.Fatalf("can not get rule manager: %v", err)
+    }
+    ruleSet := ruleManager.GetRuleSet()
+    items, err := notifyqueue.LoadItems(deadLetterDir)
+    if err != nil {
+        log.Fatalf("can not load dead letters (%v): %v", deadLetterDir, err)
+    }
+    notifierCache := notifiercache.NewNotifierCache(callers)
+    defer notifierCache.Clear()
+    replayed, failed := replay(os.Stdout, items, ruleSet, notifierCache, deadLetterDir, label, id, dryRun, keep)
+    notifierCache.Flush()
+    if dryRun {
+        return
+    }
+    log.Printf("replayed = %v, failed = %v", replayed, failed)
+    if failed > 0 {
+        notifierCache.Clear()
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifiercache"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifyqueue"
+    "github.com/potix/log_monitor/actor_plugins/matcher/rulemanager"
+)
+
+func newTestItem(id string, label string) (*notifyqueue.Item) {
+    return &notifyqueue.Item{
+        ID: id,
+        Label: label,
+        NotifierName: "missing",
+        NotifierConfig: "missing.toml",
+        Event: &notifierplugger.Event{
+            Action: notifierplugger.EventTrigger,
+            Msg: []byte("ERROR disk full\n"),
+            FileID: "file1",
+            FileName: "/var/log/app.log",
+            Label: label,
+        },
+        Attempts: 5,
+        NextAttempt: 0,
+        LastError: "failed",
+        CreatedAt: 0,
+    }
+}
+
+func TestReplay(t *testing.T) {
+    // notifier of app is configured but its plugin is not loaded, notifier of db is not configured
+    ruleSet := &rulemanager.RuleSet{
+        Config: &configurator.Config{},
+        Rules: []*rulemanager.Rule{
+            &rulemanager.Rule{
+                PathMatcher: &configurator.PathMatcher{
+                    Label: "app",
+                    Notifiers: []*configurator.Notifier{ &configurator.Notifier{ Name: "missing", Config: "missing.toml" } },
+                },
+            },
+        },
+    }
+    tests := []struct {
+        name string
+        label string
+        id string
+        dryRun bool
+        listed []string
+        failed int
+    }{
+        { "all", "", "", false, nil, 3 },
+        { "label", "app", "", false, nil, 2 },
+        { "id", "", "id2", false, nil, 1 },
+        { "id of other label", "app", "id3", false, nil, 0 },
+        { "dry run", "", "", true, []string{ "id1", "id2", "id3" }, 0 },
+        { "dry run with id", "", "id2", true, []string{ "id2" }, 0 },
+        { "dry run with label", "db", "", true, []string{ "id3" }, 0 },
+    }
+    for _, test := range tests {
+        deadLetterDir := t.TempDir()
+        items := []*notifyqueue.Item{ newTestItem("id1", "app"), newTestItem("id2", "app"), newTestItem("id3", "db") }
+        for _, item := range items {
+            err := notifyqueue.SaveItem(deadLetterDir, item)
+            if err != nil {
+                t.Fatalf("can not save item: %v", err)
+            }
+        }
+        out := new(bytes.Buffer)
+        replayed, failed := replay(out, items, ruleSet, notifiercache.NewNotifierCache("test"), deadLetterDir, test.label, test.id, test.dryRun, false)
+        if replayed != 0 || failed != test.failed {
+            t.Errorf("%v: unexpected result (%v, %v)", test.name, replayed, failed)
+        }
+        listed := make([]string, 0)
+        for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+            if line != "" {
+                listed = append(listed, strings.Split(line, "\t")[0])
+            }
+        }
+        if strings.Join(listed, ",") != strings.Join(test.listed, ",") {
+            t.Errorf("%v: unexpected listed items (%v, %v)", test.name, listed, test.listed)
+        }
+        // failed and listed items are kept as they are
+        loaded, err := notifyqueue.LoadItems(deadLetterDir)
+        if err != nil || len(loaded) != 3 {
+            t.Fatalf("%v: dead letters are changed (%v, %v)", test.name, len(loaded), err)
+        }
+        for _, item := range loaded {
+            if item.Attempts != 5 || item.LastError != "failed" {
+                t.Errorf("%v: dead letter is changed (%v, %v, %v)", test.name, item.ID, item.Attempts, item.LastError)
+            }
+        }
+    }
+}
@@ -0,0 +1,177 @@
+package rulemanager
+
+import (
+    "fmt"
+    "time"
+    "strings"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+)
+
+var weekdays = map[string]time.Weekday{
+    "sun": time.Sunday,
+    "mon": time.Monday,
+    "tue": time.Tuesday,
+    "wed": time.Wednesday,
+    "thu": time.Thursday,
+    "fri": time.Friday,
+    "sat": time.Saturday,
+}
+
+// Schedule is compiled schedule
+type Schedule struct {
+    Location *time.Location
+    Days map[time.Weekday]bool
+    Start int
+    End int
+}
+
+// Route is compiled route
+type Route struct {
+    Route *configurator.Route
+    Key string
+    Labels map[string]bool
+    MinSeverity string
+    Schedule *Schedule
+}
+
+func parseMinute(clock string) (int, error) {
+    t, err := time.Parse("15:04", clock)
+    if err != nil {
+        return 0, errors.Wrapf(err, "can not parse time (%v)", clock)
+    }
+    return t.Hour() * 60 + t.Minute(), nil
+}
+
+func compileSchedule(schedule *configurator.Schedule) (*Schedule, error) {
+    location := time.Local
+    if schedule.TimeZone != "" {
+        newLocation, err := time.LoadLocation(schedule.TimeZone)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not load time zone (%v)", schedule.TimeZone)
+        }
+        location = newLocation
+    }
+    days := make(map[time.Weekday]bool)
+    for _, day := range schedule.Days {
+        weekday, ok := weekdays[strings.ToLower(day)]
+        if !ok {
+            return nil, errors.Errorf("unexpected day (%v)", day)
+        }
+        days[weekday] = true
+    }
+    start := 0
+    end := 24 * 60
+    var err error
+    if schedule.Start != "" {
+        start, err = parseMinute(schedule.Start)
+        if err != nil {
+            return nil, errors.Wrap(err, "invalid start")
+        }
+    }
+    if schedule.End != "" {
+        end, err = parseMinute(schedule.End)
+        if err != nil {
+            return nil, errors.Wrap(err, "invalid end")
+        }
+    }
+    return &Schedule{
+        Location: location,
+        Days: days,
+        Start: start,
+        End: end,
+    }, nil
+}
+
+func compileRoute(index int, configRoute *configurator.Route) (*Route, error) {
+    key := configRoute.Name
+    if key == "" {
+        key = fmt.Sprintf("route%v", index)
+    }
+    labels := make(map[string]bool)
+    for _, label := range configRoute.Labels {
+        labels[label] = true
+    }
+    if configRoute.MinSeverity != "" && notifierplugger.SeverityRank(configRoute.MinSeverity) == 0 {
+        return nil, errors.Errorf("unexpected min severity (%v)", configRoute.MinSeverity)
+    }
+    var schedule *Schedule
+    if configRoute.Schedule != nil {
+        newSchedule, err := compileSchedule(configRoute.Schedule)
+        if err != nil {
+            return nil, errors.Wrapf(err, "invalid schedule (%v)", key)
+        }
+        schedule = newSchedule
+    }
+    err := validateNotifiers(configRoute.Notifiers)
+    if err != nil {
+        return nil, errors.Wrapf(err, "invalid notifiers (%v)", key)
+    }
+    if configRoute.Escalation != nil {
+        escalation := configRoute.Escalation
+        if escalation.Count <= 0 || escalation.Window <= 0 {
+            return nil, errors.Errorf("escalation count and window must be positive (%v, %v)", escalation.Count, escalation.Window)
+        }
+        err := validateNotifiers(escalation.Notifiers)
+        if err != nil {
+            return nil, errors.Wrapf(err, "invalid escalation notifiers (%v)", key)
+        }
+    }
+    return &Route{
+        Route: configRoute,
+        Key: key,
+        Labels: labels,
+        MinSeverity: configRoute.MinSeverity,
+        Schedule: schedule,
+    }, nil
+}
+
+// Contains is report whether time is in schedule
+func (s *Schedule) Contains(now time.Time) (bool) {
+    local := now.In(s.Location)
+    minute := local.Hour() * 60 + local.Minute()
+    weekday := local.Weekday()
+    if s.Start <= s.End {
+        if minute < s.Start || minute >= s.End {
+            return false
+        }
+    } else {
+        // over midnight, the part after midnight belongs to the previous day
+        if minute < s.End {
+            weekday = (weekday + 6) % 7
+        } else if minute < s.Start {
+            return false
+        }
+    }
+    return len(s.Days) == 0 || s.Days[weekday]
+}
+
+// Match is report whether route matches label and severity at the time
+func (r *Route) Match(label string, severity string, now time.Time) (bool) {
+    if len(r.Labels) > 0 && !r.Labels[label] {
+        return false
+    }
+    if r.MinSeverity != "" && notifierplugger.SeverityRank(severity) < notifierplugger.SeverityRank(r.MinSeverity) {
+        return false
+    }
+    if r.Schedule != nil && r.Schedule.Contains(now) == r.Route.OutsideSchedule {
+        return false
+    }
+    return true
+}
+
+// GetRoutes is get matched routes, it returns empty when no route is matched
+func (r *RuleSet) GetRoutes(label string, severity string, now time.Time) ([]*Route) {
+    routes := make([]*Route, 0)
+    for _, route := range r.Routes {
+        if !route.Match(label, severity, now) {
+            continue
+        }
+        routes = append(routes, route)
+        if !route.Route.Continue {
+            break
+        }
+    }
+    return routes
+}
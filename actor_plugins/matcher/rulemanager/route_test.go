@@ -0,0 +1,144 @@
+package rulemanager
+
+import (
+    "time"
+    "strings"
+    "testing"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+)
+
+// at is time of day in january 2026 in utc, 2026-01-05 is monday
+func at(day int, clock string) (time.Time) {
+    t, err := time.Parse("15:04", clock)
+    if err != nil {
+        panic(err)
+    }
+    return time.Date(2026, time.January, day, t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+func mustCompileSchedule(t *testing.T, schedule *configurator.Schedule) (*Schedule) {
+    compiled, err := compileSchedule(schedule)
+    if err != nil {
+        t.Fatalf("can not compile schedule (%+v): %v", schedule, err)
+    }
+    return compiled
+}
+
+func TestScheduleContains(t *testing.T) {
+    weekdays := &configurator.Schedule{ TimeZone: "UTC", Days: []string{ "mon", "tue", "wed", "thu", "fri" }, Start: "09:00", End: "18:00" }
+    fridayNight := &configurator.Schedule{ TimeZone: "UTC", Days: []string{ "Fri" }, Start: "22:00", End: "06:00" }
+    everyNight := &configurator.Schedule{ TimeZone: "UTC", Start: "22:00", End: "06:00" }
+    allDay := &configurator.Schedule{ TimeZone: "UTC", Days: []string{ "sat", "sun" } }
+    tests := []struct {
+        name string
+        schedule *configurator.Schedule
+        now time.Time
+        expected bool
+    }{
+        { "before start", weekdays, at(5, "08:59"), false },
+        { "at start", weekdays, at(5, "09:00"), true },
+        { "before end", weekdays, at(9, "17:59"), true },
+        { "at end", weekdays, at(9, "18:00"), false },
+        { "weekend", weekdays, at(10, "12:00"), false },
+        { "friday night", fridayNight, at(9, "23:00"), true },
+        { "after midnight belongs to friday", fridayNight, at(10, "05:59"), true },
+        { "end after midnight", fridayNight, at(10, "06:00"), false },
+        { "after midnight belongs to thursday", fridayNight, at(9, "05:00"), false },
+        { "thursday night", fridayNight, at(8, "23:00"), false },
+        { "between end and start", fridayNight, at(9, "12:00"), false },
+        { "every night", everyNight, at(5, "03:00"), true },
+        { "every night at start", everyNight, at(6, "22:00"), true },
+        { "every day time", everyNight, at(6, "21:59"), false },
+        { "all day", allDay, at(11, "00:00"), true },
+        { "all day end", allDay, at(11, "23:59"), true },
+        { "all day other day", allDay, at(5, "00:00"), false },
+    }
+    for _, test := range tests {
+        if got := mustCompileSchedule(t, test.schedule).Contains(test.now); got != test.expected {
+            t.Errorf("%v: unexpected result (%v, %v)", test.name, got, test.expected)
+        }
+    }
+}
+
+func TestScheduleLocation(t *testing.T) {
+    schedule := mustCompileSchedule(t, &configurator.Schedule{ TimeZone: "UTC", Days: []string{ "mon" }, Start: "09:00", End: "18:00" })
+    schedule.Location = time.FixedZone("JST", 9 * 60 * 60)
+    // 00:30 UTC is 09:30 JST
+    if !schedule.Contains(at(5, "00:30")) {
+        t.Errorf("time is not converted into location of schedule")
+    }
+    // 23:30 UTC of sunday is 08:30 JST of monday
+    if schedule.Contains(at(4, "23:30")) {
+        t.Errorf("time before start in location of schedule is contained")
+    }
+}
+
+func TestCompileRouteErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        route *configurator.Route
+        expected string
+    }{
+        { "unexpected severity", &configurator.Route{ MinSeverity: "fatal" }, "unexpected min severity" },
+        { "unexpected day", &configurator.Route{ Schedule: &configurator.Schedule{ Days: []string{ "holiday" } } }, "unexpected day" },
+        { "invalid start", &configurator.Route{ Schedule: &configurator.Schedule{ Start: "25:00" } }, "invalid start" },
+        { "unknown time zone", &configurator.Route{ Schedule: &configurator.Schedule{ TimeZone: "Nowhere/Unknown" } }, "can not load time zone" },
+        { "zero escalation count", &configurator.Route{ Escalation: &configurator.Escalation{ Count: 0, Window: 60 } }, "must be positive" },
+    }
+    for _, test := range tests {
+        _, err := compileRoute(0, test.route)
+        if err == nil || !strings.Contains(err.Error(), test.expected) {
+            t.Errorf("%v: unexpected error (%v)", test.name, err)
+        }
+    }
+}
+
+func mustCompileRoute(t *testing.T, index int, route *configurator.Route) (*Route) {
+    compiled, err := compileRoute(index, route)
+    if err != nil {
+        t.Fatalf("can not compile route (%+v): %v", route, err)
+    }
+    return compiled
+}
+
+func TestGetRoutes(t *testing.T) {
+    ruleSet := &RuleSet{
+        Routes: []*Route{
+            mustCompileRoute(t, 0, &configurator.Route{ Name: "db", Labels: []string{ "db" }, MinSeverity: notifierplugger.SeverityCritical }),
+            mustCompileRoute(t, 1, &configurator.Route{ Name: "error", MinSeverity: notifierplugger.SeverityError, Continue: true }),
+            mustCompileRoute(t, 2, &configurator.Route{
+                Schedule: &configurator.Schedule{ TimeZone: "UTC", Days: []string{ "mon", "tue", "wed", "thu", "fri" }, Start: "09:00", End: "18:00" },
+                OutsideSchedule: true,
+            }),
+            mustCompileRoute(t, 3, &configurator.Route{ Name: "default" }),
+        },
+    }
+    tests := []struct {
+        name string
+        label string
+        severity string
+        now time.Time
+        expected string
+    }{
+        { "first match stops", "db", notifierplugger.SeverityCritical, at(5, "12:00"), "db" },
+        { "label does not match", "app", notifierplugger.SeverityCritical, at(5, "12:00"), "error,default" },
+        { "below min severity", "db", notifierplugger.SeverityError, at(5, "12:00"), "error,default" },
+        { "below min severity of every route", "app", notifierplugger.SeverityWarning, at(5, "12:00"), "default" },
+        { "unknown severity is lowest", "app", "", at(5, "12:00"), "default" },
+        { "outside schedule", "app", notifierplugger.SeverityWarning, at(10, "12:00"), "route2" },
+        { "continue to outside schedule", "app", notifierplugger.SeverityError, at(5, "20:00"), "error,route2" },
+    }
+    for _, test := range tests {
+        keys := make([]string, 0)
+        for _, route := range ruleSet.GetRoutes(test.label, test.severity, test.now) {
+            keys = append(keys, route.Key)
+        }
+        if got := strings.Join(keys, ","); got != test.expected {
+            t.Errorf("%v: unexpected routes (%v, %v)", test.name, got, test.expected)
+        }
+    }
+    if routes := (&RuleSet{}).GetRoutes("app", notifierplugger.SeverityError, at(5, "12:00")); len(routes) != 0 {
+        t.Errorf("routes are matched without routes (%v)", len(routes))
+    }
+}
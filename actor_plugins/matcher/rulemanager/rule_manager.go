@@ -2,66 +2,168 @@ package rulemanager
 
 import (
     "time"
-    "regexp"
     "log"
+    "sync"
+    "path/filepath"
+    "github.com/pkg/errors"
+    "github.com/fsnotify/fsnotify"
     "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
 )
 
+var ruleManagers = make(map[string]*RuleManager)
+var ruleManagersMutex = new(sync.Mutex)
+
 // RuleManager is RuleManager
 type RuleManager struct {
-    config *configurator.Config
+    configFile string
     configurator *configurator.Configurator
+    ruleSet *RuleSet
+    ruleSetMutex *sync.Mutex
+    lastError string
+    watcher *fsnotify.Watcher
+    refs int
+    refsMutex *sync.Mutex
     finish chan bool
+    finished chan bool
+}
+
+func (r *RuleManager) reload() {
+    config, err := r.configurator.Load()
+    if err != nil {
+        r.reloadError(errors.Wrap(err, "can not load config"))
+        return
+    }
+    newRuleSet, err := compileRuleSet(config)
+    if err != nil {
+        r.reloadError(errors.Wrap(err, "invalid config"))
+        return
+    }
+    r.lastError = ""
+    if !diffRuleSet(r.GetRuleSet(), newRuleSet) {
+        return
+    }
+    r.ruleSetMutex.Lock()
+    defer r.ruleSetMutex.Unlock()
+    r.ruleSet = newRuleSet
+    log.Printf("reloaded config (%v)", r.configFile)
 }
 
-func (r *RuleManager) reloadLoop() {
+func (r *RuleManager) reloadError(err error) {
+    // log once until config is changed
+    if err.Error() == r.lastError {
+        return
+    }
+    r.lastError = err.Error()
+    log.Printf("keep last good rules (%v): %v", r.configFile, err)
+}
+
+// reloadLoop is reload rules until finish, watcher and channels are passed
+// so that the loop does not see those of next start
+func (r *RuleManager) reloadLoop(watcher *fsnotify.Watcher, finish chan bool, finished chan bool) {
+    defer close(finished)
     for {
+        var autoReload <-chan time.Time
+        if r.GetRuleSet().Config.AutoReload > 0 {
+            autoReload = time.After(time.Duration(r.GetRuleSet().Config.AutoReload) * time.Second)
+        }
         select {
-        case <-time.After(time.Duration(r.config.AutoReload) *time.Second):
-	    config, err := r.configurator.Load()
-	    if err != nil {
-	        log.Printf("can not load config: %v", err)
-		break
-	    }
-	    r.config = config
-        case <-r.finish:
+        case <-autoReload:
+            r.reload()
+        case event, ok := <-watcher.Events:
+            if !ok {
+                return
+            }
+            if filepath.Clean(event.Name) != r.configFile {
+                break
+            }
+            if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+                break
+            }
+            r.reload()
+        case err, ok := <-watcher.Errors:
+            if !ok {
+                return
+            }
+            log.Printf("watcher error (%v): %v", r.configFile, err)
+        case <-finish:
             return
         }
     }
 }
 
-// GetRule is get rule
-func (r *RuleManager) GetRule(filename string) (*configurator.PathMatcher) {
-    for _, pathMatcher := range r.config.PathMatchers {
-	matched, err := regexp.MatchString(pathMatcher.Pattern, filename)
-	if err != nil {
-	    log.Printf("can not match string (%v, %v): %v", pathMatcher.Pattern, filename, err)
-            continue
-	}
-	if !matched {
-	    continue
-	}
-	return pathMatcher
-    }
-    return nil
+// GetRuleSet is get current rule set
+func (r *RuleManager) GetRuleSet() (*RuleSet) {
+    r.ruleSetMutex.Lock()
+    defer r.ruleSetMutex.Unlock()
+    return r.ruleSet
 }
 
-// Start is tart
+// Start is start
 func (r *RuleManager) Start() (error) {
+    r.refsMutex.Lock()
+    defer r.refsMutex.Unlock()
+    r.refs++
+    if r.refs > 1 {
+        return nil
+    }
+    watcher, err := fsnotify.NewWatcher()
+    if err != nil {
+        r.refs--
+        return errors.Wrap(err, "can not create watcher")
+    }
+    // watch directory to follow replacing config file
+    err = watcher.Add(filepath.Dir(r.configFile))
+    if err != nil {
+        watcher.Close()
+        r.refs--
+        return errors.Wrapf(err, "can not watch config file (%v)", r.configFile)
+    }
+    r.watcher = watcher
     r.finish = make(chan bool)
-    go r.reloadLoop()
+    r.finished = make(chan bool)
+    go r.reloadLoop(r.watcher, r.finish, r.finished)
     return nil
 }
 
 // Stop is stop
 func (r *RuleManager) Stop() {
+    r.refsMutex.Lock()
+    defer r.refsMutex.Unlock()
+    r.refs--
+    if r.refs > 0 {
+        return
+    }
     close(r.finish)
+    r.watcher.Close()
+    // wait so that the loop does not reload together with the loop of next start
+    <-r.finished
 }
 
-// NewRuleManager is create new rule manager
-func NewRuleManager(config *configurator.Config, configurator  *configurator.Configurator) (*RuleManager, error) {
-    return &RuleManager {
-	config: config,
+// GetRuleManager is get rule manager shared by matchers of same config file
+func GetRuleManager(configFile string, configurator *configurator.Configurator) (*RuleManager, error) {
+    ruleManagersMutex.Lock()
+    defer ruleManagersMutex.Unlock()
+    configFile = filepath.Clean(configFile)
+    ruleManager, ok := ruleManagers[configFile]
+    if ok {
+        return ruleManager, nil
+    }
+    config, err := configurator.Load()
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not load config (%v)", configFile)
+    }
+    ruleSet, err := compileRuleSet(config)
+    if err != nil {
+        return nil, errors.Wrapf(err, "invalid config (%v)", configFile)
+    }
+    ruleManager = &RuleManager {
+        configFile: configFile,
         configurator: configurator,
-    }, nil
+        ruleSet: ruleSet,
+        ruleSetMutex: new(sync.Mutex),
+        refs: 0,
+        refsMutex: new(sync.Mutex),
+    }
+    ruleManagers[configFile] = ruleManager
+    return ruleManager, nil
 }
@@ -0,0 +1,72 @@
+package rulemanager
+
+import (
+    "fmt"
+    "time"
+    "testing"
+    "io/ioutil"
+    "path/filepath"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+)
+
+func writeConfig(t *testing.T, configFile string, checkInterval int64) {
+    data := fmt.Sprintf("save_prefix = \"m1\"\ncheck_interval = %v\n", checkInterval)
+    err := ioutil.WriteFile(configFile, []byte(data), 0644)
+    if err != nil {
+        t.Fatalf("can not write config: %v", err)
+    }
+}
+
+func waitCheckInterval(ruleManager *RuleManager, checkInterval int64, timeout time.Duration) (bool) {
+    deadline := time.Now().Add(timeout)
+    for time.Now().Before(deadline) {
+        if ruleManager.GetRuleSet().Config.CheckInterval == checkInterval {
+            return true
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+    return false
+}
+
+func TestStartStopStart(t *testing.T) {
+    configFile := filepath.Join(t.TempDir(), "matcher.toml")
+    writeConfig(t, configFile, 1)
+    newConfigurator, err := configurator.NewConfigurator(configFile)
+    if err != nil {
+        t.Fatalf("can not create configurator: %v", err)
+    }
+    ruleManager, err := GetRuleManager(configFile, newConfigurator)
+    if err != nil {
+        t.Fatalf("can not get rule manager: %v", err)
+    }
+    for i := 0; i < 3; i++ {
+        err := ruleManager.Start()
+        if err != nil {
+            t.Fatalf("can not start: %v", err)
+        }
+        ruleManager.Stop()
+    }
+    err = ruleManager.Start()
+    if err != nil {
+        t.Fatalf("can not start: %v", err)
+    }
+    // second reference does not start another loop
+    err = ruleManager.Start()
+    if err != nil {
+        t.Fatalf("can not start: %v", err)
+    }
+    writeConfig(t, configFile, 2)
+    if !waitCheckInterval(ruleManager, 2, 5 * time.Second) {
+        t.Errorf("config is not reloaded after restart")
+    }
+    ruleManager.Stop()
+    writeConfig(t, configFile, 3)
+    if !waitCheckInterval(ruleManager, 3, 5 * time.Second) {
+        t.Errorf("config is not reloaded while referenced")
+    }
+    ruleManager.Stop()
+    writeConfig(t, configFile, 4)
+    if waitCheckInterval(ruleManager, 4, 500 * time.Millisecond) {
+        t.Errorf("config is reloaded after stop")
+    }
+}
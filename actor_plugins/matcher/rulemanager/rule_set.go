@@ -0,0 +1,243 @@
+package rulemanager
+
+import (
+    "fmt"
+    "log"
+    "regexp"
+    "reflect"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/aggregator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+)
+
+const (
+    defaultSeverity string = notifierplugger.SeverityError
+)
+
+// MsgRule is compiled msg matcher
+type MsgRule struct {
+    MsgMatcher *configurator.MsgMatcher
+    Regexp *regexp.Regexp
+    RecoveryRegexp *regexp.Regexp
+    Severity string
+}
+
+// Rule is compiled path matcher
+type Rule struct {
+    PathMatcher *configurator.PathMatcher
+    Regexp *regexp.Regexp
+    MsgRules []*MsgRule
+    Severity string
+}
+
+// RuleSet is compiled config
+type RuleSet struct {
+    Config *configurator.Config
+    Rules []*Rule
+    Routes []*Route
+}
+
+// GetRule is get rule of file
+func (r *RuleSet) GetRule(fileName string) (*Rule) {
+    for _, rule := range r.Rules {
+        if !rule.Regexp.MatchString(fileName) {
+            continue
+        }
+        return rule
+    }
+    return nil
+}
+
+func validateAggregation(aggregation *configurator.Aggregation) (error) {
+    switch aggregation.Mode {
+    case aggregator.ModeCount:
+        if aggregation.Count <= 0 || aggregation.Window <= 0 {
+            return errors.Errorf("count and window must be positive (%v, %v)", aggregation.Count, aggregation.Window)
+        }
+    case aggregator.ModeRate:
+        if aggregation.Rate <= 0 || aggregation.Window <= 0 {
+            return errors.Errorf("rate and window must be positive (%v, %v)", aggregation.Rate, aggregation.Window)
+        }
+    case aggregator.ModeAbsence:
+        if aggregation.Duration <= 0 {
+            return errors.Errorf("duration must be positive (%v)", aggregation.Duration)
+        }
+    default:
+        return errors.Errorf("unexpected aggregation mode (%v)", aggregation.Mode)
+    }
+    return nil
+}
+
+func validateNotifiers(notifiers []*configurator.Notifier) (error) {
+    for _, notifier := range notifiers {
+        _, _, ok := notifierplugger.GetNotifierPlugin(notifier.Name)
+        if !ok {
+            return errors.Errorf("not found notifier plugin (%v)", notifier.Name)
+        }
+        if notifier.Retry != nil {
+            retry := notifier.Retry
+            if retry.MaxAttempts < 0 || retry.Interval < 0 || retry.MaxInterval < 0 {
+                return errors.Errorf("retry must not be negative (%v, %v, %v)", retry.MaxAttempts, retry.Interval, retry.MaxInterval)
+            }
+        }
+    }
+    return nil
+}
+
+func compileSeverity(severity string, fallbackSeverity string) (string, error) {
+    if severity == "" {
+        return fallbackSeverity, nil
+    }
+    if notifierplugger.SeverityRank(severity) == 0 {
+        return "", errors.Errorf("unexpected severity (%v)", severity)
+    }
+    return severity, nil
+}
+
+func compileRule(pathMatcher *configurator.PathMatcher) (*Rule, error) {
+    pathRegexp, err := regexp.Compile(pathMatcher.Pattern)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not compile path pattern (%v)", pathMatcher.Pattern)
+    }
+    pathSeverity, err := compileSeverity(pathMatcher.Severity, defaultSeverity)
+    if err != nil {
+        return nil, errors.Wrapf(err, "invalid severity (%v)", pathMatcher.Label)
+    }
+    msgRules := make([]*MsgRule, 0, len(pathMatcher.MsgMatchers))
+    for _, msgMatcher := range pathMatcher.MsgMatchers {
+        msgRegexp, err := regexp.Compile(msgMatcher.Pattern)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not compile msg pattern (%v)", msgMatcher.Pattern)
+        }
+        var recoveryRegexp *regexp.Regexp
+        if msgMatcher.RecoveryPattern != "" {
+            recoveryRegexp, err = regexp.Compile(msgMatcher.RecoveryPattern)
+            if err != nil {
+                return nil, errors.Wrapf(err, "can not compile recovery pattern (%v)", msgMatcher.RecoveryPattern)
+            }
+        }
+        severity, err := compileSeverity(msgMatcher.Severity, pathSeverity)
+        if err != nil {
+            return nil, errors.Wrapf(err, "invalid severity (%v)", msgMatcher.Pattern)
+        }
+        if msgMatcher.Aggregation != nil {
+            err := validateAggregation(msgMatcher.Aggregation)
+            if err != nil {
+                return nil, errors.Wrapf(err, "invalid aggregation (%v)", msgMatcher.Pattern)
+            }
+        }
+        msgRules = append(msgRules, &MsgRule{
+            MsgMatcher: msgMatcher,
+            Regexp: msgRegexp,
+            RecoveryRegexp: recoveryRegexp,
+            Severity: severity,
+        })
+    }
+    if pathMatcher.Grouping != nil {
+        grouping := pathMatcher.Grouping
+        if grouping.Interval < 0 || grouping.Count < 0 || grouping.Cooldown < 0 {
+            return nil, errors.Errorf("grouping must not be negative (%v, %v, %v)", grouping.Interval, grouping.Count, grouping.Cooldown)
+        }
+    }
+    if pathMatcher.Heartbeat != nil && pathMatcher.Heartbeat.Duration <= 0 {
+        return nil, errors.Errorf("heartbeat duration must be positive (%v)", pathMatcher.Heartbeat.Duration)
+    }
+    err = validateNotifiers(pathMatcher.Notifiers)
+    if err != nil {
+        return nil, errors.Wrap(err, "invalid notifiers")
+    }
+    return &Rule{
+        PathMatcher: pathMatcher,
+        Regexp: pathRegexp,
+        MsgRules: msgRules,
+        Severity: pathSeverity,
+    }, nil
+}
+
+func compileRuleSet(config *configurator.Config) (*RuleSet, error) {
+    if config.AutoReload < 0 || config.CheckInterval < 0 {
+        return nil, errors.Errorf("auto_reload and check_interval must not be negative (%v, %v)", config.AutoReload, config.CheckInterval)
+    }
+    rules := make([]*Rule, 0, len(config.PathMatchers))
+    for _, pathMatcher := range config.PathMatchers {
+        rule, err := compileRule(pathMatcher)
+        if err != nil {
+            return nil, errors.Wrapf(err, "invalid path matcher (%v)", pathMatcher.Label)
+        }
+        rules = append(rules, rule)
+    }
+    routes := make([]*Route, 0, len(config.Routes))
+    for i, configRoute := range config.Routes {
+        route, err := compileRoute(i, configRoute)
+        if err != nil {
+            return nil, errors.Wrapf(err, "invalid route (%v)", i)
+        }
+        routes = append(routes, route)
+    }
+    return &RuleSet{
+        Config: config,
+        Rules: rules,
+        Routes: routes,
+    }, nil
+}
+
+// ruleKeys is keys of rules for diff, labels may be empty or duplicated so that occurrence is added
+func ruleKeys(ruleSet *RuleSet) ([]string) {
+    occurrences := make(map[string]int)
+    keys := make([]string, 0, len(ruleSet.Rules))
+    for _, rule := range ruleSet.Rules {
+        label := rule.PathMatcher.Label
+        keys = append(keys, fmt.Sprintf("%v#%v", label, occurrences[label]))
+        occurrences[label]++
+    }
+    return keys
+}
+
+// diffRuleSet is log differences of rule sets and report whether there are differences
+func diffRuleSet(oldRuleSet *RuleSet, newRuleSet *RuleSet) (bool) {
+    changed := false
+    oldConfig := *oldRuleSet.Config
+    newConfig := *newRuleSet.Config
+    oldConfig.PathMatchers = nil
+    newConfig.PathMatchers = nil
+    if !reflect.DeepEqual(oldConfig, newConfig) {
+        log.Printf("config changed (%+v -> %+v)", oldConfig, newConfig)
+        changed = true
+    }
+    oldKeys := ruleKeys(oldRuleSet)
+    oldPathMatchers := make(map[string]*configurator.PathMatcher)
+    for i, rule := range oldRuleSet.Rules {
+        oldPathMatchers[oldKeys[i]] = rule.PathMatcher
+    }
+    newKeys := ruleKeys(newRuleSet)
+    newPathMatchers := make(map[string]*configurator.PathMatcher)
+    for i, rule := range newRuleSet.Rules {
+        key := newKeys[i]
+        label := rule.PathMatcher.Label
+        newPathMatchers[key] = rule.PathMatcher
+        oldPathMatcher, ok := oldPathMatchers[key]
+        if !ok {
+            log.Printf("rule added (%v)", label)
+            changed = true
+            continue
+        }
+        if !reflect.DeepEqual(oldPathMatcher, rule.PathMatcher) {
+            log.Printf("rule changed (%v)", label)
+            changed = true
+            continue
+        }
+        if i >= len(oldKeys) || oldKeys[i] != key {
+            log.Printf("rule moved (%v)", label)
+            changed = true
+        }
+    }
+    for i, rule := range oldRuleSet.Rules {
+        _, ok := newPathMatchers[oldKeys[i]]
+        if !ok {
+            log.Printf("rule removed (%v)", rule.PathMatcher.Label)
+            changed = true
+        }
+    }
+    return changed
+}
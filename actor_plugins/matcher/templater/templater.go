@@ -0,0 +1,272 @@
+package templater
+
+import (
+    "io"
+    "os"
+    "fmt"
+    "sync"
+    "time"
+    "bytes"
+    "regexp"
+    "strings"
+    "io/ioutil"
+    "unicode/utf8"
+    "encoding/json"
+    texttemplate "text/template"
+    htmltemplate "html/template"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+)
+
+// Params is template parameters of notification
+type Params struct {
+    Message string
+    FileID string
+    FileName string
+    Label string
+    Severity string
+    Action string
+    Pattern string
+    Hostname string
+    Time time.Time
+    Timestamp string
+}
+
+type executor interface {
+    Execute(w io.Writer, data interface{}) (error)
+}
+
+// Template is compiled template
+type Template struct {
+    name string
+    executor executor
+}
+
+var regexpCache = make(map[string]*regexp.Regexp)
+var regexpCacheMutex = new(sync.Mutex)
+
+var hostname = func() (string) {
+    name, err := os.Hostname()
+    if err != nil {
+        return "unknown"
+    }
+    return name
+}()
+
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+    regexpCacheMutex.Lock()
+    defer regexpCacheMutex.Unlock()
+    re, ok := regexpCache[pattern]
+    if ok {
+        return re, nil
+    }
+    re, err := regexp.Compile(pattern)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not compile pattern (%v)", pattern)
+    }
+    regexpCache[pattern] = re
+    return re, nil
+}
+
+// Truncate is truncate text to length bytes without breaking utf8 characters
+func Truncate(length int, text string) (string) {
+    if length < 0 || len(text) <= length {
+        return text
+    }
+    // text[length] is first dropped byte, back up to start of character that is cut
+    // only trailing partial character is removed, invalid bytes before it are kept
+    cut := length
+    for cut > 0 && cut > length - utf8.UTFMax && !utf8.RuneStart(text[cut]) {
+        cut--
+    }
+    if cut < length {
+        r, size := utf8.DecodeRuneInString(text[cut:])
+        if !(r == utf8.RuneError && size == 1) && cut + size > length {
+            return text[:cut]
+        }
+    }
+    return text[:length]
+}
+
+func capture(pattern string, text string, group int) (string, error) {
+    re, err := compileRegexp(pattern)
+    if err != nil {
+        return "", err
+    }
+    match := re.FindStringSubmatch(text)
+    if group < 0 || group >= len(match) {
+        return "", nil
+    }
+    return match[group], nil
+}
+
+func namedCapture(pattern string, text string, name string) (string, error) {
+    re, err := compileRegexp(pattern)
+    if err != nil {
+        return "", err
+    }
+    match := re.FindStringSubmatch(text)
+    for index, subexpName := range re.SubexpNames() {
+        if subexpName == name && index < len(match) {
+            return match[index], nil
+        }
+    }
+    return "", nil
+}
+
+func toJSON(v interface{}) (string, error) {
+    buf, err := json.Marshal(v)
+    return string(buf), err
+}
+
+func jsonEscape(text string) (string, error) {
+    quoted, err := toJSON(text)
+    if err != nil {
+        return "", err
+    }
+    return quoted[1:len(quoted) - 1], nil
+}
+
+func defaultValue(value string, text string) (string) {
+    if text == "" {
+        return value
+    }
+    return text
+}
+
+// Funcs is helper functions available in templates
+var Funcs = map[string]interface{}{
+    "trim": func(text string) string { return strings.TrimRight(text, "\r\n") },
+    "trimSpace": strings.TrimSpace,
+    "truncate": Truncate,
+    "upper": strings.ToUpper,
+    "lower": strings.ToLower,
+    "replace": func(old string, new string, text string) string { return strings.Replace(text, old, new, -1) },
+    "default": defaultValue,
+    "json": toJSON,
+    "jsonEscape": jsonEscape,
+    "capture": capture,
+    "namedCapture": namedCapture,
+    "hostname": func() string { return hostname },
+    "now": time.Now,
+    "formatTime": func(layout string, t time.Time) string { return t.Format(layout) },
+    "rfc3339": func(t time.Time) string { return t.Format(time.RFC3339) },
+    "unix": func(t time.Time) int64 { return t.Unix() },
+}
+
+// NewParams is create params from event
+// hostname is host of event if logs are matched on other host
+func NewParams(event *notifierplugger.Event) (*Params) {
+    now := time.Now()
+    eventHostname := hostname
+    if event.Host != "" {
+        eventHostname = event.Host
+    }
+    return &Params{
+        Message: strings.TrimRight(string(event.Msg), "\r\n"),
+        FileID: event.FileID,
+        FileName: event.FileName,
+        Label: event.Label,
+        Severity: event.Severity,
+        Action: event.Action,
+        Pattern: event.Pattern,
+        Hostname: eventHostname,
+        Time: now,
+        Timestamp: now.Format(time.RFC3339),
+    }
+}
+
+// SampleParams is params used to validate templates
+func SampleParams() (*Params) {
+    return NewParams(&notifierplugger.Event{
+        Action: notifierplugger.EventTrigger,
+        Msg: []byte("sample message 123\n"),
+        FileID: "0",
+        FileName: "/var/log/sample",
+        Label: "sample",
+        Severity: notifierplugger.SeverityError,
+        Pattern: "sample",
+    })
+}
+
+func validate(t *Template, sample interface{}) (error) {
+    if sample == nil {
+        sample = SampleParams()
+    }
+    _, err := t.Execute(sample)
+    if err != nil {
+        return errors.Wrap(err, "template is not valid for sample")
+    }
+    return nil
+}
+
+// New is create text template, it is validated with sample (params of SampleParams if sample is nil)
+func New(name string, text string, sample interface{}) (*Template, error) {
+    tmpl, err := texttemplate.New(name).Option("missingkey=error").Funcs(Funcs).Parse(text)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not parse template (%v)", name)
+    }
+    t := &Template{
+        name: name,
+        executor: tmpl,
+    }
+    err = validate(t, sample)
+    if err != nil {
+        return nil, err
+    }
+    return t, nil
+}
+
+// NewHTML is create html template that escapes values, it is validated like New
+func NewHTML(name string, text string, sample interface{}) (*Template, error) {
+    tmpl, err := htmltemplate.New(name).Option("missingkey=error").Funcs(Funcs).Parse(text)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not parse html template (%v)", name)
+    }
+    t := &Template{
+        name: name,
+        executor: tmpl,
+    }
+    err = validate(t, sample)
+    if err != nil {
+        return nil, err
+    }
+    return t, nil
+}
+
+// NewFromFile is create text template from file
+func NewFromFile(fileName string, sample interface{}) (*Template, error) {
+    text, err := ioutil.ReadFile(fileName)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not read template file (%v)", fileName)
+    }
+    return New(fileName, string(text), sample)
+}
+
+// NewHTMLFromFile is create html template from file
+func NewHTMLFromFile(fileName string, sample interface{}) (*Template, error) {
+    text, err := ioutil.ReadFile(fileName)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not read template file (%v)", fileName)
+    }
+    return NewHTML(fileName, string(text), sample)
+}
+
+// Execute is execute template
+func (t *Template) Execute(data interface{}) (string, error) {
+    buf := new(bytes.Buffer)
+    err := t.executor.Execute(buf, data)
+    if err != nil {
+        return "", errors.Wrapf(err, "can not execute template (%v)", t.name)
+    }
+    return buf.String(), nil
+}
+
+// ExecuteOr is execute template, it returns fallback when execution is failed
+func (t *Template) ExecuteOr(data interface{}, fallback string) (string) {
+    text, err := t.Execute(data)
+    if err != nil {
+        return fmt.Sprintf("%v (template error: %v)", fallback, err)
+    }
+    return text
+}
@@ -0,0 +1,48 @@
+package templater
+
+import (
+    "testing"
+)
+
+func TestTruncate(t *testing.T) {
+    tests := []struct {
+        name string
+        length int
+        text string
+        expected string
+    }{
+        { "short", 5, "abc", "abc" },
+        { "ascii", 3, "abcdef", "abc" },
+        { "negative", -1, "abc", "abc" },
+        { "zero", 0, "abc", "" },
+        { "two byte cut", 2, "aé", "a" },
+        { "three byte cut", 4, "日本", "日" },
+        { "three byte boundary", 3, "日本", "日" },
+        { "four byte cut", 3, "a\U0001F600", "a" },
+        { "invalid byte first", 3, "\xffabc", "\xffab" },
+        { "invalid byte at cut", 3, "ab\xff\xfe", "ab\xff" },
+        { "invalid and multibyte", 4, "\xff日x", "\xff日" },
+        { "invalid and cut", 3, "\xff日x", "\xff" },
+        { "stray continuation", 2, "a\x80\x80\x80", "a\x80" },
+    }
+    for _, test := range tests {
+        truncated := Truncate(test.length, test.text)
+        if truncated != test.expected {
+            t.Errorf("%v: unexpected text (%q, %q)", test.name, truncated, test.expected)
+        }
+    }
+}
+
+func TestExecuteOr(t *testing.T) {
+    template, err := New("test", "{{.Label}}", nil)
+    if err != nil {
+        t.Fatalf("can not create template: %v", err)
+    }
+    text := template.ExecuteOr(struct{}{}, "fallback")
+    if len(text) < len("fallback") || text[:len("fallback")] != "fallback" {
+        t.Errorf("fallback is not used (%v)", text)
+    }
+    if text := template.ExecuteOr(SampleParams(), "fallback"); text != "sample" {
+        t.Errorf("unexpected text (%v)", text)
+    }
+}
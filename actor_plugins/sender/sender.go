@@ -65,6 +65,21 @@ type Sender struct {
 }
 
 
+// waitRetry is wait for retry after limited by reciever, events are drained so that ModifiedFile does not block
+func (s *Sender) waitRetry(retryAfter time.Duration) (bool) {
+    timer := time.NewTimer(retryAfter)
+    defer timer.Stop()
+    for {
+        select {
+        case _, ok := <-s.fileCheckInfo.eventCh:
+            if !ok {
+               return false
+            }
+        case <-timer.C:
+            return true
+        }
+    }
+}
 
 func (s *Sender) fileCheckLoop() {
     for {
@@ -105,6 +120,13 @@ again:
             log.Printf("can not recieve reply : %v", err)
             continue
 	}
+        if !transferReply.Success && transferReply.RetryAfter > 0 {
+            log.Printf("transfer is limited, retry after %v seconds : %v", transferReply.RetryAfter, transferReply.Msg)
+            if !s.waitRetry(time.Duration(transferReply.RetryAfter) * time.Second) {
+               return
+            }
+            goto again
+        }
         if !transferReply.Success  {
             log.Printf("can not transfer : %v", transferReply.Msg)
             continue
@@ -1,6 +1,10 @@
 #!/bin/bash
 protoc  logpb/log.proto --go_out=plugins=grpc:.
-go build log_reciever.go
+protoc  logpb/query.proto --go_out=plugins=grpc:.
+protoc  logpb/subscription.proto --go_out=plugins=grpc:.
+# sqlite3 driver of sql store is linked by BUILD_TAGS=sqlite, it needs cgo
+go build -tags "${BUILD_TAGS}" log_reciever.go
+go build log_query.go
 go build log_monitor.go
 cd actor_plugins/matcher
 ./build.sh
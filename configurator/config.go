@@ -20,9 +20,132 @@ type LogMonitorConfig struct {
     Targets []*Target `json:"targets" yaml:"targets" toml:"targets"`  
 }
 
+// PathPolicy is character policy of path token
+// allowed is characters of regexp character class, disallowed characters are replaced with replacement or rejected if replacement is empty
+type PathPolicy struct {
+    Allowed string `json:"allowed" yaml:"allowed" toml:"allowed"`
+    Replacement string `json:"replacement" yaml:"replacement" toml:"replacement"`
+    AllowSlash bool `json:"allow_slash" yaml:"allow_slash" toml:"allow_slash"`
+}
+
+// S3Config is config of s3 compatible object store
+// access_key and secret_key are taken from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY if they are empty
+// batch_size and max_buffered are bytes, batch_interval and timeout are seconds
+type S3Config struct {
+    Endpoint string `json:"endpoint" yaml:"endpoint" toml:"endpoint"`
+    Region string `json:"region" yaml:"region" toml:"region"`
+    Bucket string `json:"bucket" yaml:"bucket" toml:"bucket"`
+    Prefix string `json:"prefix" yaml:"prefix" toml:"prefix"`
+    AccessKey string `json:"access_key" yaml:"access_key" toml:"access_key"`
+    SecretKey string `json:"secret_key" yaml:"secret_key" toml:"secret_key"`
+    PathStyle bool `json:"path_style" yaml:"path_style" toml:"path_style"`
+    BatchSize int64 `json:"batch_size" yaml:"batch_size" toml:"batch_size"`
+    BatchInterval int64 `json:"batch_interval" yaml:"batch_interval" toml:"batch_interval"`
+    MaxBuffered int64 `json:"max_buffered" yaml:"max_buffered" toml:"max_buffered"`
+    Timeout int64 `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+// SQLConfig is config of sql store
+// driver must be linked to log reciever, sqlite3 driver is linked by building with sqlite tag
+type SQLConfig struct {
+    Driver string `json:"driver" yaml:"driver" toml:"driver"`
+    DSN string `json:"dsn" yaml:"dsn" toml:"dsn"`
+}
+
+// RelayConfig is config of relay that forwards transferred logs to upstream reciever
+// relay_id is hostname and addr_port if it is empty, max_spool_size is bytes and timeout is seconds
+// requests are replied with retry after while spool is over max_spool_size
+type RelayConfig struct {
+    Upstream string `json:"upstream" yaml:"upstream" toml:"upstream"`
+    RelayID string `json:"relay_id" yaml:"relay_id" toml:"relay_id"`
+    SpoolDir string `json:"spool_dir" yaml:"spool_dir" toml:"spool_dir"`
+    MaxSpoolSize int64 `json:"max_spool_size" yaml:"max_spool_size" toml:"max_spool_size"`
+    MaxHops int64 `json:"max_hops" yaml:"max_hops" toml:"max_hops"`
+    Timeout int64 `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+// MatcherConfig is config of reciever side matcher
+// label is glob pattern of label of transferred logs, config is config file of matcher actor plugin
+// rule of path matcher is selected by path of transferred logs
+type MatcherConfig struct {
+    Label string `json:"label" yaml:"label" toml:"label"`
+    Config string `json:"config" yaml:"config" toml:"config"`
+}
+
+// RateLimit is limit of transferred logs that match label and host (glob patterns, empty matches all)
+// key is "label" (default) or "host", limits are counted for each value of key
+// bytes_per_second and requests_per_second allow burst of one second, daily_bytes is reset at local midnight
+// request larger than daily_bytes is rejected
+// zero is unlimited
+type RateLimit struct {
+    Label string `json:"label" yaml:"label" toml:"label"`
+    Host string `json:"host" yaml:"host" toml:"host"`
+    Key string `json:"key" yaml:"key" toml:"key"`
+    BytesPerSecond int64 `json:"bytes_per_second" yaml:"bytes_per_second" toml:"bytes_per_second"`
+    RequestsPerSecond float64 `json:"requests_per_second" yaml:"requests_per_second" toml:"requests_per_second"`
+    DailyBytes int64 `json:"daily_bytes" yaml:"daily_bytes" toml:"daily_bytes"`
+}
+
+// ListenerConfig is config of listener of sources that do not run log monitor
+// type is "syslog_udp", "syslog_tcp" (RFC3164 or RFC5424), "tcp" (newline delimited) or "http" (POST)
+// label is label of logs (default is type), path is path of logs (default is "/" + app name of syslog, "/tcp" or "/http")
+// host is hostname of syslog message or address of peer, label, host and path of http are overridden by query
+// max_message_size is bytes of a syslog message, a tcp line or a http body
+type ListenerConfig struct {
+    Type string `json:"type" yaml:"type" toml:"type"`
+    AddrPort string `json:"addr_port" yaml:"addr_port" toml:"addr_port"`
+    Label string `json:"label" yaml:"label" toml:"label"`
+    Path string `json:"path" yaml:"path" toml:"path"`
+    MaxMessageSize int64 `json:"max_message_size" yaml:"max_message_size" toml:"max_message_size"`
+}
+
 // LogRecieverConfig is config of log reciever
+// store is "file", "s3", "sql", "fanout" that writes to all of fanout_stores or "none"
+// relay forwards logs to upstream, address of original sender is taken from requests of trusted_relays (ip or cidr)
+// rotate_interval is "hourly" or "daily", rotate_size and retention_size are bytes, retention_age and retention_interval are seconds
+// rotated files are named "<file>.rotated-<YYYYMMDD-HHMMSS>", paths that contain ".rotated-" are rejected
+// path_policies is keyed by "label", "host", "addr" or "file_path"
+// fsync is "always", "periodic" (every flush_interval) or "never", write_buffer_size is bytes, flush_interval and idle_timeout are seconds
+// enable_query serves query api of stored files on query_addr_port (default 127.0.0.1:50010), it needs file store
+// enable_subscribe serves live subscription of incoming logs on query_addr_port, subscribe_buffer_size is max buffered messages per subscriber
+// query api and subscription have no authentication, query_addr_port must not be reachable from untrusted networks
+// matchers are evaluated in order and the first matched label is used, match_queue_size is max queued requests for matching
+// sources of matchers are evicted after match_source_idle_timeout seconds without logs or when max_match_sources is exceeded
+// all matched rate_limits are applied, limited sender is told to retry after seconds
+// max_message_size is bytes of grpc message, it must be larger than chunk of sender (default of grpc is 4MiB)
+// listeners accept syslog, tcp and http in addition to grpc, their logs are saved like transferred logs
 type LogRecieverConfig struct {
     AddrPort string `json:"addr_port" yaml:"addr_port" toml:"addr_port"`
+    MaxMessageSize int64 `json:"max_message_size" yaml:"max_message_size" toml:"max_message_size"`
+    RateLimits []*RateLimit `json:"rate_limits" yaml:"rate_limits" toml:"rate_limits"`
+    Listeners []*ListenerConfig `json:"listeners" yaml:"listeners" toml:"listeners"`
+    EnableQuery bool `json:"enable_query" yaml:"enable_query" toml:"enable_query"`
+    QueryAddrPort string `json:"query_addr_port" yaml:"query_addr_port" toml:"query_addr_port"`
+    EnableSubscribe bool `json:"enable_subscribe" yaml:"enable_subscribe" toml:"enable_subscribe"`
+    SubscribeBufferSize int64 `json:"subscribe_buffer_size" yaml:"subscribe_buffer_size" toml:"subscribe_buffer_size"`
+    MaxSubscribers int64 `json:"max_subscribers" yaml:"max_subscribers" toml:"max_subscribers"`
+    Matchers []*MatcherConfig `json:"matchers" yaml:"matchers" toml:"matchers"`
+    Relay *RelayConfig `json:"relay" yaml:"relay" toml:"relay"`
+    TrustedRelays []string `json:"trusted_relays" yaml:"trusted_relays" toml:"trusted_relays"`
+    MatchQueueSize int64 `json:"match_queue_size" yaml:"match_queue_size" toml:"match_queue_size"`
+    MatchSourceIdleTimeout int64 `json:"match_source_idle_timeout" yaml:"match_source_idle_timeout" toml:"match_source_idle_timeout"`
+    MaxMatchSources int64 `json:"max_match_sources" yaml:"max_match_sources" toml:"max_match_sources"`
+    Store string `json:"store" yaml:"store" toml:"store"`
+    FanoutStores []string `json:"fanout_stores" yaml:"fanout_stores" toml:"fanout_stores"`
+    S3 *S3Config `json:"s3" yaml:"s3" toml:"s3"`
+    SQL *SQLConfig `json:"sql" yaml:"sql" toml:"sql"`
     Path string `json:"path" yaml:"path" toml:"path"` 
     PathFormat string `json:"path_format" yaml:"path_format" toml:"path_format"`
+    PathPolicies map[string]*PathPolicy `json:"path_policies" yaml:"path_policies" toml:"path_policies"`
+    RotateSize int64 `json:"rotate_size" yaml:"rotate_size" toml:"rotate_size"`
+    RotateInterval string `json:"rotate_interval" yaml:"rotate_interval" toml:"rotate_interval"`
+    Compress bool `json:"compress" yaml:"compress" toml:"compress"`
+    RetentionAge int64 `json:"retention_age" yaml:"retention_age" toml:"retention_age"`
+    RetentionSize int64 `json:"retention_size" yaml:"retention_size" toml:"retention_size"`
+    RetentionInterval int64 `json:"retention_interval" yaml:"retention_interval" toml:"retention_interval"`
+    MaxOpenFiles int64 `json:"max_open_files" yaml:"max_open_files" toml:"max_open_files"`
+    WriteBufferSize int64 `json:"write_buffer_size" yaml:"write_buffer_size" toml:"write_buffer_size"`
+    Fsync string `json:"fsync" yaml:"fsync" toml:"fsync"`
+    FlushInterval int64 `json:"flush_interval" yaml:"flush_interval" toml:"flush_interval"`
+    IdleTimeout int64 `json:"idle_timeout" yaml:"idle_timeout" toml:"idle_timeout"`
 }
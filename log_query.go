@@ -0,0 +1,227 @@
+package main
+
+import (
+    "io"
+    "os"
+    "fmt"
+    "log"
+    "flag"
+    "time"
+    "context"
+    "strings"
+    "os/signal"
+    "syscall"
+    "github.com/pkg/errors"
+    "google.golang.org/grpc"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+func usage() {
+    fmt.Fprintf(os.Stderr, "usage: %v [-addr host:port] <command> [options] [args]\n", os.Args[0])
+    fmt.Fprintf(os.Stderr, "commands:\n")
+    fmt.Fprintf(os.Stderr, "  list [-label glob] [-host glob] [-file glob] [-rotated]\n")
+    fmt.Fprintf(os.Stderr, "  tail [-n lines] [-f] <stored path>\n")
+    fmt.Fprintf(os.Stderr, "  grep [-label glob] [-host glob] [-file glob] [-rotated] [-since time] [-until time] [-start offset] [-end offset] [-max matches] <pattern> [stored path ...]\n")
+    fmt.Fprintf(os.Stderr, "  subscribe [-label glob] [-host glob] [-path glob] [-buffer size] [pattern]\n")
+    fmt.Fprintf(os.Stderr, "time is RFC3339 or duration before now (e.g. 1h)\n")
+    flag.PrintDefaults()
+}
+
+// parseTime is parse RFC3339 time or duration before now to unix time
+func parseTime(value string) (int64, error) {
+    if value == "" {
+        return 0, nil
+    }
+    t, err := time.Parse(time.RFC3339, value)
+    if err == nil {
+        return t.Unix(), nil
+    }
+    d, err := time.ParseDuration(value)
+    if err != nil {
+        return 0, errors.Errorf("can not parse time (%v)", value)
+    }
+    return time.Now().Add(-d).Unix(), nil
+}
+
+func list(ctx context.Context, client logpb.QueryClient, args []string) (error) {
+    flagSet := flag.NewFlagSet("list", flag.ExitOnError)
+    label := flagSet.String("label", "", "label glob pattern")
+    host := flagSet.String("host", "", "host glob pattern")
+    filePath := flagSet.String("file", "", "file path glob pattern")
+    withRotated := flagSet.Bool("rotated", false, "include rotated files")
+    flagSet.Parse(args)
+    reply, err := client.List(ctx, &logpb.ListRequest{
+        Label: *label,
+        Host: *host,
+        FilePath: *filePath,
+        WithRotated: *withRotated,
+    })
+    if err != nil {
+        return errors.Wrap(err, "can not list")
+    }
+    for _, source := range reply.Sources {
+        fmt.Printf("%v\t%v\t%v\t%v\t%v\t%v\t%v\n", source.StoredPath, source.Size,
+            time.Unix(source.ModTime, 0).Format(time.RFC3339), source.Label, source.Host, source.Addr, source.FilePath)
+    }
+    return nil
+}
+
+func tail(ctx context.Context, client logpb.QueryClient, args []string) (error) {
+    flagSet := flag.NewFlagSet("tail", flag.ExitOnError)
+    lines := flagSet.Int64("n", 10, "number of lines")
+    follow := flagSet.Bool("f", false, "follow appended data")
+    flagSet.Parse(args)
+    if flagSet.NArg() != 1 {
+        return errors.New("no stored path")
+    }
+    stream, err := client.Tail(ctx, &logpb.TailRequest{
+        StoredPath: flagSet.Arg(0),
+        Lines: *lines,
+        Follow: *follow,
+    })
+    if err != nil {
+        return errors.Wrap(err, "can not tail")
+    }
+    for {
+        reply, err := stream.Recv()
+        if err == io.EOF || ctx.Err() != nil {
+            return nil
+        }
+        if err != nil {
+            return errors.Wrap(err, "can not recieve tail")
+        }
+        os.Stdout.Write(reply.Data)
+    }
+}
+
+func grep(ctx context.Context, client logpb.QueryClient, args []string) (error) {
+    flagSet := flag.NewFlagSet("grep", flag.ExitOnError)
+    label := flagSet.String("label", "", "label glob pattern")
+    host := flagSet.String("host", "", "host glob pattern")
+    filePath := flagSet.String("file", "", "file path glob pattern")
+    withRotated := flagSet.Bool("rotated", false, "include rotated files")
+    since := flagSet.String("since", "", "files modified at or after time")
+    until := flagSet.String("until", "", "files modified at or before time")
+    startOffset := flagSet.Int64("start", 0, "start byte offset in each file")
+    endOffset := flagSet.Int64("end", 0, "end byte offset in each file (0 is end of file)")
+    maxMatches := flagSet.Int64("max", 0, "max matches (0 is server default)")
+    flagSet.Parse(args)
+    if flagSet.NArg() < 1 {
+        return errors.New("no pattern")
+    }
+    startTime, err := parseTime(*since)
+    if err != nil {
+        return err
+    }
+    endTime, err := parseTime(*until)
+    if err != nil {
+        return err
+    }
+    stream, err := client.Grep(ctx, &logpb.GrepRequest{
+        StoredPaths: flagSet.Args()[1:],
+        Label: *label,
+        Host: *host,
+        FilePath: *filePath,
+        WithRotated: *withRotated,
+        Pattern: flagSet.Arg(0),
+        StartTime: startTime,
+        EndTime: endTime,
+        StartOffset: *startOffset,
+        EndOffset: *endOffset,
+        MaxMatches: *maxMatches,
+    })
+    if err != nil {
+        return errors.Wrap(err, "can not grep")
+    }
+    for {
+        reply, err := stream.Recv()
+        if err == io.EOF || ctx.Err() != nil {
+            return nil
+        }
+        if err != nil {
+            return errors.Wrap(err, "can not recieve grep")
+        }
+        fmt.Printf("%v:%v:%s\n", reply.StoredPath, reply.Offset, reply.Line)
+    }
+}
+
+func subscribe(ctx context.Context, client logpb.SubscriptionClient, args []string) (error) {
+    flagSet := flag.NewFlagSet("subscribe", flag.ExitOnError)
+    label := flagSet.String("label", "", "label glob pattern")
+    host := flagSet.String("host", "", "host glob pattern")
+    filePath := flagSet.String("path", "", "path glob pattern")
+    bufferSize := flagSet.Int64("buffer", 0, "max buffered messages on server (0 is server default)")
+    flagSet.Parse(args)
+    stream, err := client.Subscribe(ctx, &logpb.SubscribeRequest{
+        Label: *label,
+        Host: *host,
+        Path: *filePath,
+        Pattern: flagSet.Arg(0),
+        BufferSize: *bufferSize,
+    })
+    if err != nil {
+        return errors.Wrap(err, "can not subscribe")
+    }
+    dropped := int64(0)
+    for {
+        reply, err := stream.Recv()
+        if err == io.EOF || ctx.Err() != nil {
+            return nil
+        }
+        if err != nil {
+            return errors.Wrap(err, "can not recieve subscription")
+        }
+        if reply.Dropped > dropped {
+            fmt.Fprintf(os.Stderr, "dropped %v messages\n", reply.Dropped - dropped)
+            dropped = reply.Dropped
+        }
+        prefix := fmt.Sprintf("%v %v(%v) %v: ", reply.Label, reply.Host, reply.Addr, reply.Path)
+        for _, line := range strings.SplitAfter(string(reply.LogData), "\n") {
+            if line == "" {
+                continue
+            }
+            fmt.Print(prefix + line)
+        }
+    }
+}
+
+func main() {
+    var addrPort string
+    flag.StringVar(&addrPort, "addr", "127.0.0.1:50010", "query addr port of log reciever")
+    flag.Usage = usage
+    flag.Parse()
+    if flag.NArg() < 1 {
+        usage()
+        os.Exit(2)
+    }
+    conn, err := grpc.Dial(addrPort, grpc.WithInsecure())
+    if err != nil {
+        log.Fatalf("can not dial: %v", err)
+    }
+    defer conn.Close()
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    sigChan := make(chan os.Signal, 1)
+    signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+    go func() {
+        <-sigChan
+        cancel()
+    }()
+    client := logpb.NewQueryClient(conn)
+    switch flag.Arg(0) {
+    case "list":
+        err = list(ctx, client, flag.Args()[1:])
+    case "tail":
+        err = tail(ctx, client, flag.Args()[1:])
+    case "grep":
+        err = grep(ctx, client, flag.Args()[1:])
+    case "subscribe":
+        err = subscribe(ctx, logpb.NewSubscriptionClient(conn), flag.Args()[1:])
+    default:
+        usage()
+        os.Exit(2)
+    }
+    if err != nil {
+        log.Fatalf("%v", err)
+    }
+}
@@ -0,0 +1,312 @@
+package logmatcher
+
+import (
+    "log"
+    "path"
+    "time"
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "path/filepath"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/configurator"
+    matcherconfigurator "github.com/potix/log_monitor/actor_plugins/matcher/configurator"
+    "github.com/potix/log_monitor/actor_plugins/matcher/filechecker"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifiercache"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifierplugger"
+    "github.com/potix/log_monitor/actor_plugins/matcher/rulemanager"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+const (
+    callers string = "log_reciever.matcher"
+    defaultCheckInterval int64 = 60
+    defaultMatchQueueSize int64 = 10000
+    defaultMatchSourceIdleTimeout int64 = 86400
+    defaultMaxMatchSources int64 = 10000
+    maxRemainder int = 1048576
+    tickInterval time.Duration = time.Second
+)
+
+// labelMatcher is rules of matcher config applied to labels
+type labelMatcher struct {
+    label string
+    configFile string
+    ruleManager *rulemanager.RuleManager
+    notifierCache *notifiercache.NotifierCache
+}
+
+// source is transferred file of host, it is checked like local file of matcher
+type source struct {
+    fileID string
+    label string
+    host string
+    path string
+    labelMatcher *labelMatcher
+    fileChecker *filechecker.FileChecker
+    remainder []byte
+    lastChecked time.Time
+    lastReceived time.Time
+}
+
+// LogMatcher is run rules of matcher against transferred logs
+// requests are matched in background, they are dropped when queue is full
+// idle sources are evicted, absence and heartbeat of them are not checked after eviction
+type LogMatcher struct {
+    labelMatchers []*labelMatcher
+    sources map[string]*source
+    sourceIdleTimeout time.Duration
+    maxSources int
+    requestChan chan *logpb.TransferRequest
+    finish chan bool
+    finished chan bool
+}
+
+func globMatch(pattern string, value string) (bool) {
+    if pattern == "" {
+        return true
+    }
+    matched, err := path.Match(pattern, value)
+    return err == nil && matched
+}
+
+func sourceKey(label string, host string, filePath string) (string) {
+    return label + "\x00" + host + "\x00" + filePath
+}
+
+func (l *LogMatcher) findLabelMatcher(label string) (*labelMatcher) {
+    for _, labelMatcher := range l.labelMatchers {
+        if globMatch(labelMatcher.label, label) {
+            return labelMatcher
+        }
+    }
+    return nil
+}
+
+// evict is stop checker of source, queued notifications and windows are persisted and loaded when source comes back
+func (l *LogMatcher) evict(key string, reason string) {
+    s := l.sources[key]
+    s.fileChecker.Stop()
+    delete(l.sources, key)
+    log.Printf("evicted source, %v (%v, %v, %v)", reason, s.label, s.host, s.path)
+}
+
+func (l *LogMatcher) evictIdleSources(now time.Time) {
+    for key, s := range l.sources {
+        if now.Sub(s.lastReceived) > l.sourceIdleTimeout {
+            l.evict(key, "idle")
+        }
+    }
+}
+
+func (l *LogMatcher) evictOldestSource() {
+    oldestKey := ""
+    var oldest *source
+    for key, s := range l.sources {
+        if oldest == nil || s.lastReceived.Before(oldest.lastReceived) {
+            oldestKey = key
+            oldest = s
+        }
+    }
+    if oldest != nil {
+        l.evict(oldestKey, "too many sources")
+    }
+}
+
+func (l *LogMatcher) getSource(request *logpb.TransferRequest, now time.Time) (*source) {
+    key := sourceKey(request.Label, request.Host, request.Path)
+    s, ok := l.sources[key]
+    if ok {
+        s.lastReceived = now
+        return s
+    }
+    labelMatcher := l.findLabelMatcher(request.Label)
+    if labelMatcher == nil {
+        return nil
+    }
+    for len(l.sources) >= l.maxSources {
+        l.evictOldestSource()
+    }
+    sum := sha256.Sum256([]byte(key))
+    s = &source{
+        fileID: hex.EncodeToString(sum[:16]),
+        label: request.Label,
+        host: request.Host,
+        path: request.Path,
+        labelMatcher: labelMatcher,
+        fileChecker: filechecker.NewHostFileChecker(callers, request.Host, labelMatcher.notifierCache),
+        remainder: nil,
+        lastChecked: now,
+        lastReceived: now,
+    }
+    s.fileChecker.Start()
+    l.sources[key] = s
+    return s
+}
+
+// check is check complete lines of data, incomplete last line is kept until next data
+func (s *source) check(data []byte, now time.Time) {
+    ruleSet := s.labelMatcher.ruleManager.GetRuleSet()
+    rule := ruleSet.GetRule(s.path)
+    if rule == nil {
+        s.remainder = nil
+        return
+    }
+    if len(s.remainder) > 0 {
+        data = append(s.remainder, data...)
+        s.remainder = nil
+    }
+    i := bytes.LastIndexByte(data, '\n')
+    if i + 1 < len(data) {
+        rest := data[i + 1:]
+        if len(rest) <= maxRemainder {
+            s.remainder = append([]byte(nil), rest...)
+            data = data[:i + 1]
+        }
+    }
+    s.fileChecker.CheckData(s.fileID, s.path, data, ruleSet, rule)
+    s.lastChecked = now
+}
+
+func (s *source) checkInterval() (time.Duration) {
+    checkInterval := defaultCheckInterval
+    if s.labelMatcher.ruleManager.GetRuleSet().Config.CheckInterval > 0 {
+        checkInterval = s.labelMatcher.ruleManager.GetRuleSet().Config.CheckInterval
+    }
+    return time.Duration(checkInterval) * time.Second
+}
+
+func (l *LogMatcher) matchLoop() {
+    defer close(l.finished)
+    ticker := time.NewTicker(tickInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-l.finish:
+            return
+        case request := <-l.requestChan:
+            now := time.Now()
+            s := l.getSource(request, now)
+            if s == nil {
+                continue
+            }
+            s.check(request.LogData, now)
+        case now := <-ticker.C:
+            l.evictIdleSources(now)
+            // absence and heartbeat are checked even if no logs are transferred
+            for _, s := range l.sources {
+                if now.Sub(s.lastChecked) < s.checkInterval() {
+                    continue
+                }
+                s.check(nil, now)
+            }
+        }
+    }
+}
+
+// Match is queue transferred logs for matching
+func (l *LogMatcher) Match(request *logpb.TransferRequest) {
+    if l.findLabelMatcher(request.Label) == nil {
+        return
+    }
+    select {
+    case l.requestChan <- request:
+    default:
+        log.Printf("match queue is full, logs are not matched (%v, %v, %v)", request.Label, request.Host, request.Path)
+    }
+}
+
+// Start is start
+func (l *LogMatcher) Start() (error) {
+    for i, labelMatcher := range l.labelMatchers {
+        err := labelMatcher.ruleManager.Start()
+        if err != nil {
+            for _, started := range l.labelMatchers[:i] {
+                started.ruleManager.Stop()
+            }
+            return errors.Wrapf(err, "can not start rule manager (%v)", labelMatcher.configFile)
+        }
+    }
+    go l.matchLoop()
+    return nil
+}
+
+// Stop is stop, queued notifications are kept by notify queue
+func (l *LogMatcher) Stop() {
+    close(l.finish)
+    <-l.finished
+    if len(l.requestChan) > 0 {
+        log.Printf("logs are not matched at stop (%v requests)", len(l.requestChan))
+    }
+    for _, s := range l.sources {
+        s.fileChecker.Stop()
+    }
+    for _, labelMatcher := range l.labelMatchers {
+        labelMatcher.notifierCache.Clear()
+        labelMatcher.ruleManager.Stop()
+    }
+}
+
+func newLabelMatcher(matcherConfig *configurator.MatcherConfig) (*labelMatcher, error) {
+    configFile := matcherConfig.Config
+    matcherConfigurator, err := matcherconfigurator.NewConfigurator(configFile)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not create configurator (%v)", configFile)
+    }
+    config, err := matcherConfigurator.Load()
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not load config (%v)", configFile)
+    }
+    pluginPath := path.Join(filepath.Dir(configFile), config.NotifierPluginPath)
+    err = notifierplugger.LoadNotifierPlugins(pluginPath)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not load notifier plugins (%v)", pluginPath)
+    }
+    ruleManager, err := rulemanager.GetRuleManager(configFile, matcherConfigurator)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not get rule manager (%v)", configFile)
+    }
+    log.Printf("label = %v, matcher config = %v", matcherConfig.Label, configFile)
+    return &labelMatcher{
+        label: matcherConfig.Label,
+        configFile: configFile,
+        ruleManager: ruleManager,
+        notifierCache: notifiercache.NewNotifierCache(callers),
+    }, nil
+}
+
+// NewLogMatcher is create new log matcher
+func NewLogMatcher(config *configurator.LogRecieverConfig) (*LogMatcher, error) {
+    if len(config.Matchers) == 0 {
+        return nil, errors.New("no matchers")
+    }
+    labelMatchers := make([]*labelMatcher, 0, len(config.Matchers))
+    for _, matcherConfig := range config.Matchers {
+        labelMatcher, err := newLabelMatcher(matcherConfig)
+        if err != nil {
+            return nil, errors.Wrapf(err, "invalid matcher (%v)", matcherConfig.Label)
+        }
+        labelMatchers = append(labelMatchers, labelMatcher)
+    }
+    matchQueueSize := defaultMatchQueueSize
+    if config.MatchQueueSize > 0 {
+        matchQueueSize = config.MatchQueueSize
+    }
+    sourceIdleTimeout := defaultMatchSourceIdleTimeout
+    if config.MatchSourceIdleTimeout > 0 {
+        sourceIdleTimeout = config.MatchSourceIdleTimeout
+    }
+    maxSources := defaultMaxMatchSources
+    if config.MaxMatchSources > 0 {
+        maxSources = config.MaxMatchSources
+    }
+    return &LogMatcher{
+        labelMatchers: labelMatchers,
+        sources: make(map[string]*source),
+        sourceIdleTimeout: time.Duration(sourceIdleTimeout) * time.Second,
+        maxSources: int(maxSources),
+        requestChan: make(chan *logpb.TransferRequest, matchQueueSize),
+        finish: make(chan bool),
+        finished: make(chan bool),
+    }, nil
+}
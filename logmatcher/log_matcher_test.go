@@ -0,0 +1,75 @@
+package logmatcher
+
+import (
+    "time"
+    "testing"
+    "github.com/potix/log_monitor/actor_plugins/matcher/notifiercache"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+func newTestLogMatcher(maxSources int) (*LogMatcher) {
+    return &LogMatcher{
+        labelMatchers: []*labelMatcher{
+            &labelMatcher{
+                label: "app",
+                configFile: "",
+                ruleManager: nil,
+                notifierCache: notifiercache.NewNotifierCache(callers),
+            },
+        },
+        sources: make(map[string]*source),
+        sourceIdleTimeout: time.Minute,
+        maxSources: maxSources,
+    }
+}
+
+func newTestRequest(host string) (*logpb.TransferRequest) {
+    return &logpb.TransferRequest{
+        Label: "app",
+        Host: host,
+        Path: "/var/log/app.log",
+        LogData: nil,
+    }
+}
+
+func TestIdleSourcesAreEvicted(t *testing.T) {
+    logMatcher := newTestLogMatcher(10)
+    now := time.Now()
+    logMatcher.getSource(newTestRequest("idle"), now)
+    logMatcher.getSource(newTestRequest("active"), now)
+    if s := logMatcher.getSource(&logpb.TransferRequest{ Label: "other" }, now); s != nil {
+        t.Errorf("source of unmatched label is created")
+    }
+    logMatcher.getSource(newTestRequest("active"), now.Add(30 * time.Second))
+    logMatcher.evictIdleSources(now.Add(70 * time.Second))
+    if len(logMatcher.sources) != 1 {
+        t.Fatalf("unexpected sources (%v)", len(logMatcher.sources))
+    }
+    if _, ok := logMatcher.sources[sourceKey("app", "active", "/var/log/app.log")]; !ok {
+        t.Errorf("active source is evicted")
+    }
+    logMatcher.evictIdleSources(now.Add(100 * time.Second))
+    if len(logMatcher.sources) != 0 {
+        t.Errorf("unexpected sources (%v)", len(logMatcher.sources))
+    }
+}
+
+func TestSourcesAreCapped(t *testing.T) {
+    logMatcher := newTestLogMatcher(2)
+    now := time.Now()
+    logMatcher.getSource(newTestRequest("a"), now)
+    logMatcher.getSource(newTestRequest("b"), now.Add(time.Second))
+    logMatcher.getSource(newTestRequest("a"), now.Add(2 * time.Second))
+    logMatcher.getSource(newTestRequest("c"), now.Add(3 * time.Second))
+    defer func() {
+        for key := range logMatcher.sources {
+            logMatcher.evict(key, "test")
+        }
+    }()
+    if len(logMatcher.sources) != 2 {
+        t.Fatalf("unexpected sources (%v)", len(logMatcher.sources))
+    }
+    if _, ok := logMatcher.sources[sourceKey("app", "b", "/var/log/app.log")]; ok {
+        t.Errorf("least recently received source is not evicted")
+    }
+}
@@ -87,9 +87,11 @@ func (m *TransferRequest) GetLogData() []byte {
 }
 
 // The response message containing the greetings
+// retryAfter is seconds that sender should wait before next transfer when it is limited
 type TransferReply struct {
 	Success              bool     `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
 	Msg                  string   `protobuf:"bytes,2,opt,name=msg,proto3" json:"msg,omitempty"`
+	RetryAfter           int64    `protobuf:"varint,3,opt,name=retryAfter,proto3" json:"retryAfter,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -134,6 +136,13 @@ func (m *TransferReply) GetMsg() string {
 	return ""
 }
 
+func (m *TransferReply) GetRetryAfter() int64 {
+	if m != nil {
+		return m.RetryAfter
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*TransferRequest)(nil), "TransferRequest")
 	proto.RegisterType((*TransferReply)(nil), "TransferReply")
@@ -142,19 +151,20 @@ func init() {
 func init() { proto.RegisterFile("logpb/log.proto", fileDescriptor_ac8b9aa51c3c42db) }
 
 var fileDescriptor_ac8b9aa51c3c42db = []byte{
-	// 189 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xcf, 0xc9, 0x4f, 0x2f,
-	0x48, 0xd2, 0xcf, 0xc9, 0x4f, 0xd7, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x57, 0xca, 0xe4, 0xe2, 0x0f,
-	0x29, 0x4a, 0xcc, 0x2b, 0x4e, 0x4b, 0x2d, 0x0a, 0x4a, 0x2d, 0x2c, 0x4d, 0x2d, 0x2e, 0x11, 0x12,
-	0xe1, 0x62, 0xcd, 0x49, 0x4c, 0x4a, 0xcd, 0x91, 0x60, 0x54, 0x60, 0xd4, 0xe0, 0x0c, 0x82, 0x70,
-	0x84, 0x84, 0xb8, 0x58, 0x32, 0xf2, 0x8b, 0x4b, 0x24, 0x98, 0xc0, 0x82, 0x60, 0x36, 0x48, 0xac,
-	0x20, 0xb1, 0x24, 0x43, 0x82, 0x19, 0x22, 0x06, 0x62, 0x0b, 0x49, 0x70, 0xb1, 0xe7, 0xe4, 0xa7,
-	0xbb, 0x24, 0x96, 0x24, 0x4a, 0xb0, 0x28, 0x30, 0x6a, 0xf0, 0x04, 0xc1, 0xb8, 0x4a, 0xd6, 0x5c,
-	0xbc, 0x08, 0xab, 0x0a, 0x72, 0x2a, 0x41, 0x4a, 0x8b, 0x4b, 0x93, 0x93, 0x53, 0x8b, 0x8b, 0xc1,
-	0x56, 0x71, 0x04, 0xc1, 0xb8, 0x42, 0x02, 0x5c, 0xcc, 0xb9, 0xc5, 0xe9, 0x50, 0xbb, 0x40, 0x4c,
-	0x23, 0x53, 0x2e, 0x66, 0x9f, 0xfc, 0x74, 0x21, 0x3d, 0x2e, 0x0e, 0x98, 0x19, 0x42, 0x02, 0x7a,
-	0x68, 0x2e, 0x97, 0xe2, 0xd3, 0x43, 0xb1, 0x40, 0x89, 0x21, 0x89, 0x0d, 0xec, 0x4b, 0x63, 0x40,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0xaa, 0x87, 0x3a, 0x52, 0xf8, 0x00, 0x00, 0x00,
+	// 205 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x90, 0x4d, 0x4b, 0xc4, 0x30,
+	0x10, 0x86, 0xad, 0xa9, 0x5a, 0x07, 0xb5, 0x65, 0xf0, 0x10, 0x3c, 0x48, 0xe9, 0xa9, 0xa7, 0x08,
+	0x8a, 0x3f, 0x40, 0xf0, 0xe8, 0x29, 0x78, 0xf3, 0x94, 0x96, 0x34, 0x15, 0xb2, 0x9b, 0x6c, 0x92,
+	0x1e, 0xfa, 0xef, 0x97, 0xa4, 0x5b, 0xf6, 0xe3, 0xf6, 0xbe, 0x0f, 0x03, 0xcf, 0xcc, 0x40, 0xa9,
+	0x8d, 0xb2, 0xdd, 0x9b, 0x36, 0x8a, 0x59, 0x67, 0x82, 0x69, 0xfe, 0xa1, 0xfc, 0x75, 0x62, 0xeb,
+	0x07, 0xe9, 0xb8, 0xdc, 0x4d, 0xd2, 0x07, 0x7c, 0x86, 0x1b, 0x2d, 0x3a, 0xa9, 0x69, 0x56, 0x67,
+	0xed, 0x3d, 0x5f, 0x0a, 0x22, 0xe4, 0xa3, 0xf1, 0x81, 0x5e, 0x27, 0x98, 0x72, 0x64, 0x56, 0x84,
+	0x91, 0x92, 0x85, 0xc5, 0x8c, 0x14, 0xee, 0xb4, 0x51, 0xdf, 0x22, 0x08, 0x9a, 0xd7, 0x59, 0xfb,
+	0xc0, 0xd7, 0xda, 0xfc, 0xc1, 0xe3, 0x51, 0x65, 0xf5, 0x1c, 0x47, 0xfd, 0xd4, 0xf7, 0xd2, 0xfb,
+	0xa4, 0x2a, 0xf8, 0x5a, 0xb1, 0x02, 0xb2, 0xf1, 0xea, 0xe0, 0x8a, 0x11, 0x5f, 0x01, 0x9c, 0x0c,
+	0x6e, 0xfe, 0x1a, 0x82, 0x74, 0x49, 0x48, 0xf8, 0x09, 0x79, 0xff, 0x04, 0xf2, 0x63, 0x14, 0x32,
+	0x28, 0x56, 0x07, 0x56, 0xec, 0xe2, 0xb2, 0x97, 0x27, 0x76, 0xb6, 0x40, 0x73, 0xd5, 0xdd, 0xa6,
+	0x2f, 0x7c, 0xec, 0x07, 0x00, 0x88, 0x95, 0x89, 0xc1, 0x18, 0x01, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
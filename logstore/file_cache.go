@@ -0,0 +1,218 @@
+package logstore
+
+import (
+    "os"
+    "log"
+    "path"
+    "sync"
+    "time"
+    "bufio"
+    "container/list"
+    "github.com/pkg/errors"
+)
+
+const (
+    fsyncAlways string = "always"
+    fsyncPeriodic string = "periodic"
+    fsyncNever string = "never"
+)
+
+type openFile struct {
+    path string
+    file *os.File
+    writer *bufio.Writer
+    size int64
+    modTime time.Time
+    lastUsed time.Time
+    dirty bool
+    synced bool
+    closed bool
+    element *list.Element
+    mutex *sync.Mutex
+}
+
+// fileCache is LRU of open files
+// files and lru are not goroutine safe and are guarded by caller, open file is guarded by its mutex
+// open file is closed only while both are locked, so file got from cache is closed when writer finds it closed
+type fileCache struct {
+    maxOpenFiles int
+    bufferSize int
+    fsync string
+    files map[string]*openFile
+    lru *list.List
+}
+
+func (o *openFile) write(data []byte, now time.Time) (error) {
+    _, err := o.writer.Write(data)
+    if err != nil {
+        return errors.Wrapf(err, "can not write log data (%v)", o.path)
+    }
+    o.size += int64(len(data))
+    o.modTime = now
+    o.dirty = true
+    o.synced = false
+    return nil
+}
+
+func (o *openFile) flush() (error) {
+    if !o.dirty {
+        return nil
+    }
+    err := o.writer.Flush()
+    if err != nil {
+        return errors.Wrapf(err, "can not flush log data (%v)", o.path)
+    }
+    o.dirty = false
+    return nil
+}
+
+func (o *openFile) sync() (error) {
+    err := o.flush()
+    if err != nil {
+        return err
+    }
+    if o.synced {
+        return nil
+    }
+    err = o.file.Sync()
+    if err != nil {
+        return errors.Wrapf(err, "can not sync file (%v)", o.path)
+    }
+    o.synced = true
+    return nil
+}
+
+func (c *fileCache) has(filePath string) (bool) {
+    _, ok := c.files[filePath]
+    return ok
+}
+
+func (c *fileCache) get(filePath string, now time.Time) (*openFile, error) {
+    o, ok := c.files[filePath]
+    if ok {
+        o.lastUsed = now
+        c.lru.MoveToFront(o.element)
+        return o, nil
+    }
+    for c.lru.Len() >= c.maxOpenFiles {
+        oldest := c.lru.Back().Value.(*openFile)
+        err := c.close(oldest.path)
+        if err != nil {
+            log.Printf("can not close evicted file: %v", err)
+        }
+    }
+    err := os.MkdirAll(path.Dir(filePath), 0755)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not create directories (%v)", filePath)
+    }
+    file, err :=  os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not open file (%v)", filePath)
+    }
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return nil, errors.Wrapf(err, "can not stat file (%v)", filePath)
+    }
+    o = &openFile{
+        path: filePath,
+        file: file,
+        writer: bufio.NewWriterSize(file, c.bufferSize),
+        size: info.Size(),
+        modTime: info.ModTime(),
+        lastUsed: now,
+        dirty: false,
+        synced: true,
+        closed: false,
+        mutex: new(sync.Mutex),
+    }
+    o.element = c.lru.PushFront(o)
+    c.files[filePath] = o
+    return o, nil
+}
+
+func (c *fileCache) close(filePath string) (error) {
+    o, ok := c.files[filePath]
+    if !ok {
+        return nil
+    }
+    delete(c.files, filePath)
+    c.lru.Remove(o.element)
+    o.mutex.Lock()
+    defer o.mutex.Unlock()
+    o.closed = true
+    var err error
+    if c.fsync == fsyncNever {
+        err = o.flush()
+    } else {
+        err = o.sync()
+    }
+    closeErr := o.file.Close()
+    if err != nil {
+        return err
+    }
+    if closeErr != nil {
+        return errors.Wrapf(closeErr, "can not close file (%v)", filePath)
+    }
+    return nil
+}
+
+// closeIdle is close idle files and return remaining open files
+func (c *fileCache) closeIdle(idleTimeout time.Duration, now time.Time) ([]*openFile) {
+    openFiles := make([]*openFile, 0, len(c.files))
+    for filePath, o := range c.files {
+        if now.Sub(o.lastUsed) > idleTimeout {
+            err := c.close(filePath)
+            if err != nil {
+                log.Printf("can not close idle file: %v", err)
+            }
+            continue
+        }
+        openFiles = append(openFiles, o)
+    }
+    return openFiles
+}
+
+// flushFile is flush buffer and sync file on periodic fsync, it does not need lock of cache
+func (c *fileCache) flushFile(o *openFile) {
+    o.mutex.Lock()
+    defer o.mutex.Unlock()
+    if o.closed {
+        return
+    }
+    var err error
+    if c.fsync == fsyncPeriodic {
+        err = o.sync()
+    } else {
+        err = o.flush()
+    }
+    if err != nil {
+        log.Printf("can not flush file: %v", err)
+    }
+}
+
+// flush is flush buffers, close idle files and sync files on periodic fsync
+func (c *fileCache) flush(idleTimeout time.Duration, now time.Time) {
+    for _, o := range c.closeIdle(idleTimeout, now) {
+        c.flushFile(o)
+    }
+}
+
+func (c *fileCache) closeAll() {
+    for filePath := range c.files {
+        err := c.close(filePath)
+        if err != nil {
+            log.Printf("can not close file: %v", err)
+        }
+    }
+}
+
+func newFileCache(maxOpenFiles int, bufferSize int, fsync string) (*fileCache) {
+    return &fileCache{
+        maxOpenFiles: maxOpenFiles,
+        bufferSize: bufferSize,
+        fsync: fsync,
+        files: make(map[string]*openFile),
+        lru: list.New(),
+    }
+}
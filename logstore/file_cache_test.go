@@ -0,0 +1,199 @@
+package logstore
+
+import (
+    "fmt"
+    "sort"
+    "sync"
+    "time"
+    "strings"
+    "context"
+    "testing"
+    "io/ioutil"
+    "path/filepath"
+    "github.com/potix/log_monitor/configurator"
+)
+
+func readFile(t *testing.T, filePath string) (string) {
+    buf, err := ioutil.ReadFile(filePath)
+    if err != nil {
+        t.Fatalf("can not read file (%v): %v", filePath, err)
+    }
+    return string(buf)
+}
+
+func getAndWrite(t *testing.T, cache *fileCache, filePath string, data string, now time.Time) {
+    o, err := cache.get(filePath, now)
+    if err != nil {
+        t.Fatalf("can not get file (%v): %v", filePath, err)
+    }
+    err = o.write([]byte(data), now)
+    if err != nil {
+        t.Fatalf("can not write file (%v): %v", filePath, err)
+    }
+}
+
+func TestFileCacheEvictsLeastRecentlyUsed(t *testing.T) {
+    dir := t.TempDir()
+    cache := newFileCache(2, 4096, fsyncNever)
+    now := time.Now()
+    a, b, c := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")
+    getAndWrite(t, cache, a, "a1", now)
+    getAndWrite(t, cache, b, "b1", now)
+    getAndWrite(t, cache, a, "a2", now)
+    getAndWrite(t, cache, c, "c1", now)
+    if cache.has(b) || !cache.has(a) || !cache.has(c) {
+        t.Fatalf("least recently used file is not evicted (%v, %v, %v)", cache.has(a), cache.has(b), cache.has(c))
+    }
+    if cache.lru.Len() != 2 || len(cache.files) != 2 {
+        t.Errorf("unexpected open files (%v, %v)", cache.lru.Len(), len(cache.files))
+    }
+    // buffered data is flushed at eviction
+    if data := readFile(t, b); data != "b1" {
+        t.Errorf("unexpected data of evicted file (%v)", data)
+    }
+    if data := readFile(t, a); data != "" {
+        t.Errorf("data of open file is not buffered (%v)", data)
+    }
+}
+
+func TestFileCacheClosesIdleFiles(t *testing.T) {
+    dir := t.TempDir()
+    cache := newFileCache(10, 4096, fsyncNever)
+    now := time.Now()
+    idle, active := filepath.Join(dir, "idle"), filepath.Join(dir, "active")
+    getAndWrite(t, cache, idle, "idle", now)
+    getAndWrite(t, cache, active, "active", now.Add(50 * time.Second))
+    cache.flush(time.Minute, now.Add(90 * time.Second))
+    if cache.has(idle) || !cache.has(active) {
+        t.Fatalf("unexpected open files (%v, %v)", cache.has(idle), cache.has(active))
+    }
+    if data := readFile(t, idle); data != "idle" {
+        t.Errorf("unexpected data of idle file (%v)", data)
+    }
+    // open file is flushed without close
+    if data := readFile(t, active); data != "active" {
+        t.Errorf("unexpected data of active file (%v)", data)
+    }
+}
+
+func TestLogStoreFlushesOnStop(t *testing.T) {
+    logStore := newTestLogStore(t, &configurator.LogRecieverConfig{
+        FlushInterval: 3600,
+    })
+    logStore.Start()
+    save(t, logStore, "/var/log/app.log", "line1\n")
+    save(t, logStore, "/var/log/app.log", "line2\n")
+    filePath := filepath.Join(logStore.config.Path, "app", "web1_127.0.0.1", "var", "log", "app.log")
+    if data := readFile(t, filePath); data != "" {
+        t.Errorf("data is not buffered (%v)", data)
+    }
+    logStore.Stop()
+    if data := readFile(t, filePath); data != "line1\nline2\n" {
+        t.Errorf("unexpected data after stop (%v)", data)
+    }
+    if len(logStore.fileCache.files) != 0 {
+        t.Errorf("files are open after stop (%v)", len(logStore.fileCache.files))
+    }
+}
+
+func TestSaveDoesNotWaitForOtherFile(t *testing.T) {
+    logStore := newTestLogStore(t, &configurator.LogRecieverConfig{})
+    defer logStore.fileCache.closeAll()
+    save(t, logStore, "/var/log/slow.log", "line\n")
+    slowPath := filepath.Join(logStore.config.Path, "app", "web1_127.0.0.1", "var", "log", "slow.log")
+    // writer of slow file holds its lock as if it were in fsync
+    slow := logStore.fileCache.files[slowPath]
+    slow.mutex.Lock()
+    saved := make(chan bool)
+    go func() {
+        save(t, logStore, "/var/log/other.log", "line\n")
+        close(saved)
+    }()
+    select {
+    case <-saved:
+    case <-time.After(5 * time.Second):
+        t.Errorf("save of other file waits for slow file")
+    }
+    slow.mutex.Unlock()
+}
+
+func TestConcurrentSaveWithRotationAndEviction(t *testing.T) {
+    logStore := newTestLogStore(t, &configurator.LogRecieverConfig{
+        RotateSize: 200,
+        MaxOpenFiles: 1,
+        Fsync: fsyncAlways,
+    })
+    paths := []string{ "/var/log/a.log", "/var/log/b.log" }
+    writers := 4
+    lines := 50
+    waitGroup := new(sync.WaitGroup)
+    for w := 0; w < writers; w++ {
+        for _, filePath := range paths {
+            waitGroup.Add(1)
+            go func(w int, filePath string) {
+                defer waitGroup.Done()
+                for i := 0; i < lines; i++ {
+                    err := logStore.Save(context.Background(), "127.0.0.1", newRequest(filePath, []byte(fmt.Sprintf("w%v-%03d\n", w, i))))
+                    if err != nil {
+                        t.Errorf("can not save (%v): %v", filePath, err)
+                    }
+                }
+            }(w, filePath)
+        }
+    }
+    waitGroup.Wait()
+    logStore.fileCache.closeAll()
+    dir := filepath.Join(logStore.config.Path, "app", "web1_127.0.0.1", "var", "log")
+    for _, filePath := range paths {
+        files, err := filepath.Glob(filepath.Join(dir, filepath.Base(filePath) + "*"))
+        if err != nil || len(files) < 2 {
+            t.Fatalf("file is not rotated (%v, %v)", files, err)
+        }
+        got := make([]string, 0)
+        for _, file := range files {
+            got = append(got, strings.Split(strings.TrimSuffix(readFile(t, file), "\n"), "\n")...)
+        }
+        sort.Strings(got)
+        expected := make([]string, 0, writers * lines)
+        for w := 0; w < writers; w++ {
+            for i := 0; i < lines; i++ {
+                expected = append(expected, fmt.Sprintf("w%v-%03d", w, i))
+            }
+        }
+        if strings.Join(got, ",") != strings.Join(expected, ",") {
+            t.Errorf("lines are lost or broken (%v, %v)", filePath, len(got))
+        }
+    }
+}
+
+func benchmarkSave(b *testing.B, maxOpenFiles int64, paths []string) {
+    logStore, err := NewLogStore(&configurator.LogRecieverConfig{
+        Path: b.TempDir(),
+        MaxOpenFiles: maxOpenFiles,
+    })
+    if err != nil {
+        b.Fatalf("can not create log store: %v", err)
+    }
+    data := []byte("2026-01-01T00:00:00 INFO benchmark log line\n")
+    b.SetBytes(int64(len(data)))
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        err := logStore.Save(context.Background(), "127.0.0.1", newRequest(paths[i % len(paths)], data))
+        if err != nil {
+            b.Fatalf("can not save: %v", err)
+        }
+    }
+    b.StopTimer()
+    logStore.fileCache.closeAll()
+}
+
+func BenchmarkSave(b *testing.B) {
+    paths := []string{ "/var/log/a.log", "/var/log/b.log" }
+    b.Run("cached", func(b *testing.B) {
+        benchmarkSave(b, 2, paths)
+    })
+    // every save reopens file
+    b.Run("uncached", func(b *testing.B) {
+        benchmarkSave(b, 1, paths)
+    })
+}
@@ -1,10 +1,10 @@
 package logstore
 
 import (
-    "os"
-    "path"
+    "log"
+    "sync"
+    "time"
     "path/filepath"
-    "strings"
     "context"
     "github.com/pkg/errors"
     "github.com/potix/log_monitor/configurator"
@@ -13,41 +13,179 @@ import (
 
 const (
     defaultPathFormat string = "${LABEL}/${HOST}_${ADDR}/${FILE_PATH}"
+    defaultRetentionInterval int64 = 600
+    defaultMaxOpenFiles int64 = 256
+    defaultWriteBufferSize int64 = 65536
+    defaultFlushInterval int64 = 1
+    defaultIdleTimeout int64 = 60
+    compressQueueSize int = 1000
 )
 
 // LogStore is LogStore
 type LogStore struct {
     config *configurator.LogRecieverConfig
+    formatter *pathFormatter
+    mutex *sync.Mutex
+    labelDirs map[string]string
+    fileCache *fileCache
+    flushInterval time.Duration
+    idleTimeout time.Duration
+    compressChan chan string
+    finish chan bool
+    waitGroup *sync.WaitGroup
 }
 
-// Save is save
-func (l *LogStore)Save(ctx context.Context, addr string, request *logpb.TransferRequest) (error) {
-    format := defaultPathFormat
-    if l.config.PathFormat != "" {
-        format = l.config.PathFormat
-    } 
-    r := strings.NewReplacer("${LABEL}", request.Label, "${HOST}", request.Host, "${ADDR}", addr, "${FILE_PATH}", request.Path)
-    formatPath := r.Replace(format)
-    filePath := filepath.Join(l.config.Path, formatPath)
-    err := os.MkdirAll(path.Dir(filePath), 0755)
-    if err != nil {
-        return errors.Wrapf(err, "can not create directories (%v)", filePath)
+// rotateFile is close and rotate file, it is skipped when other writer has rotated the file
+func (l *LogStore) rotateFile(filePath string, file *openFile) (error) {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+    if l.fileCache.files[filePath] != file {
+        return nil
     }
-    file, err :=  os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    err := l.fileCache.close(filePath)
     if err != nil {
-        return errors.Wrapf(err, "can not open file (%v)", filePath)
+        return err
     }
-    defer file.Close()
-    _, err = file.Write(request.LogData)
+    // closed file is not written any more
+    return l.rotate(filePath, file.modTime)
+}
+
+// Save is save, mutex of log store guards only file cache so that writes and fsyncs of different files run in parallel
+func (l *LogStore)Save(ctx context.Context, addr string, request *logpb.TransferRequest) (error) {
+    now := time.Now()
+    relPath, label, err := l.formatter.format(addr, request, now)
     if err != nil {
-        return errors.Wrapf(err, "can not write log data (%v)", filePath)
+        return err
+    }
+    filePath := filepath.Join(l.config.Path, relPath)
+    for {
+        l.mutex.Lock()
+        err = l.confine(filePath, !l.fileCache.has(filePath))
+        if err != nil {
+            l.mutex.Unlock()
+            return err
+        }
+        l.labelDirs[label] = l.labelDir(label)
+        file, err := l.fileCache.get(filePath, now)
+        l.mutex.Unlock()
+        if err != nil {
+            return err
+        }
+        file.mutex.Lock()
+        if file.closed {
+            // evicted or rotated by other writer after get
+            file.mutex.Unlock()
+            continue
+        }
+        if l.needRotate(file.size, file.modTime, int64(len(request.LogData)), now) {
+            file.mutex.Unlock()
+            err = l.rotateFile(filePath, file)
+            if err != nil {
+                return err
+            }
+            continue
+        }
+        err = file.write(request.LogData, now)
+        if err == nil && l.config.Fsync == fsyncAlways {
+            err = file.sync()
+        }
+        file.mutex.Unlock()
+        return err
+    }
+}
+
+func (l *LogStore) flushLoop() {
+    defer l.waitGroup.Done()
+    ticker := time.NewTicker(l.flushInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-l.finish:
+            l.mutex.Lock()
+            l.fileCache.closeAll()
+            l.mutex.Unlock()
+            return
+        case <-ticker.C:
+            l.mutex.Lock()
+            openFiles := l.fileCache.closeIdle(l.idleTimeout, time.Now())
+            l.mutex.Unlock()
+            for _, file := range openFiles {
+                l.fileCache.flushFile(file)
+            }
+        }
+    }
+}
+
+// Start is start background flush, compression and retention
+func (l *LogStore) Start() {
+    l.waitGroup.Add(1)
+    go l.flushLoop()
+    if l.config.Compress {
+        l.waitGroup.Add(1)
+        go l.compressLoop()
+    }
+    if l.config.Compress || l.config.RetentionAge > 0 || l.config.RetentionSize > 0 {
+        l.waitGroup.Add(1)
+        go l.retentionLoop()
     }
-    return nil
+}
+
+// Stop is stop, open files are flushed and closed
+func (l *LogStore) Stop() {
+    close(l.finish)
+    l.waitGroup.Wait()
 }
 
 // NewLogStore is  create new log store
-func NewLogStore(config *configurator.LogRecieverConfig) (*LogStore) {
-     return &LogStore{
-         config: config,
-     }
+func NewLogStore(config *configurator.LogRecieverConfig) (*LogStore, error) {
+    switch config.RotateInterval {
+    case "", rotateHourly, rotateDaily:
+    default:
+        return nil, errors.Errorf("unexpected rotate interval (%v)", config.RotateInterval)
+    }
+    if config.RotateSize < 0 || config.RetentionAge < 0 || config.RetentionSize < 0 {
+        return nil, errors.Errorf("rotate size, retention age and retention size must not be negative")
+    }
+    fsync := fsyncNever
+    if config.Fsync != "" {
+        fsync = config.Fsync
+    }
+    switch fsync {
+    case fsyncAlways, fsyncPeriodic, fsyncNever:
+    default:
+        return nil, errors.Errorf("unexpected fsync (%v)", config.Fsync)
+    }
+    maxOpenFiles := defaultMaxOpenFiles
+    if config.MaxOpenFiles > 0 {
+        maxOpenFiles = config.MaxOpenFiles
+    }
+    writeBufferSize := defaultWriteBufferSize
+    if config.WriteBufferSize > 0 {
+        writeBufferSize = config.WriteBufferSize
+    }
+    flushInterval := defaultFlushInterval
+    if config.FlushInterval > 0 {
+        flushInterval = config.FlushInterval
+    }
+    idleTimeout := defaultIdleTimeout
+    if config.IdleTimeout > 0 {
+        idleTimeout = config.IdleTimeout
+    }
+    formatter, err := newPathFormatter(config)
+    if err != nil {
+        return nil, err
+    }
+    log.Printf("path = %v, path format = %v", config.Path, formatter.pathFormat)
+    return &LogStore{
+        config: config,
+        formatter: formatter,
+        mutex: new(sync.Mutex),
+        labelDirs: make(map[string]string),
+        fileCache: newFileCache(int(maxOpenFiles), int(writeBufferSize), fsync),
+        flushInterval: time.Duration(flushInterval) * time.Second,
+        idleTimeout: time.Duration(idleTimeout) * time.Second,
+        compressChan: make(chan string, compressQueueSize),
+        finish: make(chan bool),
+        waitGroup: new(sync.WaitGroup),
+    }, nil
 }
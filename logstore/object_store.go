@@ -0,0 +1,217 @@
+package logstore
+
+import (
+    "os"
+    "fmt"
+    "log"
+    "sync"
+    "time"
+    "bytes"
+    "strings"
+    "context"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/configurator"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+const (
+    defaultS3Region string = "us-east-1"
+    defaultBatchSize int64 = 4194304
+    defaultBatchInterval int64 = 60
+    defaultMaxBuffered int64 = 268435456
+    defaultS3Timeout int64 = 30
+    objectKeyTimeFormat string = "20060102T150405.000000000Z"
+)
+
+type objectBatch struct {
+    key string
+    buf *bytes.Buffer
+    created time.Time
+}
+
+// ObjectStore is store that puts batched logs to s3 compatible object storage
+// logs of same path are batched into one object per batch_size or batch_interval
+type ObjectStore struct {
+    config *configurator.S3Config
+    formatter *pathFormatter
+    s3Client *s3Client
+    batchSize int64
+    batchInterval time.Duration
+    maxBuffered int64
+    buffered int64
+    batches map[string]*objectBatch
+    sequence int64
+    mutex *sync.Mutex
+    finish chan bool
+    finished chan bool
+}
+
+// Save is buffer log data, it is put to object storage in background
+func (o *ObjectStore) Save(ctx context.Context, addr string, request *logpb.TransferRequest) (error) {
+    relPath, _, err := o.formatter.format(addr, request, time.Now())
+    if err != nil {
+        return err
+    }
+    o.mutex.Lock()
+    defer o.mutex.Unlock()
+    if o.buffered + int64(len(request.LogData)) > o.maxBuffered {
+        return errors.Errorf("too many buffered log data (%v)", o.buffered)
+    }
+    batch, ok := o.batches[relPath]
+    if !ok {
+        batch = &objectBatch{
+            key: relPath,
+            buf: new(bytes.Buffer),
+            created: time.Now(),
+        }
+        o.batches[relPath] = batch
+    }
+    batch.buf.Write(request.LogData)
+    o.buffered += int64(len(request.LogData))
+    return nil
+}
+
+func (o *ObjectStore) objectKey(batch *objectBatch) (string) {
+    o.sequence++
+    key := fmt.Sprintf("%v/%v-%v.log", strings.TrimLeft(batch.key, "/"), batch.created.UTC().Format(objectKeyTimeFormat), o.sequence)
+    if o.config.Prefix != "" {
+        key = strings.TrimRight(o.config.Prefix, "/") + "/" + key
+    }
+    return key
+}
+
+// takeBatches is take batches that should be put, all batches are taken if force is true
+func (o *ObjectStore) takeBatches(now time.Time, force bool) (map[string]*objectBatch) {
+    o.mutex.Lock()
+    defer o.mutex.Unlock()
+    batches := make(map[string]*objectBatch)
+    for relPath, batch := range o.batches {
+        if !force && int64(batch.buf.Len()) < o.batchSize && now.Sub(batch.created) < o.batchInterval {
+            continue
+        }
+        delete(o.batches, relPath)
+        batches[o.objectKey(batch)] = batch
+    }
+    return batches
+}
+
+func (o *ObjectStore) restoreBatch(batch *objectBatch) {
+    o.mutex.Lock()
+    defer o.mutex.Unlock()
+    current, ok := o.batches[batch.key]
+    if ok {
+        // keep order of log data
+        batch.buf.Write(current.buf.Bytes())
+    }
+    o.batches[batch.key] = batch
+}
+
+func (o *ObjectStore) put(now time.Time, force bool) {
+    for key, batch := range o.takeBatches(now, force) {
+        size := int64(batch.buf.Len())
+        err := o.s3Client.PutObject(key, batch.buf.Bytes())
+        if err != nil {
+            log.Printf("can not put batch, retry later (%v): %v", key, err)
+            o.restoreBatch(batch)
+            continue
+        }
+        o.mutex.Lock()
+        o.buffered -= size
+        o.mutex.Unlock()
+    }
+}
+
+func (o *ObjectStore) putLoop() {
+    defer close(o.finished)
+    ticker := time.NewTicker(time.Second)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-o.finish:
+            o.put(time.Now(), true)
+            return
+        case <-ticker.C:
+            o.put(time.Now(), false)
+        }
+    }
+}
+
+// Start is start
+func (o *ObjectStore) Start() {
+    go o.putLoop()
+}
+
+// Stop is stop, buffered log data is put before stop
+func (o *ObjectStore) Stop() {
+    close(o.finish)
+    <-o.finished
+    o.mutex.Lock()
+    defer o.mutex.Unlock()
+    if o.buffered > 0 {
+        log.Printf("lost buffered log data at stop (%v bytes)", o.buffered)
+    }
+}
+
+// NewObjectStore is create new object store
+func NewObjectStore(config *configurator.LogRecieverConfig) (*ObjectStore, error) {
+    s3Config := config.S3
+    if s3Config == nil || s3Config.Endpoint == "" || s3Config.Bucket == "" {
+        return nil, errors.New("no s3 endpoint or bucket")
+    }
+    formatter, err := newPathFormatter(config)
+    if err != nil {
+        return nil, err
+    }
+    region := defaultS3Region
+    if s3Config.Region != "" {
+        region = s3Config.Region
+    }
+    accessKey := s3Config.AccessKey
+    if accessKey == "" {
+        accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+    }
+    secretKey := s3Config.SecretKey
+    if secretKey == "" {
+        secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+    }
+    if accessKey == "" || secretKey == "" {
+        return nil, errors.New("no s3 access key or secret key")
+    }
+    batchSize := defaultBatchSize
+    if s3Config.BatchSize > 0 {
+        batchSize = s3Config.BatchSize
+    }
+    batchInterval := defaultBatchInterval
+    if s3Config.BatchInterval > 0 {
+        batchInterval = s3Config.BatchInterval
+    }
+    maxBuffered := defaultMaxBuffered
+    if s3Config.MaxBuffered > 0 {
+        maxBuffered = s3Config.MaxBuffered
+    }
+    timeout := defaultS3Timeout
+    if s3Config.Timeout > 0 {
+        timeout = s3Config.Timeout
+    }
+    s3Client, err := newS3Client(s3Config.Endpoint, region, s3Config.Bucket, accessKey, secretKey,
+        s3Config.PathStyle, time.Duration(timeout) * time.Second)
+    if err != nil {
+        return nil, errors.Wrap(err, "can not create s3 client")
+    }
+    // config is not logged because it has secret key
+    log.Printf("endpoint = %v, bucket = %v, prefix = %v", s3Config.Endpoint, s3Config.Bucket, s3Config.Prefix)
+    return &ObjectStore{
+        config: s3Config,
+        formatter: formatter,
+        s3Client: s3Client,
+        batchSize: batchSize,
+        batchInterval: time.Duration(batchInterval) * time.Second,
+        maxBuffered: maxBuffered,
+        buffered: 0,
+        batches: make(map[string]*objectBatch),
+        sequence: 0,
+        mutex: new(sync.Mutex),
+        finish: make(chan bool),
+        finished: make(chan bool),
+    }, nil
+}
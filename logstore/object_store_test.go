@@ -0,0 +1,304 @@
+package logstore
+
+import (
+    "sort"
+    "sync"
+    "time"
+    "strings"
+    "context"
+    "testing"
+    "net/http"
+    "net/http/httptest"
+    "io/ioutil"
+    "path/filepath"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "github.com/potix/log_monitor/configurator"
+)
+
+const (
+    testAccessKey string = "AKIDEXAMPLE"
+    testSecretKey string = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+    testBucket string = "logs"
+)
+
+// s3Stub is s3 compatible server that verifies signature version 4 independently of s3Client
+type s3Stub struct {
+    *httptest.Server
+    mutex *sync.Mutex
+    objects map[string]string
+    status int
+    errors []string
+}
+
+func newS3Stub() (*s3Stub) {
+    s := &s3Stub{
+        mutex: new(sync.Mutex),
+        objects: make(map[string]string),
+        status: http.StatusOK,
+        errors: make([]string, 0),
+    }
+    s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+    return s
+}
+
+func (s *s3Stub) verify(r *http.Request, body []byte) (string) {
+    sum := sha256.Sum256(body)
+    payloadHash := hex.EncodeToString(sum[:])
+    if r.Header.Get("X-Amz-Content-Sha256") != payloadHash {
+        return "unexpected payload hash"
+    }
+    amzDate := r.Header.Get("X-Amz-Date")
+    if _, err := time.Parse("20060102T150405Z", amzDate); err != nil {
+        return "unexpected date " + amzDate
+    }
+    scope := amzDate[:8] + "/us-east-1/s3/aws4_request"
+    prefix := "AWS4-HMAC-SHA256 Credential=" + testAccessKey + "/" + scope + ", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="
+    authorization := r.Header.Get("Authorization")
+    if !strings.HasPrefix(authorization, prefix) {
+        return "unexpected authorization " + authorization
+    }
+    canonicalRequest := r.Method + "\n" + r.URL.EscapedPath() + "\n\n" +
+        "host:" + r.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n\n" +
+        "host;x-amz-content-sha256;x-amz-date\n" + payloadHash
+    canonicalSum := sha256.Sum256([]byte(canonicalRequest))
+    stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalSum[:])
+    key := []byte("AWS4" + testSecretKey)
+    for _, data := range []string{ amzDate[:8], "us-east-1", "s3", "aws4_request", stringToSign } {
+        mac := hmac.New(sha256.New, key)
+        mac.Write([]byte(data))
+        key = mac.Sum(nil)
+    }
+    if signature := strings.TrimPrefix(authorization, prefix); signature != hex.EncodeToString(key) {
+        return "unexpected signature " + signature
+    }
+    return ""
+}
+
+func (s *s3Stub) handle(w http.ResponseWriter, r *http.Request) {
+    body, _ := ioutil.ReadAll(r.Body)
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    if reason := s.verify(r, body); reason != "" {
+        s.errors = append(s.errors, reason)
+        w.WriteHeader(http.StatusForbidden)
+        return
+    }
+    if r.Method != "PUT" || !strings.HasPrefix(r.URL.Path, "/" + testBucket + "/") {
+        s.errors = append(s.errors, "unexpected request " + r.Method + " " + r.URL.Path)
+        w.WriteHeader(http.StatusBadRequest)
+        return
+    }
+    if s.status != http.StatusOK {
+        w.WriteHeader(s.status)
+        return
+    }
+    s.objects[strings.TrimPrefix(r.URL.Path, "/" + testBucket + "/")] = string(body)
+}
+
+func (s *s3Stub) setStatus(status int) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    s.status = status
+}
+
+// objectsOf is data of objects that have prefix, it is ordered by key
+func (s *s3Stub) objectsOf(t *testing.T, prefix string) ([]string) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    for _, reason := range s.errors {
+        t.Errorf("invalid request: %v", reason)
+    }
+    keys := make([]string, 0)
+    for key := range s.objects {
+        if strings.HasPrefix(key, prefix) {
+            keys = append(keys, key)
+        }
+    }
+    sort.Strings(keys)
+    data := make([]string, 0, len(keys))
+    for _, key := range keys {
+        data = append(data, s.objects[key])
+    }
+    return data
+}
+
+func newTestS3Config(stub *s3Stub) (*configurator.LogRecieverConfig) {
+    return &configurator.LogRecieverConfig{
+        S3: &configurator.S3Config{
+            Endpoint: stub.URL,
+            Bucket: testBucket,
+            Prefix: "prefix/",
+            AccessKey: testAccessKey,
+            SecretKey: testSecretKey,
+            PathStyle: true,
+            BatchSize: 10,
+            BatchInterval: 60,
+            MaxBuffered: 100,
+        },
+    }
+}
+
+func newTestObjectStore(t *testing.T, stub *s3Stub) (*ObjectStore) {
+    objectStore, err := NewObjectStore(newTestS3Config(stub))
+    if err != nil {
+        t.Fatalf("can not create object store: %v", err)
+    }
+    return objectStore
+}
+
+func TestEscapePath(t *testing.T) {
+    escaped := escapePath("/logs/app/web 1/a+b=c~d_e-f.log")
+    if escaped != "/logs/app/web%201/a%2Bb%3Dc~d_e-f.log" {
+        t.Errorf("unexpected escaped path (%v)", escaped)
+    }
+}
+
+func TestObjectStoreSignsRequests(t *testing.T) {
+    stub := newS3Stub()
+    defer stub.Close()
+    objectStore := newTestObjectStore(t, stub)
+    // escaped characters are signed as sent
+    err := objectStore.Save(context.Background(), "127.0.0.1", newRequest("/var/log/app 1+2.log", []byte("line\n")))
+    if err != nil {
+        t.Fatalf("can not save: %v", err)
+    }
+    objectStore.put(time.Now(), true)
+    objects := stub.objectsOf(t, "prefix/app/web1_127.0.0.1/var/log/app 1+2.log/")
+    if len(objects) != 1 || objects[0] != "line\n" {
+        t.Errorf("unexpected objects (%q)", objects)
+    }
+}
+
+func TestObjectStoreBatchesBySizeAndInterval(t *testing.T) {
+    stub := newS3Stub()
+    defer stub.Close()
+    objectStore := newTestObjectStore(t, stub)
+    now := time.Now()
+    saveObject := func(filePath string, data string) {
+        err := objectStore.Save(context.Background(), "127.0.0.1", newRequest(filePath, []byte(data)))
+        if err != nil {
+            t.Fatalf("can not save: %v", err)
+        }
+    }
+    saveObject("/var/log/large.log", "01234")
+    saveObject("/var/log/large.log", "56789")
+    saveObject("/var/log/small.log", "abc")
+    objectStore.put(now, false)
+    if objects := stub.objectsOf(t, "prefix/app/web1_127.0.0.1/var/log/large.log/"); len(objects) != 1 || objects[0] != "0123456789" {
+        t.Errorf("batch of batch size is not put (%q)", objects)
+    }
+    if objects := stub.objectsOf(t, "prefix/app/web1_127.0.0.1/var/log/small.log/"); len(objects) != 0 {
+        t.Errorf("small batch is put before batch interval (%q)", objects)
+    }
+    objectStore.put(now.Add(61 * time.Second), false)
+    if objects := stub.objectsOf(t, "prefix/app/web1_127.0.0.1/var/log/small.log/"); len(objects) != 1 || objects[0] != "abc" {
+        t.Errorf("batch is not put after batch interval (%q)", objects)
+    }
+    if objectStore.buffered != 0 || len(objectStore.batches) != 0 {
+        t.Errorf("unexpected buffered (%v, %v)", objectStore.buffered, len(objectStore.batches))
+    }
+    err := objectStore.Save(context.Background(), "127.0.0.1", newRequest("/var/log/large.log", make([]byte, 101)))
+    if err == nil {
+        t.Errorf("log data over max buffered is accepted")
+    }
+}
+
+func TestObjectStoreRestoresFailedBatch(t *testing.T) {
+    stub := newS3Stub()
+    defer stub.Close()
+    objectStore := newTestObjectStore(t, stub)
+    stub.setStatus(http.StatusServiceUnavailable)
+    err := objectStore.Save(context.Background(), "127.0.0.1", newRequest("/var/log/app.log", []byte("first\n")))
+    if err != nil {
+        t.Fatalf("can not save: %v", err)
+    }
+    objectStore.put(time.Now(), true)
+    if objectStore.buffered != 6 || len(objectStore.batches) != 1 {
+        t.Fatalf("failed batch is not restored (%v, %v)", objectStore.buffered, len(objectStore.batches))
+    }
+    err = objectStore.Save(context.Background(), "127.0.0.1", newRequest("/var/log/app.log", []byte("second\n")))
+    if err != nil {
+        t.Fatalf("can not save: %v", err)
+    }
+    stub.setStatus(http.StatusOK)
+    objectStore.put(time.Now(), true)
+    objects := stub.objectsOf(t, "prefix/app/web1_127.0.0.1/var/log/app.log/")
+    if len(objects) != 1 || objects[0] != "first\nsecond\n" {
+        t.Errorf("unexpected objects (%q)", objects)
+    }
+    if objectStore.buffered != 0 {
+        t.Errorf("unexpected buffered (%v)", objectStore.buffered)
+    }
+}
+
+func TestObjectStoreRestoresBatchBeforeNewData(t *testing.T) {
+    stub := newS3Stub()
+    defer stub.Close()
+    objectStore := newTestObjectStore(t, stub)
+    err := objectStore.Save(context.Background(), "127.0.0.1", newRequest("/var/log/app.log", []byte("first\n")))
+    if err != nil {
+        t.Fatalf("can not save: %v", err)
+    }
+    batches := objectStore.takeBatches(time.Now(), true)
+    // log data saved while failed batch is put
+    err = objectStore.Save(context.Background(), "127.0.0.1", newRequest("/var/log/app.log", []byte("second\n")))
+    if err != nil {
+        t.Fatalf("can not save: %v", err)
+    }
+    for _, batch := range batches {
+        objectStore.restoreBatch(batch)
+    }
+    for _, batch := range objectStore.batches {
+        if data := batch.buf.String(); data != "first\nsecond\n" {
+            t.Errorf("order of log data is not kept (%q)", data)
+        }
+    }
+}
+
+func TestFanoutStoreSavesToAllStores(t *testing.T) {
+    stub := newS3Stub()
+    defer stub.Close()
+    config := newTestS3Config(stub)
+    config.Store = storeFanout
+    config.FanoutStores = []string{ storeFile, storeS3 }
+    config.Path = t.TempDir()
+    store, err := NewStore(config)
+    if err != nil {
+        t.Fatalf("can not create fanout store: %v", err)
+    }
+    store.Start()
+    err = store.Save(context.Background(), "127.0.0.1", newRequest("/var/log/app.log", []byte("line\n")))
+    if err != nil {
+        t.Fatalf("can not save: %v", err)
+    }
+    store.Stop()
+    if data := readFile(t, filepath.Join(config.Path, "app", "web1_127.0.0.1", "var", "log", "app.log")); data != "line\n" {
+        t.Errorf("unexpected file data (%q)", data)
+    }
+    if objects := stub.objectsOf(t, "prefix/app/web1_127.0.0.1/var/log/app.log/"); len(objects) != 1 || objects[0] != "line\n" {
+        t.Errorf("unexpected objects (%q)", objects)
+    }
+}
+
+func TestFanoutStoreReportsFailedStores(t *testing.T) {
+    stub := newS3Stub()
+    defer stub.Close()
+    config := newTestS3Config(stub)
+    config.FanoutStores = []string{ storeFile, storeS3 }
+    config.Path = t.TempDir()
+    fanoutStore, err := NewFanoutStore(config)
+    if err != nil {
+        t.Fatalf("can not create fanout store: %v", err)
+    }
+    // s3 store is over max buffered
+    err = fanoutStore.Save(context.Background(), "127.0.0.1", newRequest("/var/log/app.log", make([]byte, 101)))
+    if err == nil || !strings.Contains(err.Error(), storeS3 + ": ") || strings.Contains(err.Error(), storeFile + ": ") {
+        t.Errorf("unexpected error (%v)", err)
+    }
+    err = fanoutStore.Save(context.Background(), "127.0.0.1", newRequest("/var/log/../../etc/passwd", []byte("line\n")))
+    if err == nil || !IsPathError(err) {
+        t.Errorf("path error is not returned (%v)", err)
+    }
+}
@@ -0,0 +1,570 @@
+package logstore
+
+import (
+    "io"
+    "os"
+    "log"
+    "path"
+    "sort"
+    "time"
+    "bufio"
+    "bytes"
+    "regexp"
+    "context"
+    "strings"
+    "path/filepath"
+    "compress/gzip"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/configurator"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+const (
+    defaultTailLines int64 = 10
+    maxTailLines int64 = 10000
+    defaultMaxMatches int64 = 1000
+    queryChunkSize int = 65536
+    followInterval time.Duration = 500 * time.Millisecond
+)
+
+var pathTokenPatterns = map[string]string{
+    "${LABEL}": "[^/]+",
+    "${HOST}": "[^/]+",
+    "${ADDR}": "[^/_]+",
+    "${FILE_PATH}": ".+",
+    "${YYYY}": "[0-9]{4}",
+    "${MM}": "[0-9]{2}",
+    "${DD}": "[0-9]{2}",
+    "${HH}": "[0-9]{2}",
+}
+
+var pathTokenRegexp = regexp.MustCompile(`\$\{[A-Z_]+\}`)
+
+// Query is query service of logs that LogStore wrote
+// stored paths are relative to storage root, tokens of source are parsed back from path_format
+type Query struct {
+    config *configurator.LogRecieverConfig
+    root string
+    pathRegexp *regexp.Regexp
+    finish chan bool
+}
+
+type storedFile struct {
+    source *logpb.Source
+    path string
+}
+
+// compilePathFormat is convert path format to regexp that has named groups of tokens
+func compilePathFormat(pathFormat string) (*regexp.Regexp, error) {
+    pattern := "^"
+    groups := make(map[string]bool)
+    last := 0
+    for _, loc := range pathTokenRegexp.FindAllStringIndex(pathFormat, -1) {
+        pattern += regexp.QuoteMeta(pathFormat[last:loc[0]])
+        token := pathFormat[loc[0]:loc[1]]
+        tokenPattern, ok := pathTokenPatterns[token]
+        if !ok {
+            return nil, errors.Errorf("unexpected token in path format (%v)", token)
+        }
+        name := strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(token, "${"), "}"))
+        if groups[name] {
+            pattern += "(?:" + tokenPattern + ")"
+        } else {
+            pattern += "(?P<" + name + ">" + tokenPattern + ")"
+            groups[name] = true
+        }
+        last = loc[1]
+    }
+    pattern += regexp.QuoteMeta(pathFormat[last:]) + "$"
+    pathRegexp, err := regexp.Compile(pattern)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not compile path format (%v)", pathFormat)
+    }
+    return pathRegexp, nil
+}
+
+func globMatch(pattern string, value string) (bool) {
+    if pattern == "" {
+        return true
+    }
+    matched, err := path.Match(pattern, value)
+    return err == nil && matched
+}
+
+// parse is parse stored path to source, it returns nil if stored path is not written by LogStore
+func (q *Query) parse(storedPath string, info os.FileInfo) (*logpb.Source) {
+    base := storedPath
+    rotated := false
+    loc := rotatedRegexp.FindStringIndex(storedPath)
+    if loc != nil {
+        base = storedPath[:loc[0]]
+        rotated = true
+    }
+    match := q.pathRegexp.FindStringSubmatch(path.Clean(base))
+    if match == nil {
+        return nil
+    }
+    source := &logpb.Source{
+        StoredPath: storedPath,
+        Size: info.Size(),
+        ModTime: info.ModTime().Unix(),
+        Rotated: rotated,
+        Compressed: strings.HasSuffix(storedPath, ".gz"),
+    }
+    for i, name := range q.pathRegexp.SubexpNames() {
+        switch name {
+        case tokenLabel:
+            source.Label = match[i]
+        case tokenHost:
+            source.Host = match[i]
+        case tokenAddr:
+            source.Addr = match[i]
+        case tokenFilePath:
+            source.FilePath = match[i]
+        }
+    }
+    return source
+}
+
+// list is list stored files, file path pattern is matched without leading slash
+func (q *Query) list(label string, host string, filePath string, withRotated bool) ([]*storedFile, error) {
+    filePath = strings.TrimLeft(filePath, "/")
+    storedFiles := make([]*storedFile, 0)
+    err := filepath.Walk(q.root, func(walkPath string, info os.FileInfo, err error) (error) {
+        if err != nil || !info.Mode().IsRegular() || strings.HasSuffix(walkPath, ".tmp") {
+            return nil
+        }
+        rel, err := filepath.Rel(q.root, walkPath)
+        if err != nil {
+            return nil
+        }
+        source := q.parse(filepath.ToSlash(rel), info)
+        if source == nil || (source.Rotated && !withRotated) {
+            return nil
+        }
+        storedFiles = append(storedFiles, &storedFile{
+            source: source,
+            path: walkPath,
+        })
+        return nil
+    })
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not walk storage root (%v)", q.root)
+    }
+    filtered := make([]*storedFile, 0, len(storedFiles))
+    for _, storedFile := range storedFiles {
+        source := storedFile.source
+        if globMatch(label, source.Label) && globMatch(host, source.Host) && globMatch(filePath, source.FilePath) {
+            filtered = append(filtered, storedFile)
+        }
+    }
+    return filtered, nil
+}
+
+// resolve is resolve stored path to file path under storage root
+func (q *Query) resolve(storedPath string) (*storedFile, error) {
+    filePath := filepath.Join(q.root, filepath.FromSlash(path.Clean("/" + storedPath)))
+    if filePath == q.root || !within(q.root, filePath) {
+        return nil, &PathError{ Token: "stored_path", Value: storedPath, Reason: "path is out of storage root" }
+    }
+    realRoot, err := filepath.EvalSymlinks(q.root)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not resolve storage root (%v)", q.root)
+    }
+    realPath, err := filepath.EvalSymlinks(filePath)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not resolve stored path (%v)", storedPath)
+    }
+    if !within(realRoot, realPath) {
+        return nil, &PathError{ Token: "stored_path", Value: storedPath, Reason: "path links out of storage root" }
+    }
+    info, err := os.Stat(realPath)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not stat stored path (%v)", storedPath)
+    }
+    if !info.Mode().IsRegular() {
+        return nil, errors.Errorf("stored path is not regular file (%v)", storedPath)
+    }
+    rel, err := filepath.Rel(q.root, filePath)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not get relative path (%v)", filePath)
+    }
+    source := q.parse(filepath.ToSlash(rel), info)
+    if source == nil {
+        source = &logpb.Source{
+            StoredPath: filepath.ToSlash(rel),
+            Size: info.Size(),
+            ModTime: info.ModTime().Unix(),
+            Compressed: strings.HasSuffix(rel, ".gz"),
+        }
+    }
+    return &storedFile{
+        source: source,
+        path: filePath,
+    }, nil
+}
+
+func (q *Query) stopped(ctx context.Context) (bool) {
+    select {
+    case <-q.finish:
+        return true
+    case <-ctx.Done():
+        return true
+    default:
+        return false
+    }
+}
+
+// List is list stored sources
+func (q *Query) List(ctx context.Context, request *logpb.ListRequest) (*logpb.ListReply, error) {
+    storedFiles, err := q.list(request.Label, request.Host, request.FilePath, request.WithRotated)
+    if err != nil {
+        return nil, err
+    }
+    sources := make([]*logpb.Source, 0, len(storedFiles))
+    for _, storedFile := range storedFiles {
+        sources = append(sources, storedFile.source)
+    }
+    return &logpb.ListReply{
+        Sources: sources,
+    }, nil
+}
+
+// tailOffset is find offset of last lines by reading file backwards
+func tailOffset(file *os.File, size int64, lines int64) (int64, error) {
+    buf := make([]byte, queryChunkSize)
+    offset := size
+    count := int64(0)
+    for offset > 0 {
+        n := int64(len(buf))
+        if offset < n {
+            n = offset
+        }
+        offset -= n
+        _, err := file.ReadAt(buf[:n], offset)
+        if err != nil && err != io.EOF {
+            return 0, errors.Wrapf(err, "can not read file (%v)", file.Name())
+        }
+        for i := n - 1; i >= 0; i-- {
+            if buf[i] != '\n' || offset + i == size - 1 {
+                // newline at end of file does not start line
+                continue
+            }
+            count++
+            if count == lines {
+                return offset + i + 1, nil
+            }
+        }
+    }
+    return 0, nil
+}
+
+func sendFile(stream logpb.Query_TailServer, reader io.Reader) (int64, error) {
+    buf := make([]byte, queryChunkSize)
+    sent := int64(0)
+    for {
+        n, err := reader.Read(buf)
+        if n > 0 {
+            data := make([]byte, n)
+            copy(data, buf[:n])
+            sendErr := stream.Send(&logpb.TailReply{ Data: data })
+            if sendErr != nil {
+                return sent, errors.Wrap(sendErr, "can not send tail reply")
+            }
+            sent += int64(n)
+        }
+        if err == io.EOF {
+            return sent, nil
+        }
+        if err != nil {
+            return sent, errors.Wrap(err, "can not read file")
+        }
+    }
+}
+
+// tailCompressed is tail gzipped file, it keeps last lines in memory with ring buffer
+func (q *Query) tailCompressed(stream logpb.Query_TailServer, storedFile *storedFile, lines int64) (error) {
+    file, err := os.Open(storedFile.path)
+    if err != nil {
+        return errors.Wrapf(err, "can not open file (%v)", storedFile.source.StoredPath)
+    }
+    defer file.Close()
+    gzipReader, err := gzip.NewReader(file)
+    if err != nil {
+        return errors.Wrapf(err, "can not read gzip file (%v)", storedFile.source.StoredPath)
+    }
+    defer gzipReader.Close()
+    reader := bufio.NewReader(gzipReader)
+    tail := make([][]byte, 0)
+    next := 0
+    for {
+        line, err := reader.ReadBytes('\n')
+        if len(line) > 0 {
+            if int64(len(tail)) < lines {
+                tail = append(tail, line)
+            } else {
+                tail[next] = line
+                next = (next + 1) % len(tail)
+            }
+        }
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return errors.Wrapf(err, "can not read gzip file (%v)", storedFile.source.StoredPath)
+        }
+    }
+    ordered := make([][]byte, 0, len(tail))
+    ordered = append(ordered, tail[next:]...)
+    ordered = append(ordered, tail[:next]...)
+    _, err = sendFile(stream, bytes.NewReader(bytes.Join(ordered, nil)))
+    return err
+}
+
+// follow is send data appended to file, file is reopened when it is rotated or truncated
+func (q *Query) follow(stream logpb.Query_TailServer, storedFile *storedFile, file *os.File, offset int64) (error) {
+    ticker := time.NewTicker(followInterval)
+    defer ticker.Stop()
+    defer func() {
+        file.Close()
+    }()
+    for {
+        select {
+        case <-q.finish:
+            return nil
+        case <-stream.Context().Done():
+            return nil
+        case <-ticker.C:
+        }
+        info, err := file.Stat()
+        if err != nil {
+            return errors.Wrapf(err, "can not stat file (%v)", storedFile.source.StoredPath)
+        }
+        if info.Size() < offset {
+            log.Printf("followed file is truncated (%v)", storedFile.source.StoredPath)
+            offset = 0
+        }
+        _, err = file.Seek(offset, io.SeekStart)
+        if err != nil {
+            return errors.Wrapf(err, "can not seek file (%v)", storedFile.source.StoredPath)
+        }
+        sent, err := sendFile(stream, file)
+        offset += sent
+        if err != nil {
+            return err
+        }
+        current, err := os.Stat(storedFile.path)
+        if err != nil || os.SameFile(info, current) {
+            // new file is created by next save after rotation
+            continue
+        }
+        newFile, err := os.Open(storedFile.path)
+        if err != nil {
+            continue
+        }
+        // rest of rotated file is sent before switching
+        _, err = sendFile(stream, file)
+        if err != nil {
+            newFile.Close()
+            return err
+        }
+        file.Close()
+        file = newFile
+        offset = 0
+    }
+}
+
+// Tail is send last lines of stored file, appended data is sent until client cancels if follow is true
+// lines is clamped to max tail lines, follow is ignored for compressed files
+func (q *Query) Tail(request *logpb.TailRequest, stream logpb.Query_TailServer) (error) {
+    storedFile, err := q.resolve(request.StoredPath)
+    if err != nil {
+        return err
+    }
+    lines := defaultTailLines
+    if request.Lines > 0 {
+        lines = request.Lines
+    }
+    if lines > maxTailLines {
+        lines = maxTailLines
+    }
+    if storedFile.source.Compressed {
+        return q.tailCompressed(stream, storedFile, lines)
+    }
+    file, err := os.Open(storedFile.path)
+    if err != nil {
+        return errors.Wrapf(err, "can not open file (%v)", request.StoredPath)
+    }
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return errors.Wrapf(err, "can not stat file (%v)", request.StoredPath)
+    }
+    offset, err := tailOffset(file, info.Size(), lines)
+    if err != nil {
+        file.Close()
+        return err
+    }
+    sent, err := sendFile(stream, io.NewSectionReader(file, offset, info.Size() - offset))
+    if err != nil || !request.Follow {
+        file.Close()
+        return err
+    }
+    return q.follow(stream, storedFile, file, offset + sent)
+}
+
+func (q *Query) grepSources(request *logpb.GrepRequest) ([]*storedFile, error) {
+    var storedFiles []*storedFile
+    if len(request.StoredPaths) > 0 {
+        storedFiles = make([]*storedFile, 0, len(request.StoredPaths))
+        for _, storedPath := range request.StoredPaths {
+            storedFile, err := q.resolve(storedPath)
+            if err != nil {
+                return nil, err
+            }
+            storedFiles = append(storedFiles, storedFile)
+        }
+    } else {
+        var err error
+        storedFiles, err = q.list(request.Label, request.Host, request.FilePath, request.WithRotated)
+        if err != nil {
+            return nil, err
+        }
+    }
+    selected := make([]*storedFile, 0, len(storedFiles))
+    for _, storedFile := range storedFiles {
+        if request.StartTime > 0 && storedFile.source.ModTime < request.StartTime {
+            continue
+        }
+        if request.EndTime > 0 && storedFile.source.ModTime > request.EndTime {
+            continue
+        }
+        selected = append(selected, storedFile)
+    }
+    // older files first
+    sort.SliceStable(selected, func(i, j int) bool {
+        return selected[i].source.ModTime < selected[j].source.ModTime
+    })
+    return selected, nil
+}
+
+// grepFile is grep lines that start in byte range, offsets of compressed file are offsets of uncompressed data
+func (q *Query) grepFile(stream logpb.Query_GrepServer, storedFile *storedFile, pattern *regexp.Regexp,
+    startOffset int64, endOffset int64, remaining int64) (int64, error) {
+    file, err := os.Open(storedFile.path)
+    if err != nil {
+        return 0, errors.Wrapf(err, "can not open file (%v)", storedFile.source.StoredPath)
+    }
+    defer file.Close()
+    var reader io.Reader = file
+    if storedFile.source.Compressed {
+        gzipReader, err := gzip.NewReader(file)
+        if err != nil {
+            return 0, errors.Wrapf(err, "can not read gzip file (%v)", storedFile.source.StoredPath)
+        }
+        defer gzipReader.Close()
+        reader = gzipReader
+    }
+    bufReader := bufio.NewReaderSize(reader, queryChunkSize)
+    offset := int64(0)
+    matches := int64(0)
+    for endOffset <= 0 || offset < endOffset {
+        if q.stopped(stream.Context()) {
+            return matches, nil
+        }
+        line, err := bufReader.ReadBytes('\n')
+        lineOffset := offset
+        offset += int64(len(line))
+        if len(line) > 0 && lineOffset >= startOffset && pattern.Match(line) {
+            sendErr := stream.Send(&logpb.GrepReply{
+                StoredPath: storedFile.source.StoredPath,
+                Offset: lineOffset,
+                Line: bytes.TrimRight(line, "\n"),
+            })
+            if sendErr != nil {
+                return matches, errors.Wrap(sendErr, "can not send grep reply")
+            }
+            matches++
+            if matches >= remaining {
+                return matches, nil
+            }
+        }
+        if err == io.EOF {
+            return matches, nil
+        }
+        if err != nil {
+            return matches, errors.Wrapf(err, "can not read file (%v)", storedFile.source.StoredPath)
+        }
+    }
+    return matches, nil
+}
+
+// Grep is send lines that match pattern in selected files
+func (q *Query) Grep(request *logpb.GrepRequest, stream logpb.Query_GrepServer) (error) {
+    if request.Pattern == "" {
+        return errors.New("no pattern")
+    }
+    pattern, err := regexp.Compile(request.Pattern)
+    if err != nil {
+        return errors.Wrapf(err, "can not compile pattern (%v)", request.Pattern)
+    }
+    if request.StartOffset < 0 || request.EndOffset < 0 {
+        return errors.New("offsets must not be negative")
+    }
+    maxMatches := defaultMaxMatches
+    if request.MaxMatches > 0 {
+        maxMatches = request.MaxMatches
+    }
+    storedFiles, err := q.grepSources(request)
+    if err != nil {
+        return err
+    }
+    for _, storedFile := range storedFiles {
+        if q.stopped(stream.Context()) {
+            return nil
+        }
+        matches, err := q.grepFile(stream, storedFile, pattern, request.StartOffset, request.EndOffset, maxMatches)
+        if err != nil {
+            return err
+        }
+        maxMatches -= matches
+        if maxMatches <= 0 {
+            return nil
+        }
+    }
+    return nil
+}
+
+// Stop is stop following tails, grpc server can not stop gracefully while they are running
+func (q *Query) Stop() {
+    close(q.finish)
+}
+
+// NewQuery is create new query, it needs file store
+func NewQuery(config *configurator.LogRecieverConfig) (*Query, error) {
+    useFile := config.Store == "" || config.Store == storeFile
+    if config.Store == storeFanout {
+        for _, name := range config.FanoutStores {
+            if name == "" || name == storeFile {
+                useFile = true
+            }
+        }
+    }
+    if !useFile {
+        return nil, errors.Errorf("query needs file store (%v)", config.Store)
+    }
+    formatter, err := newPathFormatter(config)
+    if err != nil {
+        return nil, err
+    }
+    pathRegexp, err := compilePathFormat(formatter.pathFormat)
+    if err != nil {
+        return nil, err
+    }
+    return &Query{
+        config: config,
+        root: filepath.Clean(config.Path),
+        pathRegexp: pathRegexp,
+        finish: make(chan bool),
+    }, nil
+}
@@ -0,0 +1,82 @@
+package logstore
+
+import (
+    "os"
+    "bytes"
+    "context"
+    "strings"
+    "testing"
+    "path/filepath"
+    "compress/gzip"
+    "google.golang.org/grpc"
+    "github.com/potix/log_monitor/configurator"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+type tailStream struct {
+    grpc.ServerStream
+    data *bytes.Buffer
+}
+
+func (t *tailStream) Send(reply *logpb.TailReply) (error) {
+    t.data.Write(reply.Data)
+    return nil
+}
+
+func (t *tailStream) Context() (context.Context) {
+    return context.Background()
+}
+
+func writeCompressed(t *testing.T, filePath string, data string) {
+    err := os.MkdirAll(filepath.Dir(filePath), 0755)
+    if err != nil {
+        t.Fatalf("can not create directory: %v", err)
+    }
+    file, err := os.Create(filePath)
+    if err != nil {
+        t.Fatalf("can not create file: %v", err)
+    }
+    defer file.Close()
+    gzipWriter := gzip.NewWriter(file)
+    gzipWriter.Write([]byte(data))
+    err = gzipWriter.Close()
+    if err != nil {
+        t.Fatalf("can not compress file: %v", err)
+    }
+}
+
+func TestTailCompressed(t *testing.T) {
+    config := &configurator.LogRecieverConfig{
+        Path: t.TempDir(),
+    }
+    query, err := NewQuery(config)
+    if err != nil {
+        t.Fatalf("can not create query: %v", err)
+    }
+    storedPath := "app/web1_127.0.0.1/var/log/app.log" + rotatedMarker + "20260101-000000.gz"
+    lines := make([]string, 0)
+    for _, c := range "abcdefghij" {
+        lines = append(lines, string(c) + "\n")
+    }
+    writeCompressed(t, filepath.Join(config.Path, storedPath), strings.Join(lines, "") + "partial")
+    tests := []struct {
+        lines int64
+        expected string
+    }{
+        { 1, "partial" },
+        { 3, "i\nj\npartial" },
+        { 11, strings.Join(lines, "") + "partial" },
+        // lines of client is clamped
+        { 1 << 40, strings.Join(lines, "") + "partial" },
+    }
+    for _, test := range tests {
+        stream := &tailStream{ data: new(bytes.Buffer) }
+        err := query.Tail(&logpb.TailRequest{ StoredPath: storedPath, Lines: test.lines }, stream)
+        if err != nil {
+            t.Fatalf("can not tail (%v): %v", test.lines, err)
+        }
+        if data := stream.data.String(); data != test.expected {
+            t.Errorf("unexpected tail (%v, %q, %q)", test.lines, data, test.expected)
+        }
+    }
+}
@@ -0,0 +1,253 @@
+package logstore
+
+import (
+    "io"
+    "os"
+    "fmt"
+    "log"
+    "sort"
+    "time"
+    "regexp"
+    "strings"
+    "path/filepath"
+    "compress/gzip"
+    "github.com/pkg/errors"
+)
+
+const (
+    rotateHourly string = "hourly"
+    rotateDaily string = "daily"
+    rotateSuffixFormat string = "20060102-150405"
+    // rotatedMarker is reserved, stored paths of senders can not contain it
+    rotatedMarker string = ".rotated-"
+)
+
+// rotated files are "<file>.rotated-<YYYYMMDD-HHMMSS>[.<n>][.gz]"
+var rotatedRegexp = regexp.MustCompile(`\.rotated-[0-9]{8}-[0-9]{6}(\.[0-9]+)?(\.gz)?$`)
+
+type rotatedFile struct {
+    path string
+    size int64
+    modTime time.Time
+}
+
+func (l *LogStore) period(t time.Time) (string) {
+    switch l.config.RotateInterval {
+    case rotateHourly:
+        return t.Format("2006010215")
+    case rotateDaily:
+        return t.Format("20060102")
+    default:
+        return ""
+    }
+}
+
+func (l *LogStore) needRotate(currentSize int64, modTime time.Time, size int64, now time.Time) (bool) {
+    if currentSize == 0 {
+        return false
+    }
+    if l.config.RotateSize > 0 && currentSize + size > l.config.RotateSize {
+        return true
+    }
+    return l.period(modTime) != l.period(now)
+}
+
+func exists(filePath string) (bool) {
+    _, err := os.Stat(filePath)
+    return err == nil
+}
+
+func (l *LogStore) rotate(filePath string, modTime time.Time) (error) {
+    base := filePath + rotatedMarker + modTime.Format(rotateSuffixFormat)
+    rotatedPath := base
+    for n := 1; exists(rotatedPath) || exists(rotatedPath + ".gz"); n++ {
+        rotatedPath = fmt.Sprintf("%v.%v", base, n)
+    }
+    err := os.Rename(filePath, rotatedPath)
+    if err != nil {
+        return errors.Wrapf(err, "can not rotate file (%v, %v)", filePath, rotatedPath)
+    }
+    if l.config.Compress {
+        l.enqueueCompress(rotatedPath)
+    }
+    return nil
+}
+
+func (l *LogStore) enqueueCompress(filePath string) {
+    select {
+    case l.compressChan <- filePath:
+    default:
+        // it is compressed by next retention check
+        log.Printf("compress queue is full (%v)", filePath)
+    }
+}
+
+func compressFile(filePath string) (error) {
+    src, err := os.Open(filePath)
+    if err != nil {
+        if os.IsNotExist(err) {
+            // already compressed
+            return nil
+        }
+        return errors.Wrapf(err, "can not open file (%v)", filePath)
+    }
+    defer src.Close()
+    tmpPath := filePath + ".gz.tmp"
+    dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+    if err != nil {
+        return errors.Wrapf(err, "can not create file (%v)", tmpPath)
+    }
+    gzipWriter := gzip.NewWriter(dst)
+    _, err = io.Copy(gzipWriter, src)
+    if err == nil {
+        err = gzipWriter.Close()
+    }
+    closeErr := dst.Close()
+    if err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        os.Remove(tmpPath)
+        return errors.Wrapf(err, "can not compress file (%v)", filePath)
+    }
+    err = os.Rename(tmpPath, filePath + ".gz")
+    if err != nil {
+        os.Remove(tmpPath)
+        return errors.Wrapf(err, "can not rename file (%v)", tmpPath)
+    }
+    err = os.Remove(filePath)
+    if err != nil {
+        return errors.Wrapf(err, "can not remove file (%v)", filePath)
+    }
+    return nil
+}
+
+func (l *LogStore) compressLoop() {
+    defer l.waitGroup.Done()
+    for {
+        select {
+        case <-l.finish:
+            return
+        case filePath := <-l.compressChan:
+            err := compressFile(filePath)
+            if err != nil {
+                log.Printf("can not compress rotated file: %v", err)
+            }
+        }
+    }
+}
+
+// labelDir is directory that has only files of label, it is storage root if path format can not separate labels
+func (l *LogStore) labelDir(label string) (string) {
+    segments := strings.Split(l.formatter.pathFormat, "/")
+    for i, segment := range segments {
+        if !strings.Contains(segment, "${LABEL}") {
+            continue
+        }
+        prefix := strings.Join(segments[:i + 1], "/")
+        if strings.Contains(strings.Replace(prefix, "${LABEL}", "", -1), "${") {
+            return l.config.Path
+        }
+        return filepath.Join(l.config.Path, strings.Replace(prefix, "${LABEL}", label, -1))
+    }
+    return l.config.Path
+}
+
+func (l *LogStore) removeExpired(now time.Time) {
+    maxAge := time.Duration(l.config.RetentionAge) * time.Second
+    filepath.Walk(l.config.Path, func(filePath string, info os.FileInfo, err error) (error) {
+        if err != nil || info.IsDir() || !rotatedRegexp.MatchString(info.Name()) {
+            return nil
+        }
+        if l.config.RetentionAge > 0 && now.Sub(info.ModTime()) > maxAge {
+            err := os.Remove(filePath)
+            if err != nil {
+                log.Printf("can not remove expired file (%v): %v", filePath, err)
+                return nil
+            }
+            log.Printf("removed expired file (%v)", filePath)
+            return nil
+        }
+        if l.config.Compress && !strings.HasSuffix(filePath, ".gz") {
+            l.enqueueCompress(filePath)
+        }
+        return nil
+    })
+}
+
+func (l *LogStore) reduceUsage(dir string) {
+    total := int64(0)
+    rotatedFiles := make([]*rotatedFile, 0)
+    filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) (error) {
+        if err != nil || info.IsDir() {
+            return nil
+        }
+        total += info.Size()
+        if rotatedRegexp.MatchString(info.Name()) {
+            rotatedFiles = append(rotatedFiles, &rotatedFile{
+                path: filePath,
+                size: info.Size(),
+                modTime: info.ModTime(),
+            })
+        }
+        return nil
+    })
+    if total <= l.config.RetentionSize {
+        return
+    }
+    sort.Slice(rotatedFiles, func(i, j int) bool {
+        return rotatedFiles[i].modTime.Before(rotatedFiles[j].modTime)
+    })
+    for _, rotatedFile := range rotatedFiles {
+        if total <= l.config.RetentionSize {
+            return
+        }
+        err := os.Remove(rotatedFile.path)
+        if err != nil {
+            log.Printf("can not remove file (%v): %v", rotatedFile.path, err)
+            continue
+        }
+        log.Printf("removed file for disk usage (%v, %v)", dir, rotatedFile.path)
+        total -= rotatedFile.size
+    }
+    if total <= l.config.RetentionSize {
+        return
+    }
+    log.Printf("disk usage exceeds retention size by active files (%v, %v)", dir, total)
+}
+
+func (l *LogStore) retention() {
+    l.removeExpired(time.Now())
+    if l.config.RetentionSize <= 0 {
+        return
+    }
+    // labels are learned from saved requests
+    dirs := make(map[string]bool)
+    l.mutex.Lock()
+    for _, dir := range l.labelDirs {
+        dirs[dir] = true
+    }
+    l.mutex.Unlock()
+    for dir := range dirs {
+        l.reduceUsage(dir)
+    }
+}
+
+func (l *LogStore) retentionLoop() {
+    defer l.waitGroup.Done()
+    interval := defaultRetentionInterval
+    if l.config.RetentionInterval > 0 {
+        interval = l.config.RetentionInterval
+    }
+    l.retention()
+    ticker := time.NewTicker(time.Duration(interval) * time.Second)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-l.finish:
+            return
+        case <-ticker.C:
+            l.retention()
+        }
+    }
+}
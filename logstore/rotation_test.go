@@ -0,0 +1,92 @@
+package logstore
+
+import (
+    "os"
+    "time"
+    "context"
+    "testing"
+    "path/filepath"
+    "github.com/potix/log_monitor/configurator"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+func newTestLogStore(t *testing.T, config *configurator.LogRecieverConfig) (*LogStore) {
+    config.Path = t.TempDir()
+    logStore, err := NewLogStore(config)
+    if err != nil {
+        t.Fatalf("can not create log store: %v", err)
+    }
+    return logStore
+}
+
+func newRequest(filePath string, data []byte) (*logpb.TransferRequest) {
+    return &logpb.TransferRequest{
+        Label: "app",
+        Host: "web1",
+        Path: filePath,
+        LogData: data,
+    }
+}
+
+func save(t *testing.T, logStore *LogStore, filePath string, data string) {
+    err := logStore.Save(context.Background(), "127.0.0.1", newRequest(filePath, []byte(data)))
+    if err != nil {
+        t.Fatalf("can not save (%v): %v", filePath, err)
+    }
+}
+
+func TestRetentionRemovesOnlyRotatedFiles(t *testing.T) {
+    logStore := newTestLogStore(t, &configurator.LogRecieverConfig{
+        RotateSize: 10,
+        RetentionAge: 60,
+    })
+    save(t, logStore, "/var/log/app.log", "0123456789")
+    save(t, logStore, "/var/log/app.log", "abc")
+    // sender file that looks like a rotated file of old naming
+    save(t, logStore, "/var/log/app.log.20260101-000000", "sender")
+    logStore.fileCache.closeAll()
+    dir := filepath.Join(logStore.config.Path, "app", "web1_127.0.0.1", "var", "log")
+    rotated, err := filepath.Glob(filepath.Join(dir, "app.log" + rotatedMarker + "*"))
+    if err != nil || len(rotated) != 1 {
+        t.Fatalf("unexpected rotated files (%v, %v)", rotated, err)
+    }
+    old := time.Now().Add(-time.Hour)
+    for _, name := range []string{ "app.log", "app.log.20260101-000000", filepath.Base(rotated[0]) } {
+        err := os.Chtimes(filepath.Join(dir, name), old, old)
+        if err != nil {
+            t.Fatalf("can not change time (%v): %v", name, err)
+        }
+    }
+    logStore.removeExpired(time.Now())
+    if exists(rotated[0]) {
+        t.Errorf("expired rotated file is not removed (%v)", rotated[0])
+    }
+    for _, name := range []string{ "app.log", "app.log.20260101-000000" } {
+        if !exists(filepath.Join(dir, name)) {
+            t.Errorf("sender file is removed (%v)", name)
+        }
+    }
+}
+
+func TestRotatedMarkerIsRejected(t *testing.T) {
+    logStore := newTestLogStore(t, &configurator.LogRecieverConfig{})
+    for _, filePath := range []string{ "/var/log/app.log.rotated-20260101-000000", "/var/log.rotated-x/app.log" } {
+        err := logStore.Save(context.Background(), "127.0.0.1", newRequest(filePath, []byte("data")))
+        if err == nil || !IsPathError(err) {
+            t.Errorf("reserved name is accepted (%v, %v)", filePath, err)
+        }
+    }
+    logStore = newTestLogStore(t, &configurator.LogRecieverConfig{
+        PathFormat: "${LABEL}/${HOST}${FILE_PATH}",
+    })
+    // tokens are joined into reserved name by path format
+    err := logStore.Save(context.Background(), "127.0.0.1", &logpb.TransferRequest{
+        Label: "app",
+        Host: "x.rotated",
+        Path: "-20260101-000000",
+        LogData: []byte("data"),
+    })
+    if err == nil || !IsPathError(err) {
+        t.Errorf("reserved name made by path format is accepted (%v)", err)
+    }
+}
@@ -0,0 +1,147 @@
+package logstore
+
+import (
+    "io"
+    "fmt"
+    "time"
+    "bytes"
+    "strings"
+    "net/url"
+    "net/http"
+    "io/ioutil"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "github.com/pkg/errors"
+)
+
+const (
+    s3Service string = "s3"
+    s3Algorithm string = "AWS4-HMAC-SHA256"
+    amzDateFormat string = "20060102T150405Z"
+    maxErrorBody int64 = 1024
+)
+
+// s3Client is minimal client of s3 compatible api, it signs requests with signature version 4
+type s3Client struct {
+    endpoint *url.URL
+    region string
+    bucket string
+    accessKey string
+    secretKey string
+    pathStyle bool
+    httpClient *http.Client
+}
+
+func hmacSHA256(key []byte, data string) ([]byte) {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(data))
+    return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) (string) {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
+
+// escapePath is uri encode except unreserved characters and slash
+func escapePath(p string) (string) {
+    buf := new(bytes.Buffer)
+    for _, b := range []byte(p) {
+        if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+            b == '-' || b == '_' || b == '.' || b == '~' || b == '/' {
+            buf.WriteByte(b)
+            continue
+        }
+        fmt.Fprintf(buf, "%%%02X", b)
+    }
+    return buf.String()
+}
+
+func (s *s3Client) objectURL(key string) (string, string, string) {
+    host := s.endpoint.Host
+    objectPath := "/" + key
+    if s.pathStyle {
+        objectPath = "/" + s.bucket + objectPath
+    } else {
+        host = s.bucket + "." + host
+    }
+    objectPath = escapePath(objectPath)
+    return s.endpoint.Scheme + "://" + host + objectPath, host, objectPath
+}
+
+func (s *s3Client) sign(request *http.Request, host string, canonicalPath string, payloadHash string, now time.Time) {
+    amzDate := now.UTC().Format(amzDateFormat)
+    date := amzDate[:8]
+    request.Header.Set("X-Amz-Date", amzDate)
+    request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+    signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+    canonicalRequest := strings.Join([]string{
+        request.Method,
+        canonicalPath,
+        "",
+        "host:" + host,
+        "x-amz-content-sha256:" + payloadHash,
+        "x-amz-date:" + amzDate,
+        "",
+        signedHeaders,
+        payloadHash,
+    }, "\n")
+    scope := date + "/" + s.region + "/" + s3Service + "/aws4_request"
+    stringToSign := strings.Join([]string{
+        s3Algorithm,
+        amzDate,
+        scope,
+        sha256Hex([]byte(canonicalRequest)),
+    }, "\n")
+    key := hmacSHA256([]byte("AWS4" + s.secretKey), date)
+    key = hmacSHA256(key, s.region)
+    key = hmacSHA256(key, s3Service)
+    key = hmacSHA256(key, "aws4_request")
+    signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+    request.Header.Set("Authorization", fmt.Sprintf("%v Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+        s3Algorithm, s.accessKey, scope, signedHeaders, signature))
+}
+
+// PutObject is put object
+func (s *s3Client) PutObject(key string, data []byte) (error) {
+    objectURL, host, objectPath := s.objectURL(key)
+    request, err := http.NewRequest("PUT", objectURL, bytes.NewReader(data))
+    if err != nil {
+        return errors.Wrapf(err, "can not create request (%v)", objectURL)
+    }
+    request.Host = host
+    request.Header.Set("Content-Type", "text/plain")
+    s.sign(request, host, objectPath, sha256Hex(data), time.Now())
+    response, err := s.httpClient.Do(request)
+    if err != nil {
+        return errors.Wrapf(err, "can not put object (%v)", objectURL)
+    }
+    defer response.Body.Close()
+    body, _ := ioutil.ReadAll(&io.LimitedReader{ R: response.Body, N: maxErrorBody })
+    if response.StatusCode < 200 || response.StatusCode >= 300 {
+        return errors.Errorf("unexpected status of put object (%v, %v): %v", objectURL, response.Status, string(body))
+    }
+    return nil
+}
+
+func newS3Client(endpoint string, region string, bucket string, accessKey string, secretKey string, pathStyle bool, timeout time.Duration) (*s3Client, error) {
+    endpointURL, err := url.Parse(endpoint)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not parse endpoint (%v)", endpoint)
+    }
+    if endpointURL.Scheme != "http" && endpointURL.Scheme != "https" {
+        return nil, errors.Errorf("unexpected scheme of endpoint (%v)", endpoint)
+    }
+    return &s3Client{
+        endpoint: endpointURL,
+        region: region,
+        bucket: bucket,
+        accessKey: accessKey,
+        secretKey: secretKey,
+        pathStyle: pathStyle,
+        httpClient: &http.Client{
+            Timeout: timeout,
+        },
+    }, nil
+}
@@ -0,0 +1,248 @@
+package logstore
+
+import (
+    "os"
+    "fmt"
+    "path"
+    "time"
+    "regexp"
+    "strings"
+    "path/filepath"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/configurator"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+const (
+    tokenLabel string = "label"
+    tokenHost string = "host"
+    tokenAddr string = "addr"
+    tokenFilePath string = "file_path"
+    maxSegmentLength int = 255
+)
+
+var defaultPathPolicies = map[string]*configurator.PathPolicy{
+    // label keeps spaces so that labels like "matcher 1" are stored as they are
+    tokenLabel: &configurator.PathPolicy{
+        Allowed: "A-Za-z0-9._ -",
+        Replacement: "_",
+        AllowSlash: false,
+    },
+    tokenHost: &configurator.PathPolicy{
+        Allowed: "A-Za-z0-9._-",
+        Replacement: "_",
+        AllowSlash: false,
+    },
+    tokenAddr: &configurator.PathPolicy{
+        Allowed: "A-Za-z0-9.:_-",
+        Replacement: "_",
+        AllowSlash: false,
+    },
+    tokenFilePath: &configurator.PathPolicy{
+        Allowed: "^\\x00-\\x1f\\x7f/\\\\",
+        Replacement: "_",
+        AllowSlash: true,
+    },
+}
+
+// PathError is error of path that can not be stored
+type PathError struct {
+    Token string
+    Value string
+    Reason string
+}
+
+type pathPolicy struct {
+    allowed *regexp.Regexp
+    replacement string
+    allowSlash bool
+}
+
+// pathFormatter is format relative path of request with sanitized tokens
+type pathFormatter struct {
+    pathFormat string
+    pathPolicies map[string]*pathPolicy
+}
+
+// Error is error message
+func (e *PathError) Error() (string) {
+    return fmt.Sprintf("invalid %v (%q): %v", e.Token, e.Value, e.Reason)
+}
+
+// IsPathError is report whether error is caused by invalid path
+func IsPathError(err error) (bool) {
+    _, ok := errors.Cause(err).(*PathError)
+    return ok
+}
+
+func compilePathPolicies(configPolicies map[string]*configurator.PathPolicy) (map[string]*pathPolicy, error) {
+    policies := make(map[string]*pathPolicy)
+    for token, defaultPolicy := range defaultPathPolicies {
+        policy, ok := configPolicies[token]
+        if !ok {
+            policy = defaultPolicy
+        }
+        allowed, err := regexp.Compile("^[" + policy.Allowed + "]$")
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not compile allowed characters of path policy (%v)", token)
+        }
+        if strings.ContainsAny(policy.Replacement, "/\\\x00") || strings.Trim(policy.Replacement, ".") == "" && policy.Replacement != "" {
+            return nil, errors.Errorf("unsafe replacement of path policy (%v, %q)", token, policy.Replacement)
+        }
+        policies[token] = &pathPolicy{
+            allowed: allowed,
+            replacement: policy.Replacement,
+            allowSlash: policy.AllowSlash,
+        }
+    }
+    for token := range configPolicies {
+        _, ok := defaultPathPolicies[token]
+        if !ok {
+            return nil, errors.Errorf("unexpected path policy (%v)", token)
+        }
+    }
+    return policies, nil
+}
+
+func (p *pathPolicy) sanitizeSegment(token string, value string, segment string) (string, error) {
+    if segment == ".." {
+        return "", &PathError{ Token: token, Value: value, Reason: "parent directory is not allowed" }
+    }
+    if strings.Contains(segment, rotatedMarker) {
+        return "", &PathError{ Token: token, Value: value, Reason: fmt.Sprintf("%q is reserved for rotated files", rotatedMarker) }
+    }
+    sanitized := make([]string, 0, len(segment))
+    for _, r := range segment {
+        c := string(r)
+        if p.allowed.MatchString(c) {
+            sanitized = append(sanitized, c)
+            continue
+        }
+        if p.replacement == "" {
+            return "", &PathError{ Token: token, Value: value, Reason: fmt.Sprintf("character %q is not allowed", r) }
+        }
+        sanitized = append(sanitized, p.replacement)
+    }
+    result := strings.Join(sanitized, "")
+    if result == "" || result == "." || result == ".." {
+        return "", &PathError{ Token: token, Value: value, Reason: "empty or dot name is not allowed" }
+    }
+    if len(result) > maxSegmentLength {
+        return "", &PathError{ Token: token, Value: value, Reason: "name is too long" }
+    }
+    return result, nil
+}
+
+func (p *pathPolicy) sanitize(token string, value string) (string, error) {
+    if strings.ContainsRune(value, 0) {
+        return "", &PathError{ Token: token, Value: value, Reason: "NUL is not allowed" }
+    }
+    if !p.allowSlash {
+        return p.sanitizeSegment(token, value, value)
+    }
+    segments := make([]string, 0)
+    for _, segment := range strings.Split(value, "/") {
+        if segment == "" || segment == "." {
+            continue
+        }
+        sanitized, err := p.sanitizeSegment(token, value, segment)
+        if err != nil {
+            return "", err
+        }
+        segments = append(segments, sanitized)
+    }
+    if len(segments) == 0 {
+        return "", &PathError{ Token: token, Value: value, Reason: "empty path is not allowed" }
+    }
+    return strings.Join(segments, "/"), nil
+}
+
+// format is format relative path, it returns path and sanitized label
+func (p *pathFormatter) format(addr string, request *logpb.TransferRequest, now time.Time) (string, string, error) {
+    label, err := p.pathPolicies[tokenLabel].sanitize(tokenLabel, request.Label)
+    if err != nil {
+        return "", "", err
+    }
+    host, err := p.pathPolicies[tokenHost].sanitize(tokenHost, request.Host)
+    if err != nil {
+        return "", "", err
+    }
+    sanitizedAddr, err := p.pathPolicies[tokenAddr].sanitize(tokenAddr, addr)
+    if err != nil {
+        return "", "", err
+    }
+    filePath, err := p.pathPolicies[tokenFilePath].sanitize(tokenFilePath, request.Path)
+    if err != nil {
+        return "", "", err
+    }
+    r := strings.NewReplacer(
+        "${LABEL}", label,
+        "${HOST}", host,
+        "${ADDR}", sanitizedAddr,
+        "${FILE_PATH}", filePath,
+        "${YYYY}", now.Format("2006"),
+        "${MM}", now.Format("01"),
+        "${DD}", now.Format("02"),
+        "${HH}", now.Format("15"))
+    formatted := path.Clean(r.Replace(p.pathFormat))
+    // tokens joined by path format can not make a name of rotated file either
+    if strings.Contains(path.Base(formatted), rotatedMarker) {
+        return "", "", &PathError{ Token: "path", Value: formatted, Reason: fmt.Sprintf("%q is reserved for rotated files", rotatedMarker) }
+    }
+    return formatted, label, nil
+}
+
+func newPathFormatter(config *configurator.LogRecieverConfig) (*pathFormatter, error) {
+    pathPolicies, err := compilePathPolicies(config.PathPolicies)
+    if err != nil {
+        return nil, errors.Wrap(err, "invalid path policies")
+    }
+    pathFormat := defaultPathFormat
+    if config.PathFormat != "" {
+        pathFormat = config.PathFormat
+    }
+    return &pathFormatter{
+        pathFormat: pathFormat,
+        pathPolicies: pathPolicies,
+    }, nil
+}
+
+func within(root string, target string) (bool) {
+    rel, err := filepath.Rel(root, target)
+    if err != nil {
+        return false
+    }
+    return rel != ".." && !strings.HasPrefix(rel, ".." + string(filepath.Separator))
+}
+
+// confine is check that file path is under storage root, symbolic links are resolved for files not opened yet
+func (l *LogStore) confine(filePath string, resolveLinks bool) (error) {
+    root := filepath.Clean(l.config.Path)
+    if filePath == root || !within(root, filePath) {
+        return &PathError{ Token: "path", Value: filePath, Reason: "path is out of storage root" }
+    }
+    if !resolveLinks {
+        return nil
+    }
+    realRoot, err := filepath.EvalSymlinks(root)
+    if err != nil {
+        // storage root is created later
+        return nil
+    }
+    dir := filepath.Dir(filePath)
+    for dir != root && !exists(dir) {
+        dir = filepath.Dir(dir)
+    }
+    realDir, err := filepath.EvalSymlinks(dir)
+    if err != nil {
+        return errors.Wrapf(err, "can not resolve directory (%v)", dir)
+    }
+    if !within(realRoot, realDir) {
+        return &PathError{ Token: "path", Value: filePath, Reason: "directory links out of storage root" }
+    }
+    info, err := os.Lstat(filePath)
+    if err == nil && info.Mode() & os.ModeSymlink != 0 {
+        return &PathError{ Token: "path", Value: filePath, Reason: "symbolic link is not allowed" }
+    }
+    return nil
+}
@@ -0,0 +1,149 @@
+package logstore
+
+import (
+    "os"
+    "strings"
+    "testing"
+    "path/filepath"
+    "unicode/utf8"
+    "github.com/potix/log_monitor/configurator"
+)
+
+func TestSanitize(t *testing.T) {
+    policies, err := compilePathPolicies(nil)
+    if err != nil {
+        t.Fatalf("can not compile path policies: %v", err)
+    }
+    tests := []struct {
+        name string
+        token string
+        value string
+        expected string
+        failed bool
+    }{
+        { "file path", tokenFilePath, "var/log/app.log", "var/log/app.log", false },
+        { "absolute file path", tokenFilePath, "/var/log/app.log", "var/log/app.log", false },
+        { "dot and empty segments", tokenFilePath, "/var/./log//app.log", "var/log/app.log", false },
+        { "parent directory", tokenFilePath, "/var/log/../../etc/passwd", "", true },
+        { "parent directory only", tokenFilePath, "..", "", true },
+        { "root only", tokenFilePath, "/", "", true },
+        { "nul", tokenFilePath, "/var/log/app\x00.log", "", true },
+        { "backslash", tokenFilePath, "..\\..\\etc\\passwd", ".._.._etc_passwd", false },
+        { "control character", tokenFilePath, "app\n.log", "app_.log", false },
+        { "overlong segment", tokenFilePath, "/var/" + strings.Repeat("a", maxSegmentLength + 1), "", true },
+        { "longest segment", tokenFilePath, "/var/" + strings.Repeat("a", maxSegmentLength), "var/" + strings.Repeat("a", maxSegmentLength), false },
+        { "invalid utf8", tokenFilePath, "/var/log/app\xff.log", "var/log/app�.log", false },
+        { "label", tokenLabel, "app-1.x", "app-1.x", false },
+        { "label with slash", tokenLabel, "/etc/passwd", "_etc_passwd", false },
+        { "label with space", tokenLabel, "matcher 1", "matcher 1", false },
+        { "label with tab", tokenLabel, "matcher\t1", "matcher_1", false },
+        { "label parent directory", tokenLabel, "..", "", true },
+        { "label dot", tokenLabel, ".", "", true },
+        { "label empty", tokenLabel, "", "", true },
+        { "label nul", tokenLabel, "app\x00", "", true },
+        { "label backslash", tokenLabel, "a\\b", "a_b", false },
+        { "label invalid utf8", tokenLabel, "app\xfe", "app_", false },
+        { "label overlong", tokenLabel, strings.Repeat("a", maxSegmentLength + 1), "", true },
+        { "host", tokenHost, "web1.example.com", "web1.example.com", false },
+        { "addr", tokenAddr, "[::1]:514", "_::1_:514", false },
+    }
+    for _, test := range tests {
+        sanitized, err := policies[test.token].sanitize(test.token, test.value)
+        if test.failed {
+            if err == nil || !IsPathError(err) {
+                t.Errorf("%v: unexpected result (%q, %v)", test.name, sanitized, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%v: can not sanitize: %v", test.name, err)
+            continue
+        }
+        if sanitized != test.expected || !utf8.ValidString(sanitized) {
+            t.Errorf("%v: unexpected sanitized (%q, %q)", test.name, sanitized, test.expected)
+        }
+    }
+}
+
+func TestSanitizeWithoutReplacement(t *testing.T) {
+    policies, err := compilePathPolicies(map[string]*configurator.PathPolicy{
+        tokenFilePath: &configurator.PathPolicy{
+            Allowed: "A-Za-z0-9._-",
+            Replacement: "",
+            AllowSlash: true,
+        },
+    })
+    if err != nil {
+        t.Fatalf("can not compile path policies: %v", err)
+    }
+    for _, value := range []string{ "a\\b", "a b", "a\xffb" } {
+        _, err := policies[tokenFilePath].sanitize(tokenFilePath, value)
+        if err == nil || !IsPathError(err) {
+            t.Errorf("disallowed character is accepted (%q, %v)", value, err)
+        }
+    }
+}
+
+func TestUnsafeReplacementIsRejected(t *testing.T) {
+    for _, replacement := range []string{ "/", "\\", "\x00", ".", ".." } {
+        _, err := compilePathPolicies(map[string]*configurator.PathPolicy{
+            tokenLabel: &configurator.PathPolicy{
+                Allowed: "A-Za-z0-9",
+                Replacement: replacement,
+                AllowSlash: false,
+            },
+        })
+        if err == nil {
+            t.Errorf("unsafe replacement is accepted (%q)", replacement)
+        }
+    }
+}
+
+func TestConfine(t *testing.T) {
+    logStore := newTestLogStore(t, &configurator.LogRecieverConfig{})
+    root := logStore.config.Path
+    outside := t.TempDir()
+    err := os.MkdirAll(filepath.Join(root, "app", "real"), 0755)
+    if err != nil {
+        t.Fatalf("can not create directory: %v", err)
+    }
+    links := map[string]string{
+        filepath.Join(root, "app", "out"): outside,
+        filepath.Join(root, "app", "in"): filepath.Join(root, "app", "real"),
+        filepath.Join(root, "app", "real", "file.log"): filepath.Join(outside, "file.log"),
+    }
+    for link, target := range links {
+        err := os.Symlink(target, link)
+        if err != nil {
+            t.Fatalf("can not create symbolic link (%v): %v", link, err)
+        }
+    }
+    tests := []struct {
+        name string
+        filePath string
+        resolveLinks bool
+        failed bool
+    }{
+        { "file", filepath.Join(root, "app", "a.log"), true, false },
+        { "new directory", filepath.Join(root, "app", "new", "dir", "a.log"), true, false },
+        { "root", root, true, true },
+        { "parent of root", filepath.Dir(root), true, true },
+        { "outside", filepath.Join(outside, "a.log"), true, true },
+        { "absolute path", "/etc/passwd", true, true },
+        { "dot dot", root + "/app/../../a.log", true, true },
+        { "directory link out of root", filepath.Join(root, "app", "out", "a.log"), true, true },
+        { "directory link out of root below new directory", filepath.Join(root, "app", "out", "new", "a.log"), true, true },
+        { "directory link in root", filepath.Join(root, "app", "in", "a.log"), true, false },
+        { "file link", filepath.Join(root, "app", "real", "file.log"), true, true },
+        { "opened file is not resolved", filepath.Join(root, "app", "out", "a.log"), false, false },
+    }
+    for _, test := range tests {
+        err := logStore.confine(filepath.Clean(test.filePath), test.resolveLinks)
+        if test.failed && (err == nil || !IsPathError(err)) {
+            t.Errorf("%v: path is not confined (%v, %v)", test.name, test.filePath, err)
+        }
+        if !test.failed && err != nil {
+            t.Errorf("%v: unexpected error (%v): %v", test.name, test.filePath, err)
+        }
+    }
+}
@@ -0,0 +1,89 @@
+package logstore
+
+import (
+    "log"
+    "time"
+    "context"
+    "database/sql"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/configurator"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+const (
+    defaultSQLDriver string = "sqlite3"
+)
+
+var sqlSchema = []string{
+    `CREATE TABLE IF NOT EXISTS logs (
+        label TEXT NOT NULL,
+        host TEXT NOT NULL,
+        addr TEXT NOT NULL,
+        path TEXT NOT NULL,
+        received_at INTEGER NOT NULL,
+        data BLOB NOT NULL
+    )`,
+    `CREATE INDEX IF NOT EXISTS logs_source ON logs (label, host, path, received_at)`,
+}
+
+// SQLStore is store that inserts logs to sql database
+type SQLStore struct {
+    config *configurator.SQLConfig
+    db *sql.DB
+}
+
+// Save is save
+func (s *SQLStore) Save(ctx context.Context, addr string, request *logpb.TransferRequest) (error) {
+    _, err := s.db.ExecContext(ctx,
+        "INSERT INTO logs (label, host, addr, path, received_at, data) VALUES (?, ?, ?, ?, ?, ?)",
+        request.Label, request.Host, addr, request.Path, time.Now().UnixNano(), request.LogData)
+    if err != nil {
+        return errors.Wrapf(err, "can not insert log data (%v, %v, %v)", request.Label, request.Host, request.Path)
+    }
+    return nil
+}
+
+// Start is start
+func (s *SQLStore) Start() {
+}
+
+// Stop is stop
+func (s *SQLStore) Stop() {
+    err := s.db.Close()
+    if err != nil {
+        log.Printf("can not close database: %v", err)
+    }
+}
+
+// NewSQLStore is create new sql store
+func NewSQLStore(config *configurator.LogRecieverConfig) (*SQLStore, error) {
+    sqlConfig := config.SQL
+    if sqlConfig == nil || sqlConfig.DSN == "" {
+        return nil, errors.New("no sql dsn")
+    }
+    driver := defaultSQLDriver
+    if sqlConfig.Driver != "" {
+        driver = sqlConfig.Driver
+    }
+    db, err := sql.Open(driver, sqlConfig.DSN)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not open database (%v), driver may not be linked", driver)
+    }
+    if driver == defaultSQLDriver {
+        // sqlite does not allow concurrent writers
+        db.SetMaxOpenConns(1)
+    }
+    for _, statement := range sqlSchema {
+        _, err := db.Exec(statement)
+        if err != nil {
+            db.Close()
+            return nil, errors.Wrapf(err, "can not create schema (%v)", driver)
+        }
+    }
+    // dsn is not logged because it may have password
+    log.Printf("driver = %v", driver)
+    return &SQLStore{
+        config: sqlConfig,
+        db: db,
+    }, nil
+}
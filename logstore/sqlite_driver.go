@@ -0,0 +1,8 @@
+// +build sqlite
+
+package logstore
+
+import (
+    // sqlite3 driver of sql store, it needs cgo
+    _ "github.com/mattn/go-sqlite3"
+)
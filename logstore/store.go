@@ -0,0 +1,133 @@
+package logstore
+
+import (
+    "sync"
+    "strings"
+    "context"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/configurator"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+const (
+    storeFile string = "file"
+    storeS3 string = "s3"
+    storeSQL string = "sql"
+    storeFanout string = "fanout"
+    storeNone string = "none"
+)
+
+// Store is storage of transferred logs
+type Store interface {
+    Start()
+    Stop()
+    Save(ctx context.Context, addr string, request *logpb.TransferRequest) (error)
+}
+
+// FanoutStore is store that writes to several stores
+// logs are saved at least once, stores that succeeded may have duplicates when sender retries
+type FanoutStore struct {
+    names []string
+    stores []Store
+}
+
+// Start is start
+func (f *FanoutStore) Start() {
+    for _, store := range f.stores {
+        store.Start()
+    }
+}
+
+// Stop is stop
+func (f *FanoutStore) Stop() {
+    for _, store := range f.stores {
+        store.Stop()
+    }
+}
+
+// Save is save to all stores
+func (f *FanoutStore) Save(ctx context.Context, addr string, request *logpb.TransferRequest) (error) {
+    errs := make([]error, len(f.stores))
+    waitGroup := new(sync.WaitGroup)
+    for i, store := range f.stores {
+        waitGroup.Add(1)
+        go func(i int, store Store) {
+            defer waitGroup.Done()
+            errs[i] = store.Save(ctx, addr, request)
+        }(i, store)
+    }
+    waitGroup.Wait()
+    msgs := make([]string, 0)
+    for i, err := range errs {
+        if err == nil {
+            continue
+        }
+        if IsPathError(err) {
+            return err
+        }
+        msgs = append(msgs, f.names[i] + ": " + err.Error())
+    }
+    if len(msgs) > 0 {
+        return errors.Errorf("can not save to stores (%v)", strings.Join(msgs, ", "))
+    }
+    return nil
+}
+
+// NopStore is store that discards logs, it is used by relay that does not store logs locally
+type NopStore struct {
+}
+
+// Start is start
+func (n *NopStore) Start() {
+}
+
+// Stop is stop
+func (n *NopStore) Stop() {
+}
+
+// Save is discard
+func (n *NopStore) Save(ctx context.Context, addr string, request *logpb.TransferRequest) (error) {
+    return nil
+}
+
+func newStore(name string, config *configurator.LogRecieverConfig) (Store, error) {
+    switch name {
+    case "", storeFile:
+        return NewLogStore(config)
+    case storeS3:
+        return NewObjectStore(config)
+    case storeSQL:
+        return NewSQLStore(config)
+    case storeNone:
+        return &NopStore{}, nil
+    default:
+        return nil, errors.Errorf("unexpected store (%v)", name)
+    }
+}
+
+// NewFanoutStore is create new fanout store
+func NewFanoutStore(config *configurator.LogRecieverConfig) (*FanoutStore, error) {
+    if len(config.FanoutStores) == 0 {
+        return nil, errors.New("no fanout stores")
+    }
+    stores := make([]Store, 0, len(config.FanoutStores))
+    for _, name := range config.FanoutStores {
+        store, err := newStore(name, config)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not create store (%v)", name)
+        }
+        stores = append(stores, store)
+    }
+    return &FanoutStore{
+        names: config.FanoutStores,
+        stores: stores,
+    }, nil
+}
+
+// NewStore is create new store selected by config
+func NewStore(config *configurator.LogRecieverConfig) (Store, error) {
+    if config.Store == storeFanout {
+        return NewFanoutStore(config)
+    }
+    return newStore(config.Store, config)
+}
@@ -0,0 +1,138 @@
+package reciever
+
+import (
+    "io"
+    "log"
+    "net"
+    "time"
+    "context"
+    "strconv"
+    "net/http"
+    "io/ioutil"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+const (
+    defaultHTTPPath string = "/http"
+    httpShutdownTimeout time.Duration = 10 * time.Second
+)
+
+// httpListener is listener of logs posted over http
+// label, host and path are taken from query, they default to label and path of listener and address of peer
+// limited request is replied with 429 and Retry-After
+type httpListener struct {
+    listen net.Listener
+    server *http.Server
+    transfer transferFunc
+    label string
+    path string
+    maxMessageSize int64
+    finished chan bool
+}
+
+func (h *httpListener) ServeHTTP(writer http.ResponseWriter, httpRequest *http.Request) {
+    if httpRequest.Method != http.MethodPost {
+        writer.Header().Set("Allow", http.MethodPost)
+        http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    addr, _, err := net.SplitHostPort(httpRequest.RemoteAddr)
+    if err != nil {
+        addr = httpRequest.RemoteAddr
+    }
+    query := httpRequest.URL.Query()
+    label := query.Get("label")
+    if label == "" {
+        label = h.label
+    }
+    host := query.Get("host")
+    if host == "" {
+        host = addr
+    }
+    path := query.Get("path")
+    if path == "" {
+        path = h.path
+    }
+    data, err := ioutil.ReadAll(io.LimitReader(httpRequest.Body, h.maxMessageSize + 1))
+    if err != nil {
+        http.Error(writer, "can not read body", http.StatusBadRequest)
+        return
+    }
+    if int64(len(data)) > h.maxMessageSize {
+        http.Error(writer, "body is too large", http.StatusRequestEntityTooLarge)
+        return
+    }
+    if len(data) == 0 {
+        writer.Write([]byte("OK\n"))
+        return
+    }
+    if data[len(data) - 1] != '\n' {
+        data = append(data, '\n')
+    }
+    request := &logpb.TransferRequest{
+        Label: label,
+        Host: host,
+        Path: path,
+        LogData: data,
+    }
+    reply, err := h.transfer(httpRequest.Context(), addr, nil, request)
+    if err != nil {
+        log.Printf("can not transfer log: %v", err)
+        http.Error(writer, reply.Msg, http.StatusInternalServerError)
+        return
+    }
+    if !reply.Success && reply.RetryAfter > 0 {
+        writer.Header().Set("Retry-After", strconv.FormatInt(reply.RetryAfter, 10))
+        http.Error(writer, reply.Msg, http.StatusTooManyRequests)
+        return
+    }
+    if !reply.Success {
+        http.Error(writer, reply.Msg, http.StatusBadRequest)
+        return
+    }
+    writer.Write([]byte("OK\n"))
+}
+
+func (h *httpListener) start() {
+    go func() {
+        defer close(h.finished)
+        err := h.server.Serve(h.listen)
+        if err != nil && err != http.ErrServerClosed {
+            log.Printf("can not serve http (%v): %v", h.listen.Addr(), err)
+        }
+    }()
+}
+
+func (h *httpListener) stop() {
+    ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+    defer cancel()
+    err := h.server.Shutdown(ctx)
+    if err != nil {
+        log.Printf("can not shutdown http (%v): %v", h.listen.Addr(), err)
+        h.server.Close()
+    }
+    <-h.finished
+}
+
+func (h *httpListener) close() {
+    h.listen.Close()
+}
+
+func newHTTPListener(listen net.Listener, transfer transferFunc, label string, path string, maxMessageSize int64) (*httpListener) {
+    if path == "" {
+        path = defaultHTTPPath
+    }
+    h := &httpListener{
+        listen: listen,
+        server: nil,
+        transfer: transfer,
+        label: label,
+        path: path,
+        maxMessageSize: maxMessageSize,
+        finished: make(chan bool),
+    }
+    h.server = &http.Server{
+        Handler: h,
+    }
+    return h
+}
@@ -0,0 +1,77 @@
+package reciever
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "net/http"
+    "net/http/httptest"
+    "github.com/pkg/errors"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+func TestHTTPListener(t *testing.T) {
+    tests := []struct {
+        name string
+        method string
+        target string
+        body string
+        reply *logpb.TransferReply
+        replyErr error
+        status int
+        retryAfter string
+        request *logpb.TransferRequest
+    }{
+        { "not post", http.MethodGet, "/", "", nil, nil, http.StatusMethodNotAllowed, "", nil },
+        { "too large", http.MethodPost, "/", "0123456789a", nil, nil, http.StatusRequestEntityTooLarge, "", nil },
+        { "empty", http.MethodPost, "/", "", nil, nil, http.StatusOK, "", nil },
+        {
+            "defaults", http.MethodPost, "/", "line",
+            &logpb.TransferReply{ Success: true, Msg: "OK" }, nil, http.StatusOK, "",
+            newTransferRequest("http", "192.0.2.1", defaultHTTPPath, "line\n"),
+        },
+        {
+            "query", http.MethodPost, "/?label=app&host=web1&path=/var/log/app.log", "line\n",
+            &logpb.TransferReply{ Success: true, Msg: "OK" }, nil, http.StatusOK, "",
+            newTransferRequest("app", "web1", "/var/log/app.log", "line\n"),
+        },
+        {
+            "limited", http.MethodPost, "/", "line\n",
+            &logpb.TransferReply{ Success: false, Msg: "limited: daily quota exceeded", RetryAfter: 5 }, nil, http.StatusTooManyRequests, "5",
+            newTransferRequest("http", "192.0.2.1", defaultHTTPPath, "line\n"),
+        },
+        {
+            "rejected", http.MethodPost, "/", "line\n",
+            &logpb.TransferReply{ Success: false, Msg: "rejected: invalid label" }, nil, http.StatusBadRequest, "",
+            newTransferRequest("http", "192.0.2.1", defaultHTTPPath, "line\n"),
+        },
+        {
+            "server error", http.MethodPost, "/", "line\n",
+            &logpb.TransferReply{ Success: false, Msg: "can not save" }, errors.New("can not save"), http.StatusInternalServerError, "",
+            newTransferRequest("http", "192.0.2.1", defaultHTTPPath, "line\n"),
+        },
+    }
+    for _, test := range tests {
+        var transferred *logpb.TransferRequest
+        transfer := func(ctx context.Context, addr string, hops []string, request *logpb.TransferRequest) (*logpb.TransferReply, error) {
+            transferred = request
+            return test.reply, test.replyErr
+        }
+        h := newHTTPListener(nil, transfer, "http", "", 10)
+        recorder := httptest.NewRecorder()
+        h.ServeHTTP(recorder, httptest.NewRequest(test.method, test.target, strings.NewReader(test.body)))
+        if recorder.Code != test.status || recorder.Header().Get("Retry-After") != test.retryAfter {
+            t.Errorf("%v: unexpected response (%v, %q)", test.name, recorder.Code, recorder.Header().Get("Retry-After"))
+        }
+        if test.status == http.StatusMethodNotAllowed && recorder.Header().Get("Allow") != http.MethodPost {
+            t.Errorf("%v: unexpected allow header (%q)", test.name, recorder.Header().Get("Allow"))
+        }
+        if (transferred == nil) != (test.request == nil) {
+            t.Fatalf("%v: unexpected transfer (%+v)", test.name, transferred)
+        }
+        if transferred != nil && (transferred.Label != test.request.Label || transferred.Host != test.request.Host ||
+            transferred.Path != test.request.Path || string(transferred.LogData) != string(test.request.LogData)) {
+            t.Errorf("%v: unexpected transferred request (%+v)", test.name, transferred)
+        }
+    }
+}
@@ -0,0 +1,192 @@
+package reciever
+
+import (
+    "fmt"
+    "math"
+    "sync"
+    "time"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/configurator"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+const (
+    limitKeyLabel string = "label"
+    limitKeyHost string = "host"
+    quotaDateFormat string = "20060102"
+    bucketIdleTimeout time.Duration = time.Hour
+)
+
+// bucket is token bucket that has burst of one second, tokens become negative by large request
+type bucket struct {
+    rate float64
+    tokens float64
+    last time.Time
+}
+
+// quota is bytes used in a day
+type quota struct {
+    date string
+    used int64
+}
+
+type limitState struct {
+    bytes *bucket
+    requests *bucket
+    quota *quota
+    lastUsed time.Time
+}
+
+// limiter is rate limits and daily quotas of transferred logs
+type limiter struct {
+    rateLimits []*configurator.RateLimit
+    states map[string]*limitState
+    lastPruned time.Time
+    mutex *sync.Mutex
+}
+
+func newBucket(rate float64, now time.Time) (*bucket) {
+    return &bucket{
+        rate: rate,
+        tokens: rate,
+        last: now,
+    }
+}
+
+func (b *bucket) refill(now time.Time) {
+    b.tokens = math.Min(b.rate, b.tokens + now.Sub(b.last).Seconds() * b.rate)
+    b.last = now
+}
+
+// wait is seconds until cost can be taken, cost is capped by burst so that large request can pass
+func (b *bucket) wait(cost float64) (float64) {
+    need := math.Min(cost, b.rate)
+    if b.tokens >= need {
+        return 0
+    }
+    return (need - b.tokens) / b.rate
+}
+
+func nextDay(now time.Time) (time.Time) {
+    year, month, day := now.Date()
+    return time.Date(year, month, day + 1, 0, 0, 0, 0, now.Location())
+}
+
+func (l *limiter) state(i int, rateLimit *configurator.RateLimit, request *logpb.TransferRequest, now time.Time) (*limitState) {
+    key := request.Label
+    if rateLimit.Key == limitKeyHost {
+        key = request.Host
+    }
+    stateKey := fmt.Sprintf("%v/%v", i, key)
+    state, ok := l.states[stateKey]
+    if !ok {
+        state = &limitState{}
+        if rateLimit.BytesPerSecond > 0 {
+            state.bytes = newBucket(float64(rateLimit.BytesPerSecond), now)
+        }
+        if rateLimit.RequestsPerSecond > 0 {
+            state.requests = newBucket(rateLimit.RequestsPerSecond, now)
+        }
+        if rateLimit.DailyBytes > 0 {
+            state.quota = &quota{ date: now.Format(quotaDateFormat), used: 0 }
+        }
+        l.states[stateKey] = state
+    }
+    state.lastUsed = now
+    return state
+}
+
+func (l *limiter) prune(now time.Time) {
+    if now.Sub(l.lastPruned) < bucketIdleTimeout {
+        return
+    }
+    l.lastPruned = now
+    for key, state := range l.states {
+        if now.Sub(state.lastUsed) > bucketIdleTimeout && (state.quota == nil || state.quota.date != now.Format(quotaDateFormat)) {
+            delete(l.states, key)
+        }
+    }
+}
+
+// allow is take tokens and quota of all matched limits, it returns seconds to wait and reason if request is limited
+// request larger than daily quota never passes and is reported with error
+func (l *limiter) allow(request *logpb.TransferRequest, now time.Time) (int64, string, error) {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+    l.prune(now)
+    size := int64(len(request.LogData))
+    states := make([]*limitState, 0, len(l.rateLimits))
+    wait := 0.0
+    reason := ""
+    for i, rateLimit := range l.rateLimits {
+        if !globMatch(rateLimit.Label, request.Label) || !globMatch(rateLimit.Host, request.Host) {
+            continue
+        }
+        if rateLimit.DailyBytes > 0 && size > rateLimit.DailyBytes {
+            return 0, "", errors.Errorf("larger than daily quota (%v)", rateLimit.DailyBytes)
+        }
+        state := l.state(i, rateLimit, request, now)
+        states = append(states, state)
+        if state.bytes != nil {
+            state.bytes.refill(now)
+            w := state.bytes.wait(float64(size))
+            if w > wait {
+                wait, reason = w, "bytes per second exceeded"
+            }
+        }
+        if state.requests != nil {
+            state.requests.refill(now)
+            w := state.requests.wait(1)
+            if w > wait {
+                wait, reason = w, "requests per second exceeded"
+            }
+        }
+        if state.quota != nil {
+            date := now.Format(quotaDateFormat)
+            if state.quota.date != date {
+                state.quota.date = date
+                state.quota.used = 0
+            }
+            if state.quota.used + size > rateLimit.DailyBytes {
+                w := nextDay(now).Sub(now).Seconds()
+                if w > wait {
+                    wait, reason = w, "daily quota exceeded"
+                }
+            }
+        }
+    }
+    if wait > 0 {
+        return int64(math.Ceil(wait)), reason, nil
+    }
+    for _, state := range states {
+        if state.bytes != nil {
+            state.bytes.tokens -= float64(size)
+        }
+        if state.requests != nil {
+            state.requests.tokens--
+        }
+        if state.quota != nil {
+            state.quota.used += size
+        }
+    }
+    return 0, "", nil
+}
+
+func newLimiter(rateLimits []*configurator.RateLimit) (*limiter, error) {
+    for i, rateLimit := range rateLimits {
+        switch rateLimit.Key {
+        case "", limitKeyLabel, limitKeyHost:
+        default:
+            return nil, errors.Errorf("unexpected key of rate limit (%v, %v)", i, rateLimit.Key)
+        }
+        if rateLimit.BytesPerSecond < 0 || rateLimit.RequestsPerSecond < 0 || rateLimit.DailyBytes < 0 {
+            return nil, errors.Errorf("rate limit must not be negative (%v)", i)
+        }
+    }
+    return &limiter{
+        rateLimits: rateLimits,
+        states: make(map[string]*limitState),
+        lastPruned: time.Now(),
+        mutex: new(sync.Mutex),
+    }, nil
+}
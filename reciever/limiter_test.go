@@ -0,0 +1,139 @@
+package reciever
+
+import (
+    "sort"
+    "strings"
+    "testing"
+    "time"
+    "github.com/potix/log_monitor/configurator"
+)
+
+// t0 is monday morning in utc
+var t0 = time.Date(2026, time.January, 5, 10, 0, 0, 0, time.UTC)
+
+func newTestLimiter(t *testing.T, now time.Time, rateLimits ...*configurator.RateLimit) (*limiter) {
+    l, err := newLimiter(rateLimits)
+    if err != nil {
+        t.Fatalf("can not create limiter: %v", err)
+    }
+    l.lastPruned = now
+    return l
+}
+
+type limitStep struct {
+    name string
+    now time.Time
+    label string
+    host string
+    size int
+    retryAfter int64
+    reason string
+}
+
+func runLimitSteps(t *testing.T, l *limiter, steps []limitStep) {
+    for _, step := range steps {
+        request := newTransferRequest(step.label, step.host, "/var/log/app.log", strings.Repeat("x", step.size))
+        retryAfter, reason, err := l.allow(request, step.now)
+        if err != nil {
+            t.Errorf("%v: unexpected error (%v)", step.name, err)
+            continue
+        }
+        if retryAfter != step.retryAfter || reason != step.reason {
+            t.Errorf("%v: unexpected result (%v, %q)", step.name, retryAfter, reason)
+        }
+    }
+}
+
+func TestTokenBucket(t *testing.T) {
+    l := newTestLimiter(t, t0, &configurator.RateLimit{ BytesPerSecond: 100, RequestsPerSecond: 2 })
+    runLimitSteps(t, l, []limitStep{
+        { "first", t0, "app", "web1", 60, 0, "" },
+        { "bytes exceeded", t0, "app", "web1", 60, 1, "bytes per second exceeded" },
+        { "refilled", t0.Add(200 * time.Millisecond), "app", "web1", 60, 0, "" },
+        { "requests wait longer", t0.Add(200 * time.Millisecond), "app", "web1", 1, 1, "requests per second exceeded" },
+        { "other label has own bucket", t0.Add(200 * time.Millisecond), "db", "web1", 100, 0, "" },
+        { "large request passes with burst", t0.Add(1200 * time.Millisecond), "app", "web1", 500, 0, "" },
+        { "large request is paid back", t0.Add(2200 * time.Millisecond), "app", "web1", 1, 4, "bytes per second exceeded" },
+    })
+}
+
+func TestDailyQuota(t *testing.T) {
+    beforeMidnight := time.Date(2026, time.January, 5, 23, 59, 0, 0, time.UTC)
+    l := newTestLimiter(t, beforeMidnight, &configurator.RateLimit{ Key: limitKeyHost, DailyBytes: 100 })
+    runLimitSteps(t, l, []limitStep{
+        { "first", beforeMidnight, "app", "web1", 60, 0, "" },
+        { "exceeded until midnight", beforeMidnight, "app", "web1", 50, 60, "daily quota exceeded" },
+        { "limited request is not counted", beforeMidnight.Add(30 * time.Second), "db", "web1", 40, 0, "" },
+        { "other host has own quota", beforeMidnight, "app", "web2", 100, 0, "" },
+        { "quota is used up", beforeMidnight.Add(59 * time.Second), "app", "web1", 1, 1, "daily quota exceeded" },
+        { "reset at midnight", beforeMidnight.Add(time.Minute), "app", "web1", 100, 0, "" },
+    })
+    _, _, err := l.allow(newTransferRequest("app", "web3", "/var/log/app.log", strings.Repeat("x", 101)), beforeMidnight)
+    if err == nil || !strings.Contains(err.Error(), "larger than daily quota") {
+        t.Errorf("unexpected error of request larger than daily quota (%v)", err)
+    }
+}
+
+func TestAllOrNothing(t *testing.T) {
+    l := newTestLimiter(t, t0,
+        &configurator.RateLimit{ Key: limitKeyHost, BytesPerSecond: 100 },
+        &configurator.RateLimit{ Label: "app", DailyBytes: 50 },
+    )
+    runLimitSteps(t, l, []limitStep{
+        { "limited by quota", t0, "app", "web1", 50, 0, "" },
+        { "tokens are not taken by limited request", t0, "app", "web1", 10, 50400, "daily quota exceeded" },
+        { "tokens are left for other label", t0, "db", "web1", 50, 0, "" },
+        { "tokens are taken", t0, "db", "web1", 1, 1, "bytes per second exceeded" },
+    })
+}
+
+func TestPrune(t *testing.T) {
+    l := newTestLimiter(t, t0,
+        &configurator.RateLimit{ Label: "app", RequestsPerSecond: 10 },
+        &configurator.RateLimit{ Label: "db", DailyBytes: 1000 },
+    )
+    tests := []struct {
+        name string
+        now time.Time
+        label string
+        expected string
+    }{
+        { "states are added", t0, "app", "0/app" },
+        { "quota state is added", t0, "db", "0/app,1/db" },
+        { "not pruned within interval", t0.Add(59 * time.Minute), "other", "0/app,1/db" },
+        { "idle bucket is pruned", t0.Add(61 * time.Minute), "other", "1/db" },
+        { "quota of today is kept", t0.Add(13 * time.Hour), "other", "1/db" },
+        { "quota of yesterday is pruned", t0.Add(15 * time.Hour), "other", "" },
+    }
+    for _, test := range tests {
+        _, _, err := l.allow(newTransferRequest(test.label, "web1", "/var/log/app.log", "x"), test.now)
+        if err != nil {
+            t.Fatalf("%v: unexpected error (%v)", test.name, err)
+        }
+        keys := make([]string, 0, len(l.states))
+        for key := range l.states {
+            keys = append(keys, key)
+        }
+        sort.Strings(keys)
+        if got := strings.Join(keys, ","); got != test.expected {
+            t.Errorf("%v: unexpected states (%v, %v)", test.name, got, test.expected)
+        }
+    }
+}
+
+func TestNewLimiterErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        rateLimit *configurator.RateLimit
+    }{
+        { "unexpected key", &configurator.RateLimit{ Key: "path" } },
+        { "negative bytes", &configurator.RateLimit{ BytesPerSecond: -1 } },
+        { "negative requests", &configurator.RateLimit{ RequestsPerSecond: -1 } },
+        { "negative daily bytes", &configurator.RateLimit{ DailyBytes: -1 } },
+    }
+    for _, test := range tests {
+        if _, err := newLimiter([]*configurator.RateLimit{ test.rateLimit }); err == nil {
+            t.Errorf("%v: invalid rate limit is accepted", test.name)
+        }
+    }
+}
@@ -0,0 +1,196 @@
+package reciever
+
+import (
+    "net"
+    "log"
+    "sync"
+    "time"
+    "context"
+    "github.com/pkg/errors"
+    "github.com/potix/log_monitor/configurator"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+const (
+    listenerTypeSyslogUDP string = "syslog_udp"
+    listenerTypeSyslogTCP string = "syslog_tcp"
+    listenerTypeTCP string = "tcp"
+    listenerTypeHTTP string = "http"
+    defaultListenerMaxMessageSize int64 = 1048576
+    maxBatchSize int = 1048576
+    acceptRetryInterval time.Duration = time.Second
+)
+
+// listener is listener of sources that do not run log monitor
+type listener interface {
+    start()
+    stop()
+    // close is close socket of listener that is not started
+    close()
+}
+
+// transferFunc is transfer of reciever, listeners save logs through it
+type transferFunc func(ctx context.Context, addr string, hops []string, request *logpb.TransferRequest) (*logpb.TransferReply, error)
+
+func peerAddr(addr net.Addr) (string) {
+    switch a := addr.(type) {
+    case *net.TCPAddr:
+        return a.IP.String()
+    case *net.UDPAddr:
+        return a.IP.String()
+    default:
+        return addr.String()
+    }
+}
+
+// deliver is transfer request, limited request is retried after waiting so that peer is blocked by tcp
+// it returns false when listener is stopped while waiting
+func deliver(transfer transferFunc, addr string, request *logpb.TransferRequest, finish chan bool) (bool) {
+    for {
+        reply, err := transfer(context.Background(), addr, nil, request)
+        if err != nil {
+            log.Printf("can not transfer log: %v", err)
+            return true
+        }
+        if reply.Success || reply.RetryAfter <= 0 {
+            // rejected logs are logged by transfer
+            return true
+        }
+        select {
+        case <-finish:
+            return false
+        case <-time.After(time.Duration(reply.RetryAfter) * time.Second):
+        }
+    }
+}
+
+// streamServer is accept connections of stream listener, connections are closed at stop
+type streamServer struct {
+    listen net.Listener
+    handle func(conn net.Conn)
+    mutex *sync.Mutex
+    conns map[net.Conn]bool
+    waitGroup *sync.WaitGroup
+    finish chan bool
+}
+
+func (s *streamServer) isFinished() (bool) {
+    select {
+    case <-s.finish:
+        return true
+    default:
+        return false
+    }
+}
+
+func (s *streamServer) track(conn net.Conn) (bool) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    if s.isFinished() {
+        return false
+    }
+    s.conns[conn] = true
+    s.waitGroup.Add(1)
+    return true
+}
+
+func (s *streamServer) untrack(conn net.Conn) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    delete(s.conns, conn)
+    conn.Close()
+    s.waitGroup.Done()
+}
+
+func (s *streamServer) serve() {
+    defer s.waitGroup.Done()
+    for {
+        conn, err := s.listen.Accept()
+        if err != nil {
+            if s.isFinished() {
+                return
+            }
+            log.Printf("can not accept (%v): %v", s.listen.Addr(), err)
+            time.Sleep(acceptRetryInterval)
+            continue
+        }
+        if !s.track(conn) {
+            conn.Close()
+            return
+        }
+        go func() {
+            defer s.untrack(conn)
+            s.handle(conn)
+        }()
+    }
+}
+
+func (s *streamServer) start() {
+    s.waitGroup.Add(1)
+    go s.serve()
+}
+
+func (s *streamServer) stop() {
+    s.mutex.Lock()
+    close(s.finish)
+    s.listen.Close()
+    for conn := range s.conns {
+        conn.Close()
+    }
+    s.mutex.Unlock()
+    s.waitGroup.Wait()
+}
+
+func (s *streamServer) close() {
+    s.listen.Close()
+}
+
+func newStreamServer(listen net.Listener, handle func(conn net.Conn)) (*streamServer) {
+    return &streamServer{
+        listen: listen,
+        handle: handle,
+        mutex: new(sync.Mutex),
+        conns: make(map[net.Conn]bool),
+        waitGroup: new(sync.WaitGroup),
+        finish: make(chan bool),
+    }
+}
+
+func newListener(config *configurator.ListenerConfig, transfer transferFunc) (listener, error) {
+    label := config.Label
+    if label == "" {
+        label = config.Type
+    }
+    maxMessageSize := defaultListenerMaxMessageSize
+    if config.MaxMessageSize > 0 {
+        maxMessageSize = config.MaxMessageSize
+    }
+    switch config.Type {
+    case listenerTypeSyslogUDP:
+        conn, err := net.ListenPacket("udp", config.AddrPort)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not listen addr port (%v)", config.AddrPort)
+        }
+        return newSyslogUDPListener(conn, transfer, label, config.Path, int(maxMessageSize)), nil
+    case listenerTypeSyslogTCP:
+        listen, err := net.Listen("tcp", config.AddrPort)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not listen addr port (%v)", config.AddrPort)
+        }
+        return newSyslogTCPListener(listen, transfer, label, config.Path, int(maxMessageSize)), nil
+    case listenerTypeTCP:
+        listen, err := net.Listen("tcp", config.AddrPort)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not listen addr port (%v)", config.AddrPort)
+        }
+        return newTCPListener(listen, transfer, label, config.Path, int(maxMessageSize)), nil
+    case listenerTypeHTTP:
+        listen, err := net.Listen("tcp", config.AddrPort)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not listen addr port (%v)", config.AddrPort)
+        }
+        return newHTTPListener(listen, transfer, label, config.Path, maxMessageSize), nil
+    default:
+        return nil, errors.Errorf("unexpected listener type (%v)", config.Type)
+    }
+}
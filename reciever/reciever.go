@@ -2,20 +2,39 @@ package reciever
 
 import (
     "net"
+    "log"
+    "time"
+    "strings"
     "context"
     "github.com/pkg/errors"
     "google.golang.org/grpc"
     "google.golang.org/grpc/peer"
     "github.com/potix/log_monitor/configurator"
     "github.com/potix/log_monitor/logstore"
+    "github.com/potix/log_monitor/logmatcher"
+    "github.com/potix/log_monitor/relay"
     logpb "github.com/potix/log_monitor/logpb"
 )
 
+const (
+    defaultQueryAddrPort string = "127.0.0.1:50010"
+)
+
 // Reciever is reciever
 type Reciever struct {
-    logstore *logstore.LogStore
+    logstore logstore.Store
+    query *logstore.Query
+    subscriptionHub *subscriptionHub
+    logMatcher *logmatcher.LogMatcher
+    relay *relay.Relay
+    limiter *limiter
+    listeners []listener
+    trustedRelays []*net.IPNet
     listen net.Listener
     server *grpc.Server
+    // query server is separated from transfer server so that it is not exposed with ingest port
+    queryListen net.Listener
+    queryServer *grpc.Server
     config *configurator.LogRecieverConfig
 }
 
@@ -31,50 +50,305 @@ func (r *Reciever) getRemoteAddr(ctx context.Context) (string) {
     return tcpAddr.IP.String()
 }
 
+// getOriginAddr is address of original sender if request is forwarded by trusted relay
+func (r *Reciever) getOriginAddr(ctx context.Context, addr string) (string) {
+    ip := net.ParseIP(addr)
+    if ip == nil {
+        return addr
+    }
+    for _, trustedRelay := range r.trustedRelays {
+        if !trustedRelay.Contains(ip) {
+            continue
+        }
+        originAddr := relay.IncomingOriginAddr(ctx)
+        if originAddr != "" {
+            return originAddr
+        }
+        return addr
+    }
+    return addr
+}
+
+func parseTrustedRelays(trustedRelays []string) ([]*net.IPNet, error) {
+    ipNets := make([]*net.IPNet, 0, len(trustedRelays))
+    for _, trustedRelay := range trustedRelays {
+        if !strings.Contains(trustedRelay, "/") {
+            if strings.Contains(trustedRelay, ":") {
+                trustedRelay += "/128"
+            } else {
+                trustedRelay += "/32"
+            }
+        }
+        _, ipNet, err := net.ParseCIDR(trustedRelay)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not parse trusted relay (%v)", trustedRelay)
+        }
+        ipNets = append(ipNets, ipNet)
+    }
+    return ipNets, nil
+}
+
 // Transfer is transfer
 func (r *Reciever) Transfer(ctx context.Context, request *logpb.TransferRequest) (*logpb.TransferReply, error) {
-     addr := r.getRemoteAddr(ctx)
+     addr := r.getOriginAddr(ctx, r.getRemoteAddr(ctx))
+     hops := relay.IncomingHops(ctx)
+     return r.transfer(ctx, addr, hops, request)
+}
+
+// transfer is save, publish, match and forward logs, it is shared by grpc and listeners
+func (r *Reciever) transfer(ctx context.Context, addr string, hops []string, request *logpb.TransferRequest) (*logpb.TransferReply, error) {
+     if r.relay != nil {
+        err := r.relay.CheckLoop(hops)
+        if err != nil {
+            log.Printf("rejected log (%v, %v, %v, %v): %v", request.Label, request.Host, addr, request.Path, err)
+            return &logpb.TransferReply{
+                Success: false,
+                Msg: "rejected: " + err.Error(),
+            }, nil
+        }
+     }
+     if r.limiter != nil {
+        retryAfter, reason, err := r.limiter.allow(request, time.Now())
+        if err != nil {
+            log.Printf("rejected log (%v, %v, %v, %v): %v", request.Label, request.Host, addr, request.Path, err)
+            return &logpb.TransferReply{
+                Success: false,
+                Msg: "rejected: " + err.Error(),
+            }, nil
+        }
+        if retryAfter > 0 {
+            // limited request is not server error, sender waits retry_after seconds and sends it again
+            log.Printf("limited log (%v, %v, %v, %v): %v, retry after %v seconds", request.Label, request.Host, addr, request.Path, reason, retryAfter)
+            return &logpb.TransferReply{
+                Success: false,
+                Msg: "limited: " + reason,
+                RetryAfter: retryAfter,
+            }, nil
+        }
+     }
+     if r.relay != nil {
+        // room of spool is checked before saving, forward still fails if concurrent requests fill spool
+        retryAfter, err := r.relay.CheckSpool(request)
+        if err != nil {
+            log.Printf("rejected log (%v, %v, %v, %v): %v", request.Label, request.Host, addr, request.Path, err)
+            return &logpb.TransferReply{
+                Success: false,
+                Msg: "rejected: " + err.Error(),
+            }, nil
+        }
+        if retryAfter > 0 {
+            log.Printf("limited log (%v, %v, %v, %v): spool is full, retry after %v seconds", request.Label, request.Host, addr, request.Path, retryAfter)
+            return &logpb.TransferReply{
+                Success: false,
+                Msg: "limited: spool is full",
+                RetryAfter: retryAfter,
+            }, nil
+        }
+     }
      err := r.logstore.Save(ctx, addr, request)
+     if err != nil && logstore.IsPathError(err) {
+        // rejected request is not server error, reply it to sender
+        log.Printf("rejected log (%v, %v, %v, %v): %v", request.Label, request.Host, addr, request.Path, err)
+        return &logpb.TransferReply{
+            Success: false,
+            Msg: "rejected: " + err.Error(),
+        }, nil
+     }
      if err != nil {
         return &logpb.TransferReply{
             Success: false,
             Msg: err.Error(),
         }, errors.Wrapf(err, "can not save log (%v, %v, %v, %v)", request.Label, request.Host, addr, request.Path)
      }
+     if r.subscriptionHub != nil {
+        r.subscriptionHub.publish(addr, request)
+     }
+     if r.logMatcher != nil {
+        r.logMatcher.Match(request)
+     }
+     if r.relay != nil {
+        err := r.relay.Forward(addr, hops, request)
+        if err != nil {
+            // sender retries, stores that succeeded may have duplicates
+            return &logpb.TransferReply{
+                Success: false,
+                Msg: err.Error(),
+            }, errors.Wrapf(err, "can not forward log (%v, %v, %v, %v)", request.Label, request.Host, addr, request.Path)
+        }
+     }
      return &logpb.TransferReply{
           Success: true,
           Msg: "OK",
      }, nil
 }
 
-// Start is start
+// Start is start, server runs in background so that Stop can flush log store
 func (r *Reciever) Start() (error) {
-    err := r.server.Serve(r.listen)
-    if err != nil { 
-        return errors.Wrap(err, "can not start server")
+    if r.logMatcher != nil {
+        err := r.logMatcher.Start()
+        if err != nil {
+            return errors.Wrap(err, "can not start log matcher")
+        }
+    }
+    if r.relay != nil {
+        err := r.relay.Start()
+        if err != nil {
+            return errors.Wrap(err, "can not start relay")
+        }
+    }
+    r.logstore.Start()
+    go func() {
+        err := r.server.Serve(r.listen)
+        if err != nil {
+            log.Printf("can not serve: %v", err)
+        }
+    }()
+    if r.queryServer != nil {
+        go func() {
+            err := r.queryServer.Serve(r.queryListen)
+            if err != nil {
+                log.Printf("can not serve query: %v", err)
+            }
+        }()
+    }
+    for _, listener := range r.listeners {
+        listener.start()
     }
     return nil
 }
 
 // Stop is stop
 func (r *Reciever) Stop() {
+     // following tails and subscriptions block graceful stop
+     if r.query != nil {
+        r.query.Stop()
+     }
+     if r.subscriptionHub != nil {
+        r.subscriptionHub.stop()
+     }
+     if r.queryServer != nil {
+        r.queryServer.GracefulStop()
+     }
      r.server.GracefulStop()
+     for _, listener := range r.listeners {
+        listener.stop()
+     }
+     if r.relay != nil {
+        r.relay.Stop()
+     }
+     r.logstore.Stop()
+     if r.logMatcher != nil {
+        r.logMatcher.Stop()
+     }
 }
 
 // NewReciever is create new reciver
-func NewReciever(config *configurator.LogRecieverConfig) (*Reciever, error){
+func NewReciever(config *configurator.LogRecieverConfig) (reciever *Reciever, err error){
     listen, err := net.Listen("tcp", config.AddrPort)
     if err != nil {
         return nil, errors.Wrapf(err, "can not listen addr port (%v)", config.AddrPort)
     }
-    server := grpc.NewServer()
-    reciever := &Reciever{
-        logstore: logstore.NewLogStore(config),
+    var queryListen net.Listener
+    listeners := make([]listener, 0, len(config.Listeners))
+    defer func() {
+        if err == nil {
+            return
+        }
+        // sockets opened so far are closed on error
+        listen.Close()
+        if queryListen != nil {
+            queryListen.Close()
+        }
+        for _, listener := range listeners {
+            listener.close()
+        }
+    }()
+    var query *logstore.Query
+    if config.EnableQuery {
+        query, err = logstore.NewQuery(config)
+        if err != nil {
+            return nil, errors.Wrap(err, "can not create query")
+        }
+    }
+    if config.EnableQuery || config.EnableSubscribe {
+        queryAddrPort := defaultQueryAddrPort
+        if config.QueryAddrPort != "" {
+            queryAddrPort = config.QueryAddrPort
+        }
+        queryListen, err = net.Listen("tcp", queryAddrPort)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not listen query addr port (%v)", queryAddrPort)
+        }
+    }
+    var logMatcher *logmatcher.LogMatcher
+    if len(config.Matchers) > 0 {
+        logMatcher, err = logmatcher.NewLogMatcher(config)
+        if err != nil {
+            return nil, errors.Wrap(err, "can not create log matcher")
+        }
+    }
+    var logRelay *relay.Relay
+    if config.Relay != nil {
+        logRelay, err = relay.NewRelay(config)
+        if err != nil {
+            return nil, errors.Wrap(err, "can not create relay")
+        }
+    }
+    var logLimiter *limiter
+    if len(config.RateLimits) > 0 {
+        logLimiter, err = newLimiter(config.RateLimits)
+        if err != nil {
+            return nil, errors.Wrap(err, "can not create limiter")
+        }
+    }
+    trustedRelays, err := parseTrustedRelays(config.TrustedRelays)
+    if err != nil {
+        return nil, errors.Wrap(err, "invalid trusted relays")
+    }
+    logstore, err := logstore.NewStore(config)
+    if err != nil {
+        return nil, errors.Wrap(err, "can not create log store")
+    }
+    serverOptions := make([]grpc.ServerOption, 0, 1)
+    if config.MaxMessageSize > 0 {
+        serverOptions = append(serverOptions, grpc.MaxRecvMsgSize(int(config.MaxMessageSize)))
+    }
+    server := grpc.NewServer(serverOptions...)
+    var queryServer *grpc.Server
+    if queryListen != nil {
+        queryServer = grpc.NewServer()
+    }
+    reciever = &Reciever{
+        logstore: logstore,
+        query: query,
+        subscriptionHub: nil,
+        logMatcher: logMatcher,
+        relay: logRelay,
+        limiter: logLimiter,
+        listeners: nil,
+        trustedRelays: trustedRelays,
         listen: listen,
         server: server,
+        queryListen: queryListen,
+        queryServer: queryServer,
         config: config,
     }
     logpb.RegisterLogServer(server, reciever)
+    if query != nil {
+        logpb.RegisterQueryServer(queryServer, query)
+    }
+    if config.EnableSubscribe {
+        reciever.subscriptionHub = newSubscriptionHub(config.SubscribeBufferSize, config.MaxSubscribers)
+        logpb.RegisterSubscriptionServer(queryServer, reciever.subscriptionHub)
+    }
+    for _, listenerConfig := range config.Listeners {
+        listener, err := newListener(listenerConfig, reciever.transfer)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not create listener (%v, %v)", listenerConfig.Type, listenerConfig.AddrPort)
+        }
+        listeners = append(listeners, listener)
+    }
+    reciever.listeners = listeners
 
     return reciever, nil
 }
@@ -0,0 +1,98 @@
+package reciever
+
+import (
+    "context"
+    "testing"
+    "google.golang.org/grpc/metadata"
+    "github.com/potix/log_monitor/configurator"
+    "github.com/potix/log_monitor/relay"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+type testStore struct {
+    saved []*logpb.TransferRequest
+}
+
+func (s *testStore) Start() {
+}
+
+func (s *testStore) Stop() {
+}
+
+func (s *testStore) Save(ctx context.Context, addr string, request *logpb.TransferRequest) (error) {
+    s.saved = append(s.saved, request)
+    return nil
+}
+
+func TestOriginAddr(t *testing.T) {
+    trustedRelays, err := parseTrustedRelays([]string{ "10.0.0.0/8", "192.168.1.1", "fd00::1" })
+    if err != nil {
+        t.Fatalf("can not parse trusted relays: %v", err)
+    }
+    r := &Reciever{ trustedRelays: trustedRelays }
+    forwarded := metadata.NewIncomingContext(context.Background(), metadata.Pairs(relay.OriginAddrKey, "172.16.0.1"))
+    tests := []struct {
+        name string
+        ctx context.Context
+        addr string
+        expected string
+    }{
+        { "trusted cidr", forwarded, "10.1.2.3", "172.16.0.1" },
+        { "trusted ip", forwarded, "192.168.1.1", "172.16.0.1" },
+        { "trusted ipv6", forwarded, "fd00::1", "172.16.0.1" },
+        { "not trusted", forwarded, "192.168.1.2", "192.168.1.2" },
+        { "not forwarded", context.Background(), "10.1.2.3", "10.1.2.3" },
+        { "not ip", forwarded, "NoPeer", "NoPeer" },
+    }
+    for _, test := range tests {
+        if addr := r.getOriginAddr(test.ctx, test.addr); addr != test.expected {
+            t.Errorf("%v: unexpected addr (%v, %v)", test.name, addr, test.expected)
+        }
+    }
+    _, err = parseTrustedRelays([]string{ "10.0.0.0/33" })
+    if err == nil {
+        t.Errorf("invalid trusted relay is accepted")
+    }
+}
+
+func TestTransferWhenSpoolIsFull(t *testing.T) {
+    rl, err := relay.NewRelay(&configurator.LogRecieverConfig{
+        AddrPort: "127.0.0.1:50000",
+        Relay: &configurator.RelayConfig{
+            Upstream: "127.0.0.1:50001",
+            RelayID: "relay1",
+            SpoolDir: t.TempDir(),
+            MaxSpoolSize: 10,
+        },
+    })
+    if err != nil {
+        t.Fatalf("can not create relay: %v", err)
+    }
+    store := &testStore{}
+    r := &Reciever{ logstore: store, relay: rl }
+    tests := []struct {
+        name string
+        logData string
+        success bool
+        msg string
+        retryAfter int64
+        saved int
+    }{
+        { "room", "12345678", true, "OK", 0, 1 },
+        { "full", "123", false, "limited: spool is full", 10, 1 },
+        { "larger than spool", "12345678901", false, "rejected: larger than max spool size (10)", 0, 1 },
+    }
+    for _, test := range tests {
+        reply, err := r.transfer(context.Background(), "127.0.0.1", nil, newTransferRequest("app", "web1", "/var/log/app.log", test.logData))
+        if err != nil {
+            t.Fatalf("%v: unexpected error (%v)", test.name, err)
+        }
+        if reply.Success != test.success || reply.Msg != test.msg || reply.RetryAfter != test.retryAfter {
+            t.Errorf("%v: unexpected reply (%+v)", test.name, reply)
+        }
+        // request that is not spooled is not saved, so it is not saved twice at retry
+        if len(store.saved) != test.saved {
+            t.Errorf("%v: unexpected saved requests (%v, %v)", test.name, len(store.saved), test.saved)
+        }
+    }
+}
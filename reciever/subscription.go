@@ -0,0 +1,168 @@
+package reciever
+
+import (
+    "log"
+    "path"
+    "sync"
+    "bytes"
+    "regexp"
+    "sync/atomic"
+    "github.com/pkg/errors"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+const (
+    defaultSubscribeBufferSize int64 = 1024
+    defaultMaxSubscribers int64 = 64
+)
+
+// subscriber is subscriber of incoming logs, messages are dropped when buffer is full
+type subscriber struct {
+    // dropped is first for 64 bit alignment of atomic operations
+    dropped int64
+    request *logpb.SubscribeRequest
+    pattern *regexp.Regexp
+    replyChan chan *logpb.SubscribeReply
+}
+
+// subscriptionHub is fan out incoming logs to subscribers
+type subscriptionHub struct {
+    bufferSize int64
+    maxSubscribers int64
+    mutex *sync.RWMutex
+    subscribers map[*subscriber]bool
+    finish chan bool
+}
+
+func globMatch(pattern string, value string) (bool) {
+    if pattern == "" {
+        return true
+    }
+    matched, err := path.Match(pattern, value)
+    return err == nil && matched
+}
+
+// filter is return matched lines of log data, it returns nil if nothing matches
+func (s *subscriber) filter(request *logpb.TransferRequest) ([]byte) {
+    if !globMatch(s.request.Label, request.Label) || !globMatch(s.request.Host, request.Host) || !globMatch(s.request.Path, request.Path) {
+        return nil
+    }
+    if s.pattern == nil {
+        return request.LogData
+    }
+    matched := new(bytes.Buffer)
+    for _, line := range bytes.SplitAfter(request.LogData, []byte("\n")) {
+        if len(line) > 0 && s.pattern.Match(line) {
+            matched.Write(line)
+        }
+    }
+    if matched.Len() == 0 {
+        return nil
+    }
+    return matched.Bytes()
+}
+
+func (h *subscriptionHub) publish(addr string, request *logpb.TransferRequest) {
+    h.mutex.RLock()
+    defer h.mutex.RUnlock()
+    for s := range h.subscribers {
+        logData := s.filter(request)
+        if logData == nil {
+            continue
+        }
+        reply := &logpb.SubscribeReply{
+            Label: request.Label,
+            Host: request.Host,
+            Addr: addr,
+            Path: request.Path,
+            LogData: logData,
+        }
+        select {
+        case s.replyChan <- reply:
+        default:
+            atomic.AddInt64(&s.dropped, 1)
+        }
+    }
+}
+
+func (h *subscriptionHub) subscribe(request *logpb.SubscribeRequest) (*subscriber, error) {
+    var pattern *regexp.Regexp
+    if request.Pattern != "" {
+        var err error
+        pattern, err = regexp.Compile(request.Pattern)
+        if err != nil {
+            return nil, errors.Wrapf(err, "can not compile pattern (%v)", request.Pattern)
+        }
+    }
+    bufferSize := h.bufferSize
+    if request.BufferSize > 0 && request.BufferSize < bufferSize {
+        bufferSize = request.BufferSize
+    }
+    s := &subscriber{
+        dropped: 0,
+        request: request,
+        pattern: pattern,
+        replyChan: make(chan *logpb.SubscribeReply, bufferSize),
+    }
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+    if int64(len(h.subscribers)) >= h.maxSubscribers {
+        return nil, errors.Errorf("too many subscribers (%v)", len(h.subscribers))
+    }
+    h.subscribers[s] = true
+    return s, nil
+}
+
+func (h *subscriptionHub) unsubscribe(s *subscriber) {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+    delete(h.subscribers, s)
+}
+
+// Subscribe is send incoming logs that match request until client cancels
+func (h *subscriptionHub) Subscribe(request *logpb.SubscribeRequest, stream logpb.Subscription_SubscribeServer) (error) {
+    s, err := h.subscribe(request)
+    if err != nil {
+        return err
+    }
+    defer h.unsubscribe(s)
+    for {
+        select {
+        case <-h.finish:
+            return nil
+        case <-stream.Context().Done():
+            dropped := atomic.LoadInt64(&s.dropped)
+            if dropped > 0 {
+                log.Printf("subscriber dropped messages (%v, %v, %v, %v): %v", request.Label, request.Host, request.Path, request.Pattern, dropped)
+            }
+            return nil
+        case reply := <-s.replyChan:
+            reply.Dropped = atomic.LoadInt64(&s.dropped)
+            err := stream.Send(reply)
+            if err != nil {
+                return errors.Wrap(err, "can not send subscribe reply")
+            }
+        }
+    }
+}
+
+// stop is stop subscriptions, grpc server can not stop gracefully while they are running
+func (h *subscriptionHub) stop() {
+    close(h.finish)
+}
+
+func newSubscriptionHub(bufferSize int64, maxSubscribers int64) (*subscriptionHub) {
+    if bufferSize <= 0 {
+        bufferSize = defaultSubscribeBufferSize
+    }
+    if maxSubscribers <= 0 {
+        maxSubscribers = defaultMaxSubscribers
+    }
+    return &subscriptionHub{
+        bufferSize: bufferSize,
+        maxSubscribers: maxSubscribers,
+        mutex: new(sync.RWMutex),
+        subscribers: make(map[*subscriber]bool),
+        finish: make(chan bool),
+    }
+}
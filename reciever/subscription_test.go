@@ -0,0 +1,182 @@
+package reciever
+
+import (
+    "time"
+    "context"
+    "testing"
+    "google.golang.org/grpc"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+func newTransferRequest(label string, host string, filePath string, logData string) (*logpb.TransferRequest) {
+    return &logpb.TransferRequest{
+        Label: label,
+        Host: host,
+        Path: filePath,
+        LogData: []byte(logData),
+    }
+}
+
+func TestSubscriberFilter(t *testing.T) {
+    request := newTransferRequest("app", "web1", "/var/log/app.log", "INFO start\nERROR disk full\nINFO stop\nERROR again")
+    tests := []struct {
+        name string
+        subscribe *logpb.SubscribeRequest
+        expected string
+        matched bool
+    }{
+        { "no filter", &logpb.SubscribeRequest{}, string(request.LogData), true },
+        { "label", &logpb.SubscribeRequest{ Label: "app" }, string(request.LogData), true },
+        { "other label", &logpb.SubscribeRequest{ Label: "db" }, "", false },
+        { "host glob", &logpb.SubscribeRequest{ Host: "web*" }, string(request.LogData), true },
+        { "other host glob", &logpb.SubscribeRequest{ Host: "db?" }, "", false },
+        { "path glob", &logpb.SubscribeRequest{ Path: "/var/log/*.log" }, string(request.LogData), true },
+        { "glob does not cross slash", &logpb.SubscribeRequest{ Path: "/var/*.log" }, "", false },
+        { "invalid glob", &logpb.SubscribeRequest{ Label: "[" }, "", false },
+        { "matched lines", &logpb.SubscribeRequest{ Pattern: "^ERROR" }, "ERROR disk full\nERROR again", true },
+        { "regexp", &logpb.SubscribeRequest{ Pattern: "st(art|op)" }, "INFO start\nINFO stop\n", true },
+        { "no line matches", &logpb.SubscribeRequest{ Pattern: "WARN" }, "", false },
+        { "pattern and glob", &logpb.SubscribeRequest{ Label: "a*", Pattern: "disk" }, "ERROR disk full\n", true },
+    }
+    for _, test := range tests {
+        hub := newSubscriptionHub(0, 0)
+        s, err := hub.subscribe(test.subscribe)
+        if err != nil {
+            t.Fatalf("%v: can not subscribe: %v", test.name, err)
+        }
+        logData := s.filter(request)
+        if (logData != nil) != test.matched || string(logData) != test.expected {
+            t.Errorf("%v: unexpected filtered data (%q, %q)", test.name, logData, test.expected)
+        }
+    }
+}
+
+func TestInvalidPattern(t *testing.T) {
+    hub := newSubscriptionHub(0, 0)
+    _, err := hub.subscribe(&logpb.SubscribeRequest{ Pattern: "(" })
+    if err == nil {
+        t.Errorf("invalid pattern is accepted")
+    }
+    if len(hub.subscribers) != 0 {
+        t.Errorf("subscriber of invalid pattern is added (%v)", len(hub.subscribers))
+    }
+}
+
+func TestPublishDropsWhenBufferIsFull(t *testing.T) {
+    hub := newSubscriptionHub(4, 0)
+    small, err := hub.subscribe(&logpb.SubscribeRequest{ BufferSize: 2 })
+    if err != nil {
+        t.Fatalf("can not subscribe: %v", err)
+    }
+    // buffer size larger than hub's one is limited
+    large, err := hub.subscribe(&logpb.SubscribeRequest{ BufferSize: 100 })
+    if err != nil {
+        t.Fatalf("can not subscribe: %v", err)
+    }
+    other, err := hub.subscribe(&logpb.SubscribeRequest{ Label: "db" })
+    if err != nil {
+        t.Fatalf("can not subscribe: %v", err)
+    }
+    for i := 0; i < 5; i++ {
+        hub.publish("127.0.0.1", newTransferRequest("app", "web1", "/var/log/app.log", "line\n"))
+    }
+    tests := []struct {
+        name string
+        s *subscriber
+        buffered int
+        dropped int64
+    }{
+        { "small", small, 2, 3 },
+        { "large", large, 4, 1 },
+        { "not matched", other, 0, 0 },
+    }
+    for _, test := range tests {
+        if len(test.s.replyChan) != test.buffered || test.s.dropped != test.dropped {
+            t.Errorf("%v: unexpected buffered and dropped (%v, %v)", test.name, len(test.s.replyChan), test.s.dropped)
+        }
+    }
+    reply := <-small.replyChan
+    if reply.Addr != "127.0.0.1" || reply.Label != "app" || reply.Host != "web1" || reply.Path != "/var/log/app.log" || string(reply.LogData) != "line\n" {
+        t.Errorf("unexpected reply (%+v)", reply)
+    }
+}
+
+func TestMaxSubscribers(t *testing.T) {
+    hub := newSubscriptionHub(0, 2)
+    first, err := hub.subscribe(&logpb.SubscribeRequest{})
+    if err != nil {
+        t.Fatalf("can not subscribe: %v", err)
+    }
+    _, err = hub.subscribe(&logpb.SubscribeRequest{})
+    if err != nil {
+        t.Fatalf("can not subscribe: %v", err)
+    }
+    _, err = hub.subscribe(&logpb.SubscribeRequest{})
+    if err == nil {
+        t.Fatalf("subscriber over max subscribers is accepted")
+    }
+    hub.unsubscribe(first)
+    _, err = hub.subscribe(&logpb.SubscribeRequest{})
+    if err != nil {
+        t.Errorf("can not subscribe after unsubscribe: %v", err)
+    }
+}
+
+type testSubscribeStream struct {
+    grpc.ServerStream
+    ctx context.Context
+    replies chan *logpb.SubscribeReply
+}
+
+func (s *testSubscribeStream) Context() (context.Context) {
+    return s.ctx
+}
+
+func (s *testSubscribeStream) Send(reply *logpb.SubscribeReply) (error) {
+    s.replies <- reply
+    return nil
+}
+
+func TestSubscribeStream(t *testing.T) {
+    hub := newSubscriptionHub(0, 0)
+    ctx, cancel := context.WithCancel(context.Background())
+    stream := &testSubscribeStream{ ctx: ctx, replies: make(chan *logpb.SubscribeReply, 10) }
+    done := make(chan error)
+    go func() {
+        done <- hub.Subscribe(&logpb.SubscribeRequest{ Pattern: "ERROR" }, stream)
+    }()
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        hub.mutex.RLock()
+        subscribers := len(hub.subscribers)
+        hub.mutex.RUnlock()
+        if subscribers == 1 {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("subscriber is not added")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+    hub.publish("127.0.0.1", newTransferRequest("app", "web1", "/var/log/app.log", "INFO ok\nERROR ng\n"))
+    select {
+    case reply := <-stream.replies:
+        if string(reply.LogData) != "ERROR ng\n" || reply.Dropped != 0 {
+            t.Errorf("unexpected reply (%q, %v)", reply.LogData, reply.Dropped)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatalf("no reply")
+    }
+    cancel()
+    select {
+    case err := <-done:
+        if err != nil {
+            t.Errorf("unexpected error (%v)", err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatalf("subscribe does not return at cancel")
+    }
+    if len(hub.subscribers) != 0 {
+        t.Errorf("subscriber is not removed (%v)", len(hub.subscribers))
+    }
+}
@@ -0,0 +1,265 @@
+package reciever
+
+import (
+    "io"
+    "log"
+    "net"
+    "time"
+    "bufio"
+    "bytes"
+    "strings"
+    "context"
+    "github.com/pkg/errors"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+const (
+    defaultSyslogPath string = "/syslog"
+    maxDatagramSize int = 65536
+    maxLengthDigits int = 10
+)
+
+// syslogHeader is fields of syslog header that are mapped to host and path
+type syslogHeader struct {
+    hostname string
+    appName string
+}
+
+func nilValue(value string) (string) {
+    if value == "-" {
+        return ""
+    }
+    return value
+}
+
+// parseSyslog is parse header of RFC5424 or RFC3164, fields are empty if they are not found
+func parseSyslog(message string) (*syslogHeader) {
+    header := &syslogHeader{
+        hostname: "",
+        appName: "",
+    }
+    if !strings.HasPrefix(message, "<") {
+        return header
+    }
+    end := strings.IndexByte(message, '>')
+    if end < 2 || end > 4 {
+        return header
+    }
+    message = message[end + 1:]
+    if strings.HasPrefix(message, "1 ") {
+        // VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+        fields := strings.SplitN(message, " ", 5)
+        if len(fields) >= 4 {
+            header.hostname = nilValue(fields[2])
+            header.appName = nilValue(fields[3])
+        }
+        return header
+    }
+    // TIMESTAMP HOSTNAME TAG: MSG, timestamp and hostname are often omitted
+    hasTimestamp := false
+    if len(message) > len(time.Stamp) {
+        _, err := time.Parse(time.Stamp, message[:len(time.Stamp)])
+        if err == nil {
+            message = strings.TrimLeft(message[len(time.Stamp):], " ")
+            hasTimestamp = true
+        }
+    }
+    fields := strings.Fields(message)
+    if !hasTimestamp && len(fields) > 0 {
+        _, err := time.Parse(time.RFC3339, fields[0])
+        if err == nil {
+            fields = fields[1:]
+            hasTimestamp = true
+        }
+    }
+    if len(fields) == 0 {
+        return header
+    }
+    if hasTimestamp && len(fields) > 1 && !strings.ContainsAny(fields[0], "[:") {
+        header.hostname = fields[0]
+        fields = fields[1:]
+    }
+    tag := fields[0]
+    if i := strings.IndexAny(tag, "[:"); i >= 0 {
+        tag = tag[:i]
+    }
+    header.appName = tag
+    return header
+}
+
+// syslogRequest is map syslog message to request, host is hostname of message and path is app name of message
+func syslogRequest(label string, path string, addr string, message []byte) (*logpb.TransferRequest) {
+    message = bytes.TrimRight(message, "\r\n\x00")
+    if len(message) == 0 {
+        return nil
+    }
+    header := parseSyslog(string(message))
+    host := header.hostname
+    if host == "" {
+        host = addr
+    }
+    if path == "" {
+        path = defaultSyslogPath
+        if header.appName != "" {
+            path = "/" + header.appName
+        }
+    }
+    logData := make([]byte, 0, len(message) + 1)
+    logData = append(logData, message...)
+    logData = append(logData, '\n')
+    return &logpb.TransferRequest{
+        Label: label,
+        Host: host,
+        Path: path,
+        LogData: logData,
+    }
+}
+
+// syslogUDPListener is listener of syslog over udp, limited messages are dropped
+type syslogUDPListener struct {
+    conn net.PacketConn
+    transfer transferFunc
+    label string
+    path string
+    maxMessageSize int
+    finish chan bool
+    finished chan bool
+}
+
+func (s *syslogUDPListener) serve() {
+    defer close(s.finished)
+    buffer := make([]byte, maxDatagramSize)
+    for {
+        n, remoteAddr, err := s.conn.ReadFrom(buffer)
+        if err != nil {
+            select {
+            case <-s.finish:
+                return
+            default:
+            }
+            log.Printf("can not read syslog (%v): %v", s.conn.LocalAddr(), err)
+            time.Sleep(acceptRetryInterval)
+            continue
+        }
+        if n > s.maxMessageSize {
+            n = s.maxMessageSize
+        }
+        addr := peerAddr(remoteAddr)
+        request := syslogRequest(s.label, s.path, addr, buffer[:n])
+        if request == nil {
+            continue
+        }
+        // limited and rejected messages are logged by transfer
+        _, err = s.transfer(context.Background(), addr, nil, request)
+        if err != nil {
+            log.Printf("can not transfer log: %v", err)
+        }
+    }
+}
+
+func (s *syslogUDPListener) start() {
+    go s.serve()
+}
+
+func (s *syslogUDPListener) stop() {
+    close(s.finish)
+    s.conn.Close()
+    <-s.finished
+}
+
+func (s *syslogUDPListener) close() {
+    s.conn.Close()
+}
+
+func newSyslogUDPListener(conn net.PacketConn, transfer transferFunc, label string, path string, maxMessageSize int) (*syslogUDPListener) {
+    return &syslogUDPListener{
+        conn: conn,
+        transfer: transfer,
+        label: label,
+        path: path,
+        maxMessageSize: maxMessageSize,
+        finish: make(chan bool),
+        finished: make(chan bool),
+    }
+}
+
+// readSyslogMessage is read a message that is framed by octet counting or newline (RFC6587)
+// too long message is truncated
+func readSyslogMessage(reader *bufio.Reader, maxMessageSize int) ([]byte, error) {
+    first, err := reader.Peek(1)
+    if err != nil {
+        return nil, err
+    }
+    if first[0] >= '1' && first[0] <= '9' {
+        length := 0
+        for i := 0; ; i++ {
+            c, err := reader.ReadByte()
+            if err != nil {
+                return nil, err
+            }
+            if c == ' ' {
+                break
+            }
+            if c < '0' || c > '9' || i >= maxLengthDigits {
+                return nil, errors.New("invalid octet counting")
+            }
+            length = length * 10 + int(c - '0')
+        }
+        size := length
+        if size > maxMessageSize {
+            size = maxMessageSize
+        }
+        message := make([]byte, size)
+        _, err := io.ReadFull(reader, message)
+        if err != nil {
+            return nil, err
+        }
+        _, err = reader.Discard(length - size)
+        return message, err
+    }
+    line, err := reader.ReadSlice('\n')
+    message := append([]byte(nil), line...)
+    for err == bufio.ErrBufferFull {
+        _, err = reader.ReadSlice('\n')
+    }
+    return message, err
+}
+
+// syslogTCPListener is listener of syslog over tcp
+type syslogTCPListener struct {
+    *streamServer
+    transfer transferFunc
+    label string
+    path string
+    maxMessageSize int
+}
+
+func (s *syslogTCPListener) handleConn(conn net.Conn) {
+    addr := peerAddr(conn.RemoteAddr())
+    reader := bufio.NewReaderSize(conn, s.maxMessageSize)
+    for {
+        message, err := readSyslogMessage(reader, s.maxMessageSize)
+        request := syslogRequest(s.label, s.path, addr, message)
+        if request != nil && !deliver(s.transfer, addr, request, s.finish) {
+            return
+        }
+        if err != nil {
+            if err != io.EOF && !s.isFinished() {
+                log.Printf("can not read syslog (%v, %v): %v", conn.LocalAddr(), addr, err)
+            }
+            return
+        }
+    }
+}
+
+func newSyslogTCPListener(listen net.Listener, transfer transferFunc, label string, path string, maxMessageSize int) (*syslogTCPListener) {
+    s := &syslogTCPListener{
+        streamServer: nil,
+        transfer: transfer,
+        label: label,
+        path: path,
+        maxMessageSize: maxMessageSize,
+    }
+    s.streamServer = newStreamServer(listen, s.handleConn)
+    return s
+}
@@ -0,0 +1,98 @@
+package reciever
+
+import (
+    "io"
+    "bufio"
+    "strings"
+    "testing"
+)
+
+func TestParseSyslog(t *testing.T) {
+    tests := []struct {
+        name string
+        message string
+        hostname string
+        appName string
+    }{
+        { "rfc5424", "<34>1 2026-01-05T10:00:00.000Z web1 app 123 ID47 - disk full", "web1", "app" },
+        { "rfc5424 nil values", "<34>1 2026-01-05T10:00:00.000Z - - - - - disk full", "", "" },
+        { "rfc5424 without message", "<34>1 - web1", "", "" },
+        { "rfc3164", "<13>Jan  5 10:00:00 web1 sshd[123]: disk full", "web1", "sshd" },
+        { "rfc3164 without hostname", "<13>Jan  5 10:00:00 sshd[123]: disk full", "", "sshd" },
+        { "no timestamp", "<13>sshd[123]: disk full", "", "sshd" },
+        { "no timestamp is not hostname", "<13>web1 sshd: disk full", "", "web1" },
+        { "rfc3339 timestamp", "<13>2026-01-05T10:00:00+09:00 web1 app: disk full", "web1", "app" },
+        { "tag with pid", "<13>Jan  5 10:00:00 web1 cron[42] disk full", "web1", "cron" },
+        { "tag with colon", "<13>Jan 15 10:00:00 web1 kernel: disk full", "web1", "kernel" },
+        { "no pri", "Jan  5 10:00:00 web1 sshd: disk full", "", "" },
+        { "empty pri", "<>1 - web1 app - - - disk full", "", "" },
+        { "too long pri", "<1234>1 - web1 app - - - disk full", "", "" },
+        { "unterminated pri", "<13 web1 app: disk full", "", "" },
+        { "only pri", "<13>", "", "" },
+    }
+    for _, test := range tests {
+        header := parseSyslog(test.message)
+        if header.hostname != test.hostname || header.appName != test.appName {
+            t.Errorf("%v: unexpected header (%q, %q)", test.name, header.hostname, header.appName)
+        }
+    }
+}
+
+func TestSyslogRequest(t *testing.T) {
+    tests := []struct {
+        name string
+        path string
+        message string
+        host string
+        expectedPath string
+        logData string
+    }{
+        { "header", "", "<13>Jan  5 10:00:00 web1 sshd[1]: ok\r\n", "web1", "/sshd", "<13>Jan  5 10:00:00 web1 sshd[1]: ok\n" },
+        { "address of peer", "", "<34>1 - - - - - - ok\x00", "10.0.0.1", defaultSyslogPath, "<34>1 - - - - - - ok\n" },
+        { "path of listener", "/fixed", "<13>sshd: ok", "10.0.0.1", "/fixed", "<13>sshd: ok\n" },
+    }
+    for _, test := range tests {
+        request := syslogRequest("syslog", test.path, "10.0.0.1", []byte(test.message))
+        if request.Label != "syslog" || request.Host != test.host || request.Path != test.expectedPath || string(request.LogData) != test.logData {
+            t.Errorf("%v: unexpected request (%+v)", test.name, request)
+        }
+    }
+    if request := syslogRequest("syslog", "", "10.0.0.1", []byte("\r\n")); request != nil {
+        t.Errorf("empty message is transferred (%+v)", request)
+    }
+}
+
+func TestReadSyslogMessage(t *testing.T) {
+    tests := []struct {
+        name string
+        stream string
+        expected []string
+        lastErr bool
+    }{
+        { "newline", "<13>a\n<13>b\n", []string{ "<13>a\n", "<13>b\n" }, false },
+        { "octet counting", "5 <13>a5 <13>b", []string{ "<13>a", "<13>b" }, false },
+        { "truncated", "20 <13>0123456789abcdef<13>b\n", []string{ "<13>0123456789", "<13>b\n" }, false },
+        { "invalid octet counting", "5x<13>a", nil, true },
+        { "too long length", "12345678901 <13>a", nil, true },
+        { "short message", "10 <13>a", nil, true },
+    }
+    for _, test := range tests {
+        reader := bufio.NewReader(strings.NewReader(test.stream))
+        messages := make([]string, 0)
+        var err error
+        for {
+            var message []byte
+            message, err = readSyslogMessage(reader, 14)
+            if err != nil {
+                break
+            }
+            messages = append(messages, string(message))
+        }
+        if strings.Join(messages, "|") != strings.Join(test.expected, "|") {
+            t.Errorf("%v: unexpected messages (%q, %q)", test.name, messages, test.expected)
+        }
+        if (err != io.EOF) != test.lastErr {
+            t.Errorf("%v: unexpected error (%v)", test.name, err)
+        }
+    }
+}
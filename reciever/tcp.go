@@ -0,0 +1,88 @@
+package reciever
+
+import (
+    "io"
+    "log"
+    "net"
+    "bufio"
+    "bytes"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+const (
+    defaultTCPPath string = "/tcp"
+)
+
+// readLines is read buffered complete lines at once so that lines are saved in batch
+// too long line is split, incomplete last line is completed at end of stream
+func readLines(reader *bufio.Reader, maxSize int) ([]byte, error) {
+    data := make([]byte, 0)
+    for {
+        line, err := reader.ReadSlice('\n')
+        data = append(data, line...)
+        if err == bufio.ErrBufferFull {
+            data = append(data, '\n')
+        } else if err != nil {
+            if len(line) > 0 {
+                data = append(data, '\n')
+            }
+            return data, err
+        }
+        if len(data) >= maxSize {
+            return data, nil
+        }
+        buffered, _ := reader.Peek(reader.Buffered())
+        if bytes.IndexByte(buffered, '\n') < 0 {
+            return data, nil
+        }
+    }
+}
+
+// tcpListener is listener of newline delimited logs over tcp, host is address of peer
+type tcpListener struct {
+    *streamServer
+    transfer transferFunc
+    label string
+    path string
+    maxMessageSize int
+}
+
+func (t *tcpListener) handleConn(conn net.Conn) {
+    addr := peerAddr(conn.RemoteAddr())
+    reader := bufio.NewReaderSize(conn, t.maxMessageSize)
+    for {
+        data, err := readLines(reader, maxBatchSize)
+        if len(data) > 0 {
+            request := &logpb.TransferRequest{
+                Label: t.label,
+                Host: addr,
+                Path: t.path,
+                LogData: data,
+            }
+            if !deliver(t.transfer, addr, request, t.finish) {
+                return
+            }
+        }
+        if err != nil {
+            if err != io.EOF && !t.isFinished() {
+                log.Printf("can not read logs (%v, %v): %v", conn.LocalAddr(), addr, err)
+            }
+            return
+        }
+    }
+}
+
+func newTCPListener(listen net.Listener, transfer transferFunc, label string, path string, maxMessageSize int) (*tcpListener) {
+    if path == "" {
+        path = defaultTCPPath
+    }
+    t := &tcpListener{
+        streamServer: nil,
+        transfer: transfer,
+        label: label,
+        path: path,
+        maxMessageSize: maxMessageSize,
+    }
+    t.streamServer = newStreamServer(listen, t.handleConn)
+    return t
+}
@@ -0,0 +1,44 @@
+package reciever
+
+import (
+    "io"
+    "bufio"
+    "strings"
+    "testing"
+)
+
+func TestReadLines(t *testing.T) {
+    tests := []struct {
+        name string
+        stream string
+        maxSize int
+        expected []string
+    }{
+        { "batch", "a\nb\nc\n", 100, []string{ "a\nb\nc\n" } },
+        { "max size", "a\nb\nc\n", 4, []string{ "a\nb\n", "c\n" } },
+        { "long line is split", "0123456789abcdefXYZ\nd\n", 100, []string{ "0123456789abcdef\n", "XYZ\nd\n" } },
+        { "partial last line", "a\nb", 100, []string{ "a\n", "b\n" } },
+        { "only partial line", "abc", 100, []string{ "abc\n" } },
+        { "empty", "", 100, nil },
+    }
+    for _, test := range tests {
+        // buffer is smallest size of bufio
+        reader := bufio.NewReaderSize(strings.NewReader(test.stream), 16)
+        batches := make([]string, 0)
+        for {
+            data, err := readLines(reader, test.maxSize)
+            if len(data) > 0 {
+                batches = append(batches, string(data))
+            }
+            if err == io.EOF {
+                break
+            }
+            if err != nil {
+                t.Fatalf("%v: unexpected error (%v)", test.name, err)
+            }
+        }
+        if strings.Join(batches, "|") != strings.Join(test.expected, "|") {
+            t.Errorf("%v: unexpected batches (%q, %q)", test.name, batches, test.expected)
+        }
+    }
+}
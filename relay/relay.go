@@ -0,0 +1,435 @@
+package relay
+
+import (
+    "os"
+    "fmt"
+    "log"
+    "sort"
+    "sync"
+    "time"
+    "strconv"
+    "strings"
+    "context"
+    "io/ioutil"
+    "path/filepath"
+    "encoding/gob"
+    "github.com/pkg/errors"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/metadata"
+    "github.com/potix/log_monitor/configurator"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+const (
+    // HopsKey is metadata key of relays that forwarded request
+    HopsKey string = "log-monitor-hops"
+    // OriginAddrKey is metadata key of address of original sender
+    OriginAddrKey string = "log-monitor-origin-addr"
+)
+
+const (
+    defaultMaxSpoolSize int64 = 1073741824
+    defaultMaxHops int64 = 8
+    defaultRelayTimeout int64 = 30
+    minRetryInterval time.Duration = time.Second
+    maxRetryInterval time.Duration = time.Minute
+    spoolFullRetryAfter int64 = 10
+    spoolSuffix string = ".spool"
+    rejectedPrefix string = "rejected:"
+)
+
+// spoolItem is request waiting for forwarding
+type spoolItem struct {
+    Addr string
+    Hops []string
+    Label string
+    Host string
+    Path string
+    LogData []byte
+}
+
+type spoolFile struct {
+    seq int64
+    size int64
+}
+
+// Relay is forward transferred logs to upstream reciever
+// requests are spooled to disk before forwarding, so they are kept while upstream is unreachable
+type Relay struct {
+    config *configurator.RelayConfig
+    relayID string
+    maxSpoolSize int64
+    maxHops int64
+    timeout time.Duration
+    conn *grpc.ClientConn
+    client logpb.LogClient
+    spoolFiles []*spoolFile
+    spoolSize int64
+    seq int64
+    mutex *sync.Mutex
+    wakeup chan bool
+    finish chan bool
+    finished chan bool
+}
+
+// LoopError is error of request that has been forwarded by this relay or too many relays
+type LoopError struct {
+    Hops []string
+    Reason string
+}
+
+// Error is error message
+func (e *LoopError) Error() (string) {
+    return fmt.Sprintf("relay loop (%v): %v", strings.Join(e.Hops, ","), e.Reason)
+}
+
+// IsLoopError is report whether error is caused by relay loop
+func IsLoopError(err error) (bool) {
+    _, ok := errors.Cause(err).(*LoopError)
+    return ok
+}
+
+// IncomingHops is get relays that forwarded request
+func IncomingHops(ctx context.Context) ([]string) {
+    md, ok := metadata.FromIncomingContext(ctx)
+    if !ok {
+        return nil
+    }
+    return md.Get(HopsKey)
+}
+
+// IncomingOriginAddr is get address of original sender, it is empty if request is not forwarded
+func IncomingOriginAddr(ctx context.Context) (string) {
+    md, ok := metadata.FromIncomingContext(ctx)
+    if !ok {
+        return ""
+    }
+    values := md.Get(OriginAddrKey)
+    if len(values) == 0 {
+        return ""
+    }
+    return values[0]
+}
+
+func (r *Relay) spoolPath(seq int64) (string) {
+    return filepath.Join(r.config.SpoolDir, fmt.Sprintf("%020d%v", seq, spoolSuffix))
+}
+
+// CheckLoop is check that request has not been forwarded by this relay
+func (r *Relay) CheckLoop(hops []string) (error) {
+    for _, hop := range hops {
+        if hop == r.relayID {
+            return &LoopError{ Hops: hops, Reason: "already forwarded by " + r.relayID }
+        }
+    }
+    if int64(len(hops)) >= r.maxHops {
+        return &LoopError{ Hops: hops, Reason: "too many hops" }
+    }
+    return nil
+}
+
+// CheckSpool is check that spool has room for request, it returns seconds to retry after if spool is full
+// it is checked before request is stored, so that request is not stored twice when sender retries
+// request larger than max spool size never has room
+func (r *Relay) CheckSpool(request *logpb.TransferRequest) (int64, error) {
+    size := int64(len(request.LogData))
+    if size > r.maxSpoolSize {
+        return 0, errors.Errorf("larger than max spool size (%v)", r.maxSpoolSize)
+    }
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    if r.spoolSize + size > r.maxSpoolSize {
+        return spoolFullRetryAfter, nil
+    }
+    return 0, nil
+}
+
+// Forward is spool request, it is forwarded to upstream in background
+func (r *Relay) Forward(addr string, hops []string, request *logpb.TransferRequest) (error) {
+    err := r.CheckLoop(hops)
+    if err != nil {
+        return err
+    }
+    item := &spoolItem{
+        Addr: addr,
+        Hops: append(append([]string(nil), hops...), r.relayID),
+        Label: request.Label,
+        Host: request.Host,
+        Path: request.Path,
+        LogData: request.LogData,
+    }
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    if r.spoolSize + int64(len(request.LogData)) > r.maxSpoolSize {
+        return errors.Errorf("spool is full (%v)", r.spoolSize)
+    }
+    seq := r.seq + 1
+    size, err := r.writeItem(seq, item)
+    if err != nil {
+        return err
+    }
+    r.seq = seq
+    r.spoolFiles = append(r.spoolFiles, &spoolFile{ seq: seq, size: size })
+    r.spoolSize += size
+    select {
+    case r.wakeup <- true:
+    default:
+    }
+    return nil
+}
+
+func (r *Relay) writeItem(seq int64, item *spoolItem) (int64, error) {
+    spoolPath := r.spoolPath(seq)
+    tmpPath := spoolPath + ".tmp"
+    file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+    if err != nil {
+        return 0, errors.Wrapf(err, "can not create spool file (%v)", tmpPath)
+    }
+    err = gob.NewEncoder(file).Encode(item)
+    if err == nil {
+        err = file.Sync()
+    }
+    closeErr := file.Close()
+    if err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        os.Remove(tmpPath)
+        return 0, errors.Wrapf(err, "can not write spool file (%v)", tmpPath)
+    }
+    err = os.Rename(tmpPath, spoolPath)
+    if err != nil {
+        os.Remove(tmpPath)
+        return 0, errors.Wrapf(err, "can not rename spool file (%v)", tmpPath)
+    }
+    return int64(len(item.LogData)), nil
+}
+
+func (r *Relay) readItem(seq int64) (*spoolItem, error) {
+    file, err := os.Open(r.spoolPath(seq))
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not open spool file (%v)", r.spoolPath(seq))
+    }
+    defer file.Close()
+    item := new(spoolItem)
+    err = gob.NewDecoder(file).Decode(item)
+    if err != nil {
+        return nil, errors.Wrapf(err, "can not decode spool file (%v)", r.spoolPath(seq))
+    }
+    return item, nil
+}
+
+func (r *Relay) oldest() (*spoolFile) {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    if len(r.spoolFiles) == 0 {
+        return nil
+    }
+    return r.spoolFiles[0]
+}
+
+func (r *Relay) remove(spoolFile *spoolFile) {
+    err := os.Remove(r.spoolPath(spoolFile.seq))
+    if err != nil {
+        log.Printf("can not remove spool file (%v): %v", r.spoolPath(spoolFile.seq), err)
+    }
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    r.spoolFiles = r.spoolFiles[1:]
+    r.spoolSize -= spoolFile.size
+}
+
+// send is send spooled item to upstream, it returns false if it should be retried
+// and the retry after requested by upstream
+func (r *Relay) send(item *spoolItem) (bool, time.Duration) {
+    md := metadata.Pairs(OriginAddrKey, item.Addr)
+    for _, hop := range item.Hops {
+        md.Append(HopsKey, hop)
+    }
+    ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(context.Background(), md), r.timeout)
+    defer cancel()
+    reply, err := r.client.Transfer(ctx, &logpb.TransferRequest{
+        Label: item.Label,
+        Host: item.Host,
+        Path: item.Path,
+        LogData: item.LogData,
+    })
+    if err != nil {
+        log.Printf("can not forward log, retry later (%v, %v, %v, %v): %v", item.Label, item.Host, item.Addr, item.Path, err)
+        return false, 0
+    }
+    if !reply.Success && strings.HasPrefix(reply.Msg, rejectedPrefix) {
+        // upstream never accepts it
+        log.Printf("forwarded log is rejected by upstream (%v, %v, %v, %v): %v", item.Label, item.Host, item.Addr, item.Path, reply.Msg)
+        return true, 0
+    }
+    if !reply.Success && reply.RetryAfter > 0 {
+        log.Printf("forwarding is limited by upstream, retry after %v seconds (%v, %v, %v, %v): %v", reply.RetryAfter, item.Label, item.Host, item.Addr, item.Path, reply.Msg)
+        return false, time.Duration(reply.RetryAfter) * time.Second
+    }
+    if !reply.Success {
+        log.Printf("can not forward log, retry later (%v, %v, %v, %v): %v", item.Label, item.Host, item.Addr, item.Path, reply.Msg)
+        return false, 0
+    }
+    return true, 0
+}
+
+func (r *Relay) wait(interval time.Duration) (bool) {
+    select {
+    case <-r.finish:
+        return false
+    case <-time.After(interval):
+        return true
+    }
+}
+
+func (r *Relay) forwardLoop() {
+    defer close(r.finished)
+    retryInterval := minRetryInterval
+    for {
+        spoolFile := r.oldest()
+        if spoolFile == nil {
+            select {
+            case <-r.finish:
+                return
+            case <-r.wakeup:
+            }
+            continue
+        }
+        item, err := r.readItem(spoolFile.seq)
+        if err != nil {
+            log.Printf("discard broken spool file: %v", err)
+            r.remove(spoolFile)
+            continue
+        }
+        ok, retryAfter := r.send(item)
+        if !ok && retryAfter > 0 {
+            // upstream tells when to retry
+            if !r.wait(retryAfter) {
+                return
+            }
+            continue
+        }
+        if !ok {
+            if !r.wait(retryInterval) {
+                return
+            }
+            retryInterval *= 2
+            if retryInterval > maxRetryInterval {
+                retryInterval = maxRetryInterval
+            }
+            continue
+        }
+        retryInterval = minRetryInterval
+        r.remove(spoolFile)
+    }
+}
+
+// loadSpool is load spool files left by last run
+func (r *Relay) loadSpool() (error) {
+    err := os.MkdirAll(r.config.SpoolDir, 0700)
+    if err != nil {
+        return errors.Wrapf(err, "can not create spool directory (%v)", r.config.SpoolDir)
+    }
+    fileInfos, err := ioutil.ReadDir(r.config.SpoolDir)
+    if err != nil {
+        return errors.Wrapf(err, "can not read spool directory (%v)", r.config.SpoolDir)
+    }
+    for _, fileInfo := range fileInfos {
+        name := fileInfo.Name()
+        if !strings.HasSuffix(name, spoolSuffix) {
+            continue
+        }
+        seq, err := strconv.ParseInt(strings.TrimSuffix(name, spoolSuffix), 10, 64)
+        if err != nil {
+            continue
+        }
+        // size is approximated by file size
+        r.spoolFiles = append(r.spoolFiles, &spoolFile{ seq: seq, size: fileInfo.Size() })
+        r.spoolSize += fileInfo.Size()
+        if seq > r.seq {
+            r.seq = seq
+        }
+    }
+    sort.Slice(r.spoolFiles, func(i, j int) bool {
+        return r.spoolFiles[i].seq < r.spoolFiles[j].seq
+    })
+    if len(r.spoolFiles) > 0 {
+        log.Printf("loaded spool files (%v, %v)", r.config.SpoolDir, len(r.spoolFiles))
+    }
+    return nil
+}
+
+// Start is start
+func (r *Relay) Start() (error) {
+    conn, err := grpc.Dial(r.config.Upstream, grpc.WithInsecure())
+    if err != nil {
+        return errors.Wrapf(err, "can not dial upstream (%v)", r.config.Upstream)
+    }
+    r.conn = conn
+    r.client = logpb.NewLogClient(conn)
+    go r.forwardLoop()
+    return nil
+}
+
+// Stop is stop, spooled requests are forwarded at next start
+func (r *Relay) Stop() {
+    close(r.finish)
+    <-r.finished
+    r.conn.Close()
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    if len(r.spoolFiles) > 0 {
+        log.Printf("spooled logs remain (%v, %v bytes)", len(r.spoolFiles), r.spoolSize)
+    }
+}
+
+// NewRelay is create new relay
+func NewRelay(config *configurator.LogRecieverConfig) (*Relay, error) {
+    relayConfig := config.Relay
+    if relayConfig == nil || relayConfig.Upstream == "" || relayConfig.SpoolDir == "" {
+        return nil, errors.New("no upstream or spool directory")
+    }
+    relayID := relayConfig.RelayID
+    if relayID == "" {
+        hostname, err := os.Hostname()
+        if err != nil {
+            return nil, errors.Wrap(err, "can not get hostname for relay id")
+        }
+        relayID = hostname + "/" + config.AddrPort
+    }
+    maxSpoolSize := defaultMaxSpoolSize
+    if relayConfig.MaxSpoolSize > 0 {
+        maxSpoolSize = relayConfig.MaxSpoolSize
+    }
+    maxHops := defaultMaxHops
+    if relayConfig.MaxHops > 0 {
+        maxHops = relayConfig.MaxHops
+    }
+    timeout := defaultRelayTimeout
+    if relayConfig.Timeout > 0 {
+        timeout = relayConfig.Timeout
+    }
+    relay := &Relay{
+        config: relayConfig,
+        relayID: relayID,
+        maxSpoolSize: maxSpoolSize,
+        maxHops: maxHops,
+        timeout: time.Duration(timeout) * time.Second,
+        conn: nil,
+        client: nil,
+        spoolFiles: make([]*spoolFile, 0),
+        spoolSize: 0,
+        seq: 0,
+        mutex: new(sync.Mutex),
+        wakeup: make(chan bool, 1),
+        finish: make(chan bool),
+        finished: make(chan bool),
+    }
+    err := relay.loadSpool()
+    if err != nil {
+        return nil, err
+    }
+    log.Printf("upstream = %v, relay id = %v, spool dir = %v", relayConfig.Upstream, relayID, relayConfig.SpoolDir)
+    return relay, nil
+}
@@ -0,0 +1,181 @@
+package relay
+
+import (
+    "time"
+    "strings"
+    "context"
+    "testing"
+    "path/filepath"
+    "google.golang.org/grpc"
+    "github.com/potix/log_monitor/configurator"
+    logpb "github.com/potix/log_monitor/logpb"
+)
+
+type upstreamStub struct {
+    reply *logpb.TransferReply
+}
+
+func (u *upstreamStub) Transfer(ctx context.Context, request *logpb.TransferRequest, opts ...grpc.CallOption) (*logpb.TransferReply, error) {
+    return u.reply, nil
+}
+
+func TestSendHonorsRetryAfter(t *testing.T) {
+    relay, err := NewRelay(&configurator.LogRecieverConfig{
+        AddrPort: "127.0.0.1:50000",
+        Relay: &configurator.RelayConfig{
+            Upstream: "127.0.0.1:50001",
+            SpoolDir: t.TempDir(),
+        },
+    })
+    if err != nil {
+        t.Fatalf("can not create relay: %v", err)
+    }
+    tests := []struct {
+        reply *logpb.TransferReply
+        ok bool
+        retryAfter time.Duration
+    }{
+        { &logpb.TransferReply{ Success: true }, true, 0 },
+        { &logpb.TransferReply{ Success: false, Msg: "limited: too many requests", RetryAfter: 5 }, false, 5 * time.Second },
+        { &logpb.TransferReply{ Success: false, Msg: "rejected: invalid label" }, true, 0 },
+        { &logpb.TransferReply{ Success: false, Msg: "can not save" }, false, 0 },
+    }
+    for _, test := range tests {
+        relay.client = &upstreamStub{ reply: test.reply }
+        ok, retryAfter := relay.send(&spoolItem{ Addr: "127.0.0.1", Label: "app", Host: "web1", Path: "/var/log/app.log" })
+        if ok != test.ok || retryAfter != test.retryAfter {
+            t.Errorf("unexpected result (%v, %v, %v)", test.reply.Msg, ok, retryAfter)
+        }
+    }
+}
+
+func newTestRelay(t *testing.T, spoolDir string, maxSpoolSize int64) (*Relay) {
+    relay, err := NewRelay(&configurator.LogRecieverConfig{
+        AddrPort: "127.0.0.1:50000",
+        Relay: &configurator.RelayConfig{
+            Upstream: "127.0.0.1:50001",
+            RelayID: "relay1",
+            SpoolDir: spoolDir,
+            MaxSpoolSize: maxSpoolSize,
+            MaxHops: 3,
+        },
+    })
+    if err != nil {
+        t.Fatalf("can not create relay: %v", err)
+    }
+    return relay
+}
+
+func newTransferRequest(logData string) (*logpb.TransferRequest) {
+    return &logpb.TransferRequest{
+        Label: "app",
+        Host: "web1",
+        Path: "/var/log/app.log",
+        LogData: []byte(logData),
+    }
+}
+
+func TestCheckLoop(t *testing.T) {
+    relay := newTestRelay(t, t.TempDir(), 0)
+    tests := []struct {
+        name string
+        hops []string
+        loop bool
+    }{
+        { "no hops", nil, false },
+        { "other relays", []string{ "relay2", "relay3" }, false },
+        { "forwarded by self", []string{ "relay2", "relay1" }, true },
+        { "max hops", []string{ "relay2", "relay3", "relay4" }, true },
+    }
+    for _, test := range tests {
+        err := relay.CheckLoop(test.hops)
+        if (err != nil) != test.loop || (err != nil && !IsLoopError(err)) {
+            t.Errorf("%v: unexpected error (%v)", test.name, err)
+        }
+        err = relay.Forward("127.0.0.1", test.hops, newTransferRequest("line\n"))
+        if (err != nil) != test.loop {
+            t.Errorf("%v: unexpected forward error (%v)", test.name, err)
+        }
+    }
+}
+
+func TestSpoolIsReloaded(t *testing.T) {
+    spoolDir := t.TempDir()
+    relay := newTestRelay(t, spoolDir, 0)
+    for _, logData := range []string{ "first\n", "second\n" } {
+        err := relay.Forward("10.0.0.1", []string{ "relay2" }, newTransferRequest(logData))
+        if err != nil {
+            t.Fatalf("can not forward: %v", err)
+        }
+    }
+    restarted := newTestRelay(t, spoolDir, 0)
+    if len(restarted.spoolFiles) != 2 || restarted.seq != 2 || restarted.spoolSize == 0 {
+        t.Fatalf("unexpected reloaded spool (%v, %v, %v)", len(restarted.spoolFiles), restarted.seq, restarted.spoolSize)
+    }
+    for i, logData := range []string{ "first\n", "second\n" } {
+        item, err := restarted.readItem(restarted.spoolFiles[i].seq)
+        if err != nil {
+            t.Fatalf("can not read spooled item: %v", err)
+        }
+        if item.Addr != "10.0.0.1" || strings.Join(item.Hops, ",") != "relay2,relay1" || item.Label != "app" || string(item.LogData) != logData {
+            t.Errorf("unexpected spooled item (%+v)", item)
+        }
+    }
+    // spooled item is forwarded in order and new item is spooled after it
+    err := restarted.Forward("10.0.0.1", nil, newTransferRequest("third\n"))
+    if err != nil || restarted.spoolFiles[2].seq != 3 {
+        t.Errorf("unexpected sequence after reload (%v)", err)
+    }
+    restarted.client = &upstreamStub{ reply: &logpb.TransferReply{ Success: true } }
+    restarted.conn, err = grpc.Dial("127.0.0.1:50001", grpc.WithInsecure())
+    if err != nil {
+        t.Fatalf("can not dial: %v", err)
+    }
+    go restarted.forwardLoop()
+    deadline := time.Now().Add(5 * time.Second)
+    for restarted.oldest() != nil {
+        if time.Now().After(deadline) {
+            t.Fatalf("spooled items are not forwarded")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+    restarted.Stop()
+    if files, _ := filepath.Glob(filepath.Join(spoolDir, "*" + spoolSuffix)); len(files) != 0 {
+        t.Errorf("forwarded spool files remain (%v)", files)
+    }
+}
+
+func TestSpoolIsFull(t *testing.T) {
+    relay := newTestRelay(t, t.TempDir(), 10)
+    tests := []struct {
+        name string
+        logData string
+        retryAfter int64
+        rejected bool
+    }{
+        { "room", "12345678", 0, false },
+        { "full", "123", spoolFullRetryAfter, false },
+        { "larger than spool", "12345678901", 0, true },
+    }
+    for _, test := range tests {
+        request := newTransferRequest(test.logData)
+        retryAfter, err := relay.CheckSpool(request)
+        if retryAfter != test.retryAfter || (err != nil) != test.rejected {
+            t.Errorf("%v: unexpected result (%v, %v)", test.name, retryAfter, err)
+        }
+        if retryAfter == 0 && err == nil {
+            err = relay.Forward("127.0.0.1", nil, request)
+            if err != nil {
+                t.Fatalf("%v: can not forward: %v", test.name, err)
+            }
+        }
+    }
+    if err := relay.Forward("127.0.0.1", nil, newTransferRequest("123")); err == nil {
+        t.Errorf("request over max spool size is spooled")
+    }
+    // forwarded item makes room
+    relay.remove(relay.oldest())
+    if retryAfter, err := relay.CheckSpool(newTransferRequest("123")); retryAfter != 0 || err != nil {
+        t.Errorf("spool has no room after remove (%v, %v)", retryAfter, err)
+    }
+}